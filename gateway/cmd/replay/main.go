@@ -0,0 +1,283 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// replay sends the invocations from a trace in the Azure Functions public
+// dataset to the gateway's /function/{name} routes, and writes the latency,
+// cold start and error of each request as CSV.
+//
+// Usage:
+//
+//	replay -invocations invocations_per_function_md.anon.d01.csv \
+//	  -durations function_durations_percentiles.anon.d01.csv \
+//	  -gateway http://127.0.0.1:8080 -top 10 -minutes 60 -speedup 1 > results.csv
+//
+// With -simulate, the trace is run through the gateway's scaling code on a
+// virtual clock instead, and a CSV report of cold starts, latency and idle
+// memory for each function is written.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/simulator"
+)
+
+func main() {
+	var (
+		gatewayURL      string
+		invocationsFile string
+		durationsFile   string
+		mappingFile     string
+		functionPrefix  string
+		trigger         string
+		outputFile      string
+		spread          string
+		top             int
+		start           int
+		minutes         int
+		maxInFlight     int
+		speedup         float64
+		seed            int64
+		timeout         time.Duration
+
+		simulate          bool
+		coldStart         time.Duration
+		memoryMB          float64
+		keepAlivePolicy   string
+		zeroDuration      time.Duration
+		targetConcurrency float64
+		quiet             bool
+	)
+
+	flag.StringVar(&gatewayURL, "gateway", "http://127.0.0.1:8080", "URL of the gateway")
+	flag.StringVar(&invocationsFile, "invocations", "", "invocations_per_function_md CSV file from the dataset (required)")
+	flag.StringVar(&durationsFile, "durations", "", "function_durations_percentiles CSV file from the dataset, sampled durations are sent in the "+DurationHeader+" header")
+	flag.StringVar(&mappingFile, "mapping", "", "CSV file of HashFunction,name to map trace functions to deployed functions")
+	flag.StringVar(&functionPrefix, "prefix", "fn-", "prefix for function names when there is no mapping, followed by the first 8 characters of HashFunction")
+	flag.StringVar(&trigger, "trigger", "", "only replay functions with this trigger, i.e. http")
+	flag.StringVar(&outputFile, "output", "", "file to write results to, default stdout")
+	flag.StringVar(&spread, "spread", SpreadUniform, "spread of each minute's invocations: "+SpreadUniform+" or "+SpreadRandom)
+	flag.IntVar(&top, "top", 0, "only replay the most invoked functions, 0 for all")
+	flag.IntVar(&start, "start", 0, "minute of the day to start from")
+	flag.IntVar(&minutes, "minutes", 60, "number of minutes to replay")
+	flag.IntVar(&maxInFlight, "max-inflight", 0, "maximum requests in flight, 0 for no limit")
+	flag.Float64Var(&speedup, "speedup", 1, "compress trace time by this factor")
+	flag.Int64Var(&seed, "seed", 1, "seed for arrival times and durations")
+	flag.DurationVar(&timeout, "timeout", time.Minute*2, "timeout for each request")
+
+	flag.BoolVar(&simulate, "simulate", false, "simulate the trace on a virtual clock instead of sending it to the gateway")
+	flag.DurationVar(&coldStart, "cold-start", time.Second*2, "simulated time for a replica to become available")
+	flag.Float64Var(&memoryMB, "memory", 128, "simulated memory per replica in MB")
+	flag.StringVar(&keepAlivePolicy, "keep-alive-policy", scaling.KeepAlivePolicyFixed, "simulated keep-alive policy: "+scaling.KeepAlivePolicyFixed+" or "+scaling.KeepAlivePolicyHybrid)
+	flag.DurationVar(&zeroDuration, "zero-duration", time.Minute*15, "simulated idle time before scaling to zero with the fixed keep-alive policy, 0 to keep warm")
+	flag.Float64Var(&targetConcurrency, "target-concurrency", 0, "simulated target in-flight requests per replica for the concurrency autoscaler, 0 to disable")
+	flag.BoolVar(&quiet, "quiet", false, "with -simulate, leave out the log of each scaling decision")
+	flag.Parse()
+
+	if len(invocationsFile) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if spread != SpreadUniform && spread != SpreadRandom {
+		log.Fatalf("spread must be %s or %s, got: %s", SpreadUniform, SpreadRandom, spread)
+	}
+	if err := scaling.ValidateKeepAlivePolicy(keepAlivePolicy); err != nil {
+		log.Fatalf("invalid value for keep-alive-policy: %s", err)
+	}
+	if speedup <= 0 {
+		log.Fatalf("speedup must be greater than 0, got: %f", speedup)
+	}
+
+	targets, err := loadTargets(invocationsFile, durationsFile, mappingFile, functionPrefix, trigger, top)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(targets) == 0 {
+		log.Fatal("no functions to replay")
+	}
+
+	var out io.Writer = os.Stdout
+	if len(outputFile) > 0 {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if simulate {
+		config := simulator.DefaultConfig()
+		config.ColdStart = coldStart
+		config.MemoryMB = memoryMB
+		config.KeepAlivePolicy = keepAlivePolicy
+		config.IdleDuration = zeroDuration
+		config.TargetConcurrency = targetConcurrency
+
+		invocations := Invocations(targets, start, minutes, spread, rand.New(rand.NewSource(seed)))
+
+		// The scaling code logs every decision it makes, to stderr unless
+		// asked to be quiet
+		if quiet {
+			log.SetOutput(io.Discard)
+		}
+		report := simulator.Run(config, invocations, time.Duration(minutes)*time.Minute)
+		if quiet {
+			log.SetOutput(os.Stderr)
+		}
+
+		if err := report.WriteCSV(out); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Requests: %d, errors: %d, cold starts: %d, idle memory: %.0f MB-seconds",
+			report.Total.Requests, report.Total.Errors, report.Total.ColdStarts, report.Total.IdleMemoryMBSeconds)
+		return
+	}
+
+	replayer := &Replayer{
+		GatewayURL:  strings.TrimRight(gatewayURL, "/"),
+		Client:      makeClient(timeout),
+		Speedup:     speedup,
+		MaxInFlight: maxInFlight,
+		Spread:      spread,
+		Random:      rand.New(rand.NewSource(seed)),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Replaying %d functions, minutes %d-%d at %.1fx", len(targets), start, start+minutes, speedup)
+
+	summary, err := replayer.Run(ctx, targets, start, minutes, out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Requests: %d, errors: %d, cold starts: %d", summary.Requests, summary.Errors, summary.ColdStarts)
+}
+
+// loadTargets reads the trace and picks a gateway function name for each
+// function to replay
+func loadTargets(invocationsFile, durationsFile, mappingFile, functionPrefix, trigger string, top int) ([]Target, error) {
+	file, err := os.Open(invocationsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	traces, err := ReadInvocations(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", invocationsFile, err)
+	}
+
+	if len(durationsFile) > 0 {
+		file, err := os.Open(durationsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		durations, err := ReadDurations(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", durationsFile, err)
+		}
+		for i := range traces {
+			traces[i].Durations = durations[traces[i].Key()]
+		}
+	}
+
+	mapping := map[string]string{}
+	if len(mappingFile) > 0 {
+		if mapping, err = readMapping(mappingFile); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", mappingFile, err)
+		}
+	}
+
+	if len(trigger) > 0 {
+		filtered := traces[:0]
+		for _, trace := range traces {
+			if trace.Trigger == trigger {
+				filtered = append(filtered, trace)
+			}
+		}
+		traces = filtered
+	}
+
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].Total() > traces[j].Total()
+	})
+	if top > 0 && len(traces) > top {
+		traces = traces[:top]
+	}
+
+	targets := make([]Target, 0, len(traces))
+	for _, trace := range traces {
+		name, ok := mapping[trace.Function]
+		if !ok {
+			if len(mapping) > 0 {
+				continue
+			}
+			name = functionPrefix + shortHash(trace.Function)
+		}
+		targets = append(targets, Target{Name: name, Trace: trace})
+	}
+
+	return targets, nil
+}
+
+func readMapping(mappingFile string) (map[string]string, error) {
+	file, err := os.Open(mappingFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string, len(records))
+	for _, record := range records {
+		mapping[record[0]] = record[1]
+	}
+	return mapping, nil
+}
+
+func shortHash(hash string) string {
+	hash = strings.ToLower(hash)
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func makeClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        1024,
+			MaxIdleConnsPerHost: 1024,
+			IdleConnTimeout:     time.Second * 90,
+		},
+	}
+}
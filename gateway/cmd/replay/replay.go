@@ -0,0 +1,283 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/simulator"
+)
+
+const (
+	// DurationHeader passes the sampled execution time in milliseconds
+	// to the function, i.e. for a function which sleeps for that long
+	DurationHeader = "X-Replay-Duration-Ms"
+
+	// coldStartHeader is set by the gateway when a request waited for
+	// the function to scale from zero
+	coldStartHeader = "X-Cold-Start"
+
+	// SpreadUniform spaces a minute's invocations evenly
+	SpreadUniform = "uniform"
+
+	// SpreadRandom places a minute's invocations at random, which for
+	// many invocations approximates a Poisson process
+	SpreadRandom = "random"
+)
+
+// Target is a function in the trace and the name it is deployed
+// with on the gateway
+type Target struct {
+	Name  string
+	Trace FunctionTrace
+}
+
+// Arrival is a single invocation to replay
+type Arrival struct {
+	// At is the offset from the start of the replay in trace time
+	At       time.Duration
+	Function string
+
+	// Duration is the sampled execution time, zero when unknown
+	Duration time.Duration
+}
+
+// Result of a replayed invocation
+type Result struct {
+	Arrival   Arrival
+	Status    int
+	Latency   time.Duration
+	ColdStart bool
+
+	// Lag is how late the request was sent, compared to its arrival
+	// time, in wall-clock time
+	Lag   time.Duration
+	Error error
+}
+
+// Summary of a replay
+type Summary struct {
+	Requests   int
+	Errors     int
+	ColdStarts int
+}
+
+// Arrivals returns the invocations of every target in minute, sorted by
+// arrival time
+func Arrivals(targets []Target, minute int, offset time.Duration, spread string, random *rand.Rand) []Arrival {
+	arrivals := []Arrival{}
+
+	for _, target := range targets {
+		if minute >= len(target.Trace.Invocations) {
+			continue
+		}
+
+		count := target.Trace.Invocations[minute]
+		for i := 0; i < count; i++ {
+			var at time.Duration
+			if spread == SpreadRandom {
+				at = time.Duration(random.Int63n(int64(time.Minute)))
+			} else {
+				at = time.Duration(i) * time.Minute / time.Duration(count)
+			}
+
+			arrival := Arrival{
+				At:       offset + at,
+				Function: target.Name,
+			}
+			if target.Trace.Durations != nil {
+				arrival.Duration = target.Trace.Durations.Sample(random)
+			}
+			arrivals = append(arrivals, arrival)
+		}
+	}
+
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		return arrivals[i].At < arrivals[j].At
+	})
+
+	return arrivals
+}
+
+// Invocations returns the arrivals in minutes of the trace from start
+// as invocations to simulate
+func Invocations(targets []Target, start, minutes int, spread string, random *rand.Rand) []simulator.Invocation {
+	invocations := []simulator.Invocation{}
+
+	for minute := start; minute < start+minutes; minute++ {
+		offset := time.Duration(minute-start) * time.Minute
+
+		for _, arrival := range Arrivals(targets, minute, offset, spread, random) {
+			invocations = append(invocations, simulator.Invocation{
+				Function: arrival.Function,
+				At:       arrival.At,
+				Duration: arrival.Duration,
+			})
+		}
+	}
+
+	return invocations
+}
+
+// Replayer sends the arrivals in a trace to the gateway
+type Replayer struct {
+	GatewayURL string
+	Client     *http.Client
+
+	// Speedup compresses trace time, i.e. 60 replays a minute per second
+	Speedup float64
+
+	// MaxInFlight bounds the requests in flight, zero for no bound. When
+	// reached, further arrivals are delayed and recorded with a lag.
+	MaxInFlight int
+
+	Spread string
+	Random *rand.Rand
+}
+
+// Run replays minutes of the trace from start, writing a CSV row for
+// each request to out, until ctx is cancelled
+func (r *Replayer) Run(ctx context.Context, targets []Target, start, minutes int, out io.Writer) (Summary, error) {
+	summary := Summary{}
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"scheduled_seconds", "function", "status", "latency_seconds", "cold_start", "lag_seconds", "error"}); err != nil {
+		return summary, err
+	}
+
+	results := make(chan Result, 1024)
+	written := make(chan error, 1)
+	go func() {
+		var writeErr error
+		for result := range results {
+			summary.Requests++
+			if result.Error != nil || result.Status >= http.StatusInternalServerError {
+				summary.Errors++
+			}
+			if result.ColdStart {
+				summary.ColdStarts++
+			}
+			if writeErr == nil {
+				writeErr = writer.Write(result.record())
+			}
+		}
+		writer.Flush()
+		if writeErr == nil {
+			writeErr = writer.Error()
+		}
+		written <- writeErr
+	}()
+
+	var inFlight chan struct{}
+	if r.MaxInFlight > 0 {
+		inFlight = make(chan struct{}, r.MaxInFlight)
+	}
+
+	wg := sync.WaitGroup{}
+	begin := time.Now()
+
+replay:
+	for minute := start; minute < start+minutes; minute++ {
+		offset := time.Duration(minute-start) * time.Minute
+
+		for _, arrival := range Arrivals(targets, minute, offset, r.Spread, r.Random) {
+			due := begin.Add(time.Duration(float64(arrival.At) / r.Speedup))
+
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					break replay
+				case <-timer.C:
+				}
+			}
+
+			if inFlight != nil {
+				select {
+				case <-ctx.Done():
+					break replay
+				case inFlight <- struct{}{}:
+				}
+			}
+
+			wg.Add(1)
+			go func(arrival Arrival, due time.Time) {
+				defer wg.Done()
+
+				lag := time.Since(due)
+				result := r.invoke(arrival)
+				result.Lag = lag
+
+				if inFlight != nil {
+					<-inFlight
+				}
+				results <- result
+			}(arrival, due)
+		}
+	}
+
+	wg.Wait()
+	close(results)
+
+	err := <-written
+	return summary, err
+}
+
+func (r *Replayer) invoke(arrival Arrival) Result {
+	result := Result{Arrival: arrival}
+
+	req, err := http.NewRequest(http.MethodPost, r.GatewayURL+"/function/"+arrival.Function, nil)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	if arrival.Duration > 0 {
+		req.Header.Set(DurationHeader, strconv.FormatInt(arrival.Duration.Milliseconds(), 10))
+	}
+
+	start := time.Now()
+	res, err := r.Client.Do(req)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.Error = err
+		return result
+	}
+
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	result.Latency = time.Since(start)
+	result.Status = res.StatusCode
+	result.ColdStart = res.Header.Get(coldStartHeader) == "true"
+	return result
+}
+
+func (r Result) record() []string {
+	errorText := ""
+	if r.Error != nil {
+		errorText = strings.ReplaceAll(r.Error.Error(), "\n", " ")
+	}
+
+	return []string{
+		fmt.Sprintf("%.3f", r.Arrival.At.Seconds()),
+		r.Arrival.Function,
+		strconv.Itoa(r.Status),
+		fmt.Sprintf("%.6f", r.Latency.Seconds()),
+		strconv.FormatBool(r.ColdStart),
+		fmt.Sprintf("%.6f", r.Lag.Seconds()),
+		errorText,
+	}
+}
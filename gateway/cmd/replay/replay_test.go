@@ -0,0 +1,114 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Replayer_WritesResultPerRequest(t *testing.T) {
+	var requests int64
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request is a cold start
+		if atomic.AddInt64(&requests, 1) == 1 {
+			w.Header().Set(coldStartHeader, "true")
+		}
+		if r.URL.Path != "/function/fn-f1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	targets := []Target{{
+		Name:  "fn-f1",
+		Trace: FunctionTrace{Function: "f1", Invocations: []int{6, 4}},
+	}}
+
+	replayer := &Replayer{
+		GatewayURL:  gateway.URL,
+		Client:      makeClient(0),
+		Speedup:     600,
+		MaxInFlight: 2,
+		Spread:      SpreadUniform,
+		Random:      rand.New(rand.NewSource(1)),
+	}
+
+	out := &bytes.Buffer{}
+	summary, err := replayer.Run(context.Background(), targets, 0, 2, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Requests != 10 || summary.Errors != 0 || summary.ColdStarts != 1 {
+		t.Errorf("want 10 requests, 0 errors and 1 cold start, got: %+v", summary)
+	}
+
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 11 {
+		t.Fatalf("want a header and 10 rows, got: %d", len(records))
+	}
+	if records[0][0] != "scheduled_seconds" || records[1][2] != "200" {
+		t.Errorf("unexpected output: %v", records[:2])
+	}
+}
+
+func Test_Replayer_StopsWhenCancelled(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer gateway.Close()
+
+	targets := []Target{{
+		Name:  "fn-f1",
+		Trace: FunctionTrace{Function: "f1", Invocations: []int{1, 1, 1}},
+	}}
+
+	replayer := &Replayer{
+		GatewayURL: gateway.URL,
+		Client:     makeClient(0),
+		Speedup:    1,
+		Spread:     SpreadUniform,
+		Random:     rand.New(rand.NewSource(1)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	summary, err := replayer.Run(ctx, targets, 0, 3, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the arrival at the very start is due before the replay stops
+	if summary.Requests > 1 {
+		t.Errorf("want the replay to stop, got: %d requests", summary.Requests)
+	}
+}
+
+func Test_Invocations_CoverEachMinute(t *testing.T) {
+	targets := []Target{{
+		Name:  "fn-f1",
+		Trace: FunctionTrace{Function: "f1", Invocations: []int{2, 0, 1}},
+	}}
+
+	invocations := Invocations(targets, 1, 2, SpreadUniform, rand.New(rand.NewSource(1)))
+	if len(invocations) != 1 {
+		t.Fatalf("want 1 invocation, got: %d", len(invocations))
+	}
+	if invocations[0].Function != "fn-f1" || invocations[0].At != time.Minute {
+		t.Errorf("want fn-f1 at 1m, got: %+v", invocations[0])
+	}
+}
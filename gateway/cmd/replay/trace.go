@@ -0,0 +1,226 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FunctionTrace holds the invocations of one function from the Azure
+// Functions public dataset, invocations_per_function_md.anon.dNN.csv
+type FunctionTrace struct {
+	Owner    string
+	App      string
+	Function string
+	Trigger  string
+
+	// Invocations is the count of invocations in each minute of the day
+	Invocations []int
+
+	// Durations is nil unless read from the matching
+	// function_durations_percentiles.anon.dNN.csv
+	Durations *DurationPercentiles
+}
+
+// Key identifies a function across the invocation and duration files
+func (f FunctionTrace) Key() string {
+	return f.Owner + "/" + f.App + "/" + f.Function
+}
+
+// Total is the count of invocations across the day
+func (f FunctionTrace) Total() int {
+	total := 0
+	for _, count := range f.Invocations {
+		total += count
+	}
+	return total
+}
+
+// DurationPercentiles of a function's execution time in milliseconds
+type DurationPercentiles struct {
+	Average float64
+
+	// Points are sorted by percentile
+	Points []PercentilePoint
+}
+
+// PercentilePoint is the duration in milliseconds at a percentile
+type PercentilePoint struct {
+	Percentile float64
+	Millis     float64
+}
+
+// Sample draws a duration by interpolating between the percentiles
+func (d DurationPercentiles) Sample(random *rand.Rand) time.Duration {
+	if len(d.Points) == 0 {
+		return time.Duration(d.Average * float64(time.Millisecond))
+	}
+
+	p := random.Float64() * 100
+	millis := d.Points[len(d.Points)-1].Millis
+
+	for i := 1; i < len(d.Points); i++ {
+		lower, upper := d.Points[i-1], d.Points[i]
+		if p <= upper.Percentile {
+			width := upper.Percentile - lower.Percentile
+			millis = lower.Millis
+			if width > 0 {
+				millis += (p - lower.Percentile) / width * (upper.Millis - lower.Millis)
+			}
+			break
+		}
+	}
+
+	return time.Duration(millis * float64(time.Millisecond))
+}
+
+// ReadInvocations parses the per-minute invocation counts, the header
+// is HashOwner,HashApp,HashFunction,Trigger,1,2,...,1440
+func ReadInvocations(r io.Reader) ([]FunctionTrace, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = false
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %s", err)
+	}
+
+	columns := indexColumns(header)
+	for _, name := range []string{"HashOwner", "HashApp", "HashFunction"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	// Minute columns are numbered from 1
+	minuteColumns := []int{}
+	for i, name := range header {
+		if minute, err := strconv.Atoi(strings.TrimSpace(name)); err == nil && minute > 0 {
+			for len(minuteColumns) < minute {
+				minuteColumns = append(minuteColumns, -1)
+			}
+			minuteColumns[minute-1] = i
+		}
+	}
+	if len(minuteColumns) == 0 {
+		return nil, fmt.Errorf("no minute columns found in header")
+	}
+
+	traces := []FunctionTrace{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		trace := FunctionTrace{
+			Owner:       record[columns["HashOwner"]],
+			App:         record[columns["HashApp"]],
+			Function:    record[columns["HashFunction"]],
+			Invocations: make([]int, len(minuteColumns)),
+		}
+		if i, ok := columns["Trigger"]; ok {
+			trace.Trigger = record[i]
+		}
+
+		for minute, column := range minuteColumns {
+			if column < 0 || column >= len(record) || len(record[column]) == 0 {
+				continue
+			}
+			count, err := strconv.Atoi(record[column])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("line %d: invalid count for minute %d: %q", line, minute+1, record[column])
+			}
+			trace.Invocations[minute] = count
+		}
+
+		traces = append(traces, trace)
+	}
+
+	return traces, nil
+}
+
+// ReadDurations parses the duration percentiles, keyed by FunctionTrace.Key,
+// the header is HashOwner,HashApp,HashFunction,Average,Count,Minimum,Maximum,
+// percentile_Average_0,percentile_Average_1,...,percentile_Average_100
+func ReadDurations(r io.Reader) (map[string]*DurationPercentiles, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %s", err)
+	}
+
+	columns := indexColumns(header)
+	for _, name := range []string{"HashOwner", "HashApp", "HashFunction", "Average"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	const percentilePrefix = "percentile_Average_"
+	percentileColumns := map[float64]int{}
+	for i, name := range header {
+		if strings.HasPrefix(name, percentilePrefix) {
+			if p, err := strconv.ParseFloat(strings.TrimPrefix(name, percentilePrefix), 64); err == nil {
+				percentileColumns[p] = i
+			}
+		}
+	}
+
+	durations := map[string]*DurationPercentiles{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		average, err := strconv.ParseFloat(record[columns["Average"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid Average: %q", line, record[columns["Average"]])
+		}
+
+		d := &DurationPercentiles{Average: average}
+		for p, column := range percentileColumns {
+			millis, err := strconv.ParseFloat(record[column], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s%v: %q", line, percentilePrefix, p, record[column])
+			}
+			d.Points = append(d.Points, PercentilePoint{Percentile: p, Millis: millis})
+		}
+		sort.Slice(d.Points, func(i, j int) bool {
+			return d.Points[i].Percentile < d.Points[j].Percentile
+		})
+
+		key := FunctionTrace{
+			Owner:    record[columns["HashOwner"]],
+			App:      record[columns["HashApp"]],
+			Function: record[columns["HashFunction"]],
+		}.Key()
+		durations[key] = d
+	}
+
+	return durations, nil
+}
+
+func indexColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	return columns
+}
@@ -0,0 +1,102 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInvocations = `HashOwner,HashApp,HashFunction,Trigger,1,2,3
+o1,a1,f1,http,2,0,1
+o1,a1,f2,timer,0,3,0
+`
+
+const testDurations = `HashOwner,HashApp,HashFunction,Average,Count,Minimum,Maximum,percentile_Average_0,percentile_Average_1,percentile_Average_25,percentile_Average_50,percentile_Average_75,percentile_Average_99,percentile_Average_100
+o1,a1,f1,100,3,10,1000,10,10,50,100,150,900,1000
+`
+
+func Test_ReadInvocations(t *testing.T) {
+	traces, err := ReadInvocations(strings.NewReader(testInvocations))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(traces) != 2 {
+		t.Fatalf("want 2 functions, got: %d", len(traces))
+	}
+
+	if traces[0].Key() != "o1/a1/f1" || traces[0].Trigger != "http" {
+		t.Errorf("unexpected function: %+v", traces[0])
+	}
+	if got := traces[1].Invocations; len(got) != 3 || got[1] != 3 {
+		t.Errorf("want invocations [0 3 0], got: %v", got)
+	}
+	if got := traces[0].Total(); got != 3 {
+		t.Errorf("want total: %d, got: %d", 3, got)
+	}
+}
+
+func Test_ReadInvocations_MissingColumn(t *testing.T) {
+	if _, err := ReadInvocations(strings.NewReader("HashOwner,HashApp,1\no1,a1,1\n")); err == nil {
+		t.Fatalf("want an error for a missing HashFunction column")
+	}
+}
+
+func Test_ReadDurations_SamplesWithinRange(t *testing.T) {
+	durations, err := ReadDurations(strings.NewReader(testDurations))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := durations["o1/a1/f1"]
+	if !ok {
+		t.Fatalf("want durations for o1/a1/f1")
+	}
+	if len(d.Points) != 7 || d.Points[0].Percentile != 0 || d.Points[6].Percentile != 100 {
+		t.Fatalf("want 7 sorted percentiles, got: %v", d.Points)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	below := 0
+	for i := 0; i < 1000; i++ {
+		sample := d.Sample(random)
+		if sample < time.Millisecond*10 || sample > time.Millisecond*1000 {
+			t.Fatalf("sample out of range: %s", sample)
+		}
+		if sample <= time.Millisecond*100 {
+			below++
+		}
+	}
+
+	// Half of the samples should fall below the median
+	if below < 400 || below > 600 {
+		t.Errorf("want around 500 samples at or below the median, got: %d", below)
+	}
+}
+
+func Test_Arrivals_UniformSpread(t *testing.T) {
+	traces, _ := ReadInvocations(strings.NewReader(testInvocations))
+	targets := []Target{{Name: "fn-f1", Trace: traces[0]}, {Name: "fn-f2", Trace: traces[1]}}
+
+	arrivals := Arrivals(targets, 0, time.Minute, SpreadUniform, rand.New(rand.NewSource(1)))
+	if len(arrivals) != 2 {
+		t.Fatalf("want 2 arrivals, got: %d", len(arrivals))
+	}
+	if arrivals[0].At != time.Minute || arrivals[1].At != time.Minute+time.Second*30 {
+		t.Errorf("want arrivals at 60s and 90s, got: %s and %s", arrivals[0].At, arrivals[1].At)
+	}
+
+	arrivals = Arrivals(targets, 1, 0, SpreadRandom, rand.New(rand.NewSource(1)))
+	if len(arrivals) != 3 {
+		t.Fatalf("want 3 arrivals, got: %d", len(arrivals))
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if arrivals[i].At < arrivals[i-1].At {
+			t.Fatalf("want arrivals sorted, got: %v", arrivals)
+		}
+	}
+}
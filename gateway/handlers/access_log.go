@@ -0,0 +1,262 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// ForwardedRequest describes a request forwarded by
+// MakeForwardingProxyHandler, once its response has been written
+type ForwardedRequest struct {
+	// Start is when the request was received
+	Start time.Time
+
+	CallID     string
+	Method     string
+	URL        string
+	StatusCode int
+	Duration   time.Duration
+
+	// RequestBytes and ResponseBytes are the sizes of the bodies read
+	// from the client and written back to it
+	RequestBytes  int64
+	ResponseBytes int64
+
+	// ClientIP is the first address of X-Forwarded-For, or the address
+	// of the connection when it was not set
+	ClientIP string
+
+	// ColdStart is true when the request waited for the function to
+	// scale from zero
+	ColdStart bool
+}
+
+// RequestNotifier is an HTTPNotifier which is also given the details of
+// each request forwarded, after its "completed" event
+type RequestNotifier interface {
+	HTTPNotifier
+	NotifyRequest(req ForwardedRequest)
+}
+
+// Fields of an access log line, in their default order
+const (
+	AccessLogFieldTime          = "time"
+	AccessLogFieldCallID        = "call_id"
+	AccessLogFieldFunction      = "function"
+	AccessLogFieldNamespace     = "namespace"
+	AccessLogFieldMethod        = "method"
+	AccessLogFieldPath          = "path"
+	AccessLogFieldStatus        = "status"
+	AccessLogFieldDuration      = "duration_seconds"
+	AccessLogFieldRequestBytes  = "request_bytes"
+	AccessLogFieldResponseBytes = "response_bytes"
+	AccessLogFieldClientIP      = "client_ip"
+	AccessLogFieldColdStart     = "cold_start"
+)
+
+// DefaultAccessLogFields are written when no fields are given
+var DefaultAccessLogFields = []string{
+	AccessLogFieldTime,
+	AccessLogFieldCallID,
+	AccessLogFieldFunction,
+	AccessLogFieldNamespace,
+	AccessLogFieldMethod,
+	AccessLogFieldPath,
+	AccessLogFieldStatus,
+	AccessLogFieldDuration,
+	AccessLogFieldRequestBytes,
+	AccessLogFieldResponseBytes,
+	AccessLogFieldClientIP,
+	AccessLogFieldColdStart,
+}
+
+// accessLogRedacted replaces the value of redacted fields
+const accessLogRedacted = "[redacted]"
+
+// AccessLogNotifier writes a line of JSON for each function invocation,
+// so that they can be parsed by log pipelines in place of the lines of
+// LoggingNotifier
+type AccessLogNotifier struct {
+	Writer io.Writer
+
+	//FunctionNamespace default namespace of the function
+	FunctionNamespace string
+
+	fields []string
+	redact map[string]bool
+	lock   sync.Mutex
+}
+
+// NewAccessLogNotifier creates an AccessLogNotifier which writes fields,
+// or DefaultAccessLogFields when empty, to writer. The values of the
+// fields in redact are replaced, so that they can be kept out of logs
+// without changing the shape of each line.
+func NewAccessLogNotifier(writer io.Writer, functionNamespace string, fields []string, redact []string) (*AccessLogNotifier, error) {
+	if len(fields) == 0 {
+		fields = DefaultAccessLogFields
+	}
+
+	for _, field := range fields {
+		if !isAccessLogField(field) {
+			return nil, fmt.Errorf("unknown access log field: %q, use one of: %s", field, strings.Join(DefaultAccessLogFields, ","))
+		}
+	}
+
+	redacted := map[string]bool{}
+	for _, field := range redact {
+		if !isAccessLogField(field) {
+			return nil, fmt.Errorf("unknown access log field to redact: %q, use one of: %s", field, strings.Join(DefaultAccessLogFields, ","))
+		}
+		redacted[field] = true
+	}
+
+	return &AccessLogNotifier{
+		Writer:            writer,
+		FunctionNamespace: functionNamespace,
+		fields:            fields,
+		redact:            redacted,
+	}, nil
+}
+
+func isAccessLogField(field string) bool {
+	for _, f := range DefaultAccessLogFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify does nothing, lines are written by NotifyRequest
+func (*AccessLogNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+}
+
+// NotifyRequest writes a line for req
+func (a *AccessLogNotifier) NotifyRequest(req ForwardedRequest) {
+	line := bytes.Buffer{}
+	line.WriteByte('{')
+
+	for i, field := range a.fields {
+		var value interface{} = accessLogRedacted
+		if !a.redact[field] {
+			value = a.value(field, req)
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			log.Printf("Error encoding access log field %s: %s", field, err)
+			return
+		}
+
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		fmt.Fprintf(&line, "%q:", field)
+		line.Write(encoded)
+	}
+	line.WriteString("}\n")
+
+	// Each line is a single Write, so that lines are not interleaved
+	// and a rotated file never holds part of one
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, err := a.Writer.Write(line.Bytes()); err != nil {
+		log.Printf("Error writing access log: %s", err)
+	}
+}
+
+func (a *AccessLogNotifier) value(field string, req ForwardedRequest) interface{} {
+	switch field {
+	case AccessLogFieldTime:
+		return req.Start.UTC().Format(time.RFC3339Nano)
+	case AccessLogFieldCallID:
+		return req.CallID
+	case AccessLogFieldFunction, AccessLogFieldNamespace:
+		functionName, namespace := middleware.GetNamespace(a.FunctionNamespace, middleware.GetServiceName(req.URL))
+		if field == AccessLogFieldFunction {
+			return functionName
+		}
+		return namespace
+	case AccessLogFieldMethod:
+		return req.Method
+	case AccessLogFieldPath:
+		// The query is left out, as it may carry values which should not be logged
+		if u, err := url.Parse(req.URL); err == nil {
+			return u.Path
+		}
+		return req.URL
+	case AccessLogFieldStatus:
+		return req.StatusCode
+	case AccessLogFieldDuration:
+		return req.Duration.Seconds()
+	case AccessLogFieldRequestBytes:
+		return req.RequestBytes
+	case AccessLogFieldResponseBytes:
+		return req.ResponseBytes
+	case AccessLogFieldClientIP:
+		return req.ClientIP
+	case AccessLogFieldColdStart:
+		return req.ColdStart
+	}
+	return nil
+}
+
+// clientIP returns the first address of X-Forwarded-For, or the address
+// of the connection
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes of the response body written
+type countingWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (c *countingWriter) Write(data []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(data)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying http.ResponseWriter for streaming responses
+func (c *countingWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_AccessLogNotifier_WritesJSONLine(t *testing.T) {
+	out := bytes.Buffer{}
+	notifier, err := NewAccessLogNotifier(&out, "openfaas-fn", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier.NotifyRequest(ForwardedRequest{
+		Start:         time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		CallID:        "a1b2",
+		Method:        http.MethodPost,
+		URL:           "/function/echo/path?token=secret",
+		StatusCode:    http.StatusOK,
+		Duration:      time.Millisecond * 1500,
+		RequestBytes:  5,
+		ResponseBytes: 12,
+		ClientIP:      "10.0.0.1",
+		ColdStart:     true,
+	})
+
+	want := `{"time":"2024-01-01T10:00:00Z","call_id":"a1b2","function":"echo","namespace":"openfaas-fn","method":"POST","path":"/function/echo/path","status":200,"duration_seconds":1.5,"request_bytes":5,"response_bytes":12,"client_ip":"10.0.0.1","cold_start":true}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func Test_AccessLogNotifier_FieldsAndRedaction(t *testing.T) {
+	out := bytes.Buffer{}
+	notifier, err := NewAccessLogNotifier(&out, "openfaas-fn", []string{"function", "status", "client_ip"}, []string{"client_ip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier.NotifyRequest(ForwardedRequest{URL: "/function/echo.dev", StatusCode: http.StatusBadGateway, ClientIP: "10.0.0.1"})
+
+	want := `{"function":"echo","status":502,"client_ip":"[redacted]"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func Test_NewAccessLogNotifier_UnknownField(t *testing.T) {
+	if _, err := NewAccessLogNotifier(&bytes.Buffer{}, "", []string{"function", "user_agent"}, nil); err == nil {
+		t.Errorf("want an error for an unknown field")
+	}
+	if _, err := NewAccessLogNotifier(&bytes.Buffer{}, "", nil, []string{"password"}); err == nil {
+		t.Errorf("want an error for an unknown field to redact")
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/function/echo", nil)
+	r.RemoteAddr = "10.0.0.2:43210"
+
+	if got := clientIP(r); got != "10.0.0.2" {
+		t.Errorf("want the address of the connection, got: %s", got)
+	}
+
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.3")
+	if got := clientIP(r); got != "203.0.113.7" {
+		t.Errorf("want the first X-Forwarded-For address, got: %s", got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_WritesAccessLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello world"))
+	}))
+	defer upstream.Close()
+
+	out := bytes.Buffer{}
+	notifier, err := NewAccessLogNotifier(&out, "openfaas-fn", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/function/echo", strings.NewReader("hello"))
+	req.Header.Set("X-Call-Id", "a1b2")
+	req.RemoteAddr = "10.0.0.2:43210"
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set(ColdStartHeader, "true")
+	handler(rr, req)
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("want a line of JSON, got: %q, %s", out.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"call_id":        "a1b2",
+		"function":       "echo",
+		"namespace":      "openfaas-fn",
+		"method":         "POST",
+		"status":         float64(200),
+		"request_bytes":  float64(5),
+		"response_bytes": float64(11),
+		"client_ip":      "10.0.0.2",
+		"cold_start":     true,
+	}
+	for field, value := range want {
+		if line[field] != value {
+			t.Errorf("%s, want: %v, got: %v", field, value, line[field])
+		}
+	}
+}
@@ -4,24 +4,28 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net/http"
+	"strings"
 
 	"github.com/openfaas/faas/gateway/pkg/middleware"
 	"github.com/openfaas/faas/gateway/requests"
 	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
 )
 
-// MakeAlertHandler handles alerts from Prometheus Alertmanager
-func MakeAlertHandler(service scaling.ServiceQuery, defaultNamespace string) http.HandlerFunc {
+// MakeAlertHandler handles alerts from Prometheus Alertmanager, the new replica count
+// comes from the ScalingPolicy selected for each function in policies, within the
+// bounds of the function capped at maxReplicas when set
+func MakeAlertHandler(service scaling.ServiceQuery, policies *scaling.ScalingPolicyRegistry, defaultNamespace string, maxReplicas uint64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if r.Body == nil {
-			http.Error(w, "A body is required for this endpoint", http.StatusBadRequest)
+			writeAlertError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "A body is required for this endpoint")
 			return
 		}
 
@@ -29,8 +33,7 @@ func MakeAlertHandler(service scaling.ServiceQuery, defaultNamespace string) htt
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Unable to read alert."))
+			writeAlertError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "Unable to read alert.")
 
 			log.Println(err)
 			return
@@ -38,21 +41,19 @@ func MakeAlertHandler(service scaling.ServiceQuery, defaultNamespace string) htt
 
 		var req requests.PrometheusAlert
 		if err := json.Unmarshal(body, &req); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Unable to parse alert, bad format."))
+			writeAlertError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "Unable to parse alert, bad format.")
 			log.Println(err)
 			return
 		}
 
-		errors := handleAlerts(req, service, defaultNamespace)
+		errors := handleAlerts(r.Context(), req, service, policies, defaultNamespace, maxReplicas)
 		if len(errors) > 0 {
 			log.Println(errors)
-			var errorOutput string
+			var errorOutput []string
 			for d, err := range errors {
-				errorOutput += fmt.Sprintf("[%d] %s\n", d, err)
+				errorOutput = append(errorOutput, fmt.Sprintf("[%d] %s", d, err))
 			}
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(errorOutput))
+			writeAlertError(w, r, http.StatusBadGateway, types.ErrorCodeScaleFailed, strings.Join(errorOutput, ", "))
 			return
 		}
 
@@ -60,10 +61,14 @@ func MakeAlertHandler(service scaling.ServiceQuery, defaultNamespace string) htt
 	}
 }
 
-func handleAlerts(req requests.PrometheusAlert, service scaling.ServiceQuery, defaultNamespace string) []error {
+func writeAlertError(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	types.WriteError(w, r, statusCode, types.ErrorResponse{Code: code, Message: message})
+}
+
+func handleAlerts(ctx context.Context, req requests.PrometheusAlert, service scaling.ServiceQuery, policies *scaling.ScalingPolicyRegistry, defaultNamespace string, maxReplicas uint64) []error {
 	var errors []error
 	for _, alert := range req.Alerts {
-		if err := scaleService(alert, service, defaultNamespace); err != nil {
+		if err := scaleService(ctx, alert, service, policies, defaultNamespace, maxReplicas); err != nil {
 			log.Println(err)
 			errors = append(errors, err)
 		}
@@ -72,24 +77,32 @@ func handleAlerts(req requests.PrometheusAlert, service scaling.ServiceQuery, de
 	return errors
 }
 
-func scaleService(alert requests.PrometheusInnerAlert, service scaling.ServiceQuery, defaultNamespace string) error {
+func scaleService(ctx context.Context, alert requests.PrometheusInnerAlert, service scaling.ServiceQuery, policies *scaling.ScalingPolicyRegistry, defaultNamespace string, maxReplicas uint64) error {
 	var err error
 
 	serviceName, namespace := middleware.GetNamespace(defaultNamespace, alert.Labels.FunctionName)
 
 	if len(serviceName) > 0 {
-		queryResponse, getErr := service.GetReplicas(serviceName, namespace)
+		queryResponse, getErr := service.GetReplicas(ctx, serviceName, namespace)
 		if getErr == nil {
 			status := alert.Status
 
-			newReplicas := CalculateReplicas(status, queryResponse.Replicas, uint64(queryResponse.MaxReplicas), queryResponse.MinReplicas, queryResponse.ScalingFactor)
+			var annotations map[string]string
+			if queryResponse.Annotations != nil {
+				annotations = *queryResponse.Annotations
+			}
+
+			queryResponse.MaxReplicas = scaling.ResolveBounds(queryResponse, maxReplicas).Max
+
+			policy := policies.Policy(annotations, scaling.ScalingPolicyStep)
+			newReplicas := policy.TargetReplicas(scaling.NewScalingObservation(queryResponse, status == "firing"))
 
 			log.Printf("[Scale] function=%s %d => %d.\n", serviceName, queryResponse.Replicas, newReplicas)
 			if newReplicas == queryResponse.Replicas {
 				return nil
 			}
 
-			updateErr := service.SetReplicas(serviceName, namespace, newReplicas)
+			updateErr := service.SetReplicas(ctx, serviceName, namespace, newReplicas)
 			if updateErr != nil {
 				err = updateErr
 			}
@@ -99,21 +112,13 @@ func scaleService(alert requests.PrometheusInnerAlert, service scaling.ServiceQu
 }
 
 // CalculateReplicas decides what replica count to set depending on current/desired amount
+// with the step ScalingPolicy
 func CalculateReplicas(status string, currentReplicas uint64, maxReplicas uint64, minReplicas uint64, scalingFactor uint64) uint64 {
-	var newReplicas uint64
-
-	maxReplicas = uint64(math.Min(float64(maxReplicas), float64(scaling.DefaultMaxReplicas)))
-	step := uint64(math.Ceil(float64(maxReplicas) / 100 * float64(scalingFactor)))
-
-	if status == "firing" && step > 0 {
-		if currentReplicas+step > maxReplicas {
-			newReplicas = maxReplicas
-		} else {
-			newReplicas = currentReplicas + step
-		}
-	} else { // Resolved event.
-		newReplicas = minReplicas
-	}
-
-	return newReplicas
+	return scaling.StepPolicy{}.TargetReplicas(scaling.ScalingObservation{
+		Replicas:      currentReplicas,
+		MinReplicas:   minReplicas,
+		MaxReplicas:   maxReplicas,
+		ScalingFactor: scalingFactor,
+		Firing:        status == "firing",
+	})
 }
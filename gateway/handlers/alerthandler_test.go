@@ -4,6 +4,10 @@
 package handlers
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/openfaas/faas/gateway/scaling"
@@ -47,8 +51,8 @@ func TestMaxScale(t *testing.T) {
 	minReplicas := uint64(1)
 	scalingFactor := uint64(100)
 	got := CalculateReplicas("firing", scaling.DefaultMinReplicas, scaling.DefaultMaxReplicas*2, minReplicas, scalingFactor)
-	if got != scaling.DefaultMaxReplicas {
-		t.Fatalf("want ceiling: %d, but got: %d", scaling.DefaultMaxReplicas, got)
+	if got != scaling.DefaultMaxReplicas*2 {
+		t.Fatalf("want ceiling of the max label: %d, but got: %d", scaling.DefaultMaxReplicas*2, got)
 	}
 }
 
@@ -128,3 +132,84 @@ func TestScaledUpWithSmallParam(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// policyServiceQuery records the replicas set for a function
+type policyServiceQuery struct {
+	replicas    uint64
+	annotations map[string]string
+	setCalls    []uint64
+}
+
+func (p *policyServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{
+		Replicas:      p.replicas,
+		MinReplicas:   1,
+		MaxReplicas:   20,
+		ScalingFactor: 20,
+		Annotations:   &p.annotations,
+	}, nil
+}
+
+func (p *policyServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	p.setCalls = append(p.setCalls, count)
+	return nil
+}
+
+func TestAlertHandler_UsesPolicyFromAnnotation(t *testing.T) {
+	cases := []struct {
+		policy string
+		want   []uint64
+	}{
+		{scaling.ScalingPolicyStep, []uint64{14}},
+		{scaling.ScalingPolicyProportional, []uint64{12}},
+		{scaling.ScalingPolicyFixed, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			query := &policyServiceQuery{
+				replicas:    10,
+				annotations: map[string]string{scaling.ScalingPolicyAnnotation: c.policy},
+			}
+			handler := MakeAlertHandler(query, scaling.NewScalingPolicyRegistry(), "openfaas-fn", 0)
+
+			body := `{"status":"firing","alerts":[{"status":"firing","labels":{"function_name":"echo"}}]}`
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/alert", strings.NewReader(body)))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("want: %d, got: %d", http.StatusOK, rr.Code)
+			}
+			if len(query.setCalls) != len(c.want) || (len(c.want) > 0 && query.setCalls[0] != c.want[0]) {
+				t.Fatalf("want replicas set: %v, got: %v", c.want, query.setCalls)
+			}
+		})
+	}
+}
+
+func TestAlertHandler_CapsMaxReplicas(t *testing.T) {
+	cases := []struct {
+		policy      string
+		maxReplicas uint64
+		want        uint64
+	}{
+		{scaling.ScalingPolicyStep, 12, 12},
+		{scaling.ScalingPolicyProportional, 11, 11},
+	}
+
+	for _, c := range cases {
+		query := &policyServiceQuery{
+			replicas:    10,
+			annotations: map[string]string{scaling.ScalingPolicyAnnotation: c.policy},
+		}
+		handler := MakeAlertHandler(query, scaling.NewScalingPolicyRegistry(), "openfaas-fn", c.maxReplicas)
+
+		body := `{"status":"firing","alerts":[{"status":"firing","labels":{"function_name":"echo"}}]}`
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/alert", strings.NewReader(body)))
+
+		if len(query.setCalls) != 1 || query.setCalls[0] != c.want {
+			t.Errorf("%s capped at %d, want replicas set: %d, got: %v", c.policy, c.maxReplicas, c.want, query.setCalls)
+		}
+	}
+}
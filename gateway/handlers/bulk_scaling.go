@@ -0,0 +1,353 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// Statuses of each item in a BulkScaleResponse
+const (
+	BulkScaleScaled    = "scaled"
+	BulkScaleUnchanged = "unchanged"
+	BulkScaleDryRun    = "dry-run"
+	BulkScaleNotFound  = "not-found"
+	BulkScaleFailed    = "failed"
+)
+
+// DefaultBulkScaleParallelism is the number of functions scaled at once
+// by MakeBulkScalingHandler when no parallelism is given
+const DefaultBulkScaleParallelism = 10
+
+// BulkScaleRequest sets the replicas of each function in Functions, and
+// of every function matched by Selector
+type BulkScaleRequest struct {
+	Functions []BulkScaleItem `json:"functions,omitempty"`
+
+	// Selector matches functions by their labels, as a comma separated
+	// list of "key=value", "key!=value" or "key", i.e. "team=ml,tier!=web"
+	Selector string `json:"selector,omitempty"`
+
+	// Namespace to match Selector in, the default namespace when empty
+	Namespace string `json:"namespace,omitempty"`
+
+	// Replicas to set for the functions matched by Selector, which may be 0
+	Replicas *uint64 `json:"replicas,omitempty"`
+
+	// DryRun returns the change for each function without making it
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// BulkScaleItem is a function and the replicas to set for it
+type BulkScaleItem struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Replicas  uint64 `json:"replicas"`
+}
+
+// BulkScaleResult is the outcome of scaling a single function
+type BulkScaleResult struct {
+	Name             string `json:"name"`
+	Namespace        string `json:"namespace"`
+	Replicas         uint64 `json:"replicas"`
+	PreviousReplicas uint64 `json:"previousReplicas"`
+	Status           string `json:"status"`
+	Error            string `json:"error,omitempty"`
+}
+
+// BulkScaleResponse holds a result for each function, in the order of
+// the request's Functions followed by those matched by its Selector
+type BulkScaleResponse struct {
+	Results []BulkScaleResult `json:"results"`
+}
+
+// MakeBulkScalingHandler sets the replicas of many functions in one request,
+// at most parallelism at a time, through service. A function is not scaled
+// outside of its bounds, capped at maxReplicas when set, or to zero when it
+// does not permit it, and is reported as failed instead.
+func MakeBulkScalingHandler(service scaling.ServiceQuery, defaultNamespace string, parallelism int, maxReplicas uint64) http.HandlerFunc {
+	if parallelism < 1 {
+		parallelism = DefaultBulkScaleParallelism
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{Code: types.ErrorCodeBadRequest, Message: "A body is required for this endpoint"})
+			return
+		}
+		defer r.Body.Close()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{Code: types.ErrorCodeBadRequest, Message: "Error reading request body"})
+			return
+		}
+
+		req := BulkScaleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{Code: types.ErrorCodeBadRequest, Message: "Error unmarshalling request body"})
+			return
+		}
+
+		items, err := bulkScaleItems(r.Context(), service, req, defaultNamespace)
+		if err != nil {
+			statusCode, code := http.StatusBadGateway, types.ErrorCodeUpstreamUnavailable
+			if errors.Is(err, errInvalidBulkScaleRequest) {
+				statusCode, code = http.StatusBadRequest, types.ErrorCodeBadRequest
+			} else if errors.Is(err, errSelectorNotSupported) {
+				statusCode, code = http.StatusNotImplemented, types.ErrorCodeInternal
+			}
+			types.WriteError(w, r, statusCode, types.ErrorResponse{Code: code, Message: err.Error()})
+			return
+		}
+
+		results := make([]BulkScaleResult, len(items))
+		sem := make(chan struct{}, parallelism)
+		wg := sync.WaitGroup{}
+
+		for i, item := range items {
+			sem <- struct{}{}
+
+			// Functions not yet started are left alone once the client has gone
+			if err := r.Context().Err(); err != nil {
+				<-sem
+				results[i] = BulkScaleResult{Name: item.Name, Namespace: item.Namespace, Replicas: item.Replicas, Status: BulkScaleFailed, Error: err.Error()}
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(i int, item BulkScaleItem) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				results[i] = bulkScale(r.Context(), service, item, req.DryRun, maxReplicas)
+			}(i, item)
+		}
+		wg.Wait()
+
+		scaled := 0
+		for _, result := range results {
+			if result.Status == BulkScaleScaled {
+				scaled++
+			}
+		}
+		log.Printf("[Scale] bulk request for %d function(s), %d scaled, dry-run: %t\n", len(results), scaled, req.DryRun)
+
+		bytesOut, _ := json.Marshal(BulkScaleResponse{Results: results})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytesOut)
+	}
+}
+
+var (
+	errInvalidBulkScaleRequest = errors.New("invalid bulk scale request")
+	errSelectorNotSupported    = errors.New("the provider cannot list functions for a selector")
+)
+
+// bulkScaleItems lists the functions named by req, and those matched by
+// its selector
+func bulkScaleItems(ctx context.Context, service scaling.ServiceQuery, req BulkScaleRequest, defaultNamespace string) ([]BulkScaleItem, error) {
+	if len(req.Functions) == 0 && len(req.Selector) == 0 {
+		return nil, fmt.Errorf("%w: functions or a selector is required", errInvalidBulkScaleRequest)
+	}
+
+	items := []BulkScaleItem{}
+	seen := map[string]bool{}
+
+	for _, item := range req.Functions {
+		if len(item.Name) == 0 {
+			return nil, fmt.Errorf("%w: each function requires a name", errInvalidBulkScaleRequest)
+		}
+		if len(item.Namespace) == 0 {
+			item.Namespace = defaultNamespace
+		}
+
+		key := item.Name + "." + item.Namespace
+		if seen[key] {
+			return nil, fmt.Errorf("%w: function %s is given more than once", errInvalidBulkScaleRequest, key)
+		}
+		seen[key] = true
+		items = append(items, item)
+	}
+
+	if len(req.Selector) == 0 {
+		return items, nil
+	}
+
+	if req.Replicas == nil {
+		return nil, fmt.Errorf("%w: replicas is required with a selector", errInvalidBulkScaleRequest)
+	}
+
+	selector, err := parseLabelSelector(req.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidBulkScaleRequest, err)
+	}
+
+	lister, ok := service.(scaling.FunctionLister)
+	if !ok {
+		return nil, errSelectorNotSupported
+	}
+
+	namespace := req.Namespace
+	if len(namespace) == 0 {
+		namespace = defaultNamespace
+	}
+
+	functions, err := lister.ListFunctions(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list functions in %s: %s", namespace, err)
+	}
+
+	for _, function := range functions {
+		var labels map[string]string
+		if function.Labels != nil {
+			labels = *function.Labels
+		}
+
+		if !selector.matches(labels) {
+			continue
+		}
+
+		functionNamespace := function.Namespace
+		if len(functionNamespace) == 0 {
+			functionNamespace = namespace
+		}
+
+		// Functions named in the request keep their own replicas
+		if key := function.Name + "." + functionNamespace; !seen[key] {
+			seen[key] = true
+			items = append(items, BulkScaleItem{Name: function.Name, Namespace: functionNamespace, Replicas: *req.Replicas})
+		}
+	}
+
+	return items, nil
+}
+
+// bulkScale sets the replicas of a single function within its bounds,
+// unless dryRun is set
+func bulkScale(ctx context.Context, service scaling.ServiceQuery, item BulkScaleItem, dryRun bool, maxReplicas uint64) BulkScaleResult {
+	result := BulkScaleResult{
+		Name:      item.Name,
+		Namespace: item.Namespace,
+		Replicas:  item.Replicas,
+	}
+
+	queryResponse, err := service.GetReplicas(ctx, item.Name, item.Namespace)
+	if err != nil {
+		result.Status = BulkScaleFailed
+		if errors.Is(err, scaling.ErrFunctionNotFound) {
+			result.Status = BulkScaleNotFound
+		}
+		result.Error = err.Error()
+		return result
+	}
+	result.PreviousReplicas = queryResponse.Replicas
+
+	if err := scaling.ValidateReplicas(queryResponse, item.Replicas, maxReplicas, time.Now()); err != nil {
+		result.Status = BulkScaleFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	switch {
+	case queryResponse.Replicas == item.Replicas:
+		result.Status = BulkScaleUnchanged
+	case dryRun:
+		result.Status = BulkScaleDryRun
+	default:
+		if err := service.SetReplicas(ctx, item.Name, item.Namespace, item.Replicas); err != nil {
+			result.Status = BulkScaleFailed
+			result.Error = err.Error()
+			return result
+		}
+		result.Status = BulkScaleScaled
+	}
+
+	return result
+}
+
+// labelSelector matches labels which satisfy every requirement
+type labelSelector []labelRequirement
+
+type labelRequirement struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+// parseLabelSelector parses a comma separated list of "key=value",
+// "key==value", "key!=value" or "key"
+func parseLabelSelector(selector string) (labelSelector, error) {
+	requirements := labelSelector{}
+
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			return nil, fmt.Errorf("empty requirement in selector %q", selector)
+		}
+
+		var requirement labelRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			requirement = labelRequirement{key: kv[0], value: kv[1], negate: true}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			requirement = labelRequirement{key: kv[0], value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			requirement = labelRequirement{key: kv[0], value: kv[1]}
+		default:
+			requirement = labelRequirement{key: part, exists: true}
+		}
+
+		requirement.key = strings.TrimSpace(requirement.key)
+		requirement.value = strings.TrimSpace(requirement.value)
+		if len(requirement.key) == 0 {
+			return nil, fmt.Errorf("missing label key in selector %q", selector)
+		}
+
+		requirements = append(requirements, requirement)
+	}
+
+	return requirements, nil
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		value, ok := labels[requirement.key]
+
+		switch {
+		case requirement.exists:
+			if !ok {
+				return false
+			}
+		case requirement.negate:
+			if ok && value == requirement.value {
+				return false
+			}
+		default:
+			if !ok || value != requirement.value {
+				return false
+			}
+		}
+	}
+	return true
+}
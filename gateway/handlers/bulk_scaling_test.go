@@ -0,0 +1,330 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	providerTypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas/gateway/plugin"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// listingServiceQuery holds the replicas and labels of functions in memory
+type listingServiceQuery struct {
+	lock      sync.Mutex
+	functions map[string]providerTypes.FunctionStatus
+
+	inFlight    int64
+	maxInFlight int64
+}
+
+func newListingServiceQuery(functions ...providerTypes.FunctionStatus) *listingServiceQuery {
+	s := &listingServiceQuery{functions: map[string]providerTypes.FunctionStatus{}}
+	for _, function := range functions {
+		s.functions[function.Name+"."+function.Namespace] = function
+	}
+	return s
+}
+
+func (s *listingServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	function, ok := s.functions[service+"."+namespace]
+	if !ok {
+		return scaling.ServiceQueryResponse{}, scaling.ErrFunctionNotFound
+	}
+
+	queryResponse := scaling.ServiceQueryResponse{Replicas: function.Replicas, Annotations: function.Annotations}
+	if function.Labels != nil {
+		queryResponse.MinReplicas, _ = strconv.ParseUint((*function.Labels)[scaling.MinScaleLabel], 10, 64)
+		queryResponse.MaxReplicas, _ = strconv.ParseUint((*function.Labels)[scaling.MaxScaleLabel], 10, 64)
+	}
+	return queryResponse, nil
+}
+
+func (s *listingServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	inFlight := atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt64(&s.maxInFlight)
+		if inFlight <= max || atomic.CompareAndSwapInt64(&s.maxInFlight, max, inFlight) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	function := s.functions[service+"."+namespace]
+	function.Replicas = count
+	s.functions[service+"."+namespace] = function
+	return nil
+}
+
+func (s *listingServiceQuery) ListFunctions(ctx context.Context, namespace string) ([]providerTypes.FunctionStatus, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	functions := []providerTypes.FunctionStatus{}
+	for _, function := range s.functions {
+		if function.Namespace == namespace {
+			functions = append(functions, function)
+		}
+	}
+	return functions, nil
+}
+
+func (s *listingServiceQuery) replicas(name, namespace string) uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.functions[name+"."+namespace].Replicas
+}
+
+func postBulkScale(t *testing.T, handler http.HandlerFunc, body string) (int, BulkScaleResponse) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/system/scale-functions", strings.NewReader(body)))
+
+	res := BulkScaleResponse{}
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, res
+}
+
+func labelled(name string, replicas uint64, labels map[string]string) providerTypes.FunctionStatus {
+	return providerTypes.FunctionStatus{Name: name, Namespace: "openfaas-fn", Replicas: replicas, Labels: &labels}
+}
+
+func Test_MakeBulkScalingHandler_ScalesNamedFunctions(t *testing.T) {
+	query := newListingServiceQuery(labelled("a", 1, nil), labelled("b", 0, nil))
+	handler := MakeBulkScalingHandler(query, "openfaas-fn", 2, 0)
+
+	code, res := postBulkScale(t, handler, `{"functions": [{"name": "a", "replicas": 0}, {"name": "b", "replicas": 3}, {"name": "c", "replicas": 1}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, code)
+	}
+
+	want := []string{BulkScaleScaled, BulkScaleScaled, BulkScaleNotFound}
+	for i, result := range res.Results {
+		if result.Status != want[i] {
+			t.Errorf("%s, want status: %s, got: %s", result.Name, want[i], result.Status)
+		}
+	}
+
+	if got := query.replicas("a", "openfaas-fn"); got != 0 {
+		t.Errorf("want a scaled to zero, got: %d", got)
+	}
+	if got := query.replicas("b", "openfaas-fn"); got != 3 {
+		t.Errorf("want b scaled to 3, got: %d", got)
+	}
+	if res.Results[0].PreviousReplicas != 1 {
+		t.Errorf("want previous replicas of 1, got: %d", res.Results[0].PreviousReplicas)
+	}
+}
+
+func Test_MakeBulkScalingHandler_SelectorWithBoundedParallelism(t *testing.T) {
+	functions := []providerTypes.FunctionStatus{labelled("other", 1, map[string]string{"experiment": "b"})}
+	for _, name := range []string{"f1", "f2", "f3", "f4", "f5", "f6"} {
+		functions = append(functions, labelled(name, 2, map[string]string{"experiment": "a"}))
+	}
+
+	query := newListingServiceQuery(functions...)
+	handler := MakeBulkScalingHandler(query, "openfaas-fn", 2, 0)
+
+	code, res := postBulkScale(t, handler, `{"selector": "experiment=a", "replicas": 0}`)
+	if code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, code)
+	}
+
+	if len(res.Results) != 6 {
+		t.Fatalf("want 6 results, got: %d", len(res.Results))
+	}
+	for _, result := range res.Results {
+		if result.Status != BulkScaleScaled || query.replicas(result.Name, result.Namespace) != 0 {
+			t.Errorf("want %s scaled to zero, got: %+v", result.Name, result)
+		}
+	}
+
+	if got := query.replicas("other", "openfaas-fn"); got != 1 {
+		t.Errorf("want functions outside the selector untouched, got: %d replicas", got)
+	}
+	if got := atomic.LoadInt64(&query.maxInFlight); got > 2 {
+		t.Errorf("want at most 2 functions scaled at once, got: %d", got)
+	}
+}
+
+func Test_MakeBulkScalingHandler_DryRun(t *testing.T) {
+	query := newListingServiceQuery(labelled("a", 1, map[string]string{"team": "ml"}))
+	handler := MakeBulkScalingHandler(query, "openfaas-fn", 1, 0)
+
+	_, res := postBulkScale(t, handler, `{"selector": "team", "replicas": 4, "dryRun": true}`)
+
+	if len(res.Results) != 1 || res.Results[0].Status != BulkScaleDryRun {
+		t.Fatalf("want a dry-run result, got: %+v", res.Results)
+	}
+	if got := query.replicas("a", "openfaas-fn"); got != 1 {
+		t.Errorf("want replicas unchanged by a dry-run, got: %d", got)
+	}
+}
+
+func Test_MakeBulkScalingHandler_OutOfBounds(t *testing.T) {
+	noZero := labelled("no-zero", 1, nil)
+	noZero.Annotations = &map[string]string{scaling.ZeroDurationAnnotation: "0"}
+
+	query := newListingServiceQuery(
+		labelled("small", 1, map[string]string{scaling.MaxScaleLabel: "5"}),
+		labelled("large", 1, nil),
+		labelled("ok", 1, map[string]string{scaling.MinScaleLabel: "2"}),
+		noZero,
+	)
+	handler := MakeBulkScalingHandler(query, "openfaas-fn", 2, 3)
+
+	code, res := postBulkScale(t, handler, `{"functions": [
+		{"name": "small", "replicas": 4},
+		{"name": "large", "replicas": 6},
+		{"name": "ok", "replicas": 3},
+		{"name": "no-zero", "replicas": 0}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, code)
+	}
+
+	want := []string{BulkScaleFailed, BulkScaleFailed, BulkScaleScaled, BulkScaleFailed}
+	for i, result := range res.Results {
+		if result.Status != want[i] {
+			t.Errorf("%s, want status: %s, got: %+v", result.Name, want[i], result)
+		}
+		if result.Status == BulkScaleFailed && query.replicas(result.Name, result.Namespace) != 1 {
+			t.Errorf("%s, want replicas unchanged, got: %d", result.Name, query.replicas(result.Name, result.Namespace))
+		}
+	}
+}
+
+func Test_MakeBulkScalingHandler_InvalidRequests(t *testing.T) {
+	handler := MakeBulkScalingHandler(newListingServiceQuery(), "openfaas-fn", 1, 0)
+
+	for _, body := range []string{
+		`{}`,
+		`{"selector": "team=ml"}`,
+		`{"selector": "=ml", "replicas": 1}`,
+		`{"functions": [{"name": "a"}, {"name": "a"}]}`,
+		`not json`,
+	} {
+		if code, _ := postBulkScale(t, handler, body); code != http.StatusBadRequest {
+			t.Errorf("%s, status code want: %d, got: %d", body, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func Test_parseLabelSelector(t *testing.T) {
+	selector, err := parseLabelSelector("team=ml, tier!=web,owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"team": "ml", "owner": "x"}, true},
+		{map[string]string{"team": "ml", "tier": "api", "owner": "x"}, true},
+		{map[string]string{"team": "ml", "tier": "web", "owner": "x"}, false},
+		{map[string]string{"team": "ml"}, false},
+		{map[string]string{"team": "web", "owner": "x"}, false},
+	}
+
+	for _, c := range cases {
+		if got := selector.matches(c.labels); got != c.want {
+			t.Errorf("%v, want: %t, got: %t", c.labels, c.want, got)
+		}
+	}
+}
+
+func Test_MakeBulkScalingHandler_ProviderUnreachable(t *testing.T) {
+	// The provider answers queries, but drops the connection on each scale
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"name":"a","replicas":1}`))
+	}))
+	defer provider.Close()
+
+	providerURL, _ := url.Parse(provider.URL + "/")
+	handler := MakeBulkScalingHandler(plugin.NewExternalServiceQuery(*providerURL, nil), "openfaas-fn", 2, 0)
+
+	code, res := postBulkScale(t, handler, `{"functions":[{"name":"a","replicas":3},{"name":"b","replicas":3}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, code)
+	}
+	for _, result := range res.Results {
+		if result.Status != BulkScaleFailed || len(result.Error) == 0 {
+			t.Errorf("%s, want failed with an error, got: %+v", result.Name, result)
+		}
+	}
+}
+
+// cancellingServiceQuery cancels the request once the first function is scaled
+type cancellingServiceQuery struct {
+	*listingServiceQuery
+	cancel context.CancelFunc
+}
+
+func (s cancellingServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	err := s.listingServiceQuery.SetReplicas(ctx, service, namespace, count)
+	s.cancel()
+	return err
+}
+
+func Test_MakeBulkScalingHandler_ClientCancels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	query := cancellingServiceQuery{
+		listingServiceQuery: newListingServiceQuery(labelled("a", 0, nil), labelled("b", 0, nil), labelled("c", 0, nil)),
+		cancel:              cancel,
+	}
+	handler := MakeBulkScalingHandler(query, "openfaas-fn", 1, 0)
+
+	req := httptest.NewRequest(http.MethodPost, "/system/scale-functions",
+		strings.NewReader(`{"functions":[{"name":"a","replicas":1},{"name":"b","replicas":1},{"name":"c","replicas":1}]}`))
+	rr := httptest.NewRecorder()
+	handler(rr, req.WithContext(ctx))
+
+	res := BulkScaleResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Results[0].Status != BulkScaleScaled {
+		t.Errorf("want the first function scaled, got: %+v", res.Results[0])
+	}
+	for _, result := range res.Results[1:] {
+		if result.Status != BulkScaleFailed || result.Error != context.Canceled.Error() {
+			t.Errorf("%s, want failed as cancelled, got: %+v", result.Name, result)
+		}
+	}
+	if query.replicas("c", "openfaas-fn") != 0 {
+		t.Errorf("want c left alone after the client cancelled")
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// writeFunctionError writes an ErrorResponse for a request to a function
+func writeFunctionError(w http.ResponseWriter, r *http.Request, statusCode int, code, message, functionName, namespace string) {
+	types.WriteError(w, r, statusCode, types.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Function:  functionName,
+		Namespace: namespace,
+	})
+}
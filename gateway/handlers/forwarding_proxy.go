@@ -5,6 +5,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/types"
 )
 
@@ -39,17 +41,57 @@ func MakeForwardingProxyHandler(proxy *types.HTTPClientReverseProxy,
 
 		start := time.Now()
 
+		// Set by MakeScalingHandler, before the function's own headers are copied
+		coldStart := w.Header().Get(ColdStartHeader) == "true"
+
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.proxy", tracing.SpanKindClient)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.url", requestURL)
+		if serviceName := middleware.GetServiceName(originalURL); len(serviceName) > 0 {
+			span.SetAttribute("faas.name", serviceName)
+		}
+
+		upstreamReq := r.WithContext(ctx)
+		body := &countingReader{ReadCloser: http.NoBody}
+		if r.Body != nil {
+			body.ReadCloser = r.Body
+			upstreamReq.Body = body
+		}
+		writer := &countingWriter{ResponseWriter: w}
+
 		log.Printf("fowarding_proxy: baseUrl = [%s], requestUrl = [%s]\n", baseURL, requestURL)
-		statusCode, err := forwardRequest(w, r, proxy.Client, baseURL, requestURL, proxy.Timeout, writeRequestURI, serviceAuthInjector)
+		statusCode, err := forwardRequest(writer, upstreamReq, proxy.Client, baseURL, requestURL, proxy.Timeout, writeRequestURI, serviceAuthInjector)
 
 		seconds := time.Since(start)
 		if err != nil {
 			log.Printf("error with upstream request to: %s, %s\n", requestURL, err.Error())
 		}
 
+		span.SetAttribute("http.status_code", statusCode)
+		span.RecordError(err)
+		span.End()
+
 		for _, notifier := range notifiers {
 			notifier.Notify(r.Method, requestURL, originalURL, statusCode, "completed", seconds)
 		}
+
+		forwarded := ForwardedRequest{
+			Start:         start,
+			CallID:        r.Header.Get("X-Call-Id"),
+			Method:        r.Method,
+			URL:           originalURL,
+			StatusCode:    statusCode,
+			Duration:      seconds,
+			RequestBytes:  body.bytes,
+			ResponseBytes: writer.bytes,
+			ClientIP:      clientIP(r),
+			ColdStart:     coldStart,
+		}
+		for _, notifier := range notifiers {
+			if requestNotifier, ok := notifier.(RequestNotifier); ok {
+				requestNotifier.NotifyRequest(forwarded)
+			}
+		}
 	}
 }
 
@@ -98,6 +140,9 @@ func forwardRequest(w http.ResponseWriter,
 		serviceAuthInjector.Inject(upstreamReq)
 	}
 
+	// The function's spans become children of the gateway's
+	tracing.Inject(r.Context(), upstreamReq.Header)
+
 	if writeRequestURI {
 		log.Printf("forwardRequest: %s %s\n", upstreamReq.Host, upstreamReq.URL.String())
 	}
@@ -107,8 +152,14 @@ func forwardRequest(w http.ResponseWriter,
 
 	res, resErr := proxyClient.Do(upstreamReq.WithContext(ctx))
 	if resErr != nil {
-		badStatus := http.StatusBadGateway
-		w.WriteHeader(badStatus)
+		badStatus, code := http.StatusBadGateway, types.ErrorCodeUpstreamUnavailable
+		if errors.Is(resErr, context.DeadlineExceeded) {
+			badStatus, code = http.StatusGatewayTimeout, types.ErrorCodeUpstreamTimeout
+		}
+
+		functionName, namespace := middleware.GetNamespace("", middleware.GetServiceName(r.URL.String()))
+		writeFunctionError(w, r, badStatus, code,
+			fmt.Sprintf("error with upstream request to: %s, %s", requestURL, resErr), functionName, namespace)
 		return badStatus, resErr
 	}
 
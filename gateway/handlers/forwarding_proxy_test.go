@@ -8,10 +8,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
+	"github.com/openfaas/faas/gateway/types"
 )
 
 func Test_buildUpstreamRequest_Body_Method_Query(t *testing.T) {
@@ -364,3 +368,68 @@ func Test_deleteHeaders(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_MakeForwardingProxyHandler_UnreachableUpstream_WritesErrorResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstreamURL, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/echo.dev", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status code want: %d, got: %d", http.StatusBadGateway, rr.Code)
+	}
+
+	errorResponse := decodeErrorResponse(t, rr)
+	if errorResponse.Code != types.ErrorCodeUpstreamUnavailable || errorResponse.Function != "echo" || errorResponse.Namespace != "dev" {
+		t.Errorf("unexpected error response: %+v", errorResponse)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_PropagatesTraceParent(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	defer tracing.SetTracer(tracing.DefaultTracer())
+	tracing.SetTracer(tracing.NewTracer(exporter, 1))
+
+	var traceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(tracing.TraceParentHeader)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/function/echo.dev", nil)
+	req.Header.Set(tracing.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	span, ok := exporter.Span("gateway.proxy")
+	if !ok {
+		t.Fatalf("want a gateway.proxy span, got: %v", exporter.Spans())
+	}
+	if span.Parent.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("want the caller as parent, got: %s", span.Parent.SpanID)
+	}
+	if want := span.Context.TraceParent(); traceParent != want {
+		t.Errorf("want traceparent upstream: %s, got: %s", want, traceParent)
+	}
+	if got := span.Attribute("http.status_code"); got != int64(http.StatusOK) {
+		t.Errorf("want http.status_code of 200, got: %v", got)
+	}
+}
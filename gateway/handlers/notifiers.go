@@ -9,6 +9,7 @@ import (
 
 	"github.com/openfaas/faas/gateway/metrics"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -56,14 +57,37 @@ func (p PrometheusFunctionNotifier) Notify(method string, URL string, originalUR
 			With(labels).
 			Inc()
 
-		// p.Metrics.GatewayFunctionRequestHistogram.WithLabelValues(serviceName).Observe(seconds)
-		p.Metrics.GatewayFunctionRequestSummary.WithLabelValues(serviceName).Observe(seconds)
+		p.Metrics.GatewayFunctionRequestHistogram.Observe(serviceName, seconds)
 	} else if event == "started" {
 		p.Metrics.GatewayFunctionInvocationStarted.WithLabelValues(serviceName).Inc()
 	}
 
 }
 
+// InvocationNotifier passes the start and completion of function
+// invocations to an InvocationObserver
+type InvocationNotifier struct {
+	Observer scaling.InvocationObserver
+	//FunctionNamespace default namespace of the function
+	FunctionNamespace string
+}
+
+// Notify passes the invocation event to the InvocationObserver
+func (p InvocationNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	serviceName := middleware.GetServiceName(originalURL)
+	if len(serviceName) == 0 {
+		return
+	}
+
+	functionName, namespace := middleware.GetNamespace(p.FunctionNamespace, serviceName)
+
+	if event == "completed" {
+		p.Observer.Completed(functionName, namespace, time.Now())
+	} else if event == "started" {
+		p.Observer.Started(functionName, namespace, time.Now())
+	}
+}
+
 // LoggingNotifier notifies a log about a request
 type LoggingNotifier struct {
 }
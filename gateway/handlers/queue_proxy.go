@@ -10,18 +10,37 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	ftypes "github.com/openfaas/faas-provider/types"
 	"github.com/openfaas/faas/gateway/metrics"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
+	"github.com/openfaas/faas/gateway/types"
 
 	"github.com/openfaas/faas/gateway/scaling"
 )
 
-// MakeQueuedProxy accepts work onto a queue
+// queueRetryAfter is suggested to clients when a request cannot be queued
+const queueRetryAfter = 5 * time.Second
+
+// MakeQueuedProxy accepts work onto a queue, the traceparent of the span
+// which queued it is carried in the request's Header
 func MakeQueuedProxy(metrics metrics.MetricOptions, queuer ftypes.RequestQueuer, pathTransformer middleware.URLPathTransformer, defaultNS string, functionQuery scaling.FunctionQuery) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name := vars["name"]
+		functionName, namespace := getNameParts(name)
+		if len(namespace) == 0 {
+			namespace = defaultNS
+		}
+
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.queue", tracing.SpanKindProducer)
+		span.SetAttribute("faas.name", functionName)
+		span.SetAttribute("faas.namespace", namespace)
+		defer span.End()
+
 		var body []byte
 		if r.Body != nil {
 			defer r.Body.Close()
@@ -29,19 +48,20 @@ func MakeQueuedProxy(metrics metrics.MetricOptions, queuer ftypes.RequestQueuer,
 			var err error
 			body, err = io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				writeFunctionError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, err.Error(), functionName, namespace)
 				return
 			}
 		}
 
 		callbackURL, err := getCallbackURLHeader(r.Header)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeFunctionError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest,
+				fmt.Sprintf("invalid X-Callback-Url: %s", err), functionName, namespace)
 			return
 		}
 
-		vars := mux.Vars(r)
-		name := vars["name"]
+		header := r.Header.Clone()
+		tracing.Inject(ctx, header)
 
 		req := &ftypes.QueueRequest{
 			Function:    name,
@@ -49,15 +69,18 @@ func MakeQueuedProxy(metrics metrics.MetricOptions, queuer ftypes.RequestQueuer,
 			Method:      r.Method,
 			QueryString: r.URL.RawQuery,
 			Path:        pathTransformer.Transform(r),
-			Header:      r.Header,
+			Header:      header,
 			Host:        r.Host,
 			CallbackURL: callbackURL,
 		}
 
 		if err = queuer.Queue(req); err != nil {
 			log.Printf("Error queuing request: %v", err)
-			http.Error(w, fmt.Sprintf("Error queuing request: %s", err.Error()),
-				http.StatusInternalServerError)
+			span.RecordError(err)
+
+			types.SetRetryAfter(w, queueRetryAfter)
+			writeFunctionError(w, r, http.StatusServiceUnavailable, types.ErrorCodeQueueUnavailable,
+				fmt.Sprintf("Error queuing request: %s", err.Error()), functionName, namespace)
 			return
 		}
 
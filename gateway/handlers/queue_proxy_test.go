@@ -5,7 +5,14 @@ package handlers
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/gorilla/mux"
+	ftypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 )
 
 func Test_getNameParts(t *testing.T) {
@@ -72,3 +79,42 @@ func Test_getCallbackURLHeader_ParseFails(t *testing.T) {
 		t.Fatal("wanted a parsing error.")
 	}
 }
+
+type recordingQueuer struct {
+	requests []*ftypes.QueueRequest
+}
+
+func (q *recordingQueuer) Queue(req *ftypes.QueueRequest) error {
+	q.requests = append(q.requests, req)
+	return nil
+}
+
+func Test_MakeQueuedProxy_CarriesTraceParent(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	defer tracing.SetTracer(tracing.DefaultTracer())
+	tracing.SetTracer(tracing.NewTracer(exporter, 1))
+
+	queuer := &recordingQueuer{}
+	handler := MakeQueuedProxy(metrics.MetricOptions{}, queuer, middleware.TransparentURLPathTransformer{}, "openfaas-fn", nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/async-function/echo", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "echo"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status code want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+
+	span, ok := exporter.Span("gateway.queue")
+	if !ok {
+		t.Fatalf("want a gateway.queue span, got: %v", exporter.Spans())
+	}
+	if got := queuer.requests[0].Header.Get(tracing.TraceParentHeader); got != span.Context.TraceParent() {
+		t.Errorf("want traceparent on the queued request: %s, got: %s", span.Context.TraceParent(), got)
+	}
+	if got := req.Header.Get(tracing.TraceParentHeader); len(got) > 0 {
+		t.Errorf("want the incoming request left unchanged, got: %s", got)
+	}
+}
@@ -4,52 +4,187 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/openfaas/faas/gateway/metrics"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
 )
 
+// activatorRetryAfter is suggested to clients when the activator's
+// queue for a function is full
+const activatorRetryAfter = 5 * time.Second
+
+// ColdStartHeader is set to "true" on responses which had to wait for
+// a function to scale from zero, and "false" otherwise
+const ColdStartHeader = "X-Cold-Start"
+
 // MakeScalingHandler creates handler which can scale a function from
 // zero to N replica(s). After scaling the next http.HandlerFunc will
 // be called. If the function is not ready after the configured
 // amount of attempts / queries then next will not be invoked and a status
 // will be returned to the client.
-func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, config scaling.ScalingConfig, defaultNamespace string) http.HandlerFunc {
+//
+// While a function scales from zero, requests are parked in the
+// activator's bounded queue for the function rather than each polling
+// the provider. The duration and phases of each cold start are recorded
+// in metricsOptions, when set. Each request is traced, with the wait for
+// a replica in its own span.
+func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, config scaling.ScalingConfig, defaultNamespace string, metricsOptions *metrics.MetricOptions) http.HandlerFunc {
+	activator := scaling.NewActivator(&scaler, config)
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 
 		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
 
-		res := scaler.Scale(functionName, namespace)
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.invoke", tracing.SpanKindServer)
+		span.SetAttribute("faas.name", functionName)
+		span.SetAttribute("faas.namespace", namespace)
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		activateCtx, activateSpan := tracing.Start(ctx, "gateway.activate", tracing.SpanKindInternal)
+		res, err := activator.Activate(activateCtx, functionName, namespace)
+
+		activateSpan.SetAttribute("faas.coldstart", res.ColdStart)
+		activateSpan.RecordError(err)
+		activateSpan.RecordError(res.Error)
+		activateSpan.End()
+		span.SetAttribute("faas.coldstart", res.ColdStart)
+
+		// The request never reached the function, so it was neither a
+		// cold nor a warm start
+		if err == scaling.ErrActivatorFull {
+			log.Printf("[Scale] function=%s.%s 0=>N queue full\n", functionName, namespace)
+
+			types.SetRetryAfter(w, activatorRetryAfter)
+			writeFunctionError(w, r, http.StatusServiceUnavailable, types.ErrorCodeActivatorFull,
+				fmt.Sprintf("function is scaling from zero: %s", err), functionName, namespace)
+			return
+		}
+
+		w.Header().Set(ColdStartHeader, strconv.FormatBool(res.ColdStart))
+		if res.ColdStart {
+			observeColdStart(metricsOptions, functionName+"."+namespace, res)
+		}
+
+		if err == scaling.ErrActivatorTimeout {
+			log.Printf("[Scale] function=%s.%s 0=>N timed-out after %.4fs\n",
+				functionName, namespace, res.Duration.Seconds())
+
+			types.SetRetryAfter(w, activatorRetryAfter)
+			writeFunctionError(w, r, http.StatusGatewayTimeout, types.ErrorCodeScaleTimeout,
+				fmt.Sprintf("function is scaling from zero: %s", err), functionName, namespace)
+			return
+		}
+
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			log.Printf("[Scale] function=%s.%s 0=>N cancelled after %.4fs: %s\n",
+				functionName, namespace, res.Duration.Seconds(), err)
+
+			writeFunctionError(w, r, http.StatusGatewayTimeout, types.ErrorCodeRequestCancelled,
+				fmt.Sprintf("function is scaling from zero: %s", err), functionName, namespace)
+			return
+		}
 
 		if !res.Found {
 			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errStr))
+			writeFunctionError(w, r, http.StatusNotFound, types.ErrorCodeFunctionNotFound, errStr, functionName, namespace)
 			return
 		}
 
 		if res.Error != nil {
-			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
+			errStr := fmt.Sprintf("error scaling function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(errStr))
+			writeFunctionError(w, r, http.StatusBadGateway, types.ErrorCodeScaleFailed, errStr, functionName, namespace)
 			return
 		}
 
 		if res.Available {
-			next.ServeHTTP(w, r)
+			if !res.ColdStart || metricsOptions == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			fw := &firstByteWriter{ResponseWriter: w}
+			next.ServeHTTP(fw, r)
+
+			if !fw.firstByte.IsZero() {
+				metricsOptions.GatewayFunctionColdStartPhaseHistogram.
+					WithLabelValues(functionName+"."+namespace, metrics.ColdStartPhaseFirstByte).
+					Observe(fw.firstByte.Sub(start).Seconds())
+			}
 			return
 		}
 
 		log.Printf("[Scale] function=%s.%s 0=>N timed-out after %.4fs\n",
 			functionName, namespace, res.Duration.Seconds())
+
+		types.SetRetryAfter(w, activatorRetryAfter)
+		writeFunctionError(w, r, http.StatusGatewayTimeout, types.ErrorCodeScaleTimeout,
+			fmt.Sprintf("function did not scale from zero after %.4fs", res.Duration.Seconds()), functionName, namespace)
+	}
+}
+
+// observeColdStart records the time spent waiting on a cold start, and
+// the time taken until each phase which was reached
+func observeColdStart(metricsOptions *metrics.MetricOptions, serviceName string, res scaling.FunctionScaleResult) {
+	if metricsOptions == nil {
+		return
+	}
+
+	metricsOptions.GatewayFunctionColdStartHistogram.
+		WithLabelValues(serviceName).
+		Observe(res.Duration.Seconds())
+
+	if res.ScaleRequested > 0 {
+		metricsOptions.GatewayFunctionColdStartPhaseHistogram.
+			WithLabelValues(serviceName, metrics.ColdStartPhaseScaleRequested).
+			Observe(res.ScaleRequested.Seconds())
+	}
+
+	if res.Ready > 0 {
+		metricsOptions.GatewayFunctionColdStartPhaseHistogram.
+			WithLabelValues(serviceName, metrics.ColdStartPhaseReplicaAvailable).
+			Observe(res.Ready.Seconds())
+	}
+}
+
+// firstByteWriter records when the response headers or body were first written
+type firstByteWriter struct {
+	http.ResponseWriter
+	firstByte time.Time
+}
+
+func (f *firstByteWriter) WriteHeader(statusCode int) {
+	if f.firstByte.IsZero() {
+		f.firstByte = time.Now()
+	}
+	f.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (f *firstByteWriter) Write(data []byte) (int, error) {
+	if f.firstByte.IsZero() {
+		f.firstByte = time.Now()
+	}
+	return f.ResponseWriter.Write(data)
+}
+
+// Flush passes through to the underlying http.ResponseWriter for streaming responses
+func (f *firstByteWriter) Flush() {
+	if flusher, ok := f.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
 	}
 }
 
@@ -59,23 +194,30 @@ func MakeScaleToZeroHandler(scaler scaling.FunctionScaler, config scaling.Scalin
 
 		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceNameZero(r.URL.String()))
 
-		res := scaler.ScaleToZero(functionName, namespace)
+		res := scaler.ScaleToZero(r.Context(), functionName, namespace)
+
+		if res.Error == context.Canceled || res.Error == context.DeadlineExceeded {
+			log.Printf("[Scale] function=%s.%s N=>0 cancelled after %.4fs: %s\n",
+				functionName, namespace, res.Duration.Seconds(), res.Error)
+
+			writeFunctionError(w, r, http.StatusGatewayTimeout, types.ErrorCodeRequestCancelled,
+				fmt.Sprintf("function is scaling to zero: %s", res.Error), functionName, namespace)
+			return
+		}
 
 		if !res.Found {
 			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errStr))
+			writeFunctionError(w, r, http.StatusNotFound, types.ErrorCodeFunctionNotFound, errStr, functionName, namespace)
 			return
 		}
 
 		if res.Error != nil {
-			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
+			errStr := fmt.Sprintf("error scaling function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(errStr))
+			writeFunctionError(w, r, http.StatusBadGateway, types.ErrorCodeScaleFailed, errStr, functionName, namespace)
 			return
 		}
 
@@ -87,5 +229,8 @@ func MakeScaleToZeroHandler(scaler scaling.FunctionScaler, config scaling.Scalin
 
 		log.Printf("[Scale] function=%s.%s N=>0 timed-out after %.4fs\n",
 			functionName, namespace, res.Duration.Seconds())
+
+		writeFunctionError(w, r, http.StatusGatewayTimeout, types.ErrorCodeScaleTimeout,
+			fmt.Sprintf("function did not scale to zero after %.4fs", res.Duration.Seconds()), functionName, namespace)
 	}
 }
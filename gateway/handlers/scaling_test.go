@@ -0,0 +1,239 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// coldServiceQuery never has an available replica
+type coldServiceQuery struct {
+}
+
+func (coldServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{
+		Replicas:      1,
+		MaxReplicas:   scaling.DefaultMaxReplicas,
+		ScalingFactor: scaling.DefaultScalingFactor,
+	}, nil
+}
+
+func (coldServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	return nil
+}
+
+func Test_MakeScalingHandler_QueueFull_Returns503WithRetryAfter(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      1,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         coldServiceQuery{},
+		ActivatorCapacity:    1,
+		ActivatorTimeout:     time.Millisecond * 200,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := MakeScalingHandler(next, scaler, config, "openfaas-fn", nil)
+
+	parked := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/function/echo", nil)
+		handler.ServeHTTP(parked, req)
+		close(done)
+	}()
+
+	// Allow the first request to be parked
+	time.Sleep(time.Millisecond * 50)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/function/echo", nil)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code want: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("want a Retry-After header")
+	}
+	if _, ok := rr.Header()[ColdStartHeader]; ok {
+		t.Errorf("want no %s header on a request which did not reach the function, got: %q", ColdStartHeader, rr.Header().Get(ColdStartHeader))
+	}
+
+	errorResponse := decodeErrorResponse(t, rr)
+	if errorResponse.Code != types.ErrorCodeActivatorFull || errorResponse.Function != "echo" || errorResponse.Namespace != "openfaas-fn" {
+		t.Errorf("unexpected error response: %+v", errorResponse)
+	}
+
+	<-done
+	if parked.Code != http.StatusGatewayTimeout {
+		t.Errorf("parked request status code want: %d, got: %d", http.StatusGatewayTimeout, parked.Code)
+	}
+	if errorResponse := decodeErrorResponse(t, parked); errorResponse.Code != types.ErrorCodeScaleTimeout {
+		t.Errorf("parked request error code want: %s, got: %s", types.ErrorCodeScaleTimeout, errorResponse.Code)
+	}
+}
+
+func decodeErrorResponse(t *testing.T, rr *httptest.ResponseRecorder) types.ErrorResponse {
+	t.Helper()
+
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("want Content-Type: application/json, got: %q", got)
+	}
+
+	errorResponse := types.ErrorResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatalf("want a JSON error response, got: %q, %s", rr.Body.String(), err)
+	}
+	return errorResponse
+}
+
+// missingServiceQuery has no functions
+type missingServiceQuery struct {
+}
+
+func (missingServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{}, scaling.ErrFunctionNotFound
+}
+
+func (missingServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	return scaling.ErrFunctionNotFound
+}
+
+func Test_MakeScalingHandler_NotFound_WritesErrorResponse(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      1,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         missingServiceQuery{},
+		ActivatorCapacity:    10,
+		ActivatorTimeout:     time.Second,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want the request not to be forwarded")
+	}
+	handler := MakeScalingHandler(next, scaler, config, "openfaas-fn", nil)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/function/missing.dev", nil)
+	req.Header.Set("X-Call-Id", "call-1")
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("status code want: %d, got: %d", http.StatusNotFound, rr.Code)
+	}
+
+	errorResponse := decodeErrorResponse(t, rr)
+	want := types.ErrorResponse{
+		Code:      types.ErrorCodeFunctionNotFound,
+		Message:   errorResponse.Message,
+		Function:  "missing",
+		Namespace: "dev",
+		CallID:    "call-1",
+	}
+	if errorResponse != want || len(errorResponse.Message) == 0 {
+		t.Errorf("want: %+v, got: %+v", want, errorResponse)
+	}
+}
+
+// startingServiceQuery starts at zero replicas, and has an available
+// replica as soon as it is scaled up
+type startingServiceQuery struct {
+	lock     sync.Mutex
+	replicas uint64
+}
+
+func (s *startingServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return scaling.ServiceQueryResponse{
+		Replicas:          s.replicas,
+		AvailableReplicas: s.replicas,
+		MaxReplicas:       scaling.DefaultMaxReplicas,
+		ScalingFactor:     scaling.DefaultScalingFactor,
+	}, nil
+}
+
+func (s *startingServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.replicas = count
+	return nil
+}
+
+func histogramSampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	metric := &dto.Metric{}
+	if err := observer.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_MakeScalingHandler_RecordsColdStart(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      1,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         &startingServiceQuery{},
+		ActivatorCapacity:    10,
+		ActivatorTimeout:     time.Second,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+	metricsOptions := metrics.BuildMetricsOptions()
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := MakeScalingHandler(next, scaler, config, "openfaas-fn", &metricsOptions)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/echo", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get(ColdStartHeader); got != "true" {
+		t.Fatalf("%s want: %s, got: %q", ColdStartHeader, "true", got)
+	}
+
+	if got := histogramSampleCount(t, metricsOptions.GatewayFunctionColdStartHistogram.WithLabelValues("echo.openfaas-fn")); got != 1 {
+		t.Errorf("want 1 cold start, got: %d", got)
+	}
+
+	for _, phase := range []string{metrics.ColdStartPhaseScaleRequested, metrics.ColdStartPhaseReplicaAvailable, metrics.ColdStartPhaseFirstByte} {
+		observer := metricsOptions.GatewayFunctionColdStartPhaseHistogram.WithLabelValues("echo.openfaas-fn", phase)
+		if got := histogramSampleCount(t, observer); got != 1 {
+			t.Errorf("phase %s want 1 observation, got: %d", phase, got)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/echo", nil))
+
+	if got := rr.Header().Get(ColdStartHeader); got != "false" {
+		t.Fatalf("%s want: %s for a warm function, got: %q", ColdStartHeader, "false", got)
+	}
+}
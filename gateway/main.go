@@ -4,16 +4,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas/gateway/handlers"
 	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/logfile"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/plugin"
 	"github.com/openfaas/faas/gateway/scaling"
 	"github.com/openfaas/faas/gateway/types"
@@ -64,16 +71,47 @@ func main() {
 	var faasHandlers types.HandlerSet
 
 	servicePollInterval := time.Second * 5
+	functionCacheSweepInterval := time.Second * 30
+
+	if len(config.OTLPEndpoint) > 0 {
+		otlpExporter, otlpErr := tracing.NewOTLPExporter(config.OTLPEndpoint, "gateway", &http.Client{Timeout: time.Second * 10})
+		if otlpErr != nil {
+			log.Fatalln(otlpErr)
+		}
+		batchExporter := tracing.NewBatchExporter(otlpExporter, time.Second*5, 2048)
+		tracing.SetTracer(tracing.NewTracer(batchExporter, config.TraceSampleRatio))
+		go shutdownTracingOnSignal(batchExporter)
+	}
 
 	metricsOptions := metrics.BuildMetricsOptions()
 
+	requestBuckets := metrics.DefaultRequestBuckets
+	if len(config.RequestDurationBuckets) > 0 {
+		var bucketsErr error
+		if requestBuckets, bucketsErr = metrics.ParseBuckets(config.RequestDurationBuckets); bucketsErr != nil {
+			log.Fatalf("invalid value for request_duration_buckets: %s", bucketsErr)
+		}
+	}
+	metricsOptions.GatewayFunctionRequestHistogram = metrics.NewRequestHistogram(requestBuckets, config.NativeHistogramBucketFactor)
+
 	prometheusQuery := metrics.NewPrometheusQuery(config.PrometheusHost, config.PrometheusPort, &http.Client{})
 
+	queryTemplates := metrics.DefaultQueryTemplates()
+	if len(config.MetricsQueriesFile) > 0 {
+		var queriesErr error
+		if queryTemplates, queriesErr = metrics.LoadQueryTemplates(config.MetricsQueriesFile); queriesErr != nil {
+			log.Fatalln(queriesErr)
+		}
+	}
+
 	// 在原来的基础上加个prometheusQuery参数
-	exporter := metrics.NewExporter(metricsOptions, credentials, config.Namespace, prometheusQuery)
+	exporter := metrics.NewExporter(metricsOptions, credentials, config.Namespace, prometheusQuery, queryTemplates)
 
 	//exporter := metrics.NewExporter(metricsOptions, credentials, config.Namespace)
 	exporter.StartServiceWatcher(*config.FunctionsProviderURL, metricsOptions, "func", servicePollInterval)
+	if config.UsageSampleInterval > 0 {
+		exporter.StartUsageSampler(config.UsageSampleInterval)
+	}
 	metrics.RegisterExporter(exporter)
 
 	reverseProxy := types.NewHTTPClientReverseProxy(config.FunctionsProviderURL,
@@ -83,12 +121,31 @@ func main() {
 
 	loggingNotifier := handlers.LoggingNotifier{}
 
+	// invocationLogger logs each function invocation, as plain text or
+	// as JSON to the access log
+	var invocationLogger handlers.HTTPNotifier = loggingNotifier
+	if len(config.AccessLog) > 0 {
+		var accessLogWriter io.Writer = os.Stdout
+		if config.AccessLog != "stdout" {
+			accessLogFile, fileErr := logfile.Open(config.AccessLog, config.AccessLogMaxSize, config.AccessLogMaxAge, config.AccessLogMaxBackups)
+			if fileErr != nil {
+				log.Fatalf("Unable to open access log: %s", fileErr)
+			}
+			accessLogWriter = accessLogFile
+		}
+
+		accessLogNotifier, accessLogErr := handlers.NewAccessLogNotifier(accessLogWriter, config.Namespace, config.AccessLogFields, config.AccessLogRedact)
+		if accessLogErr != nil {
+			log.Fatalf("Invalid access log config: %s", accessLogErr)
+		}
+		invocationLogger = accessLogNotifier
+	}
+
 	prometheusNotifier := handlers.PrometheusFunctionNotifier{
 		Metrics:           &metricsOptions,
 		FunctionNamespace: config.Namespace,
 	}
 
-	functionNotifiers := []handlers.HTTPNotifier{loggingNotifier, prometheusNotifier}
 	forwardingNotifiers := []handlers.HTTPNotifier{loggingNotifier}
 	quietNotifier := []handlers.HTTPNotifier{}
 
@@ -111,17 +168,64 @@ func main() {
 	externalServiceQuery := plugin.NewExternalServiceQuery(*config.FunctionsProviderURL, serviceAuthInjector)
 
 	scalingConfig := scaling.ScalingConfig{
-		MaxPollCount:         uint(1000),
-		SetScaleRetries:      uint(20),
-		FunctionPollInterval: time.Millisecond * 100,
-		CacheExpiry:          time.Millisecond * 250, // freshness of replica values before going stale
+		MaxPollCount:         uint(config.MaxPollCount),
+		SetScaleRetries:      uint(config.SetScaleRetries),
+		FunctionPollInterval: config.FunctionPollInterval,
+		MaxPollInterval:      config.FunctionPollMaxInterval,
+		Backoff:              config.FunctionPollBackoff,
+		CacheExpiry:          config.FunctionCacheExpiry, // freshness of replica values before going stale
 		ServiceQuery:         externalServiceQuery,
+		ActivatorCapacity:    uint(config.ActivatorCapacity),
+		ActivatorTimeout:     config.ActivatorTimeout,
+	}
+
+	// notFound caches 404s from the provider, so that requests for functions
+	// which don't exist are not all passed on to it
+	if query, ok := externalServiceQuery.(plugin.ExternalServiceQuery); ok {
+		query.NotFound.MaxEntries = config.FunctionCacheMaxEntries
+		query.NotFound.Observer = metrics.NewCacheObserver(metricsOptions, "not_found")
+		query.NotFound.Expiry = config.NotFoundCacheExpiry
+		if config.NotFoundCacheExpiry > 0 {
+			query.NotFound.StartSweeper(functionCacheSweepInterval)
+		}
 	}
 
 	// This cache can be used to query a function's annotations.
-	functionAnnotationCache := scaling.NewFunctionCache(scalingConfig.CacheExpiry)
+	functionAnnotationCache := scaling.NewBoundedFunctionCache(scalingConfig.CacheExpiry, config.FunctionCacheMaxEntries,
+		metrics.NewCacheObserver(metricsOptions, "annotations"))
+	functionAnnotationCache.StartSweeper(functionCacheSweepInterval)
 	cachedFunctionQuery := scaling.NewCachedFunctionQuery(functionAnnotationCache, externalServiceQuery)
 
+	// the request histogram reads each function's buckets from its annotations,
+	// in the background so that requests are not held up by the provider
+	requestBucketsRefreshInterval := time.Second * 30
+	metricsOptions.GatewayFunctionRequestHistogram.Annotations = cachedFunctionQuery
+	metricsOptions.GatewayFunctionRequestHistogram.Start(requestBucketsRefreshInterval)
+
+	scalingFunctionCache := scaling.NewBoundedFunctionCache(scalingConfig.CacheExpiry, config.FunctionCacheMaxEntries,
+		metrics.NewCacheObserver(metricsOptions, "scaling"))
+	scalingFunctionCache.StartSweeper(functionCacheSweepInterval)
+	scaler := scaling.NewFunctionScaler(scalingConfig, scalingFunctionCache)
+
+	// invocationTracker records the last invocation of each function for the idle reaper
+	invocationTracker := scaling.NewInvocationTracker()
+	invocationNotifier := handlers.InvocationNotifier{
+		Observer:          invocationTracker,
+		FunctionNamespace: config.Namespace,
+	}
+
+	// hybridPolicy learns the idle times of each function to pre-warm and unload it
+	hybridPolicy := scaling.NewHybridHistogramPolicy(scaling.DefaultHybridPolicyConfig(), &scaler, cachedFunctionQuery, config.KeepAlivePolicy)
+	hybridPolicyNotifier := handlers.InvocationNotifier{
+		Observer:          hybridPolicy,
+		FunctionNamespace: config.Namespace,
+	}
+
+	// scalingPolicies are selected per function by the com.openfaas.scale.policy annotation
+	scalingPolicies := scaling.NewScalingPolicyRegistry()
+
+	functionNotifiers := []handlers.HTTPNotifier{invocationLogger, prometheusNotifier, invocationNotifier, hybridPolicyNotifier}
+
 	faasHandlers.Proxy = handlers.MakeCallIDMiddleware(
 		handlers.MakeForwardingProxyHandler(reverseProxy, functionNotifiers, functionURLResolver, functionURLTransformer, nil),
 	)
@@ -144,7 +248,7 @@ func main() {
 	faasHandlers.NamespaceMutatorHandler = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector)
 
 	faasHandlers.Alert = handlers.MakeNotifierWrapper(
-		handlers.MakeAlertHandler(externalServiceQuery, config.Namespace),
+		handlers.MakeAlertHandler(externalServiceQuery, scalingPolicies, config.Namespace, uint64(config.MaxReplicas)),
 		quietNotifier,
 	)
 
@@ -155,14 +259,50 @@ func main() {
 	scaleToZeroProxy := faasHandlers.ZeroFunction
 
 	//if config.ScaleFromZero {
-	scalingFunctionCache := scaling.NewFunctionCache(scalingConfig.CacheExpiry)
-	scaler := scaling.NewFunctionScaler(scalingConfig, scalingFunctionCache)
-	functionProxy = handlers.MakeScalingHandler(functionProxy, scaler, scalingConfig, config.Namespace)
+	functionProxy = handlers.MakeScalingHandler(functionProxy, scaler, scalingConfig, config.Namespace, &metricsOptions)
 	//test
 	log.Println("----------scaleToZeroProxy---------")
 	scaleToZeroProxy = handlers.MakeScaleToZeroHandler(scaler, scalingConfig, config.Namespace)
 	//}
 
+	idleReaperInterval := time.Second * 10
+	idleReaper := scaling.NewIdleReaper(invocationTracker, &scaler, cachedFunctionQuery, config.ScaleToZeroDuration, config.KeepAlivePolicy)
+	idleReaper.Start(idleReaperInterval)
+	hybridPolicy.Start(idleReaperInterval)
+
+	// scheduleReconciler keeps functions at the minimum replicas of their schedule
+	if lister, ok := externalServiceQuery.(scaling.FunctionLister); ok && config.ScheduleInterval > 0 {
+		scheduleReconciler := scaling.NewScheduleReconciler(externalServiceQuery, lister, []string{config.Namespace}, invocationTracker)
+		if namespaceLister, ok := externalServiceQuery.(scaling.NamespaceLister); ok {
+			scheduleReconciler.NamespaceLister = namespaceLister
+		}
+		scheduleReconciler.Start(config.ScheduleInterval)
+	}
+
+	// concurrencyAutoscaler scales functions on the in-flight requests seen by the invocationTracker
+	autoscalerConfig := scaling.DefaultConcurrencyAutoscalerConfig()
+	autoscalerConfig.DefaultTarget = config.AutoscalerTargetConcurrency
+	autoscalerConfig.StableWindow = config.AutoscalerStableWindow
+	autoscalerConfig.PanicWindow = config.AutoscalerPanicWindow
+	autoscalerConfig.MaxReplicas = uint64(config.MaxReplicas)
+
+	autoscalerInterval := time.Second * 2
+	concurrencyAutoscaler := scaling.NewConcurrencyAutoscaler(autoscalerConfig, invocationTracker, externalServiceQuery, cachedFunctionQuery, scalingPolicies)
+	concurrencyAutoscaler.Start(autoscalerInterval)
+
+	if len(config.ForecastModel) > 0 {
+		var invocationCounts scaling.InvocationCountSource
+		if config.ForecastSource == "gateway" {
+			invocationCounts = metrics.NewGatewayInvocationCounts(metricsOptions.GatewayFunctionInvocation)
+		} else {
+			invocationCounts = metrics.PrometheusInvocationCounts{Fetcher: prometheusQuery, RangeFetcher: prometheusQuery}
+		}
+
+		predictiveWarmer := scaling.NewPredictiveWarmer(invocationCounts, externalServiceQuery, cachedFunctionQuery,
+			config.ForecastModel, config.Namespace, config.ForecastInterval, config.ForecastLeadTime)
+		predictiveWarmer.Start()
+	}
+
 	if config.UseNATS() {
 		log.Println("Async enabled: Using NATS Streaming")
 		log.Println("Deprecation Notice: NATS Streaming is no longer maintained and won't receive updates from June 2023")
@@ -185,8 +325,20 @@ func main() {
 
 	//prometheusQuery := metrics.NewPrometheusQuery(config.PrometheusHost, config.PrometheusPort, &http.Client{})
 
-	faasHandlers.ListFunctions = metrics.AddMetricsHandler(faasHandlers.ListFunctions, prometheusQuery)
-	faasHandlers.ScaleFunction = scaling.MakeHorizontalScalingHandler(handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector))
+	faasHandlers.ListFunctions = metrics.AddMetricsHandler(faasHandlers.ListFunctions, prometheusQuery, queryTemplates, config.Namespace)
+	faasHandlers.FunctionMetrics = metrics.MakeFunctionMetricsHandler(prometheusQuery, queryTemplates, config.Namespace)
+
+	// usageAccountant integrates the usage sampled by the exporter for /system/usage
+	usageAccountant := metrics.NewUsageAccountant(exporter, exporter, metrics.NewGatewayInvocationCounts(metricsOptions.GatewayFunctionInvocation),
+		invocationTracker, config.UsageWindow, config.UsageRetention)
+	if config.UsageSampleInterval > 0 {
+		usageAccountant.Start(config.UsageSampleInterval)
+	}
+	faasHandlers.Usage = metrics.MakeUsageHandler(usageAccountant)
+
+	faasHandlers.ScaleFunction = scaling.MakeHorizontalScalingHandler(handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector),
+		cachedFunctionQuery, config.Namespace, uint64(config.MaxReplicas))
+	faasHandlers.ScaleFunctions = handlers.MakeBulkScalingHandler(externalServiceQuery, config.Namespace, config.BulkScaleParallelism, uint64(config.MaxReplicas))
 
 	if credentials != nil {
 		faasHandlers.Alert =
@@ -201,8 +353,14 @@ func main() {
 			auth.DecorateWithBasicAuth(faasHandlers.ListFunctions, credentials)
 		faasHandlers.ScaleFunction =
 			auth.DecorateWithBasicAuth(faasHandlers.ScaleFunction, credentials)
+		faasHandlers.ScaleFunctions =
+			auth.DecorateWithBasicAuth(faasHandlers.ScaleFunctions, credentials)
 		faasHandlers.FunctionStatus =
 			auth.DecorateWithBasicAuth(faasHandlers.FunctionStatus, credentials)
+		faasHandlers.FunctionMetrics =
+			auth.DecorateWithBasicAuth(faasHandlers.FunctionMetrics, credentials)
+		faasHandlers.Usage =
+			auth.DecorateWithBasicAuth(faasHandlers.Usage, credentials)
 		faasHandlers.InfoHandler =
 			auth.DecorateWithBasicAuth(faasHandlers.InfoHandler, credentials)
 		faasHandlers.SecretHandler =
@@ -230,11 +388,14 @@ func main() {
 	r.HandleFunc("/system/alert", faasHandlers.Alert).Methods(http.MethodPost)
 
 	r.HandleFunc("/system/function/{name:["+NameExpression+"]+}", faasHandlers.FunctionStatus).Methods(http.MethodGet)
+	r.HandleFunc("/system/function/{name:["+NameExpression+"]+}/metrics", faasHandlers.FunctionMetrics).Methods(http.MethodGet)
+	r.HandleFunc("/system/usage", faasHandlers.Usage).Methods(http.MethodGet)
 	r.HandleFunc("/system/functions", faasHandlers.ListFunctions).Methods(http.MethodGet)
 	r.HandleFunc("/system/functions", faasHandlers.DeployFunction).Methods(http.MethodPost)
 	r.HandleFunc("/system/functions", faasHandlers.DeleteFunction).Methods(http.MethodDelete)
 	r.HandleFunc("/system/functions", faasHandlers.UpdateFunction).Methods(http.MethodPut)
 	r.HandleFunc("/system/scale-function/{name:["+NameExpression+"]+}", faasHandlers.ScaleFunction).Methods(http.MethodPost)
+	r.HandleFunc("/system/scale-functions", faasHandlers.ScaleFunctions).Methods(http.MethodPost)
 
 	r.HandleFunc("/system/secrets", faasHandlers.SecretHandler).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
 	r.HandleFunc("/system/logs", faasHandlers.LogProxyHandler).Methods(http.MethodGet)
@@ -286,6 +447,22 @@ func main() {
 	log.Fatal(s.ListenAndServe())
 }
 
+// shutdownTracingOnSignal sends the spans queued by exporter before the
+// gateway exits on SIGINT or SIGTERM
+func shutdownTracingOnSignal(exporter *tracing.BatchExporter) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if err := exporter.Shutdown(ctx); err != nil {
+		log.Printf("Unable to send queued spans: %s", err)
+	}
+	cancel()
+
+	os.Exit(0)
+}
+
 // runMetricsServer Listen on a separate HTTP port for Prometheus metrics to keep this accessible from
 // the internal network only.
 func runMetricsServer() {
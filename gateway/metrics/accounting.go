@@ -0,0 +1,284 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bytesPerGB is the size of a GB in memory GB-seconds
+const bytesPerGB = 1024 * 1024 * 1024
+
+// UsageSource returns the replicas and usage of each function
+type UsageSource interface {
+	UsageSamples() []UsageSample
+}
+
+// CPUCounter returns the CPU seconds used by each function by
+// "name.namespace" over the last window
+type CPUCounter interface {
+	CPUIncrease(window time.Duration) (map[string]float64, error)
+}
+
+// InvocationCounter returns the invocations of each function by
+// "name.namespace" over the last window
+type InvocationCounter interface {
+	InvocationCounts(window time.Duration) (map[string]float64, error)
+}
+
+// BusyTimeCounter returns the time invocations of a function were in
+// flight up to at, summed across concurrent invocations
+type BusyTimeCounter interface {
+	BusyTime(functionName, namespace string, at time.Time) time.Duration
+}
+
+// UsageTotals is the resources used by a function, or by all of the
+// functions in a namespace, over a period of time
+type UsageTotals struct {
+	Function  string `json:"function,omitempty"`
+	Namespace string `json:"namespace"`
+
+	Invocations float64 `json:"invocations"`
+	CPUSeconds  float64 `json:"cpuSeconds"`
+
+	// MemoryGBSeconds is the working set in GB, of 2^30 bytes, multiplied
+	// by the seconds it was held for
+	MemoryGBSeconds float64 `json:"memoryGBSeconds"`
+
+	// ReplicaSeconds is the sum of the time each replica was running, of
+	// which BusyReplicaSeconds was serving invocations, and
+	// IdleReplicaSeconds was kept alive without them
+	ReplicaSeconds     float64 `json:"replicaSeconds"`
+	BusyReplicaSeconds float64 `json:"busyReplicaSeconds"`
+	IdleReplicaSeconds float64 `json:"idleReplicaSeconds"`
+
+	// IdleMemoryGBSeconds is the part of MemoryGBSeconds held by idle replicas
+	IdleMemoryGBSeconds float64 `json:"idleMemoryGBSeconds"`
+
+	// StaleSeconds is the time for which memory could not be sampled, and
+	// is left out of MemoryGBSeconds
+	StaleSeconds float64 `json:"staleSeconds"`
+}
+
+func (u *UsageTotals) add(other UsageTotals) {
+	u.Invocations += other.Invocations
+	u.CPUSeconds += other.CPUSeconds
+	u.MemoryGBSeconds += other.MemoryGBSeconds
+	u.ReplicaSeconds += other.ReplicaSeconds
+	u.BusyReplicaSeconds += other.BusyReplicaSeconds
+	u.IdleReplicaSeconds += other.IdleReplicaSeconds
+	u.IdleMemoryGBSeconds += other.IdleMemoryGBSeconds
+	u.StaleSeconds += other.StaleSeconds
+}
+
+// UsageAccountant integrates the usage of each function between samples,
+// and keeps the totals in windows of Window for Retention. A function's
+// replica-seconds are busy for as long as it had invocations in flight,
+// summed across concurrent invocations and at most its replica-seconds,
+// and idle for the rest.
+type UsageAccountant struct {
+	Source      UsageSource
+	CPU         CPUCounter
+	Invocations InvocationCounter
+	Busy        BusyTimeCounter
+
+	// Window is the length of time each set of totals covers
+	Window time.Duration
+
+	// Retention is how long totals are kept for
+	Retention time.Duration
+
+	windows  []usageWindow
+	sampled  time.Time
+	lastBusy map[string]time.Duration
+	lock     sync.RWMutex
+}
+
+// usageWindow holds the totals by "name.namespace" from start for Window
+type usageWindow struct {
+	start     time.Time
+	functions map[string]*UsageTotals
+}
+
+// NewUsageAccountant creates a UsageAccountant which keeps totals in
+// windows of window for retention
+func NewUsageAccountant(source UsageSource, cpu CPUCounter, invocations InvocationCounter, busy BusyTimeCounter, window, retention time.Duration) *UsageAccountant {
+	return &UsageAccountant{
+		Source:      source,
+		CPU:         cpu,
+		Invocations: invocations,
+		Busy:        busy,
+		Window:      window,
+		Retention:   retention,
+		lastBusy:    map[string]time.Duration{},
+	}
+}
+
+// Start records the usage of functions on every interval
+func (a *UsageAccountant) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		a.Record(time.Now())
+		for range ticker.C {
+			a.Record(time.Now())
+		}
+	}()
+}
+
+// Record adds the usage of each function since the previous call to the
+// window holding now. The first call only records where counters start.
+func (a *UsageAccountant) Record(now time.Time) {
+	samples := a.Source.UsageSamples()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	elapsed := now.Sub(a.sampled)
+	invocations, err := a.Invocations.InvocationCounts(elapsed)
+	if err != nil {
+		log.Printf("Error counting invocations for usage accounting: %s", err)
+	}
+
+	// Busy time is a running total, so is read on every call
+	lastBusy := a.lastBusy
+	a.lastBusy = map[string]time.Duration{}
+	for _, sample := range samples {
+		a.lastBusy[sample.Name+"."+sample.Namespace] = a.Busy.BusyTime(sample.Name, sample.Namespace, now)
+	}
+
+	if a.sampled.IsZero() {
+		a.sampled = now
+		return
+	}
+
+	cpuSeconds, err := a.CPU.CPUIncrease(elapsed)
+	if err != nil {
+		log.Printf("Error reading CPU for usage accounting: %s", err)
+	}
+
+	for _, sample := range samples {
+		key := sample.Name + "." + sample.Namespace
+
+		count, ok := invocations[key]
+		if !ok {
+			count = invocations[sample.Name]
+		}
+
+		seconds := elapsed.Seconds()
+		replicaSeconds := float64(sample.Replicas) * seconds
+
+		// The memory of a stale sample may be long out of date, so it is
+		// not billed for the interval
+		memoryGBSeconds, staleSeconds := sample.MemoryBytes/bytesPerGB*seconds, 0.0
+		if sample.Stale {
+			memoryGBSeconds, staleSeconds = 0, seconds
+		}
+
+		// A replica serving one invocation is busy, the rest of the
+		// replicas are idle
+		busySeconds := (a.lastBusy[key] - lastBusy[key]).Seconds()
+		if busySeconds < 0 {
+			busySeconds = 0
+		}
+		if busySeconds > replicaSeconds {
+			busySeconds = replicaSeconds
+		}
+
+		totals := UsageTotals{
+			Invocations:        count,
+			CPUSeconds:         cpuSeconds[key],
+			MemoryGBSeconds:    memoryGBSeconds,
+			ReplicaSeconds:     replicaSeconds,
+			BusyReplicaSeconds: busySeconds,
+			IdleReplicaSeconds: replicaSeconds - busySeconds,
+			StaleSeconds:       staleSeconds,
+		}
+		if replicaSeconds > 0 {
+			totals.IdleMemoryGBSeconds = memoryGBSeconds * totals.IdleReplicaSeconds / replicaSeconds
+		}
+
+		a.window(now).total(sample.Name, sample.Namespace).add(totals)
+	}
+
+	a.sampled = now
+	a.prune(now)
+}
+
+// window returns the window holding now, and must be called with the lock held
+func (a *UsageAccountant) window(now time.Time) usageWindow {
+	start := now.Truncate(a.Window)
+	if n := len(a.windows); n > 0 && a.windows[n-1].start.Equal(start) {
+		return a.windows[n-1]
+	}
+
+	w := usageWindow{start: start, functions: map[string]*UsageTotals{}}
+	a.windows = append(a.windows, w)
+	return w
+}
+
+// prune removes windows which ended before Retention, and must be called
+// with the lock held
+func (a *UsageAccountant) prune(now time.Time) {
+	oldest := now.Add(-a.Retention)
+
+	i := 0
+	for i < len(a.windows) && a.windows[i].start.Add(a.Window).Before(oldest) {
+		i++
+	}
+	a.windows = a.windows[i:]
+}
+
+func (w usageWindow) total(functionName, namespace string) *UsageTotals {
+	key := functionName + "." + namespace
+	totals, ok := w.functions[key]
+	if !ok {
+		totals = &UsageTotals{Function: functionName, Namespace: namespace}
+		w.functions[key] = totals
+	}
+	return totals
+}
+
+// Usage sums the totals of each function, or of each namespace when
+// byNamespace is set, over the windows which overlap from and to
+func (a *UsageAccountant) Usage(from, to time.Time, byNamespace bool) []UsageTotals {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	grouped := map[string]*UsageTotals{}
+	for _, w := range a.windows {
+		if !w.start.Before(to) || !w.start.Add(a.Window).After(from) {
+			continue
+		}
+
+		for key, totals := range w.functions {
+			group := UsageTotals{Function: totals.Function, Namespace: totals.Namespace}
+			if byNamespace {
+				key = totals.Namespace
+				group.Function = ""
+			}
+
+			if _, ok := grouped[key]; !ok {
+				grouped[key] = &group
+			}
+			grouped[key].add(*totals)
+		}
+	}
+
+	usage := make([]UsageTotals, 0, len(grouped))
+	for _, totals := range grouped {
+		usage = append(usage, *totals)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Namespace != usage[j].Namespace {
+			return usage[i].Namespace < usage[j].Namespace
+		}
+		return usage[i].Function < usage[j].Function
+	})
+	return usage
+}
@@ -0,0 +1,240 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUsageSource returns samples, and cpu once, then nothing
+type fakeUsageSource struct {
+	samples []UsageSample
+	cpu     map[string]float64
+
+	cpuWindow time.Duration
+}
+
+func (f *fakeUsageSource) UsageSamples() []UsageSample {
+	return f.samples
+}
+
+func (f *fakeUsageSource) CPUIncrease(window time.Duration) (map[string]float64, error) {
+	cpu := f.cpu
+	f.cpu = nil
+	f.cpuWindow = window
+	return cpu, nil
+}
+
+// fakeInvocationCounter returns counts once, then nothing
+type fakeInvocationCounter struct {
+	counts map[string]float64
+}
+
+func (f *fakeInvocationCounter) InvocationCounts(window time.Duration) (map[string]float64, error) {
+	counts := f.counts
+	f.counts = nil
+	return counts, nil
+}
+
+// fakeBusyTimeCounter returns the running total of busy time of each function
+type fakeBusyTimeCounter map[string]time.Duration
+
+func (f fakeBusyTimeCounter) BusyTime(functionName, namespace string, at time.Time) time.Duration {
+	return f[functionName+"."+namespace]
+}
+
+func newTestAccountant() (*UsageAccountant, *fakeUsageSource, *fakeInvocationCounter, fakeBusyTimeCounter) {
+	source := &fakeUsageSource{}
+	invocations := &fakeInvocationCounter{}
+	busy := fakeBusyTimeCounter{}
+	return NewUsageAccountant(source, source, invocations, busy, time.Hour, time.Hour*24), source, invocations, busy
+}
+
+func Test_UsageAccountant_SplitsBusyAndIdle(t *testing.T) {
+	accountant, source, invocations, busy := newTestAccountant()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	source.samples = []UsageSample{
+		{Name: "busy", Namespace: "team-a", Replicas: 2, MemoryBytes: bytesPerGB},
+		{Name: "idle", Namespace: "team-a", Replicas: 1, MemoryBytes: bytesPerGB / 2},
+	}
+	busy["busy.team-a"] = time.Second * 10
+	accountant.Record(start)
+
+	source.cpu = map[string]float64{"busy.team-a": 30, "idle.team-a": 1}
+	invocations.counts = map[string]float64{"busy.team-a": 40}
+	busy["busy.team-a"] = time.Second * 100
+	accountant.Record(start.Add(time.Minute))
+
+	usage := accountant.Usage(start, start.Add(time.Hour), false)
+	if len(usage) != 2 {
+		t.Fatalf("want usage for 2 functions, got: %d", len(usage))
+	}
+
+	b, idle := usage[0], usage[1]
+	if b.Function != "busy" || b.Invocations != 40 || b.CPUSeconds != 30 || b.MemoryGBSeconds != 60 ||
+		b.ReplicaSeconds != 120 || b.BusyReplicaSeconds != 90 || b.IdleReplicaSeconds != 30 || b.IdleMemoryGBSeconds != 15 {
+		t.Errorf("unexpected usage for busy: %+v", b)
+	}
+	if idle.Function != "idle" || idle.CPUSeconds != 1 || idle.ReplicaSeconds != 60 ||
+		idle.IdleReplicaSeconds != 60 || idle.IdleMemoryGBSeconds != 30 || idle.BusyReplicaSeconds != 0 {
+		t.Errorf("unexpected usage for idle: %+v", idle)
+	}
+}
+
+func Test_UsageAccountant_BusyAtMostReplicaSeconds(t *testing.T) {
+	cases := []struct {
+		name     string
+		replicas uint64
+		busy     time.Duration
+		wantBusy float64
+	}{
+		{"one short request to ten replicas", 10, time.Second, 1},
+		{"more requests in flight than replicas", 1, time.Minute * 5, 60},
+		{"scaled to zero", 0, time.Second, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			accountant, source, _, busy := newTestAccountant()
+			start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+			source.samples = []UsageSample{{Name: "echo", Namespace: "team-a", Replicas: c.replicas}}
+			accountant.Record(start)
+			busy["echo.team-a"] = c.busy
+			accountant.Record(start.Add(time.Minute))
+
+			usage := accountant.Usage(start, start.Add(time.Hour), false)[0]
+			replicaSeconds := float64(c.replicas) * 60
+			if usage.BusyReplicaSeconds != c.wantBusy || usage.IdleReplicaSeconds != replicaSeconds-c.wantBusy {
+				t.Errorf("want %f busy and %f idle, got: %+v", c.wantBusy, replicaSeconds-c.wantBusy, usage)
+			}
+		})
+	}
+}
+
+func Test_UsageAccountant_CPUIncreaseOverInterval(t *testing.T) {
+	accountant, source, _, _ := newTestAccountant()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	source.samples = []UsageSample{{Name: "echo", Namespace: "team-a", Replicas: 3}}
+	accountant.Record(start)
+
+	// The increase is read for the interval, whatever replicas were removed
+	source.samples = []UsageSample{{Name: "echo", Namespace: "team-a", Replicas: 1}}
+	source.cpu = map[string]float64{"echo.team-a": 5}
+	accountant.Record(start.Add(time.Minute))
+
+	if source.cpuWindow != time.Minute {
+		t.Errorf("want the CPU read over the interval of %s, got: %s", time.Minute, source.cpuWindow)
+	}
+	if usage := accountant.Usage(start, start.Add(time.Hour), false); usage[0].CPUSeconds != 5 {
+		t.Errorf("want the increase over the interval counted, got: %f", usage[0].CPUSeconds)
+	}
+}
+
+func Test_UsageAccountant_StaleMemoryIsNotBilled(t *testing.T) {
+	accountant, source, _, _ := newTestAccountant()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	source.samples = []UsageSample{{Name: "echo", Namespace: "team-a", Replicas: 1, MemoryBytes: bytesPerGB}}
+	accountant.Record(start)
+
+	source.samples[0].Stale = true
+	accountant.Record(start.Add(time.Minute))
+
+	source.samples[0].Stale = false
+	accountant.Record(start.Add(time.Minute * 2))
+
+	usage := accountant.Usage(start, start.Add(time.Hour), false)[0]
+	if usage.MemoryGBSeconds != 60 || usage.StaleSeconds != 60 || usage.ReplicaSeconds != 120 {
+		t.Errorf("want memory for the fresh interval only, and the stale one flagged, got: %+v", usage)
+	}
+}
+
+func Test_UsageAccountant_WindowsAndRetention(t *testing.T) {
+	accountant, source, _, _ := newTestAccountant()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	source.samples = []UsageSample{
+		{Name: "a", Namespace: "team-a", Replicas: 1},
+		{Name: "b", Namespace: "team-a", Replicas: 1},
+		{Name: "c", Namespace: "team-b", Replicas: 1},
+	}
+	accountant.Record(start)
+	accountant.Record(start.Add(time.Minute * 30))
+	accountant.Record(start.Add(time.Minute * 90))
+
+	if usage := accountant.Usage(start, start.Add(time.Hour), false); usage[0].ReplicaSeconds != 1800 {
+		t.Errorf("want only the first window, got: %f replica-seconds", usage[0].ReplicaSeconds)
+	}
+
+	usage := accountant.Usage(start, start.Add(time.Hour*2), true)
+	if len(usage) != 2 || usage[0].Namespace != "team-a" || usage[0].Function != "" || usage[0].ReplicaSeconds != 2*5400 {
+		t.Errorf("want totals by namespace over both windows, got: %+v", usage)
+	}
+
+	accountant.Record(start.Add(time.Hour * 48))
+	if usage := accountant.Usage(start, start.Add(time.Hour*2), false); len(usage) != 0 {
+		t.Errorf("want windows older than the retention removed, got: %+v", usage)
+	}
+}
+
+func Test_MakeUsageHandler_ReturnsJSONAndCSV(t *testing.T) {
+	accountant, source, _, _ := newTestAccountant()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	source.samples = []UsageSample{{Name: "echo", Namespace: "team-a", Replicas: 1}}
+	accountant.Record(start)
+	accountant.Record(start.Add(time.Minute))
+
+	handler := MakeUsageHandler(accountant)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/system/usage?from=2023-06-01T00:00:00Z&to=2023-06-02T00:00:00Z&groupBy=namespace", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	res := UsageResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Usage) != 1 || res.Usage[0].Namespace != "team-a" || res.Usage[0].IdleReplicaSeconds != 60 {
+		t.Errorf("unexpected usage: %+v", res.Usage)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/system/usage?from=2023-06-01T00:00:00Z&to=2023-06-02T00:00:00Z&format=csv", nil))
+	if got := rr.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Content-Type want: text/csv, got: %s", got)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][1] != "function" || rows[1][1] != "echo" || rows[1][5] != "60" {
+		t.Errorf("unexpected CSV: %v", rows)
+	}
+}
+
+func Test_MakeUsageHandler_InvalidRequests(t *testing.T) {
+	accountant, _, _, _ := newTestAccountant()
+	handler := MakeUsageHandler(accountant)
+
+	for _, query := range []string{"groupBy=team", "from=yesterday", "from=200&to=100"} {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/system/usage?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s, status code want: %d, got: %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
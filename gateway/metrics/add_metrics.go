@@ -13,8 +13,9 @@ import (
 	"strconv"
 )
 
-// AddMetricsHandler wraps a http.HandlerFunc with Prometheus metrics
-func AddMetricsHandler(handler http.HandlerFunc, prometheusQuery PrometheusQueryFetcher) http.HandlerFunc {
+// AddMetricsHandler wraps a http.HandlerFunc with Prometheus metrics from queries,
+// in the namespaces of the functions listed, or defaultNamespace
+func AddMetricsHandler(handler http.HandlerFunc, prometheusQuery PrometheusQueryFetcher, queries *QueryTemplates, defaultNamespace string) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -88,48 +89,40 @@ func AddMetricsHandler(handler http.HandlerFunc, prometheusQuery PrometheusQuery
 		}
 
 		if len(functions) > 0 {
-
-			ns := functions[0].Namespace
-			q := fmt.Sprintf(`sum(gateway_function_invocation_total{function_name=~".*.%s"}) by (function_name)`, ns)
-			// Restrict query results to only function names matching namespace suffix.
-
-			results, err := prometheusQuery.Fetch(url.QueryEscape(q))
-			if err != nil {
-				// log the error but continue, the mixIn will correctly handle the empty results.
-				log.Printf("Error querying Prometheus: %s\n", err.Error())
+			namespaces := []string{}
+			for _, function := range functions {
+				namespaces = append(namespaces, function.Namespace)
 			}
-			mixIn(&functions, results)
+			vars := QueryVars{Namespace: NamespacePattern(namespaces, defaultNamespace)}
 
-			//CPU和memory
-			//ns1 := functions[0].Namespace
-			//q1 := fmt.Sprintf(`sum(pod_cpu_usage_seconds_total{function_name=~".*.%s"}) by (function_name)`, ns1)
-			q1 := fmt.Sprintf(`sum by(container, namespace) (irate(container_cpu_usage_seconds_total{image!="",namespace="openfaas-fn", container!="POD"}[5m])*100)`)
-			results1, err1 := prometheusQuery.Fetch(url.QueryEscape(q1))
-			if err1 != nil {
-				// log the error but continue, the mixIn will correctly handle the empty results.
-				log.Printf("Error querying Prometheus: %s\n", err.Error())
-			}
-			mixCPU(&functions, results1)
+			fetch := func(name string) *VectorQueryResponse {
+				q, err := queries.Query(name, vars)
+				if err != nil {
+					log.Printf("Error querying Prometheus: %s\n", err.Error())
+					return nil
+				}
 
-			//ns2 := functions[0].Namespace
-			//q2 := fmt.Sprintf(`sum(pod_memory_working_set_bytes{function_name=~".*.%s"}) by (function_name)`, ns2)
-			q2 := fmt.Sprintf(`sum by(container, namespace) (container_memory_working_set_bytes{image!="",namespace="openfaas-fn", container!="POD"})`)
-			results2, err2 := prometheusQuery.Fetch(url.QueryEscape(q2))
-			if err2 != nil {
-				// log the error but continue, the mixIn will correctly handle the empty results.
-				log.Printf("Error querying Prometheus: %s\n", err.Error())
+				results, err := prometheusQuery.Fetch(url.QueryEscape(q))
+				if err != nil {
+					// log the error but continue, the mixIn will correctly handle the empty results.
+					log.Printf("Error querying Prometheus: %s\n", err.Error())
+				}
+				return results
 			}
-			mixMemory(&functions, results2)
 
-			//sum by (function_name) (gateway_function_cold_start_seconds_sum / gateway_function_cold_start_seconds_count)
-			// q3 := fmt.Sprintf(`sum by (function_name) (gateway_function_request_seconds_sum / gateway_function_request_seconds_count)`)
-			q3 := fmt.Sprintf(`sum by (function_name) (gateway_function_request_seconds{quantile="0.9"})`)
-			results3, err3 := prometheusQuery.Fetch(url.QueryEscape(q3))
-			if err3 != nil {
-				// log the error but continue, the mixIn will correctly handle the empty results.
-				log.Printf("Error querying Prometheus: %s\n", err.Error())
-			}
-			mixTime(&functions, results3)
+			mixIn(&functions, fetch(QueryInvocations))
+			mixCPU(&functions, fetch(QueryCPU))
+			mixMemory(&functions, fetch(QueryMemory))
+			mixValue(&functions, fetch(QueryLatency), func(function *FunctionStatus, value float64) {
+				function.InvocationAvgTime = value
+			})
+
+			mixValue(&functions, fetch(QueryColdStartRate), func(function *FunctionStatus, value float64) {
+				function.ColdStartRate = value
+			})
+			mixValue(&functions, fetch(QueryColdStartP99), func(function *FunctionStatus, value float64) {
+				function.ColdStartP99 = value
+			})
 		}
 
 		bytesOut, err := json.Marshal(functions)
@@ -147,7 +140,7 @@ func AddMetricsHandler(handler http.HandlerFunc, prometheusQuery PrometheusQuery
 
 func mixIn(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 
-	if functions == nil {
+	if functions == nil || metrics == nil {
 		return
 	}
 
@@ -172,7 +165,7 @@ func mixIn(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 
 func mixCPU(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 
-	if functions == nil {
+	if functions == nil || metrics == nil {
 		return
 	}
 	log.Printf("metrices len: %d", len(metrics.Data.Result))
@@ -197,7 +190,7 @@ func mixCPU(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 
 func mixMemory(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 
-	if functions == nil {
+	if functions == nil || metrics == nil {
 		return
 	}
 
@@ -221,15 +214,15 @@ func mixMemory(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 	}
 }
 
-func mixTime(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
+// mixValue applies the value for each function in metrics with set, NaN
+// values from functions without any invocations or cold starts are skipped
+func mixValue(functions *[]FunctionStatus, metrics *VectorQueryResponse, set func(function *FunctionStatus, value float64)) {
 
-	if functions == nil {
+	if functions == nil || metrics == nil {
 		return
 	}
 
-	log.Printf("metrices len: %d", len(metrics.Data.Result))
 	for i, function := range *functions {
-		num := 0.0
 		for _, v := range metrics.Data.Result {
 			if v.Metric.FunctionName == fmt.Sprintf("%s.%s", function.Name, function.Namespace) {
 				metricValue := v.Value[1]
@@ -240,19 +233,12 @@ func mixTime(functions *[]FunctionStatus, metrics *VectorQueryResponse) {
 						log.Printf("add_metrics: unable to convert value %q for metric: %s", value, err)
 						continue
 					}
-					log.Printf("add_metrics: avgTime %f", f)
-					if math.IsNaN(f) {
-						(*functions)[i].InvocationAvgTime += 0
-						num += 1.0
-					} else {
-						(*functions)[i].InvocationAvgTime += f
-						num += 1.0
+					if math.IsNaN(f) || math.IsInf(f, 0) {
+						continue
 					}
+					set(&(*functions)[i], f)
 				}
 			}
 		}
-		if num != 0 {
-			(*functions)[i].InvocationAvgTime /= num
-		}
 	}
 }
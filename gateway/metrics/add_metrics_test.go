@@ -29,7 +29,7 @@ func Test_PrometheusMetrics_MixedInto_Services(t *testing.T) {
 	functionsHandler := makeFunctionsHandler()
 	fakeQuery := makeFakePrometheusQueryFetcher()
 
-	handler := AddMetricsHandler(functionsHandler, fakeQuery)
+	handler := AddMetricsHandler(functionsHandler, fakeQuery, DefaultQueryTemplates(), "openfaas-fn")
 
 	rr := httptest.NewRecorder()
 	request, _ := http.NewRequest(http.MethodGet, "/system/functions", nil)
@@ -64,7 +64,7 @@ func Test_MetricHandler_ForwardsErrors(t *testing.T) {
 	// explicitly set the query fetcher to nil because it should
 	// not be called when a non-200 response is returned from the
 	// functions handler, if it is called then the test will panic
-	handler := AddMetricsHandler(functionsHandler, nil)
+	handler := AddMetricsHandler(functionsHandler, nil, DefaultQueryTemplates(), "openfaas-fn")
 
 	rr := httptest.NewRecorder()
 	request, _ := http.NewRequest(http.MethodGet, "/system/functions", nil)
@@ -131,3 +131,44 @@ func makeFunctionsHandler() http.HandlerFunc {
 		}
 	}
 }
+
+func Test_PrometheusMetrics_MixesInColdStarts(t *testing.T) {
+	handler := AddMetricsHandler(makeFunctionsHandler(), makeFakePrometheusQueryFetcher(), DefaultQueryTemplates(), "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/system/functions", nil)
+	handler.ServeHTTP(rr, request)
+
+	results := []FunctionStatus{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Want %d function, got: %d", 1, len(results))
+	}
+
+	if results[0].ColdStartRate != 1 {
+		t.Errorf("ColdStartRate want: %d, got: %f", 1, results[0].ColdStartRate)
+	}
+	if results[0].ColdStartP99 != 1 {
+		t.Errorf("ColdStartP99 want: %d, got: %f", 1, results[0].ColdStartP99)
+	}
+}
+
+func Test_MixValue_SkipsNaN(t *testing.T) {
+	functions := []FunctionStatus{{Name: "echo", Namespace: "openfaas-fn"}}
+
+	results := VectorQueryResponse{}
+	body := `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"function_name":"echo.openfaas-fn"},"value":[1509267827.752,"NaN"]}]}}`
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	mixValue(&functions, &results, func(function *FunctionStatus, value float64) {
+		function.ColdStartP99 = value
+	})
+
+	if functions[0].ColdStartP99 != 0 {
+		t.Errorf("ColdStartP99 want: %d, got: %f", 0, functions[0].ColdStartP99)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// CacheObserver counts the hits, misses and evictions of a function cache
+type CacheObserver struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions prometheus.Counter
+}
+
+// NewCacheObserver creates a CacheObserver which counts with the cache
+// label set to name
+func NewCacheObserver(options MetricOptions, name string) CacheObserver {
+	return CacheObserver{
+		hits:      options.GatewayFunctionCacheHits.WithLabelValues(name),
+		misses:    options.GatewayFunctionCacheMisses.WithLabelValues(name),
+		evictions: options.GatewayFunctionCacheEvictions.WithLabelValues(name),
+	}
+}
+
+// Hit counts a lookup which found a fresh entry
+func (o CacheObserver) Hit() {
+	o.hits.Inc()
+}
+
+// Miss counts a lookup which found no entry, or an expired entry
+func (o CacheObserver) Miss() {
+	o.misses.Inc()
+}
+
+// Evicted counts an entry removed because the cache was full or it had expired
+func (o CacheObserver) Evicted() {
+	o.evictions.Inc()
+}
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"path"
 	"strconv"
+	"sync"
 	"time"
 
 	"log"
@@ -31,10 +32,30 @@ type Exporter struct {
 
 	// 加这个，用来查询prometheus
 	prometheusQuery PrometheusQueryFetcher
+	queries         *QueryTemplates
+
+	// usage holds the last CPU and memory sampled for each function by
+	// SampleUsage, so that Collect does not query Prometheus
+	usage          map[string]functionUsage
+	usageSampledAt time.Time
+	usageStale     bool
+
+	// lock guards services and usage
+	lock sync.RWMutex
+	// collectLock serialises Collect, which resets and sets the gauges
+	collectLock sync.Mutex
 }
 
-// NewExporter creates a new exporter for the OpenFaaS gateway metrics
-func NewExporter(options MetricOptions, credentials *auth.BasicAuthCredentials, namespace string, prometheusQuery PrometheusQueryFetcher) *Exporter {
+// functionUsage is the CPU and memory of a function at sampledAt
+type functionUsage struct {
+	cpuSeconds  float64
+	memoryBytes float64
+	sampledAt   time.Time
+}
+
+// NewExporter creates a new exporter for the OpenFaaS gateway metrics, the CPU
+// and memory of functions are read from prometheusQuery with queries
+func NewExporter(options MetricOptions, credentials *auth.BasicAuthCredentials, namespace string, prometheusQuery PrometheusQueryFetcher, queries *QueryTemplates) *Exporter {
 	return &Exporter{
 		metricOptions:     options,
 		services:          []types.FunctionStatus{},
@@ -42,6 +63,8 @@ func NewExporter(options MetricOptions, credentials *auth.BasicAuthCredentials,
 		FunctionNamespace: namespace,
 		// 加这个
 		prometheusQuery: prometheusQuery,
+		queries:         queries,
+		usage:           map[string]functionUsage{},
 	}
 }
 
@@ -52,11 +75,17 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	e.metricOptions.GatewayFunctionsHistogram.Describe(ch)
 	e.metricOptions.ServiceReplicasGauge.Describe(ch)
 	e.metricOptions.GatewayFunctionInvocationStarted.Describe(ch)
+	e.metricOptions.GatewayFunctionColdStartHistogram.Describe(ch)
+	e.metricOptions.GatewayFunctionColdStartPhaseHistogram.Describe(ch)
+	e.metricOptions.GatewayFunctionCacheHits.Describe(ch)
+	e.metricOptions.GatewayFunctionCacheMisses.Describe(ch)
+	e.metricOptions.GatewayFunctionCacheEvictions.Describe(ch)
 
-	// e.metricOptions.GatewayFunctionRequestHistogram.Describe(ch)
-	e.metricOptions.GatewayFunctionRequestSummary.Describe(ch)
+	e.metricOptions.GatewayFunctionRequestHistogram.Describe(ch)
 	e.metricOptions.PodCpuUsageSecondsTotal.Describe(ch)
 	e.metricOptions.PodMemoryWorkingSetBytes.Describe(ch)
+	e.metricOptions.UsageSampleTimestamp.Describe(ch)
+	e.metricOptions.UsageSampleStale.Describe(ch)
 }
 
 // Collect collects data to be consumed by prometheus
@@ -65,38 +94,65 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	e.metricOptions.GatewayFunctionsHistogram.Collect(ch)
 
 	e.metricOptions.GatewayFunctionInvocationStarted.Collect(ch)
+	e.metricOptions.GatewayFunctionColdStartHistogram.Collect(ch)
+	e.metricOptions.GatewayFunctionColdStartPhaseHistogram.Collect(ch)
+	e.metricOptions.GatewayFunctionCacheHits.Collect(ch)
+	e.metricOptions.GatewayFunctionCacheMisses.Collect(ch)
+	e.metricOptions.GatewayFunctionCacheEvictions.Collect(ch)
 
-	e.metricOptions.ServiceReplicasGauge.Reset()
+	e.collectLock.Lock()
+	defer e.collectLock.Unlock()
 
-	for _, service := range e.services {
-		var serviceName string
-		if len(service.Namespace) > 0 {
-			serviceName = fmt.Sprintf("%s.%s", service.Name, service.Namespace)
-		} else {
-			serviceName = service.Name
-		}
+	e.lock.RLock()
+	services := e.services
+	usage := e.usage
+	sampledAt, stale := e.usageSampledAt, e.usageStale
+	e.lock.RUnlock()
+
+	e.metricOptions.ServiceReplicasGauge.Reset()
 
+	for _, service := range services {
 		// Set current replica count
 		e.metricOptions.ServiceReplicasGauge.
-			WithLabelValues(serviceName).
+			WithLabelValues(serviceKey(service)).
 			Set(float64(service.Replicas))
+	}
 
-		// 加这里，不然销毁的实例没数据
-		e.metricOptions.PodCpuUsageSecondsTotal.WithLabelValues(serviceName).Set(0)
-		e.metricOptions.PodMemoryWorkingSetBytes.WithLabelValues(serviceName).Set(0)
+	// CPU and memory come from the last sample, rather than querying
+	// Prometheus during a scrape
+	e.metricOptions.PodCpuUsageSecondsTotal.Reset()
+	e.metricOptions.PodMemoryWorkingSetBytes.Reset()
+	for serviceName, u := range usage {
+		e.metricOptions.PodCpuUsageSecondsTotal.WithLabelValues(serviceName).Set(u.cpuSeconds)
+		e.metricOptions.PodMemoryWorkingSetBytes.WithLabelValues(serviceName).Set(u.memoryBytes)
+	}
+
+	if !sampledAt.IsZero() {
+		e.metricOptions.UsageSampleTimestamp.Set(float64(sampledAt.Unix()))
+	}
+	if stale {
+		e.metricOptions.UsageSampleStale.Set(1)
+	} else {
+		e.metricOptions.UsageSampleStale.Set(0)
 	}
-	// 加这个来计算
-	e.calc()
 
 	// 添加如下
-	// e.metricOptions.GatewayFunctionRequestHistogram.Collect(ch)
-	e.metricOptions.GatewayFunctionRequestSummary.Collect(ch)
+	e.metricOptions.GatewayFunctionRequestHistogram.Collect(ch)
 	e.metricOptions.PodCpuUsageSecondsTotal.Collect(ch)
 	e.metricOptions.PodMemoryWorkingSetBytes.Collect(ch)
+	e.metricOptions.UsageSampleTimestamp.Collect(ch)
+	e.metricOptions.UsageSampleStale.Collect(ch)
 
 	e.metricOptions.ServiceReplicasGauge.Collect(ch)
 }
 
+func serviceKey(service types.FunctionStatus) string {
+	if len(service.Namespace) > 0 {
+		return fmt.Sprintf("%s.%s", service.Name, service.Namespace)
+	}
+	return service.Name
+}
+
 // StartServiceWatcher starts a ticker and collects service replica counts to expose to prometheus
 func (e *Exporter) StartServiceWatcher(endpointURL url.URL, metricsOptions MetricOptions, label string, interval time.Duration) {
 	ticker := time.NewTicker(interval)
@@ -121,7 +177,6 @@ func (e *Exporter) StartServiceWatcher(endpointURL url.URL, metricsOptions Metri
 						log.Println(err)
 						continue
 					}
-					e.services = services
 				} else {
 					for _, namespace := range namespaces {
 						nsServices, err := e.getFunctions(endpointURL, namespace)
@@ -133,7 +188,9 @@ func (e *Exporter) StartServiceWatcher(endpointURL url.URL, metricsOptions Metri
 					}
 				}
 
+				e.lock.Lock()
 				e.services = services
+				e.lock.Unlock()
 
 				break
 			case <-quit:
@@ -227,36 +284,163 @@ func (e *Exporter) getNamespaces(endpointURL url.URL) ([]string, error) {
 	return namespaces, nil
 }
 
-// ! 这个是新加的函数，直接放最底下。即将查出来的指标转成自己定义的
-func (e *Exporter) calc() {
-	q1 := `sum by(container, namespace) (container_cpu_usage_seconds_total{image!="",namespace="openfaas-fn", container!="POD"})`
-	q2 := `sum by(container, namespace) (container_memory_working_set_bytes{image!="",namespace="openfaas-fn", container!="POD"})`
+// StartUsageSampler samples the CPU and memory of each function from
+// Prometheus on every interval, for Collect to report
+func (e *Exporter) StartUsageSampler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
 
-	q1Results, err := e.prometheusQuery.Fetch(url.QueryEscape(q1))
+	go func() {
+		e.SampleUsage(time.Now())
+		for range ticker.C {
+			e.SampleUsage(time.Now())
+		}
+	}()
+}
+
+// SampleUsage queries the CPU and memory of each function at the time now.
+// Functions without a value from Prometheus, i.e. scaled to zero, are set
+// to zero. When a query fails the last values are kept and marked stale.
+func (e *Exporter) SampleUsage(now time.Time) {
+	e.lock.RLock()
+	services := e.services
+	e.lock.RUnlock()
+
+	vars := QueryVars{Namespace: e.usageNamespaces(services)}
+
+	cpu, err := e.fetchUsage(QueryCPUSeconds, vars)
 	if err != nil {
-		log.Printf("Error querying q1: %s\n", err.Error())
+		e.markUsageStale(err)
 		return
 	}
+	memory, err := e.fetchUsage(QueryMemory, vars)
+	if err != nil {
+		e.markUsageStale(err)
+		return
+	}
+
+	usage := map[string]functionUsage{}
+	for _, service := range services {
+		usage[serviceKey(service)] = functionUsage{sampledAt: now}
+	}
+	for serviceName, value := range cpu {
+		u := usage[serviceName]
+		u.cpuSeconds, u.sampledAt = value, now
+		usage[serviceName] = u
+	}
+	for serviceName, value := range memory {
+		u := usage[serviceName]
+		u.memoryBytes, u.sampledAt = value, now
+		usage[serviceName] = u
+	}
 
-	// cpu
-	for _, v := range q1Results.Data.Result {
-		metricValue := v.Value[1]
-		f, _ := strconv.ParseFloat(metricValue.(string), 64)
-		log.Printf("calc cpu f: %f", f)
-		e.metricOptions.PodCpuUsageSecondsTotal.WithLabelValues(fmt.Sprintf("%s.%s", v.Metric.Container, v.Metric.Namespace)).Set(f)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.usage = usage
+	e.usageSampledAt = now
+	e.usageStale = false
+}
+
+// CPUIncrease returns the CPU seconds used by each function's containers
+// over window by "name.namespace", counter resets are handled by Prometheus
+// for each container, so replicas which are removed or replaced are not
+// counted twice
+func (e *Exporter) CPUIncrease(window time.Duration) (map[string]float64, error) {
+	e.lock.RLock()
+	services := e.services
+	e.lock.RUnlock()
+
+	return e.fetchUsage(QueryCPUIncrease, QueryVars{
+		Namespace: e.usageNamespaces(services),
+		Window:    fmt.Sprintf("%ds", int(window.Seconds())),
+	})
+}
+
+// usageNamespaces matches the namespaces of services
+func (e *Exporter) usageNamespaces(services []types.FunctionStatus) string {
+	namespaces := []string{}
+	for _, service := range services {
+		namespaces = append(namespaces, service.Namespace)
 	}
+	return NamespacePattern(namespaces, e.FunctionNamespace)
+}
+
+// UsageSample is the replicas of a function and its last sampled usage
+type UsageSample struct {
+	Name      string
+	Namespace string
+	Replicas  uint64
+
+	// MemoryBytes is the working set of all the function's replicas
+	MemoryBytes float64
+
+	// Stale is set when the last sample failed, and MemoryBytes is from
+	// an earlier one
+	Stale bool
+}
+
+// UsageSamples returns the replicas of each function known to the
+// exporter, with the memory of the last good sample and whether the
+// samples since have failed
+func (e *Exporter) UsageSamples() []UsageSample {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	samples := make([]UsageSample, 0, len(e.services))
+	for _, service := range e.services {
+		namespace := service.Namespace
+		if len(namespace) == 0 {
+			namespace = e.FunctionNamespace
+		}
 
-	q2Results, err := e.prometheusQuery.Fetch(url.QueryEscape(q2))
+		u := e.usage[serviceKey(service)]
+		samples = append(samples, UsageSample{
+			Name:        service.Name,
+			Namespace:   namespace,
+			Replicas:    service.Replicas,
+			MemoryBytes: u.memoryBytes,
+			Stale:       e.usageStale,
+		})
+	}
+	return samples
+}
+
+func (e *Exporter) markUsageStale(err error) {
+	log.Printf("Error sampling function usage, keeping the last values: %s", err)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.usageStale = true
+}
+
+// fetchUsage runs the query for name, and returns its value for each
+// function by "name.namespace"
+func (e *Exporter) fetchUsage(name string, vars QueryVars) (map[string]float64, error) {
+	q, err := e.queries.Query(name, vars)
 	if err != nil {
-		log.Printf("Error querying q2: %s\n", err.Error())
-		return
+		return nil, err
+	}
+
+	results, err := e.prometheusQuery.Fetch(url.QueryEscape(q))
+	if err != nil {
+		return nil, err
 	}
 
-	// memory
-	for _, v := range q2Results.Data.Result {
-		metricValue := v.Value[1]
-		f, _ := strconv.ParseFloat(metricValue.(string), 64)
-		log.Printf("calc memory f: %f", f)
-		e.metricOptions.PodMemoryWorkingSetBytes.WithLabelValues(fmt.Sprintf("%s.%s", v.Metric.Container, v.Metric.Namespace)).Set(f)
+	values := map[string]float64{}
+	for _, v := range results.Data.Result {
+		if len(v.Value) != 2 {
+			continue
+		}
+		value, ok := v.Value[1].(string)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		values[fmt.Sprintf("%s.%s", v.Metric.Container, v.Metric.Namespace)] = f
 	}
+	return values, nil
 }
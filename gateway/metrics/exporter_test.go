@@ -1,6 +1,15 @@
 package metrics
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 )
@@ -28,6 +37,131 @@ func readGauge(g prometheus.Metric) metricResult {
 	}
 }
 
+// usageQueryFetcher returns CPU and memory for the echo function, or err
+type usageQueryFetcher struct {
+	lock    sync.Mutex
+	err     error
+	cpu     string
+	memory  string
+	queries int
+	last    string
+}
+
+func (f *usageQueryFetcher) Fetch(query string) (*VectorQueryResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.queries++
+	f.last, _ = url.QueryUnescape(query)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	value := f.memory
+	if q, _ := url.QueryUnescape(query); strings.Contains(q, "container_cpu_usage_seconds_total") {
+		value = f.cpu
+	}
+
+	res := &VectorQueryResponse{}
+	body := fmt.Sprintf(`{"data": {"result": [{"metric": {"container": "echo", "namespace": "openfaas-fn"}, "value": [1700000000, %q]}]}}`, value)
+	if err := json.Unmarshal([]byte(body), res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func collect(e *Exporter) {
+	ch := make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+}
+
+func Test_Exporter_CollectReadsSampledUsage(t *testing.T) {
+	fetcher := &usageQueryFetcher{cpu: "12.5", memory: "1024"}
+	e := NewExporter(BuildMetricsOptions(), nil, "openfaas-fn", fetcher, DefaultQueryTemplates())
+	e.services = []types.FunctionStatus{
+		{Name: "echo", Namespace: "openfaas-fn", Replicas: 1},
+		{Name: "idle", Namespace: "openfaas-fn"},
+	}
+
+	sampledAt := time.Unix(1700000000, 0)
+	e.SampleUsage(sampledAt)
+	collect(e)
+	collect(e)
+
+	if fetcher.queries != 2 {
+		t.Errorf("want Prometheus queried only by the sampler, got: %d queries", fetcher.queries)
+	}
+
+	if got := readGauge(e.metricOptions.PodCpuUsageSecondsTotal.WithLabelValues("echo.openfaas-fn")).value; got != 12.5 {
+		t.Errorf("cpu want: %f, got: %f", 12.5, got)
+	}
+	if got := readGauge(e.metricOptions.PodMemoryWorkingSetBytes.WithLabelValues("echo.openfaas-fn")).value; got != 1024 {
+		t.Errorf("memory want: %f, got: %f", 1024.0, got)
+	}
+	if got := readGauge(e.metricOptions.PodMemoryWorkingSetBytes.WithLabelValues("idle.openfaas-fn")).value; got != 0 {
+		t.Errorf("want functions without results set to zero, got: %f", got)
+	}
+	if got := readGauge(e.metricOptions.UsageSampleTimestamp).value; got != float64(sampledAt.Unix()) {
+		t.Errorf("sample timestamp want: %d, got: %f", sampledAt.Unix(), got)
+	}
+	if got := readGauge(e.metricOptions.UsageSampleStale).value; got != 0 {
+		t.Errorf("want a fresh sample, got stale: %f", got)
+	}
+}
+
+func Test_Exporter_FailedSampleKeepsLastValues(t *testing.T) {
+	fetcher := &usageQueryFetcher{cpu: "12.5", memory: "1024"}
+	e := NewExporter(BuildMetricsOptions(), nil, "openfaas-fn", fetcher, DefaultQueryTemplates())
+	e.services = []types.FunctionStatus{{Name: "echo", Namespace: "openfaas-fn", Replicas: 1}}
+
+	sampledAt := time.Unix(1700000000, 0)
+	e.SampleUsage(sampledAt)
+
+	fetcher.err = fmt.Errorf("connection refused")
+	e.SampleUsage(sampledAt.Add(time.Minute))
+	collect(e)
+
+	if got := readGauge(e.metricOptions.PodCpuUsageSecondsTotal.WithLabelValues("echo.openfaas-fn")).value; got != 12.5 {
+		t.Errorf("want the last cpu of %f kept, got: %f", 12.5, got)
+	}
+	if got := readGauge(e.metricOptions.UsageSampleTimestamp).value; got != float64(sampledAt.Unix()) {
+		t.Errorf("want the timestamp of the last good sample: %d, got: %f", sampledAt.Unix(), got)
+	}
+	if got := readGauge(e.metricOptions.UsageSampleStale).value; got != 1 {
+		t.Errorf("want the sample marked stale, got: %f", got)
+	}
+	if samples := e.UsageSamples(); len(samples) != 1 || !samples[0].Stale || samples[0].MemoryBytes != 1024 {
+		t.Errorf("want the last sample returned as stale, got: %+v", samples)
+	}
+
+	fetcher.err = nil
+	e.SampleUsage(sampledAt.Add(time.Minute * 2))
+	collect(e)
+
+	if got := readGauge(e.metricOptions.UsageSampleStale).value; got != 0 {
+		t.Errorf("want the sample fresh once a query succeeds, got stale: %f", got)
+	}
+}
+
+func Test_Exporter_CPUIncreaseOverWindow(t *testing.T) {
+	fetcher := &usageQueryFetcher{cpu: "4.5"}
+	e := NewExporter(BuildMetricsOptions(), nil, "openfaas-fn", fetcher, DefaultQueryTemplates())
+	e.services = []types.FunctionStatus{{Name: "echo", Namespace: "openfaas-fn", Replicas: 1}}
+
+	cpu, err := e.CPUIncrease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(fetcher.last, "increase(container_cpu_usage_seconds_total") || !strings.Contains(fetcher.last, "[60s]") {
+		t.Errorf("want the increase over the window queried, got: %s", fetcher.last)
+	}
+	if got := cpu["echo.openfaas-fn"]; got != 4.5 {
+		t.Errorf("cpu want: %f, got: %f", 4.5, got)
+	}
+}
+
 //func Test_Describe_DescribesThePrometheusMetrics(t *testing.T) {
 //	metricsOptions := BuildMetricsOptions()
 //	exporter := NewExporter(metricsOptions, nil, "openfaas-fn")
@@ -54,6 +54,14 @@ type FunctionStatus struct {
 
 	InvocationAvgTime float64 `json:"invocationAvgTime,omitempty"`
 
+	// ColdStartRate is the fraction of invocations over the last hour
+	// which waited for the function to scale from zero
+	ColdStartRate float64 `json:"coldStartRate,omitempty"`
+
+	// ColdStartP99 is the 99th percentile of the time in seconds spent
+	// waiting for the function to scale from zero over the last hour
+	ColdStartP99 float64 `json:"coldStartP99,omitempty"`
+
 	// Replicas desired within the cluster
 	Replicas uint64 `json:"replicas,omitempty"`
 
@@ -0,0 +1,289 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+const (
+	// defaultMetricsRange is queried when no from is given
+	defaultMetricsRange = time.Hour
+
+	// maxMetricsPoints is the most points Prometheus returns for a series
+	maxMetricsPoints = 11000
+
+	// minMetricsWindow is the shortest range of a rate, so that it spans
+	// more than one scrape
+	minMetricsWindow = time.Minute
+)
+
+// validMetricsName matches the names and namespaces which may be written into
+// a query, the same as the NameExpression of the gateway's routes
+var validMetricsName = regexp.MustCompile("^[-a-zA-Z_0-9.]+$")
+
+// latencyQuantiles are the quantiles of the latency series
+var latencyQuantiles = []string{"0.5", "0.9", "0.99"}
+
+// functionMetricsQueries are the series returned by MakeFunctionMetricsHandler
+// and the query for each, which is run once per quantile when quantiles is set
+var functionMetricsQueries = []struct {
+	series    string
+	query     string
+	quantiles []string
+}{
+	{"invocationRate", QueryFunctionInvocationRate, nil},
+	{"errorRate", QueryFunctionErrorRate, nil},
+	{"latency", QueryFunctionLatency, latencyQuantiles},
+	{"replicas", QueryFunctionReplicas, nil},
+	{"cpu", QueryFunctionCPU, nil},
+	{"memory", QueryFunctionMemory, nil},
+}
+
+// FunctionMetricsResponse holds the time series of a function between
+// From and To, one point every StepSeconds
+type FunctionMetricsResponse struct {
+	Function    string    `json:"function"`
+	Namespace   string    `json:"namespace"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	StepSeconds float64   `json:"stepSeconds"`
+
+	// Series holds invocationRate and errorRate per second, latency in
+	// seconds with one series for each of p50, p90 and p99 labelled by
+	// quantile, replicas, cpu as a percentage of a core and memory in bytes
+	Series map[string][]TimeSeries `json:"series"`
+
+	// Errors holds the error for any series which could not be queried
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// TimeSeries is a series of points with the same labels
+type TimeSeries struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []TimeSeriesPoint `json:"points"`
+}
+
+// TimeSeriesPoint is a value at a time in seconds since the epoch
+type TimeSeriesPoint struct {
+	Time  float64 `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// MakeFunctionMetricsHandler returns the time series of a function from
+// Prometheus, for the query parameters from, to and step. from and to are
+// RFC3339 or seconds since the epoch, and default to the last hour. step is
+// a duration or a number of seconds, and defaults to 250 points. A namespace
+// which is not a valid name is rejected, as it is written into the queries.
+func MakeFunctionMetricsHandler(prometheusQuery PrometheusRangeQueryFetcher, queries *QueryTemplates, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, mux.Vars(r)["name"])
+		if ns := r.URL.Query().Get("namespace"); len(ns) > 0 {
+			namespace = ns
+		}
+		if !validMetricsName.MatchString(functionName) || !validMetricsName.MatchString(namespace) {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{
+				Code:      types.ErrorCodeBadRequest,
+				Message:   fmt.Sprintf("invalid function name or namespace: %s.%s", functionName, namespace),
+				Function:  functionName,
+				Namespace: namespace,
+			})
+			return
+		}
+		namespace = NamespacePattern([]string{namespace}, defaultNamespace)
+
+		from, to, step, err := parseMetricsRange(r.URL.Query(), time.Now())
+		if err != nil {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{
+				Code:      types.ErrorCodeBadRequest,
+				Message:   err.Error(),
+				Function:  functionName,
+				Namespace: namespace,
+			})
+			return
+		}
+
+		window := step
+		if window < minMetricsWindow {
+			window = minMetricsWindow
+		}
+		vars := QueryVars{
+			Namespace: namespace,
+			Function:  functionName,
+			Window:    fmt.Sprintf("%ds", int64(window.Seconds())),
+		}
+
+		res := FunctionMetricsResponse{
+			Function:    functionName,
+			Namespace:   namespace,
+			From:        from,
+			To:          to,
+			StepSeconds: step.Seconds(),
+			Series:      map[string][]TimeSeries{},
+		}
+
+		lock := sync.Mutex{}
+		wg := sync.WaitGroup{}
+		for _, q := range functionMetricsQueries {
+			wg.Add(1)
+			go func(series, query string, quantiles []string) {
+				defer wg.Done()
+
+				values, err := fetchQuantiles(prometheusQuery, queries, query, quantiles, vars, from, to, step)
+
+				lock.Lock()
+				defer lock.Unlock()
+
+				if err != nil {
+					log.Printf("Error querying Prometheus for %s.%s %s: %s", functionName, namespace, series, err)
+					if res.Errors == nil {
+						res.Errors = map[string]string{}
+					}
+					res.Errors[series] = err.Error()
+					return
+				}
+				res.Series[series] = values
+			}(q.series, q.query, q.quantiles)
+		}
+		wg.Wait()
+
+		if len(res.Series) == 0 {
+			types.WriteError(w, r, http.StatusBadGateway, types.ErrorResponse{
+				Code:      types.ErrorCodeUpstreamUnavailable,
+				Message:   "Unable to query Prometheus for metrics",
+				Function:  functionName,
+				Namespace: namespace,
+			})
+			return
+		}
+
+		bytesOut, _ := json.Marshal(res)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytesOut)
+	}
+}
+
+// fetchQuantiles runs the query once for each quantile and returns the series
+// of all of them, or runs it once with vars as they are when there are none
+func fetchQuantiles(prometheusQuery PrometheusRangeQueryFetcher, queries *QueryTemplates, name string, quantiles []string, vars QueryVars, from, to time.Time, step time.Duration) ([]TimeSeries, error) {
+	if len(quantiles) == 0 {
+		return fetchTimeSeries(prometheusQuery, queries, name, vars, from, to, step)
+	}
+
+	series := []TimeSeries{}
+	for _, quantile := range quantiles {
+		vars.Quantile = quantile
+		values, err := fetchTimeSeries(prometheusQuery, queries, name, vars, from, to, step)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, values...)
+	}
+	return series, nil
+}
+
+func fetchTimeSeries(prometheusQuery PrometheusRangeQueryFetcher, queries *QueryTemplates, name string, vars QueryVars, from, to time.Time, step time.Duration) ([]TimeSeries, error) {
+	q, err := queries.Query(name, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := prometheusQuery.FetchRange(url.QueryEscape(q), from, to, step)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []TimeSeries{}
+	for _, result := range results.Data.Result {
+		s := TimeSeries{Labels: result.Metric, Points: []TimeSeriesPoint{}}
+
+		for _, v := range result.Values {
+			if len(v) != 2 {
+				continue
+			}
+			t, ok := v[0].(float64)
+			if !ok {
+				continue
+			}
+			value, ok := v[1].(string)
+			if !ok {
+				continue
+			}
+
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+			s.Points = append(s.Points, TimeSeriesPoint{Time: t, Value: f})
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// parseMetricsRange reads from, to and step, with defaults relative to now
+func parseMetricsRange(query url.Values, now time.Time) (from, to time.Time, step time.Duration, err error) {
+	to = now
+	if val := query.Get("to"); len(val) > 0 {
+		if to, err = parseMetricsTime(val); err != nil {
+			return from, to, step, fmt.Errorf("invalid value for to: %s", val)
+		}
+	}
+
+	from = to.Add(-defaultMetricsRange)
+	if val := query.Get("from"); len(val) > 0 {
+		if from, err = parseMetricsTime(val); err != nil {
+			return from, to, step, fmt.Errorf("invalid value for from: %s", val)
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, step, fmt.Errorf("from must be before to")
+	}
+
+	step = to.Sub(from) / 250
+	if step < time.Second {
+		step = time.Second
+	}
+	step = step.Round(time.Second)
+
+	if val := query.Get("step"); len(val) > 0 {
+		if seconds, parseErr := strconv.ParseFloat(val, 64); parseErr == nil {
+			step = time.Duration(seconds * float64(time.Second))
+		} else if step, err = time.ParseDuration(val); err != nil {
+			return from, to, step, fmt.Errorf("invalid value for step: %s", val)
+		}
+		if step <= 0 {
+			return from, to, step, fmt.Errorf("invalid value for step: %s", val)
+		}
+	}
+
+	if points := to.Sub(from) / step; points > maxMetricsPoints {
+		return from, to, step, fmt.Errorf("step is too small, %d points would be returned, the maximum is %d", points, maxMetricsPoints)
+	}
+
+	return from, to, step, nil
+}
+
+func parseMetricsTime(val string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(val, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
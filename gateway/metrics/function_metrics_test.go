@@ -0,0 +1,154 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rangeQueryFetcher returns the same two points for every range query
+// other than those containing fail
+type rangeQueryFetcher struct {
+	fail string
+
+	lock    sync.Mutex
+	queries []string
+	step    time.Duration
+}
+
+func (f *rangeQueryFetcher) FetchRange(query string, start, end time.Time, step time.Duration) (*MatrixQueryResponse, error) {
+	q, _ := url.QueryUnescape(query)
+
+	f.lock.Lock()
+	f.queries = append(f.queries, q)
+	f.step = step
+	f.lock.Unlock()
+
+	if len(f.fail) > 0 && strings.Contains(q, f.fail) {
+		return nil, fmt.Errorf("query failed")
+	}
+
+	res := MatrixQueryResponse{}
+	body := `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,"1.5"],[1700000015,"NaN"],[1700000030,"2"]]}]}}`
+	err := json.Unmarshal([]byte(body), &res)
+	return &res, err
+}
+
+func getFunctionMetrics(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/system/function/{name}/metrics", handler)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	return rr
+}
+
+func Test_MakeFunctionMetricsHandler_ReturnsEachSeries(t *testing.T) {
+	fetcher := &rangeQueryFetcher{fail: "container_memory"}
+	handler := MakeFunctionMetricsHandler(fetcher, DefaultQueryTemplates(), "openfaas-fn")
+
+	rr := getFunctionMetrics(handler, "/system/function/echo.dev/metrics?from=1700000000&to=1700003600&step=30s")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status code want: %d, got: %d, body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	res := FunctionMetricsResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Function != "echo" || res.Namespace != "dev" || res.StepSeconds != 30 {
+		t.Errorf("want echo.dev with a 30s step, got: %s.%s %fs", res.Function, res.Namespace, res.StepSeconds)
+	}
+
+	for _, series := range []string{"invocationRate", "errorRate", "replicas", "cpu"} {
+		values := res.Series[series]
+		if len(values) != 1 || len(values[0].Points) != 2 {
+			t.Errorf("%s, want one series of two points without NaN, got: %+v", series, values)
+		}
+	}
+
+	if latency := res.Series["latency"]; len(latency) != 3 {
+		t.Errorf("latency, want a series for each of p50, p90 and p99, got: %+v", latency)
+	}
+	for _, quantile := range []string{"0.5", "0.9", "0.99"} {
+		found := false
+		for _, q := range fetcher.queries {
+			if strings.Contains(q, "histogram_quantile("+quantile+",") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("want latency queried at the %s quantile, got: %v", quantile, fetcher.queries)
+		}
+	}
+
+	if _, ok := res.Errors["memory"]; !ok {
+		t.Errorf("want the error for memory, got: %v", res.Errors)
+	}
+
+	for _, q := range fetcher.queries {
+		if strings.Contains(q, "rate(") && !strings.Contains(q, "[60s]") {
+			t.Errorf("want rates over at least a minute, got: %s", q)
+		}
+		if strings.Contains(q, "function_name") && !strings.Contains(q, `"echo.dev"`) {
+			t.Errorf("want the function in dev queried, got: %s", q)
+		}
+	}
+}
+
+func Test_MakeFunctionMetricsHandler_AllQueriesFail(t *testing.T) {
+	handler := MakeFunctionMetricsHandler(&rangeQueryFetcher{fail: "("}, DefaultQueryTemplates(), "openfaas-fn")
+
+	if rr := getFunctionMetrics(handler, "/system/function/echo/metrics"); rr.Code != http.StatusBadGateway {
+		t.Fatalf("status code want: %d, got: %d", http.StatusBadGateway, rr.Code)
+	}
+}
+
+func Test_MakeFunctionMetricsHandler_RejectsInvalidNamespace(t *testing.T) {
+	fetcher := &rangeQueryFetcher{}
+	handler := MakeFunctionMetricsHandler(fetcher, DefaultQueryTemplates(), "openfaas-fn")
+
+	path := "/system/function/echo/metrics?namespace=" + url.QueryEscape(`dev"}) or vector(1) #`)
+	if rr := getFunctionMetrics(handler, path); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status code want: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+	if len(fetcher.queries) != 0 {
+		t.Errorf("want no queries for an invalid namespace, got: %v", fetcher.queries)
+	}
+}
+
+func Test_parseMetricsRange(t *testing.T) {
+	now := time.Date(2023, time.October, 2, 12, 0, 0, 0, time.UTC)
+
+	from, to, step, err := parseMetricsRange(url.Values{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !to.Equal(now) || !from.Equal(now.Add(-time.Hour)) || step != time.Second*14 {
+		t.Errorf("want the last hour in 14s steps, got: %s to %s in %s", from, to, step)
+	}
+
+	for _, query := range []string{
+		"from=2023-10-02T12:00:00Z&to=2023-10-02T11:00:00Z",
+		"from=yesterday",
+		"step=-1",
+		"step=10ms",
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, _, _, err := parseMetricsRange(values, now); err == nil {
+			t.Errorf("%s, want an error", query)
+		}
+	}
+}
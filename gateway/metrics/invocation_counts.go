@@ -0,0 +1,177 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PrometheusInvocationCounts reads the invocations of each function from
+// the gateway_function_invocation_total counters stored in Prometheus, so
+// includes invocations through every replica of the gateway
+type PrometheusInvocationCounts struct {
+	Fetcher PrometheusQueryFetcher
+
+	// RangeFetcher reads the history of the counters for InvocationHistory
+	RangeFetcher PrometheusRangeQueryFetcher
+}
+
+// InvocationCounts returns the increase in invocations for each function over window
+func (p PrometheusInvocationCounts) InvocationCounts(window time.Duration) (map[string]float64, error) {
+	results, err := p.Fetcher.Fetch(url.QueryEscape(invocationIncreaseQuery(window)))
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]float64)
+	for _, v := range results.Data.Result {
+		if len(v.Value) < 2 {
+			continue
+		}
+
+		value, ok := v.Value[1].(string)
+		if !ok {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Printf("invocation_counts: unable to convert value %q for metric: %s", value, err)
+			continue
+		}
+		counts[v.Metric.FunctionName] += f
+	}
+
+	return counts, nil
+}
+
+// InvocationHistory returns the increase in invocations for each function
+// over every window in the period up to end, oldest first. A window without
+// a sample is counted as zero.
+func (p PrometheusInvocationCounts) InvocationHistory(window, period time.Duration, end time.Time) (map[string][]float64, error) {
+	if p.RangeFetcher == nil {
+		return nil, fmt.Errorf("no range query is configured")
+	}
+
+	steps := int(period / window)
+	if steps < 1 {
+		return map[string][]float64{}, nil
+	}
+	start := end.Add(-window * time.Duration(steps-1))
+
+	results, err := p.RangeFetcher.FetchRange(url.QueryEscape(invocationIncreaseQuery(window)), start, end, window)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]float64)
+	for _, result := range results.Data.Result {
+		functionName := result.Metric["function_name"]
+		if len(functionName) == 0 {
+			continue
+		}
+		if _, ok := history[functionName]; !ok {
+			history[functionName] = make([]float64, steps)
+		}
+
+		for _, v := range result.Values {
+			if len(v) != 2 {
+				continue
+			}
+			t, ok := v[0].(float64)
+			if !ok {
+				continue
+			}
+			value, ok := v[1].(string)
+			if !ok {
+				continue
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+
+			index := int(math.Round((t - float64(start.UnixNano())/float64(time.Second)) / window.Seconds()))
+			if index < 0 || index >= steps {
+				continue
+			}
+			history[functionName][index] += f
+		}
+	}
+
+	return history, nil
+}
+
+func invocationIncreaseQuery(window time.Duration) string {
+	return fmt.Sprintf(`sum by (function_name) (increase(gateway_function_invocation_total[%ds]))`, int(window.Seconds()))
+}
+
+// GatewayInvocationCounts reads the invocations of each function from this
+// gateway's own invocation counter, without a dependency on Prometheus
+type GatewayInvocationCounts struct {
+	Counter *prometheus.CounterVec
+
+	last   map[string]float64
+	primed bool
+	lock   sync.Mutex
+}
+
+// NewGatewayInvocationCounts creates a GatewayInvocationCounts for counter
+func NewGatewayInvocationCounts(counter *prometheus.CounterVec) *GatewayInvocationCounts {
+	return &GatewayInvocationCounts{
+		Counter: counter,
+		last:    make(map[string]float64),
+	}
+}
+
+// InvocationCounts returns the increase in invocations for each function
+// since the previous call, the window is set by the caller's interval
+func (g *GatewayInvocationCounts) InvocationCounts(window time.Duration) (map[string]float64, error) {
+	totals := make(map[string]float64)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		g.Counter.Collect(ch)
+		close(ch)
+	}()
+
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			log.Printf("invocation_counts: unable to read metric: %s", err)
+			continue
+		}
+
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "function_name" {
+				totals[label.GetValue()] += m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	// The first call only records the totals, after that a function
+	// missing from the previous call was first invoked in between.
+	counts := make(map[string]float64)
+	for functionName, total := range totals {
+		if g.primed {
+			counts[functionName] = total - g.last[functionName]
+		}
+		g.last[functionName] = total
+	}
+	g.primed = true
+
+	return counts, nil
+}
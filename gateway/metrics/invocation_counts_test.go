@@ -0,0 +1,99 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_PrometheusInvocationCounts_ReadsCountsByFunction(t *testing.T) {
+	counts, err := PrometheusInvocationCounts{Fetcher: makeFakePrometheusQueryFetcher()}.InvocationCounts(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := counts["func_echoit.openfaas-fn"]; got != 1 {
+		t.Fatalf("want: %d, got: %f", 1, got)
+	}
+}
+
+// historyRangeFetcher returns the body for every range query
+type historyRangeFetcher struct {
+	body  string
+	query string
+	start time.Time
+	end   time.Time
+	step  time.Duration
+}
+
+func (f *historyRangeFetcher) FetchRange(query string, start, end time.Time, step time.Duration) (*MatrixQueryResponse, error) {
+	f.query, _ = url.QueryUnescape(query)
+	f.start, f.end, f.step = start, end, step
+
+	res := MatrixQueryResponse{}
+	err := json.Unmarshal([]byte(f.body), &res)
+	return &res, err
+}
+
+func Test_PrometheusInvocationCounts_InvocationHistory(t *testing.T) {
+	end := time.Unix(1700000300, 0)
+	fetcher := &historyRangeFetcher{
+		body: `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"function_name":"echo.openfaas-fn"},"values":[[1700000120,"2"],[1700000180,"NaN"],[1700000300,"4"]]}]}}`,
+	}
+
+	history, err := PrometheusInvocationCounts{RangeFetcher: fetcher}.InvocationHistory(time.Minute, time.Minute*5, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fetcher.start.Equal(end.Add(-time.Minute*4)) || !fetcher.end.Equal(end) || fetcher.step != time.Minute {
+		t.Errorf("want a query of 5 one minute steps ending at %s, got: %s to %s every %s", end, fetcher.start, fetcher.end, fetcher.step)
+	}
+	if !strings.Contains(fetcher.query, "[60s]") {
+		t.Errorf("want the increase over each step, got: %s", fetcher.query)
+	}
+
+	want := []float64{0, 2, 0, 0, 4}
+	got := history["echo.openfaas-fn"]
+	if len(got) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want: %v, got: %v", want, got)
+		}
+	}
+}
+
+func Test_GatewayInvocationCounts_ReturnsIncrease(t *testing.T) {
+	metricsOptions := BuildMetricsOptions()
+	counter := metricsOptions.GatewayFunctionInvocation
+	source := NewGatewayInvocationCounts(counter)
+
+	counter.WithLabelValues("echo.openfaas-fn", "200").Add(5)
+	if counts, _ := source.InvocationCounts(time.Minute); len(counts) != 0 {
+		t.Fatalf("want the first call to record totals only, got: %v", counts)
+	}
+
+	counter.WithLabelValues("echo.openfaas-fn", "200").Add(2)
+	counter.WithLabelValues("echo.openfaas-fn", "500").Add(1)
+	counter.WithLabelValues("figlet.openfaas-fn", "200").Add(4)
+
+	counts, err := source.InvocationCounts(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := counts["echo.openfaas-fn"]; got != 3 {
+		t.Errorf("echo want: %d, got: %f", 3, got)
+	}
+	if got := counts["figlet.openfaas-fn"]; got != 4 {
+		t.Errorf("figlet want: %d, got: %f", 4, got)
+	}
+}
@@ -6,7 +6,6 @@ package metrics
 import (
 	"net/http"
 	"sync"
-	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -18,15 +17,52 @@ type MetricOptions struct {
 	GatewayFunctionsHistogram        *prometheus.HistogramVec
 	GatewayFunctionInvocationStarted *prometheus.CounterVec
 
+	// GatewayFunctionColdStartHistogram records how long requests waited
+	// for a function to scale from zero
+	GatewayFunctionColdStartHistogram *prometheus.HistogramVec
+
+	// GatewayFunctionColdStartPhaseHistogram records the time taken until
+	// each phase of a cold start, see the ColdStartPhase constants
+	GatewayFunctionColdStartPhaseHistogram *prometheus.HistogramVec
+
 	ServiceReplicasGauge *prometheus.GaugeVec
 
-	// GatewayFunctionRequestHistogram *prometheus.HistogramVec
-	GatewayFunctionRequestSummary *prometheus.SummaryVec
+	// GatewayFunctionCacheHits, GatewayFunctionCacheMisses and
+	// GatewayFunctionCacheEvictions count the lookups and evictions of
+	// each function cache, by the "cache" label
+	GatewayFunctionCacheHits      *prometheus.CounterVec
+	GatewayFunctionCacheMisses    *prometheus.CounterVec
+	GatewayFunctionCacheEvictions *prometheus.CounterVec
+
+	// GatewayFunctionRequestHistogram records the time taken by requests
+	// to each function, with buckets which can be set per function
+	GatewayFunctionRequestHistogram *RequestHistogram
+
 	// 添加cpu和memory的指标
 	PodCpuUsageSecondsTotal  *prometheus.GaugeVec
 	PodMemoryWorkingSetBytes *prometheus.GaugeVec
+
+	// UsageSampleTimestamp is when the CPU and memory of functions were last
+	// sampled from Prometheus, UsageSampleStale is 1 when the last sample failed
+	UsageSampleTimestamp prometheus.Gauge
+	UsageSampleStale     prometheus.Gauge
 }
 
+const (
+	// ColdStartPhaseScaleRequested is when the desired replicas were set
+	ColdStartPhaseScaleRequested = "scale_requested"
+
+	// ColdStartPhaseReplicaAvailable is when a replica became available
+	ColdStartPhaseReplicaAvailable = "replica_available"
+
+	// ColdStartPhaseFirstByte is when the first byte of the response was written
+	ColdStartPhaseFirstByte = "first_byte"
+)
+
+// coldStartBuckets cover a cold start from a pre-pulled image through
+// to a slow image pull
+var coldStartBuckets = []float64{.1, .25, .5, 1, 2, 5, 10, 20, 30, 60, 120}
+
 // ServiceMetricOptions provides RED metrics
 type ServiceMetricOptions struct {
 	Histogram *prometheus.HistogramVec
@@ -84,6 +120,43 @@ func BuildMetricsOptions() MetricOptions {
 		[]string{"function_name"},
 	)
 
+	gatewayFunctionColdStart := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Subsystem: "function",
+		Name:      "cold_start_seconds",
+		Help:      "Time requests waited for a function to scale from zero",
+		Buckets:   coldStartBuckets,
+	}, []string{"function_name"})
+
+	gatewayFunctionColdStartPhase := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Subsystem: "function",
+		Name:      "cold_start_phase_seconds",
+		Help:      "Time taken until each phase of a cold start",
+		Buckets:   coldStartBuckets,
+	}, []string{"function_name", "phase"})
+
+	gatewayFunctionCacheHits := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Subsystem: "function_cache",
+		Name:      "hits_total",
+		Help:      "Lookups which found a fresh entry in a function cache",
+	}, []string{"cache"})
+
+	gatewayFunctionCacheMisses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Subsystem: "function_cache",
+		Name:      "misses_total",
+		Help:      "Lookups which found no entry, or an expired entry, in a function cache",
+	}, []string{"cache"})
+
+	gatewayFunctionCacheEvictions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Subsystem: "function_cache",
+		Name:      "evictions_total",
+		Help:      "Entries removed from a function cache because it was full or they had expired",
+	}, []string{"cache"})
+
 	// 添加如下
 	podCpuUsageSecondsTotal := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -103,18 +176,19 @@ func BuildMetricsOptions() MetricOptions {
 		[]string{"function_name"},
 	)
 
-	//gatewayFunctionRequestHistogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-	//	Name:    "gateway_function_request_seconds",
-	//	Help:    "Function request time taken",
-	//	Buckets: []float64{.5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 15},
-	//}, []string{"function_name"})
-
-	gatewayFunctionRequestSummary := prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Name:       "gateway_function_request_seconds",
-		Help:       "Function request time taken",
-		MaxAge:     3 * time.Minute,
-		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.95: 0.005, 0.99: 0.001},
-	}, []string{"function_name"})
+	usageSampleTimestamp := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Subsystem: "usage",
+		Name:      "sample_timestamp_seconds",
+		Help:      "Time the CPU and memory of functions were last sampled from Prometheus",
+	})
+
+	usageSampleStale := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Subsystem: "usage",
+		Name:      "sample_stale",
+		Help:      "1 when the last sample of CPU and memory failed and older values are reported",
+	})
 
 	metricsOptions := MetricOptions{
 		GatewayFunctionsHistogram:        gatewayFunctionsHistogram,
@@ -122,10 +196,21 @@ func BuildMetricsOptions() MetricOptions {
 		ServiceReplicasGauge:             serviceReplicas,
 		GatewayFunctionInvocationStarted: gatewayFunctionInvocationStarted,
 
+		GatewayFunctionColdStartHistogram:      gatewayFunctionColdStart,
+		GatewayFunctionColdStartPhaseHistogram: gatewayFunctionColdStartPhase,
+
+		GatewayFunctionCacheHits:      gatewayFunctionCacheHits,
+		GatewayFunctionCacheMisses:    gatewayFunctionCacheMisses,
+		GatewayFunctionCacheEvictions: gatewayFunctionCacheEvictions,
+
+		GatewayFunctionRequestHistogram: NewRequestHistogram(DefaultRequestBuckets, 0),
+
 		// 添加如下
-		GatewayFunctionRequestSummary: gatewayFunctionRequestSummary,
-		PodCpuUsageSecondsTotal:       podCpuUsageSecondsTotal,
-		PodMemoryWorkingSetBytes:      podMemoryWorkingSetBytes,
+		PodCpuUsageSecondsTotal:  podCpuUsageSecondsTotal,
+		PodMemoryWorkingSetBytes: podMemoryWorkingSetBytes,
+
+		UsageSampleTimestamp: usageSampleTimestamp,
+		UsageSampleStale:     usageSampleStale,
 	}
 
 	return metricsOptions
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // PrometheusQuery represents parameters for querying Prometheus
@@ -18,6 +20,12 @@ type PrometheusQueryFetcher interface {
 	Fetch(query string) (*VectorQueryResponse, error)
 }
 
+// PrometheusRangeQueryFetcher runs a query, escaped as for Fetch, at each
+// step between start and end
+type PrometheusRangeQueryFetcher interface {
+	FetchRange(query string, start, end time.Time, step time.Duration) (*MatrixQueryResponse, error)
+}
+
 // NewPrometheusQuery create a NewPrometheusQuery
 func NewPrometheusQuery(host string, port int, client *http.Client) PrometheusQuery {
 	return PrometheusQuery{
@@ -63,6 +71,52 @@ func (q PrometheusQuery) Fetch(query string) (*VectorQueryResponse, error) {
 	return &values, nil
 }
 
+// FetchRange queries a range of stats from /api/v1/query_range
+func (q PrometheusQuery) FetchRange(query string, start, end time.Time, step time.Duration) (*MatrixQueryResponse, error) {
+	params := fmt.Sprintf("query=%s&start=%s&end=%s&step=%s", query,
+		formatPrometheusTime(start), formatPrometheusTime(end), strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	req, reqErr := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s:%d/api/v1/query_range?%s", q.Host, q.Port, params), nil)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+
+	res, getErr := q.Client.Do(req)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	bytesOut, readErr := io.ReadAll(res.Body)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status code from Prometheus want: %d, got: %d, body: %s", http.StatusOK, res.StatusCode, string(bytesOut))
+	}
+
+	var values MatrixQueryResponse
+
+	unmarshalErr := json.Unmarshal(bytesOut, &values)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("Error unmarshaling result: %s, '%s'", unmarshalErr, string(bytesOut))
+	}
+
+	if values.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("Unexpected result type from Prometheus want: matrix, got: %q", values.Data.ResultType)
+	}
+
+	return &values, nil
+}
+
+func formatPrometheusTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', 3, 64)
+}
+
 type VectorQueryResponse struct {
 	Data struct {
 		Result []struct {
@@ -78,3 +132,15 @@ type VectorQueryResponse struct {
 		}
 	}
 }
+
+// MatrixQueryResponse is the result of a range query, with a series of
+// [timestamp, "value"] pairs for each set of labels
+type MatrixQueryResponse struct {
+	Data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
@@ -0,0 +1,262 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Names of the queries in QueryTemplates
+const (
+	// QueryInvocations is the total invocations of each function
+	QueryInvocations = "invocations"
+
+	// QueryCPU is the CPU usage of each function's containers as a percentage
+	QueryCPU = "cpu"
+
+	// QueryCPUSeconds is the total CPU seconds used by each function's containers
+	QueryCPUSeconds = "cpu_seconds"
+
+	// QueryCPUIncrease is the CPU seconds used by each function's containers
+	// over Window, counter resets are handled for each container
+	QueryCPUIncrease = "cpu_increase"
+
+	// QueryMemory is the working set in bytes of each function's containers
+	QueryMemory = "memory"
+
+	// QueryLatency is the average response time of each function over
+	// Window, through every replica of the gateway
+	QueryLatency = "latency"
+
+	// QueryColdStartRate is the ratio of cold starts to invocations of each
+	// function over the last hour
+	QueryColdStartRate = "cold_start_rate"
+
+	// QueryColdStartP99 is the 99th percentile cold start of each function
+	// over the last hour
+	QueryColdStartP99 = "cold_start_p99"
+)
+
+// Names of the queries for a single Function in Namespace, run over a range
+// of time by MakeFunctionMetricsHandler
+const (
+	QueryFunctionInvocationRate = "function_invocation_rate"
+	QueryFunctionErrorRate      = "function_error_rate"
+	QueryFunctionLatency        = "function_latency"
+	QueryFunctionReplicas       = "function_replicas"
+	QueryFunctionCPU            = "function_cpu"
+	QueryFunctionMemory         = "function_memory"
+)
+
+// cAdvisor's series are relabelled from ContainerLabel to "container" so
+// that results can be matched to functions whatever the cluster calls it
+var defaultQueries = map[string]string{
+	QueryInvocations: `sum(gateway_function_invocation_total{function_name=~".*.({{.Namespace}})"}) by (function_name)`,
+
+	QueryCPU: `label_replace(sum by({{.ContainerLabel}}, namespace) (irate(container_cpu_usage_seconds_total{image!="",namespace=~"{{.Namespace}}",{{.ContainerLabel}}!="{{.ExcludeContainer}}"}[{{.Window}}])*100), "container", "$1", "{{.ContainerLabel}}", "(.*)")`,
+
+	QueryCPUSeconds: `label_replace(sum by({{.ContainerLabel}}, namespace) (container_cpu_usage_seconds_total{image!="",namespace=~"{{.Namespace}}",{{.ContainerLabel}}!="{{.ExcludeContainer}}"}), "container", "$1", "{{.ContainerLabel}}", "(.*)")`,
+
+	QueryCPUIncrease: `label_replace(sum by({{.ContainerLabel}}, namespace) (increase(container_cpu_usage_seconds_total{image!="",namespace=~"{{.Namespace}}",{{.ContainerLabel}}!="{{.ExcludeContainer}}"}[{{.Window}}])), "container", "$1", "{{.ContainerLabel}}", "(.*)")`,
+
+	QueryMemory: `label_replace(sum by({{.ContainerLabel}}, namespace) (container_memory_working_set_bytes{image!="",namespace=~"{{.Namespace}}",{{.ContainerLabel}}!="{{.ExcludeContainer}}"}), "container", "$1", "{{.ContainerLabel}}", "(.*)")`,
+
+	QueryLatency: `sum by (function_name) (rate(gateway_function_request_seconds_sum{function_name=~".*.({{.Namespace}})"}[{{.Window}}])) / sum by (function_name) (rate(gateway_function_request_seconds_count{function_name=~".*.({{.Namespace}})"}[{{.Window}}]))`,
+
+	QueryColdStartRate: `sum by (function_name) (increase(gateway_function_cold_start_seconds_count[1h])) / sum by (function_name) (increase(gateway_function_invocation_total[1h]))`,
+
+	QueryColdStartP99: `histogram_quantile(0.99, sum by (function_name, le) (rate(gateway_function_cold_start_seconds_bucket[1h])))`,
+
+	QueryFunctionInvocationRate: `sum(rate(gateway_function_invocation_total{function_name="{{.Function}}.{{.Namespace}}"}[{{.Window}}]))`,
+
+	QueryFunctionErrorRate: `sum(rate(gateway_function_invocation_total{function_name="{{.Function}}.{{.Namespace}}",code=~"5.."}[{{.Window}}]))`,
+
+	QueryFunctionLatency: `label_replace(histogram_quantile({{.Quantile}}, sum by (le) (rate(gateway_function_request_seconds_bucket{function_name="{{.Function}}.{{.Namespace}}"}[{{.Window}}]))), "quantile", "{{.Quantile}}", "", "")`,
+
+	QueryFunctionReplicas: `max(gateway_service_count{function_name="{{.Function}}.{{.Namespace}}"})`,
+
+	QueryFunctionCPU: `sum(rate(container_cpu_usage_seconds_total{image!="",namespace="{{.Namespace}}",{{.ContainerLabel}}="{{.Function}}"}[{{.Window}}]))*100`,
+
+	QueryFunctionMemory: `sum(container_memory_working_set_bytes{image!="",namespace="{{.Namespace}}",{{.ContainerLabel}}="{{.Function}}"})`,
+}
+
+// QueryTemplates are the PromQL queries run by the gateway, written as
+// text/template with the fields of QueryVars
+type QueryTemplates struct {
+	// ContainerLabel is cAdvisor's label for the container name, i.e.
+	// "container", or "container_name" on older clusters
+	ContainerLabel string `json:"containerLabel"`
+
+	// ExcludeContainer is the name of the pause container to leave out
+	ExcludeContainer string `json:"excludeContainer"`
+
+	// Window is the range of rates, unless given by the caller
+	Window string `json:"window"`
+
+	// Quantile of the response time for QueryFunctionLatency
+	Quantile float64 `json:"quantile"`
+
+	// Queries overrides or adds templates by name
+	Queries map[string]string `json:"queries"`
+
+	templates map[string]*template.Template
+}
+
+// QueryVars are the variables available to each query template
+type QueryVars struct {
+	// Namespace is a regular expression matching the namespaces queried,
+	// i.e. "openfaas-fn|team-a"
+	Namespace string
+
+	// Function is the name of the function queried, when there is one
+	Function string
+
+	// Window is the range of rates, such as "5m"
+	Window string
+
+	ContainerLabel   string
+	ExcludeContainer string
+	Quantile         string
+}
+
+// DefaultQueryTemplates are the queries for cAdvisor's default labels and
+// the gateway's own metrics
+func DefaultQueryTemplates() *QueryTemplates {
+	q := &QueryTemplates{
+		ContainerLabel:   "container",
+		ExcludeContainer: "POD",
+		Window:           "5m",
+		Quantile:         0.9,
+		Queries:          map[string]string{},
+	}
+
+	if err := q.parse(); err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// LoadQueryTemplates reads QueryTemplates as JSON from path, any field or
+// query which is not given keeps its default
+func LoadQueryTemplates(path string) (*QueryTemplates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read query templates: %s", err)
+	}
+
+	q := DefaultQueryTemplates()
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("unable to parse query templates from %s: %s", path, err)
+	}
+
+	if q.Quantile <= 0 || q.Quantile >= 1 {
+		return nil, fmt.Errorf("quantile must be between 0 and 1, got: %f", q.Quantile)
+	}
+
+	if err := q.parse(); err != nil {
+		return nil, fmt.Errorf("invalid query template in %s: %s", path, err)
+	}
+	return q, nil
+}
+
+// parse compiles the default queries with any given in Queries, and
+// checks that each can be executed
+func (q *QueryTemplates) parse() error {
+	q.templates = map[string]*template.Template{}
+
+	for name, text := range defaultQueries {
+		if override, ok := q.Queries[name]; ok {
+			text = override
+		}
+		if err := q.add(name, text); err != nil {
+			return err
+		}
+	}
+
+	for name, text := range q.Queries {
+		if _, ok := q.templates[name]; !ok {
+			if err := q.add(name, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *QueryTemplates) add(name, text string) error {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(&bytes.Buffer{}, q.vars(QueryVars{Namespace: "openfaas-fn", Function: "echo"})); err != nil {
+		return err
+	}
+
+	q.templates[name] = tmpl
+	return nil
+}
+
+// Query renders the template for name with vars, fields of vars which are
+// not set are filled in from q
+func (q *QueryTemplates) Query(name string, vars QueryVars) (string, error) {
+	tmpl, ok := q.templates[name]
+	if !ok {
+		return "", fmt.Errorf("no query template named %q", name)
+	}
+
+	out := bytes.Buffer{}
+	if err := tmpl.Execute(&out, q.vars(vars)); err != nil {
+		return "", fmt.Errorf("unable to render query %q: %s", name, err)
+	}
+	return out.String(), nil
+}
+
+func (q *QueryTemplates) vars(vars QueryVars) QueryVars {
+	if len(vars.Window) == 0 {
+		vars.Window = q.Window
+	}
+	if len(vars.ContainerLabel) == 0 {
+		vars.ContainerLabel = q.ContainerLabel
+	}
+	if len(vars.ExcludeContainer) == 0 {
+		vars.ExcludeContainer = q.ExcludeContainer
+	}
+	if len(vars.Quantile) == 0 {
+		vars.Quantile = strconv.FormatFloat(q.Quantile, 'f', -1, 64)
+	}
+	return vars
+}
+
+// DefaultFunctionNamespace is queried when no namespace is known
+const DefaultFunctionNamespace = "openfaas-fn"
+
+// NamespacePattern matches any of namespaces in the Namespace of QueryVars,
+// or fallback when namespaces is empty, then DefaultFunctionNamespace
+func NamespacePattern(namespaces []string, fallback string) string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, namespace := range namespaces {
+		if len(namespace) > 0 && !seen[namespace] {
+			seen[namespace] = true
+			unique = append(unique, namespace)
+		}
+	}
+
+	if len(unique) == 0 {
+		if len(fallback) == 0 {
+			return DefaultFunctionNamespace
+		}
+		return fallback
+	}
+	sort.Strings(unique)
+	return strings.Join(unique, "|")
+}
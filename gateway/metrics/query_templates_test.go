@@ -0,0 +1,127 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+)
+
+// recordingQueryFetcher records each query and returns no results
+type recordingQueryFetcher struct {
+	lock    sync.Mutex
+	queries []string
+}
+
+func (r *recordingQueryFetcher) Fetch(query string) (*VectorQueryResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	q, _ := url.QueryUnescape(query)
+	r.queries = append(r.queries, q)
+	return &VectorQueryResponse{}, nil
+}
+
+func writeQueryTemplates(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "queries.json")
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_DefaultQueryTemplates_RendersNamespaces(t *testing.T) {
+	q, err := DefaultQueryTemplates().Query(QueryMemory, QueryVars{Namespace: NamespacePattern([]string{"team-b", "openfaas-fn", "team-b"}, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `label_replace(sum by(container, namespace) (container_memory_working_set_bytes{image!="",namespace=~"openfaas-fn|team-b",container!="POD"}), "container", "$1", "container", "(.*)")`
+	if q != want {
+		t.Fatalf("want: %s\ngot: %s", want, q)
+	}
+}
+
+func Test_LoadQueryTemplates_OverridesDefaults(t *testing.T) {
+	path := writeQueryTemplates(t, `{
+		"containerLabel": "container_name",
+		"quantile": 0.5,
+		"queries": {
+			"errors": "sum by (function_name) (rate(gateway_function_invocation_total{code=~\"5..\",function_name=\"{{.Function}}.{{.Namespace}}\"}[{{.Window}}]))"
+		}
+	}`)
+
+	templates, err := LoadQueryTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu, _ := templates.Query(QueryCPU, QueryVars{Namespace: "openfaas-fn"})
+	if !strings.Contains(cpu, `container_name!="POD"`) || !strings.Contains(cpu, `"container", "$1", "container_name"`) {
+		t.Errorf("want the container label replaced, got: %s", cpu)
+	}
+
+	latency, _ := templates.Query(QueryFunctionLatency, QueryVars{Namespace: "openfaas-fn", Function: "echo"})
+	if !strings.Contains(latency, `histogram_quantile(0.5,`) {
+		t.Errorf("want the quantile from the file, got: %s", latency)
+	}
+
+	errors, err := templates.Query("errors", QueryVars{Namespace: "dev", Function: "echo", Window: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errors, `function_name="echo.dev"}[1m]`) {
+		t.Errorf("want the custom query rendered, got: %s", errors)
+	}
+}
+
+func Test_LoadQueryTemplates_Invalid(t *testing.T) {
+	for _, body := range []string{
+		`not json`,
+		`{"quantile": 2}`,
+		`{"queries": {"cpu": "{{.Missing}}"}}`,
+		`{"queries": {"cpu": "{{.Namespace"}}`,
+	} {
+		if _, err := LoadQueryTemplates(writeQueryTemplates(t, body)); err == nil {
+			t.Errorf("%s, want an error", body)
+		}
+	}
+}
+
+func Test_AddMetricsHandler_QueriesEachNamespace(t *testing.T) {
+	functionsHandler := func(w http.ResponseWriter, r *http.Request) {
+		functions := []types.FunctionStatus{
+			{Name: "echo", Namespace: "openfaas-fn"},
+			{Name: "figlet", Namespace: "team-a"},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}
+
+	fetcher := &recordingQueryFetcher{}
+	handler := AddMetricsHandler(functionsHandler, fetcher, DefaultQueryTemplates(), "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/system/functions", nil))
+
+	if len(fetcher.queries) == 0 {
+		t.Fatalf("want Prometheus queried")
+	}
+	for _, q := range fetcher.queries[:3] {
+		if !strings.Contains(q, "openfaas-fn|team-a") {
+			t.Errorf("want both namespaces queried, got: %s", q)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestBucketsAnnotation overrides the buckets of a function's request
+// histogram, as upper bounds in seconds separated by commas, i.e.
+// "0.1,0.5,1,5,30"
+const RequestBucketsAnnotation = "com.openfaas.metrics.request-buckets"
+
+// DefaultRequestBuckets are the upper bounds in seconds of the request
+// histogram for functions without RequestBucketsAnnotation
+var DefaultRequestBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// AnnotationQuery returns the annotations of a function
+type AnnotationQuery interface {
+	GetAnnotations(name string, namespace string) (annotations map[string]string, err error)
+}
+
+// RequestHistogram records the time taken by requests to each function
+// as gateway_function_request_seconds. Functions share the default
+// buckets, unless given their own by RequestBucketsAnnotation, so unlike
+// a summary the histogram can be aggregated across replicas of the gateway.
+//
+// The buckets of a function are looked up once in the background when it
+// is first observed, and again by Refresh, so that recording a request
+// never waits on the provider.
+type RequestHistogram struct {
+	// Annotations looks up RequestBucketsAnnotation, when nil every
+	// function has the default buckets
+	Annotations AnnotationQuery
+
+	opts prometheus.HistogramOpts
+	desc *prometheus.Desc
+
+	// vecs holds a histogram for each set of buckets in use, by bucketsKey
+	vecs map[string]*prometheus.HistogramVec
+
+	// functions holds the buckets of each function observed
+	functions map[string]requestBuckets
+	lock      sync.RWMutex
+}
+
+// requestBuckets are the buckets a function is recorded with, and their
+// bucketsKey
+type requestBuckets struct {
+	buckets []float64
+	key     string
+}
+
+// NewRequestHistogram creates a RequestHistogram with buckets as the
+// default. Native histograms are also recorded when nativeBucketFactor is
+// greater than 1, with each bucket at most that factor wider than the last.
+func NewRequestHistogram(buckets []float64, nativeBucketFactor float64) *RequestHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultRequestBuckets
+	}
+
+	opts := prometheus.HistogramOpts{
+		Namespace:                   "gateway",
+		Subsystem:                   "function",
+		Name:                        "request_seconds",
+		Help:                        "Function request time taken",
+		Buckets:                     buckets,
+		NativeHistogramBucketFactor: nativeBucketFactor,
+	}
+
+	return &RequestHistogram{
+		opts:      opts,
+		desc:      prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, []string{"function_name"}, nil),
+		vecs:      map[string]*prometheus.HistogramVec{},
+		functions: map[string]requestBuckets{},
+	}
+}
+
+// Observe records a request to serviceName, of the form "name.namespace",
+// which took seconds. A function observed for the first time is recorded
+// with the default buckets until its own have been looked up.
+func (h *RequestHistogram) Observe(serviceName string, seconds float64) {
+	h.lock.RLock()
+	function, ok := h.functions[serviceName]
+	vec := h.vecs[function.key]
+	h.lock.RUnlock()
+
+	if !ok {
+		var added bool
+		if vec, added = h.add(serviceName); added && h.Annotations != nil {
+			go h.resolve(serviceName)
+		}
+	}
+
+	vec.WithLabelValues(serviceName).Observe(seconds)
+}
+
+// Start refreshes the buckets of the functions observed on every interval
+func (h *RequestHistogram) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			h.Refresh()
+		}
+	}()
+}
+
+// Refresh looks up the buckets of every function observed, so that
+// changes to RequestBucketsAnnotation are picked up
+func (h *RequestHistogram) Refresh() {
+	if h.Annotations == nil {
+		return
+	}
+
+	h.lock.RLock()
+	serviceNames := make([]string, 0, len(h.functions))
+	for serviceName := range h.functions {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	h.lock.RUnlock()
+
+	for _, serviceName := range serviceNames {
+		h.resolve(serviceName)
+	}
+}
+
+// resolve looks up the buckets of serviceName, it keeps the buckets it
+// has when the annotations can't be read
+func (h *RequestHistogram) resolve(serviceName string) {
+	functionName, namespace := middleware.GetNamespace("", serviceName)
+	annotations, err := h.Annotations.GetAnnotations(functionName, namespace)
+	if err != nil {
+		return
+	}
+
+	buckets := h.opts.Buckets
+	if value, ok := annotations[RequestBucketsAnnotation]; ok {
+		if buckets, err = ParseBuckets(value); err != nil {
+			log.Printf("Provided annotation %s=%s for %s is invalid: %s", RequestBucketsAnnotation, value, serviceName, err)
+			buckets = h.opts.Buckets
+		}
+	}
+
+	h.setBuckets(serviceName, buckets)
+}
+
+// add records serviceName with the default buckets, unless it has been
+// added already, and returns its histogram
+func (h *RequestHistogram) add(serviceName string) (*prometheus.HistogramVec, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if function, ok := h.functions[serviceName]; ok {
+		return h.vecs[function.key], false
+	}
+	return h.setBucketsLocked(serviceName, h.opts.Buckets), true
+}
+
+// setBuckets moves serviceName to the histogram with buckets
+func (h *RequestHistogram) setBuckets(serviceName string, buckets []float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.setBucketsLocked(serviceName, buckets)
+}
+
+// setBucketsLocked returns the histogram with buckets, and removes
+// serviceName from any histogram with the buckets it had before, must be
+// called with the lock held
+func (h *RequestHistogram) setBucketsLocked(serviceName string, buckets []float64) *prometheus.HistogramVec {
+	key := bucketsKey(buckets)
+
+	vec, ok := h.vecs[key]
+	if !ok {
+		opts := h.opts
+		opts.Buckets = buckets
+		vec = prometheus.NewHistogramVec(opts, []string{"function_name"})
+		h.vecs[key] = vec
+	}
+
+	// A function is only exported with one set of buckets, so its series
+	// starts again when they change
+	if previous, ok := h.functions[serviceName]; ok && previous.key != key {
+		h.vecs[previous.key].DeleteLabelValues(serviceName)
+	}
+	h.functions[serviceName] = requestBuckets{buckets: buckets, key: key}
+
+	return vec
+}
+
+// Describe sends the description of gateway_function_request_seconds
+func (h *RequestHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+// Collect sends the histogram of each function
+func (h *RequestHistogram) Collect(ch chan<- prometheus.Metric) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for _, vec := range h.vecs {
+		vec.Collect(ch)
+	}
+}
+
+// ParseBuckets parses upper bounds in seconds separated by commas, which
+// must be positive, and returns them in order
+func ParseBuckets(value string) ([]float64, error) {
+	buckets := []float64{}
+	seen := map[float64]bool{}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		bound, err := strconv.ParseFloat(part, 64)
+		if err != nil || bound <= 0 {
+			return nil, fmt.Errorf("bucket must be a positive number of seconds, got: %q", part)
+		}
+		if !seen[bound] {
+			seen[bound] = true
+			buckets = append(buckets, bound)
+		}
+	}
+
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no buckets in %q", value)
+	}
+	sort.Float64s(buckets)
+	return buckets, nil
+}
+
+func bucketsKey(buckets []float64) string {
+	parts := make([]string, len(buckets))
+	for i, bound := range buckets {
+		parts[i] = strconv.FormatFloat(bound, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
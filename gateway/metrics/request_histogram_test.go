@@ -0,0 +1,232 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type fakeAnnotationQuery map[string]map[string]string
+
+func (f fakeAnnotationQuery) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	annotations, ok := f[name+"."+namespace]
+	if !ok {
+		return nil, fmt.Errorf("function %s.%s not found", name, namespace)
+	}
+	return annotations, nil
+}
+
+// lockedAnnotationQuery can be changed while the histogram looks it up
+// in the background, and fails while err is set
+type lockedAnnotationQuery struct {
+	annotations map[string]string
+	err         error
+	calls       int
+	lock        sync.Mutex
+}
+
+func (l *lockedAnnotationQuery) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.calls++
+	return l.annotations, l.err
+}
+
+func (l *lockedAnnotationQuery) set(annotations map[string]string, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.annotations = annotations
+	l.err = err
+}
+
+// gatherHistograms returns the histogram of each function from h
+func gatherHistograms(t *testing.T, h *RequestHistogram) map[string]*dto.Histogram {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(h); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	histograms := map[string]*dto.Histogram{}
+	for _, family := range families {
+		if family.GetName() != "gateway_function_request_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			histograms[labels2Map(m.GetLabel())["function_name"]] = m.GetHistogram()
+		}
+	}
+	return histograms
+}
+
+func bounds(h *dto.Histogram) []float64 {
+	values := []float64{}
+	for _, b := range h.GetBucket() {
+		values = append(values, b.GetUpperBound())
+	}
+	return values
+}
+
+func Test_RequestHistogram_BucketsFromAnnotation(t *testing.T) {
+	h := NewRequestHistogram([]float64{1, 10}, 0)
+	h.Annotations = fakeAnnotationQuery{
+		"slow.openfaas-fn":  {RequestBucketsAnnotation: "30, 5,60"},
+		"fast.openfaas-fn":  {},
+		"wrong.openfaas-fn": {RequestBucketsAnnotation: "soon"},
+	}
+
+	// The first requests are recorded before the buckets are looked up
+	h.Observe("slow.openfaas-fn", 20)
+	h.Observe("fast.openfaas-fn", 0.5)
+	h.Observe("wrong.openfaas-fn", 0.5)
+	h.Observe("unknown.openfaas-fn", 0.5)
+	h.Refresh()
+
+	h.Observe("slow.openfaas-fn", 20)
+	h.Observe("fast.openfaas-fn", 1.5)
+
+	histograms := gatherHistograms(t, h)
+	if len(histograms) != 4 {
+		t.Fatalf("want a histogram for 4 functions, got: %d", len(histograms))
+	}
+
+	slow := histograms["slow.openfaas-fn"]
+	if got := fmt.Sprint(bounds(slow)); got != "[5 30 60]" {
+		t.Errorf("want buckets from the annotation, got: %s", got)
+	}
+	if slow.GetSampleCount() != 1 {
+		t.Errorf("want the histogram started again with the new buckets, got a count of: %d", slow.GetSampleCount())
+	}
+	for _, name := range []string{"fast.openfaas-fn", "wrong.openfaas-fn", "unknown.openfaas-fn"} {
+		if got := fmt.Sprint(bounds(histograms[name])); got != "[1 10]" {
+			t.Errorf("%s, want the default buckets, got: %s", name, got)
+		}
+	}
+
+	fast := histograms["fast.openfaas-fn"]
+	if fast.GetSampleCount() != 2 || fast.GetSampleSum() != 2 {
+		t.Errorf("want a count of 2 and sum of 2, got: %d %f", fast.GetSampleCount(), fast.GetSampleSum())
+	}
+}
+
+func Test_RequestHistogram_BucketsChange(t *testing.T) {
+	annotations := &lockedAnnotationQuery{annotations: map[string]string{}}
+	h := NewRequestHistogram([]float64{1, 10}, 0)
+	h.Annotations = annotations
+
+	h.Observe("echo.openfaas-fn", 0.5)
+	annotations.set(map[string]string{RequestBucketsAnnotation: "0.1,0.2"}, nil)
+	h.Refresh()
+	h.Observe("echo.openfaas-fn", 0.15)
+
+	histograms := gatherHistograms(t, h)
+	echo := histograms["echo.openfaas-fn"]
+	if got := fmt.Sprint(bounds(echo)); got != "[0.1 0.2]" {
+		t.Errorf("want the new buckets, got: %s", got)
+	}
+	if echo.GetSampleCount() != 1 {
+		t.Errorf("want the histogram started again, got a count of: %d", echo.GetSampleCount())
+	}
+}
+
+func Test_RequestHistogram_ProviderUnavailableKeepsBuckets(t *testing.T) {
+	annotations := &lockedAnnotationQuery{annotations: map[string]string{RequestBucketsAnnotation: "0.1,0.2"}}
+	h := NewRequestHistogram([]float64{1, 10}, 0)
+	h.Annotations = annotations
+
+	h.Observe("echo.openfaas-fn", 0.15)
+	h.Refresh()
+
+	annotations.set(nil, fmt.Errorf("provider unavailable"))
+	h.Refresh()
+	h.Observe("echo.openfaas-fn", 0.15)
+
+	echo := gatherHistograms(t, h)["echo.openfaas-fn"]
+	if got := fmt.Sprint(bounds(echo)); got != "[0.1 0.2]" {
+		t.Errorf("want the buckets kept, got: %s", got)
+	}
+	if echo.GetSampleCount() != 1 {
+		t.Errorf("want the histogram kept, got a count of: %d", echo.GetSampleCount())
+	}
+}
+
+func Test_RequestHistogram_ObserveDoesNotWaitOnProvider(t *testing.T) {
+	annotations := &lockedAnnotationQuery{annotations: map[string]string{}}
+	h := NewRequestHistogram([]float64{1, 10}, 0)
+	h.Annotations = annotations
+
+	// Hold the lookup in the background until every request is recorded
+	annotations.lock.Lock()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			h.Observe("echo.openfaas-fn", 0.5)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want Observe to return without waiting on the provider")
+	}
+	annotations.lock.Unlock()
+
+	h.Refresh()
+
+	annotations.lock.Lock()
+	calls := annotations.calls
+	annotations.lock.Unlock()
+	if calls > 2 {
+		t.Errorf("want the buckets looked up once and on refresh, got: %d calls", calls)
+	}
+
+	echo := gatherHistograms(t, h)["echo.openfaas-fn"]
+	if echo.GetSampleCount() != 100 {
+		t.Errorf("want a count of 100, got: %d", echo.GetSampleCount())
+	}
+}
+
+func Test_RequestHistogram_Native(t *testing.T) {
+	h := NewRequestHistogram(nil, 1.1)
+	h.Observe("echo.openfaas-fn", 0.3)
+
+	echo := gatherHistograms(t, h)["echo.openfaas-fn"]
+	if echo.GetSchema() == 0 && echo.GetZeroThreshold() == 0 {
+		t.Errorf("want a native histogram, got: %v", echo)
+	}
+	if got := len(echo.GetBucket()); got != len(DefaultRequestBuckets) {
+		t.Errorf("want the default classic buckets too, got: %d", got)
+	}
+}
+
+func Test_ParseBuckets(t *testing.T) {
+	buckets, err := ParseBuckets("5, 0.5,1,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(buckets); got != "[0.5 1 5]" {
+		t.Errorf("want sorted unique buckets, got: %s", got)
+	}
+
+	for _, value := range []string{"", "1,-2", "0", "fast"} {
+		if _, err := ParseBuckets(value); err == nil {
+			t.Errorf("%q, want an error", value)
+		}
+	}
+}
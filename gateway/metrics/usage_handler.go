@@ -0,0 +1,129 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// defaultUsageRange is reported when no from is given
+const defaultUsageRange = time.Hour * 24
+
+// UsageResponse holds the usage of each function, or namespace, between
+// From and To. Totals are kept in windows of WindowSeconds, so include
+// the whole of any window which overlaps the range.
+type UsageResponse struct {
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	GroupBy       string        `json:"groupBy"`
+	WindowSeconds float64       `json:"windowSeconds"`
+	Usage         []UsageTotals `json:"usage"`
+}
+
+// MakeUsageHandler reports the usage recorded by accountant for the query
+// parameters from, to and groupBy of "function" or "namespace". from and
+// to are RFC3339 or seconds since the epoch, and default to the last day.
+// The report is CSV for format=csv or an Accept header of text/csv.
+func MakeUsageHandler(accountant *UsageAccountant) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		from, to, err := parseUsageRange(query, time.Now())
+		if err != nil {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{Code: types.ErrorCodeBadRequest, Message: err.Error()})
+			return
+		}
+
+		groupBy := query.Get("groupBy")
+		if len(groupBy) == 0 {
+			groupBy = "function"
+		}
+		if groupBy != "function" && groupBy != "namespace" {
+			types.WriteError(w, r, http.StatusBadRequest, types.ErrorResponse{
+				Code:    types.ErrorCodeBadRequest,
+				Message: fmt.Sprintf("groupBy must be function or namespace, got: %s", groupBy),
+			})
+			return
+		}
+
+		res := UsageResponse{
+			From:          from,
+			To:            to,
+			GroupBy:       groupBy,
+			WindowSeconds: accountant.Window.Seconds(),
+			Usage:         accountant.Usage(from, to, groupBy == "namespace"),
+		}
+
+		if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			w.Header().Set("Content-Type", "text/csv")
+			w.WriteHeader(http.StatusOK)
+			writeUsageCSV(w, res)
+			return
+		}
+
+		bytesOut, _ := json.Marshal(res)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytesOut)
+	}
+}
+
+// writeUsageCSV writes a header row, then a row for each function or namespace
+func writeUsageCSV(w io.Writer, res UsageResponse) {
+	out := csv.NewWriter(w)
+
+	header := []string{"namespace"}
+	if res.GroupBy == "function" {
+		header = append(header, "function")
+	}
+	out.Write(append(header, "invocations", "cpu_seconds", "memory_gb_seconds",
+		"replica_seconds", "busy_replica_seconds", "idle_replica_seconds", "idle_memory_gb_seconds", "stale_seconds"))
+
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	for _, u := range res.Usage {
+		row := []string{u.Namespace}
+		if res.GroupBy == "function" {
+			row = append(row, u.Function)
+		}
+		out.Write(append(row, format(u.Invocations), format(u.CPUSeconds), format(u.MemoryGBSeconds),
+			format(u.ReplicaSeconds), format(u.BusyReplicaSeconds), format(u.IdleReplicaSeconds), format(u.IdleMemoryGBSeconds), format(u.StaleSeconds)))
+	}
+	out.Flush()
+}
+
+// parseUsageRange reads from and to, with defaults relative to now
+func parseUsageRange(query url.Values, now time.Time) (from, to time.Time, err error) {
+	to = now
+	if val := query.Get("to"); len(val) > 0 {
+		if to, err = parseMetricsTime(val); err != nil {
+			return from, to, fmt.Errorf("invalid value for to: %s", val)
+		}
+	}
+
+	from = to.Add(-defaultUsageRange)
+	if val := query.Get("from"); len(val) > 0 {
+		if from, err = parseMetricsTime(val); err != nil {
+			return from, to, fmt.Errorf("invalid value for from: %s", val)
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
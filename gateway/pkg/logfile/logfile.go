@@ -0,0 +1,207 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package logfile writes logs to a file which is rotated when it grows
+// too large or old, keeping a number of the files rotated.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is added to the path of a rotated file, it sorts in
+// the order the files were rotated
+const backupTimeFormat = "20060102T150405.000"
+
+// File is an io.WriteCloser for a file which is rotated by renaming it
+// with the time, then opening a new file at the same path
+type File struct {
+	// Path of the file being written
+	Path string
+
+	// MaxSize in bytes before the file is rotated, no limit when 0
+	MaxSize int64
+
+	// MaxAge of the file before it is rotated, no limit when 0
+	MaxAge time.Duration
+
+	// MaxBackups is the number of rotated files kept, all are kept when 0
+	MaxBackups int
+
+	file    *os.File
+	size    int64
+	opened  time.Time
+	closed  bool
+	lock    sync.Mutex
+	nowFunc func() time.Time
+}
+
+// Open opens or creates the file at path to append to
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	f := &File{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+		nowFunc:    time.Now,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends data to the file, rotating it first when data would take
+// it over MaxSize or it is older than MaxAge. Each write goes to a single
+// file, so a line written at once is never split between files.
+//
+// When the file can't be rotated, data is still appended to it and the
+// error is returned, the rotation is tried again on the next write.
+func (f *File) Write(data []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	// The file is not open when it could not be opened again after the
+	// last rotation
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	var rotateErr error
+	if f.shouldRotate(int64(len(data))) {
+		rotateErr = f.rotate()
+		if f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Close closes the file, later writes fail
+func (f *File) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.MaxSize > 0 && f.size+next > f.MaxSize {
+		return true
+	}
+	return f.MaxAge > 0 && f.nowFunc().Sub(f.opened) >= f.MaxAge
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	// A file which already existed is as old as when it was last changed,
+	// the nearest to its creation which is available
+	f.opened = f.nowFunc()
+	if f.size > 0 {
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+// rotate renames the file and opens a new one at Path. The file at Path
+// is opened again when it could not be renamed, so that writes carry on.
+func (f *File) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+
+	if err == nil {
+		backup := fmt.Sprintf("%s.%s", f.Path, f.nowFunc().UTC().Format(backupTimeFormat))
+		err = os.Rename(f.Path, backup)
+	}
+
+	if openErr := f.open(); openErr != nil {
+		if err == nil {
+			err = openErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune removes the oldest rotated files over MaxBackups
+func (f *File) prune() error {
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > f.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Backups returns the paths of the rotated files, oldest first
+func (f *File) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	prefix := len(f.Path) + 1
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeFormat, match[prefix:]); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
@@ -0,0 +1,194 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func Test_File_RotatesOnSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := Open(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.nowFunc = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("want 2 rotated files, got: %v", backups)
+	}
+	if got := readFile(t, backups[0]); got != "first\n" {
+		t.Errorf("want the first line in the oldest file, got: %q", got)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("want the last line in the current file, got: %q", got)
+	}
+}
+
+func Test_File_RotatesOnAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f, err := Open(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.nowFunc = func() time.Time { return now }
+	f.opened = now
+
+	f.Write([]byte("old\n"))
+	now = now.Add(time.Minute * 59)
+	f.Write([]byte("recent\n"))
+
+	if backups, _ := f.Backups(); len(backups) != 0 {
+		t.Fatalf("want no rotation within an hour, got: %v", backups)
+	}
+
+	now = now.Add(time.Minute)
+	f.Write([]byte("new\n"))
+
+	backups, _ := f.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("want 1 rotated file, got: %v", backups)
+	}
+	if got := readFile(t, backups[0]); got != "old\nrecent\n" {
+		t.Errorf("want the lines before rotation, got: %q", got)
+	}
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("want the line after rotation, got: %q", got)
+	}
+}
+
+func Test_File_KeepsMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	// Files which were not rotated by File are never removed
+	other := filepath.Join(dir, "access.log.keep")
+	if err := os.WriteFile(other, []byte("keep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path, 1, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.nowFunc = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n", "5\n"} {
+		f.Write([]byte(line))
+	}
+
+	backups, _ := f.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("want 2 rotated files, got: %v", backups)
+	}
+	if got := readFile(t, backups[0]); got != "3\n" {
+		t.Errorf("want the oldest files removed, got: %q", got)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("want other files kept, got: %s", err)
+	}
+}
+
+func Test_File_AppendsToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+	f.Close()
+
+	if got := readFile(t, path); got != "before\nafter\n" {
+		t.Errorf("want the file appended to, got: %q", got)
+	}
+	if _, err := f.Write([]byte("closed\n")); err == nil {
+		t.Errorf("want an error writing after Close")
+	}
+}
+
+func Test_File_KeepsWritingWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := Open(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.nowFunc = func() time.Time { return now }
+
+	// A directory in place of the rotated file makes the rename fail
+	backup := path + "." + now.Format(backupTimeFormat)
+	if err := os.MkdirAll(filepath.Join(backup, "taken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Errorf("want the failed rotation returned")
+	}
+	if got := readFile(t, path); got != "first\nsecond\n" {
+		t.Errorf("want lines kept in the current file, got: %q", got)
+	}
+
+	if err := os.RemoveAll(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("want the rotation tried again, got: %s", err)
+	}
+
+	if got := readFile(t, backup); got != "first\nsecond\n" {
+		t.Errorf("want the earlier lines rotated, got: %q", got)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("want the last line in the current file, got: %q", got)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package tracing
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter sends spans which have ended to a tracing backend
+type Exporter interface {
+	ExportSpans(spans []SpanData) error
+}
+
+// InMemoryExporter keeps every span exported, for tests
+type InMemoryExporter struct {
+	spans []SpanData
+	lock  sync.Mutex
+}
+
+// NewInMemoryExporter creates an empty InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpans keeps spans
+func (e *InMemoryExporter) ExportSpans(spans []SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Span returns the first span exported with name, and whether there was one
+func (e *InMemoryExporter) Span(name string) (SpanData, bool) {
+	for _, span := range e.Spans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return SpanData{}, false
+}
+
+// BatchExporter queues spans, and sends them to Exporter in batches on
+// every interval, so that requests never wait on the tracing backend. When
+// the queue is full, spans are dropped, and the number dropped is logged
+// once per interval.
+type BatchExporter struct {
+	Exporter Exporter
+
+	queue    chan SpanData
+	maxBatch int
+	dropped  uint64
+
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewBatchExporter creates a BatchExporter which queues up to maxQueue
+// spans, and sends them to exporter every interval
+func NewBatchExporter(exporter Exporter, interval time.Duration, maxQueue int) *BatchExporter {
+	b := &BatchExporter{
+		Exporter: exporter,
+		queue:    make(chan SpanData, maxQueue),
+		maxBatch: 512,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	go b.run(interval)
+	return b
+}
+
+// ExportSpans queues spans to be sent, spans are dropped once the queue is
+// full or the exporter has been shut down
+func (b *BatchExporter) ExportSpans(spans []SpanData) error {
+	for _, span := range spans {
+		select {
+		case <-b.done:
+			atomic.AddUint64(&b.dropped, 1)
+			continue
+		default:
+		}
+
+		select {
+		case b.queue <- span:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// Shutdown sends the spans queued so far, and stops sending on every
+// interval. It returns the error of ctx if it is done first.
+func (b *BatchExporter) Shutdown(ctx context.Context) error {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BatchExporter) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(b.stopped)
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.done:
+			b.flush()
+			return
+		}
+	}
+}
+
+// flush sends every queued span, and logs the spans dropped since the
+// last flush
+func (b *BatchExporter) flush() {
+	if dropped := atomic.SwapUint64(&b.dropped, 0); dropped > 0 {
+		log.Printf("Tracing queue is full, dropped %d span(s)", dropped)
+	}
+
+	for len(b.queue) > 0 {
+		batch := make([]SpanData, 0, b.maxBatch)
+		for len(batch) < b.maxBatch && len(b.queue) > 0 {
+			batch = append(batch, <-b.queue)
+		}
+
+		if err := b.Exporter.ExportSpans(batch); err != nil {
+			log.Printf("Error exporting %d span(s): %s", len(batch), err)
+		}
+	}
+}
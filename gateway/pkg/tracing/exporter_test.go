@@ -0,0 +1,60 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package tracing
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_BatchExporter_ShutdownSendsQueuedSpans(t *testing.T) {
+	inner := NewInMemoryExporter()
+	exporter := NewBatchExporter(inner, time.Hour, 10)
+
+	exporter.ExportSpans([]SpanData{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if spans := inner.Spans(); len(spans) != 3 {
+		t.Fatalf("want 3 spans sent on shutdown, got: %d", len(spans))
+	}
+
+	// Spans ended after shutdown are dropped
+	exporter.ExportSpans([]SpanData{{Name: "d"}})
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if spans := inner.Spans(); len(spans) != 3 {
+		t.Fatalf("want no spans sent after shutdown, got: %d", len(spans))
+	}
+}
+
+func Test_BatchExporter_CountsDroppedSpans(t *testing.T) {
+	inner := NewInMemoryExporter()
+	exporter := NewBatchExporter(inner, time.Hour, 1)
+
+	exporter.ExportSpans([]SpanData{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	if got := atomic.LoadUint64(&exporter.dropped); got != 2 {
+		t.Fatalf("want 2 spans dropped from a full queue, got: %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if spans := inner.Spans(); len(spans) != 1 || spans[0].Name != "a" {
+		t.Fatalf("want the queued span sent, got: %+v", spans)
+	}
+	if got := atomic.LoadUint64(&exporter.dropped); got != 0 {
+		t.Fatalf("want the dropped count reset once logged, got: %d", got)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_NewOTLPExporter_Endpoint(t *testing.T) {
+	cases := map[string]string{
+		"http://otel-collector:4318":             "http://otel-collector:4318/v1/traces",
+		"http://otel-collector:4318/":            "http://otel-collector:4318/v1/traces",
+		"https://traces.example.com/custom/otlp": "https://traces.example.com/custom/otlp",
+	}
+
+	for endpoint, want := range cases {
+		e, err := NewOTLPExporter(endpoint, "gateway", http.DefaultClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Endpoint != want {
+			t.Errorf("want: %s, got: %s", want, e.Endpoint)
+		}
+	}
+
+	for _, endpoint := range []string{"", "otel-collector:4318", "http://"} {
+		if _, err := NewOTLPExporter(endpoint, "gateway", http.DefaultClient); err == nil {
+			t.Errorf("%q, want an error", endpoint)
+		}
+	}
+}
+
+func Test_OTLPExporter_ExportSpans(t *testing.T) {
+	var got otlpRequest
+	var path string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("want JSON, got: %s", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	e, err := NewOTLPExporter(s.URL, "gateway", s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := NewInMemoryExporter()
+	tracer := NewTracer(memory, 1)
+	ctx, parent := tracer.Start(context.Background(), "gateway.invoke", SpanKindServer)
+	_, child := tracer.Start(ctx, "gateway.scale", SpanKindInternal)
+	child.SetAttribute("faas.name", "echo")
+	child.SetAttribute("faas.coldstart", true)
+	child.SetAttribute("http.status_code", 502)
+	child.RecordError(errors.New("no endpoints"))
+	child.End()
+	parent.End()
+
+	if err := e.ExportSpans(memory.Spans()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("want /v1/traces, got: %s", path)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("want one resource and scope, got: %+v", got)
+	}
+	if v := got.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; v == nil || *v != "gateway" {
+		t.Errorf("want service.name of gateway, got: %v", v)
+	}
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got: %d", len(spans))
+	}
+
+	scale, invoke := spans[0], spans[1]
+	if scale.Name != "gateway.scale" || scale.ParentSpanID != invoke.SpanID || scale.TraceID != invoke.TraceID {
+		t.Errorf("want gateway.scale as a child of gateway.invoke, got: %+v", scale)
+	}
+	if len(invoke.ParentSpanID) > 0 {
+		t.Errorf("want no parent for the root span, got: %s", invoke.ParentSpanID)
+	}
+	if scale.Status.Code != 2 || scale.Status.Message != "no endpoints" {
+		t.Errorf("want an error status, got: %+v", scale.Status)
+	}
+	if invoke.Kind != SpanKindServer {
+		t.Errorf("want a server span, got: %d", invoke.Kind)
+	}
+
+	values := map[string]otlpValue{}
+	for _, a := range scale.Attributes {
+		values[a.Key] = a.Value
+	}
+	if v := values["faas.name"].StringValue; v == nil || *v != "echo" {
+		t.Errorf("want faas.name as a string, got: %+v", values["faas.name"])
+	}
+	if v := values["faas.coldstart"].BoolValue; v == nil || !*v {
+		t.Errorf("want faas.coldstart as a bool, got: %+v", values["faas.coldstart"])
+	}
+	if v := values["http.status_code"].IntValue; v == nil || *v != "502" {
+		t.Errorf("want http.status_code as an int, got: %+v", values["http.status_code"])
+	}
+}
+
+func Test_OTLPExporter_ExportSpans_ErrorStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	e, err := NewOTLPExporter(s.URL, "gateway", s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ExportSpans([]SpanData{}); err == nil {
+		t.Fatal("want an error")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanKind is the role of a span in a trace, with the values used by OTLP
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+)
+
+// Attribute is a key and a string, bool, int64 or float64 value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is a span which has ended
+type SpanData struct {
+	Name    string
+	Kind    SpanKind
+	Context SpanContext
+
+	// Parent is the zero SpanContext for the root span of a trace
+	Parent SpanContext
+
+	Start time.Time
+	End   time.Time
+
+	Attributes []Attribute
+
+	// Error is the message of the error which failed the span, if any
+	Error string
+}
+
+// Attribute returns the value of the attribute key, or nil
+func (d SpanData) Attribute(key string) interface{} {
+	for _, a := range d.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// Span is an operation within a trace, started by Start
+type Span struct {
+	tracer    *Tracer
+	recording bool
+
+	data  SpanData
+	ended bool
+	lock  sync.Mutex
+}
+
+// Context returns the trace and ID of the span
+func (s *Span) Context() SpanContext {
+	return s.data.Context
+}
+
+// SetAttribute records value for key on the span, value is a string,
+// bool, int, int64, uint64 or float64
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.recording {
+		return
+	}
+
+	switch v := value.(type) {
+	case int:
+		value = int64(v)
+	case uint64:
+		value = int64(v)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, a := range s.data.Attributes {
+		if a.Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// RecordError marks the span as failed with err, when err is not nil
+func (s *Span) RecordError(err error) {
+	if !s.recording || err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End ends the span and exports it if it was sampled, later calls do nothing
+func (s *Span) End() {
+	if !s.recording {
+		return
+	}
+
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.lock.Unlock()
+
+	s.tracer.Exporter.ExportSpans([]SpanData{data})
+}
@@ -0,0 +1,235 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package tracing records spans for requests through the gateway, and
+// propagates them to functions and the provider with the W3C traceparent
+// header. Spans are exported over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceParentHeader carries the trace and parent span of a request, see
+// https://www.w3.org/TR/trace-context/
+const TraceParentHeader = "traceparent"
+
+// TraceID identifies every span of a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext is the part of a span which is propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid is true when neither the trace nor span ID is all zeros
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != TraceID{} && c.SpanID != SpanID{}
+}
+
+// TraceParent formats c as the value of a traceparent header
+func (c SpanContext) TraceParent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", c.TraceID, c.SpanID, flags)
+}
+
+// ParseTraceParent parses the value of a traceparent header, of the form
+// "00-<trace-id>-<parent-id>-<flags>"
+func ParseTraceParent(value string) (SpanContext, error) {
+	c := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, fmt.Errorf("invalid traceparent: %q", value)
+	}
+
+	// Later versions may add fields, but version 00 has exactly four
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return c, fmt.Errorf("invalid traceparent: %q", value)
+	}
+
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return c, fmt.Errorf("invalid trace-id in traceparent: %q", value)
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return c, fmt.Errorf("invalid parent-id in traceparent: %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return c, fmt.Errorf("invalid flags in traceparent: %q", value)
+	}
+	if !c.IsValid() {
+		return c, fmt.Errorf("invalid traceparent: %q", value)
+	}
+
+	c.Sampled = flags[0]&1 == 1
+	return c, nil
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// SpanFromContext returns the span started in ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Extract adds the parent from the traceparent header to ctx, unless a
+// span has already been started in ctx or the header is invalid
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if SpanFromContext(ctx) != nil {
+		return ctx
+	}
+
+	value := header.Get(TraceParentHeader)
+	if len(value) == 0 {
+		return ctx
+	}
+
+	parent, err := ParseTraceParent(value)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey, parent)
+}
+
+// Inject sets the traceparent header to the span started in ctx, so that
+// it becomes the parent of spans in the service called
+func Inject(ctx context.Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil && span.data.Context.IsValid() {
+		header.Set(TraceParentHeader, span.data.Context.TraceParent())
+	}
+}
+
+// Tracer starts spans, and exports those which are sampled
+type Tracer struct {
+	// Exporter is sent each sampled span when it ends, spans are not
+	// recorded when nil
+	Exporter Exporter
+
+	// SampleRatio is the fraction of new traces which are sampled, traces
+	// continued from a traceparent keep the sampling decision of the caller
+	SampleRatio float64
+}
+
+// NewTracer creates a Tracer which samples sampleRatio of new traces
+// and sends them to exporter
+func NewTracer(exporter Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{Exporter: exporter, SampleRatio: sampleRatio}
+}
+
+var (
+	defaultTracer = NewTracer(nil, 1)
+	tracerLock    sync.RWMutex
+)
+
+// SetTracer sets the Tracer used by Start
+func SetTracer(t *Tracer) {
+	tracerLock.Lock()
+	defer tracerLock.Unlock()
+	defaultTracer = t
+}
+
+// DefaultTracer returns the Tracer used by Start, which records nothing
+// until SetTracer is called
+func DefaultTracer() *Tracer {
+	tracerLock.RLock()
+	defer tracerLock.RUnlock()
+	return defaultTracer
+}
+
+// Start starts a span named name with the default Tracer
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return DefaultTracer().Start(ctx, name, kind)
+}
+
+// Start starts a span named name, as a child of the span in ctx, or of the
+// parent added by Extract. The span is ended by calling End.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.data.Context
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		parent = remote
+	}
+
+	c := SpanContext{TraceID: parent.TraceID}
+	if !parent.IsValid() {
+		c.TraceID = newTraceID()
+	}
+	c.SpanID = newSpanID()
+
+	if parent.IsValid() {
+		c.Sampled = parent.Sampled
+	} else {
+		c.Sampled = t.sample(c.TraceID)
+	}
+
+	span := &Span{
+		tracer:    t,
+		recording: c.Sampled && t.Exporter != nil,
+		data: SpanData{
+			Name:    name,
+			Kind:    kind,
+			Context: c,
+			Parent:  parent,
+			Start:   time.Now(),
+		},
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// sample decides from the trace ID alone, so every service with the same
+// ratio makes the same decision for a trace
+func (t *Tracer) sample(traceID TraceID) bool {
+	switch {
+	case t.SampleRatio >= 1:
+		return true
+	case t.SampleRatio <= 0:
+		return false
+	}
+
+	bound := uint64(t.SampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
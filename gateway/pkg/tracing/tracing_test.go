@@ -0,0 +1,158 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func Test_ParseTraceParent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	c, err := ParseTraceParent(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want the trace-id, got: %s", c.TraceID)
+	}
+	if c.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("want the parent-id, got: %s", c.SpanID)
+	}
+	if !c.Sampled {
+		t.Errorf("want sampled")
+	}
+	if got := c.TraceParent(); got != value {
+		t.Errorf("want: %s, got: %s", value, got)
+	}
+}
+
+func Test_ParseTraceParent_Invalid(t *testing.T) {
+	values := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, value := range values {
+		if _, err := ParseTraceParent(value); err == nil {
+			t.Errorf("%q, want an error", value)
+		}
+	}
+}
+
+func Test_Start_ContinuesTraceFromHeader(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, 0)
+
+	header := http.Header{}
+	header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, parent := tracer.Start(Extract(context.Background(), header), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.SetAttribute("faas.name", "echo")
+	child.RecordError(errors.New("timeout"))
+	child.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, sampled by the caller, got: %d", len(spans))
+	}
+
+	p, _ := exporter.Span("parent")
+	c, _ := exporter.Span("child")
+	if p.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || c.Context.TraceID != p.Context.TraceID {
+		t.Errorf("want the trace from the header, got: %s and %s", p.Context.TraceID, c.Context.TraceID)
+	}
+	if p.Parent.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("want the caller as parent, got: %s", p.Parent.SpanID)
+	}
+	if c.Parent.SpanID != p.Context.SpanID {
+		t.Errorf("want the child of %s, got: %s", p.Context.SpanID, c.Parent.SpanID)
+	}
+	if c.Attribute("faas.name") != "echo" || c.Error != "timeout" {
+		t.Errorf("want the attribute and error, got: %v %q", c.Attributes, c.Error)
+	}
+}
+
+func Test_Start_NotSampledFromHeader(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, 1)
+
+	header := http.Header{}
+	header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	ctx, span := tracer.Start(Extract(context.Background(), header), "parent", SpanKindServer)
+	span.End()
+
+	if got := len(exporter.Spans()); got != 0 {
+		t.Errorf("want no spans when the caller did not sample, got: %d", got)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	c, err := ParseTraceParent(out.Get(TraceParentHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Sampled || c.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want the trace propagated unsampled, got: %s", c.TraceParent())
+	}
+}
+
+func Test_Start_SampleRatio(t *testing.T) {
+	for _, ratio := range []float64{0, 1} {
+		exporter := NewInMemoryExporter()
+		tracer := NewTracer(exporter, ratio)
+
+		for i := 0; i < 10; i++ {
+			_, span := tracer.Start(context.Background(), "root", SpanKindServer)
+			span.End()
+		}
+
+		want := int(ratio * 10)
+		if got := len(exporter.Spans()); got != want {
+			t.Errorf("ratio %v, want %d spans, got: %d", ratio, want, got)
+		}
+	}
+
+	sampled := 0
+	tracer := NewTracer(nil, 0.5)
+	for i := 0; i < 1000; i++ {
+		if tracer.sample(newTraceID()) {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("want around half of traces sampled, got: %d of 1000", sampled)
+	}
+}
+
+func Test_Inject_NoSpan(t *testing.T) {
+	header := http.Header{}
+	Inject(context.Background(), header)
+
+	if got := header.Get(TraceParentHeader); len(got) > 0 {
+		t.Errorf("want no traceparent, got: %s", got)
+	}
+}
+
+func Test_Span_EndTwice(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	_, span := NewTracer(exporter, 1).Start(context.Background(), "once", SpanKindInternal)
+	span.End()
+	span.End()
+
+	if got := len(exporter.Spans()); got != 1 {
+		t.Errorf("want 1 span, got: %d", got)
+	}
+}
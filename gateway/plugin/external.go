@@ -5,18 +5,22 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	types "github.com/openfaas/faas-provider/types"
 	middleware "github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/scaling"
 )
 
@@ -28,6 +32,43 @@ type ExternalServiceQuery struct {
 
 	// IncludeUsage includes usage metrics in the response
 	IncludeUsage bool
+
+	// NotFound caches functions for which the provider returned a 404,
+	// so that requests for functions which don't exist are not all
+	// passed on to the provider. Nil or a zero Expiry disables it.
+	NotFound *scaling.FunctionCache
+
+	watch *watchSupport
+}
+
+const (
+	// DefaultNotFoundExpiry is how long a 404 from the provider is cached for
+	DefaultNotFoundExpiry = time.Second * 5
+
+	// DefaultNotFoundMaxEntries bounds the number of 404s cached
+	DefaultNotFoundMaxEntries = 10000
+)
+
+// WatchHeader is set to "true" by providers which support watching a
+// function's replicas through a long-poll on /system/function/{name}
+const WatchHeader = "X-Openfaas-Watch"
+
+// watchReprobeInterval is how long to wait before asking a provider
+// without watch support to watch again
+const watchReprobeInterval = time.Minute
+
+// watchSupport records when the provider last ignored a watch
+type watchSupport struct {
+	unsupportedAt int64
+}
+
+func (w *watchSupport) supported() bool {
+	unsupportedAt := atomic.LoadInt64(&w.unsupportedAt)
+	return unsupportedAt == 0 || time.Since(time.Unix(0, unsupportedAt)) > watchReprobeInterval
+}
+
+func (w *watchSupport) unsupported() {
+	atomic.StoreInt64(&w.unsupportedAt, time.Now().UnixNano())
 }
 
 // NewExternalServiceQuery proxies service queries to external plugin via HTTP
@@ -53,11 +94,13 @@ func NewExternalServiceQuery(externalURL url.URL, authInjector middleware.AuthIn
 		ProxyClient:  proxyClient,
 		AuthInjector: authInjector,
 		IncludeUsage: false,
+		NotFound:     scaling.NewBoundedFunctionCache(DefaultNotFoundExpiry, DefaultNotFoundMaxEntries, nil),
+		watch:        &watchSupport{},
 	}
 }
 
 // GetReplicas replica count for function
-func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string) (scaling.ServiceQueryResponse, error) {
+func (s ExternalServiceQuery) GetReplicas(ctx context.Context, serviceName, serviceNamespace string) (scaling.ServiceQueryResponse, error) {
 	start := time.Now()
 
 	var err error
@@ -65,13 +108,19 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 
 	function := types.FunctionStatus{}
 
+	if s.cachesNotFound() {
+		if _, hit := s.NotFound.Get(serviceName, serviceNamespace); hit {
+			return emptyServiceQueryResponse, fmt.Errorf("%w: %s.%s, cached", scaling.ErrFunctionNotFound, serviceName, serviceNamespace)
+		}
+	}
+
 	urlPath := fmt.Sprintf("%ssystem/function/%s?namespace=%s&usage=%v",
 		s.URL.String(),
 		serviceName,
 		serviceNamespace,
 		s.IncludeUsage)
 	log.Printf(urlPath)
-	req, err := http.NewRequest(http.MethodGet, urlPath, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
 	if err != nil {
 		return emptyServiceQueryResponse, err
 	}
@@ -80,7 +129,7 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 		s.AuthInjector.Inject(req)
 	}
 
-	res, err := s.ProxyClient.Do(req)
+	res, err := s.do(req, "provider.GetReplicas")
 	if err != nil {
 		log.Println(urlPath, err)
 		return emptyServiceQueryResponse, err
@@ -101,11 +150,189 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 
 		// log.Printf("GetReplicas [%s.%s] took: %fs", serviceName, serviceNamespace, time.Since(start).Seconds())
 
+	} else if res.StatusCode == http.StatusNotFound {
+		log.Printf("GetReplicas [%s.%s] took: %.4fs, code: %d\n", serviceName, serviceNamespace, time.Since(start).Seconds(), res.StatusCode)
+
+		if s.cachesNotFound() {
+			s.NotFound.Set(serviceName, serviceNamespace, emptyServiceQueryResponse)
+		}
+		return emptyServiceQueryResponse, fmt.Errorf("%w: %s.%s, body: %s", scaling.ErrFunctionNotFound, serviceName, serviceNamespace, string(bytesOut))
 	} else {
 		log.Printf("GetReplicas [%s.%s] took: %.4fs, code: %d\n", serviceName, serviceNamespace, time.Since(start).Seconds(), res.StatusCode)
 		return emptyServiceQueryResponse, fmt.Errorf("server returned non-200 status code (%d) for function, %s, body: %s", res.StatusCode, serviceName, string(bytesOut))
 	}
 
+	return toServiceQueryResponse(function)
+}
+
+// ListFunctions lists the functions deployed in namespace, or the
+// provider's default namespace when empty
+func (s ExternalServiceQuery) ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	urlPath := fmt.Sprintf("%ssystem/functions", s.URL.String())
+	if len(namespace) > 0 {
+		urlPath += "?namespace=" + url.QueryEscape(namespace)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.AuthInjector != nil {
+		s.AuthInjector.Inject(req)
+	}
+
+	res, err := s.do(req, "provider.ListFunctions")
+	if err != nil {
+		log.Println(urlPath, err)
+		return nil, err
+	}
+
+	var bytesOut []byte
+	if res.Body != nil {
+		bytesOut, _ = io.ReadAll(res.Body)
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned non-200 status code (%d) listing functions in %s, body: %s", res.StatusCode, namespace, string(bytesOut))
+	}
+
+	functions := []types.FunctionStatus{}
+	if err := json.Unmarshal(bytesOut, &functions); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal: %q, %s", string(bytesOut), err)
+	}
+	return functions, nil
+}
+
+// ListNamespaces returns the namespaces functions can be deployed to, or
+// none when the provider does not support namespaces
+func (s ExternalServiceQuery) ListNamespaces(ctx context.Context) ([]string, error) {
+	urlPath := fmt.Sprintf("%ssystem/namespaces", s.URL.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.AuthInjector != nil {
+		s.AuthInjector.Inject(req)
+	}
+
+	res, err := s.do(req, "provider.ListNamespaces")
+	if err != nil {
+		log.Println(urlPath, err)
+		return nil, err
+	}
+
+	var bytesOut []byte
+	if res.Body != nil {
+		bytesOut, _ = io.ReadAll(res.Body)
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned non-200 status code (%d) listing namespaces, body: %s", res.StatusCode, string(bytesOut))
+	}
+
+	namespaces := []string{}
+	if err := json.Unmarshal(bytesOut, &namespaces); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal: %q, %s", string(bytesOut), err)
+	}
+	return namespaces, nil
+}
+
+func (s ExternalServiceQuery) cachesNotFound() bool {
+	return s.NotFound != nil && s.NotFound.Expiry > 0
+}
+
+// WatchReplicas long-polls the provider until the function has an available
+// replica, or timeout passes. Providers which support watching hold the
+// request open and reply with the X-Openfaas-Watch header, the response from
+// any other provider is returned immediately and ErrWatchNotSupported is
+// returned until the provider is probed again.
+func (s ExternalServiceQuery) WatchReplicas(ctx context.Context, serviceName, serviceNamespace string, timeout time.Duration) (scaling.ServiceQueryResponse, error) {
+	var emptyServiceQueryResponse scaling.ServiceQueryResponse
+
+	if s.watch != nil && !s.watch.supported() {
+		return emptyServiceQueryResponse, scaling.ErrWatchNotSupported
+	}
+
+	function := types.FunctionStatus{}
+
+	urlPath := fmt.Sprintf("%ssystem/function/%s?namespace=%s&usage=%v&watch=available&timeout=%d",
+		s.URL.String(),
+		serviceName,
+		serviceNamespace,
+		s.IncludeUsage,
+		int(math.Ceil(timeout.Seconds())))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return emptyServiceQueryResponse, err
+	}
+
+	if s.AuthInjector != nil {
+		s.AuthInjector.Inject(req)
+	}
+
+	res, err := s.do(req, "provider.WatchReplicas")
+	if err != nil {
+		log.Println(urlPath, err)
+		return emptyServiceQueryResponse, err
+	}
+
+	var bytesOut []byte
+	if res.Body != nil {
+		bytesOut, _ = io.ReadAll(res.Body)
+		defer res.Body.Close()
+	}
+
+	if res.Header.Get(WatchHeader) != "true" {
+		if s.watch != nil {
+			s.watch.unsupported()
+		}
+		return emptyServiceQueryResponse, scaling.ErrWatchNotSupported
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return emptyServiceQueryResponse, fmt.Errorf("server returned non-200 status code (%d) for function, %s, body: %s", res.StatusCode, serviceName, string(bytesOut))
+	}
+
+	if err := json.Unmarshal(bytesOut, &function); err != nil {
+		log.Printf("Unable to unmarshal: %q, %s", string(bytesOut), err)
+		return emptyServiceQueryResponse, err
+	}
+
+	return toServiceQueryResponse(function)
+}
+
+// do sends req to the provider in a span named name, with the span as
+// the parent of any spans recorded by the provider
+func (s ExternalServiceQuery) do(req *http.Request, name string) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), name, tracing.SpanKindClient)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, req.Header)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Path)
+
+	res, err := s.ProxyClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return res, err
+	}
+
+	span.SetAttribute("http.status_code", res.StatusCode)
+	return res, nil
+}
+
+// toServiceQueryResponse reads the scaling labels of a function
+func toServiceQueryResponse(function types.FunctionStatus) (scaling.ServiceQueryResponse, error) {
 	minReplicas := uint64(scaling.DefaultMinReplicas)
 	maxReplicas := uint64(scaling.DefaultMaxReplicas)
 	scalingFactor := uint64(scaling.DefaultScalingFactor)
@@ -132,11 +359,11 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 		ScalingFactor:     scalingFactor,
 		AvailableReplicas: availableReplicas,
 		Annotations:       function.Annotations,
-	}, err
+	}, nil
 }
 
 // SetReplicas update the replica count
-func (s ExternalServiceQuery) SetReplicas(serviceName, serviceNamespace string, count uint64) error {
+func (s ExternalServiceQuery) SetReplicas(ctx context.Context, serviceName, serviceNamespace string, count uint64) error {
 	var err error
 
 	scaleReq := types.ScaleServiceRequest{
@@ -151,21 +378,21 @@ func (s ExternalServiceQuery) SetReplicas(serviceName, serviceNamespace string,
 
 	start := time.Now()
 	urlPath := fmt.Sprintf("%ssystem/scale-function/%s?namespace=%s", s.URL.String(), serviceName, serviceNamespace)
-	req, _ := http.NewRequest(http.MethodPost, urlPath, bytes.NewReader(requestBody))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, urlPath, bytes.NewReader(requestBody))
 
 	if s.AuthInjector != nil {
 		s.AuthInjector.Inject(req)
 	}
 
 	defer req.Body.Close()
-	res, err := s.ProxyClient.Do(req)
+	res, err := s.do(req, "provider.SetReplicas")
 
 	if err != nil {
 		log.Println(urlPath, err)
-	} else {
-		if res.Body != nil {
-			defer res.Body.Close()
-		}
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
 	}
 
 	if !(res.StatusCode == http.StatusOK || res.StatusCode == http.StatusAccepted) {
@@ -1,13 +1,17 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	middleware "github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/scaling"
 )
 
@@ -52,7 +56,7 @@ func TestGetReplicasNonExistentFn(t *testing.T) {
 
 	esq := NewExternalServiceQuery(*url, injector)
 
-	svcQryResp, err := esq.GetReplicas("figlet", "")
+	svcQryResp, err := esq.GetReplicas(context.Background(), "figlet", "")
 
 	if err == nil {
 		t.Logf("Error was nil, expected non-nil - the service query response value was %+v ", svcQryResp)
@@ -82,7 +86,7 @@ func TestGetReplicasExistentFn(t *testing.T) {
 
 	esq := NewExternalServiceQuery(*url, injector)
 
-	svcQryResp, err := esq.GetReplicas("figlet", "")
+	svcQryResp, err := esq.GetReplicas(context.Background(), "figlet", "")
 
 	if err != nil {
 		t.Logf("Expected err to be nil got: %s ", err.Error())
@@ -106,7 +110,7 @@ func TestSetReplicasNonExistentFn(t *testing.T) {
 	url, _ := url.Parse(testServer.URL + "/")
 	esq := NewExternalServiceQuery(*url, injector)
 
-	err := esq.SetReplicas("figlet", "", 1)
+	err := esq.SetReplicas(context.Background(), "figlet", "", 1)
 
 	expectedErrStr := "error scaling HTTP code 500"
 
@@ -129,10 +133,270 @@ func TestSetReplicasExistentFn(t *testing.T) {
 	url, _ := url.Parse(testServer.URL + "/")
 	esq := NewExternalServiceQuery(*url, injector)
 
-	err := esq.SetReplicas("figlet", "", 1)
+	err := esq.SetReplicas(context.Background(), "figlet", "", 1)
 
 	if err != nil {
 		t.Logf("Expected err to be nil got: %s ", err.Error())
 		t.Fail()
 	}
 }
+
+func TestSetReplicasProviderUnreachable(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	url, _ := url.Parse(testServer.URL + "/")
+	testServer.Close()
+
+	var injector middleware.AuthInjector
+	esq := NewExternalServiceQuery(*url, injector)
+
+	err := esq.SetReplicas(context.Background(), "figlet", "", 1)
+	if err == nil {
+		t.Fatal("want an error when the provider cannot be reached")
+	}
+}
+
+func TestSetReplicasCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			cancel()
+			<-release
+		}))
+	defer testServer.Close()
+	defer close(release)
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector)
+
+	err := esq.SetReplicas(ctx, "figlet", "", 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want: %s, got: %v", context.Canceled, err)
+	}
+}
+
+func TestWatchReplicasSupported(t *testing.T) {
+
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Get("watch") == "" || req.URL.Query().Get("timeout") != "5" {
+				t.Errorf("want a watch with a 5s timeout, got: %s", req.URL.RawQuery)
+			}
+			res.Header().Set(WatchHeader, "true")
+			res.WriteHeader(http.StatusOK)
+			res.Write([]byte(`{"name":"figlet","replicas":1,"availableReplicas":1}`))
+		}))
+	defer testServer.Close()
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector).(scaling.ReadinessWatcher)
+
+	svcQryResp, err := esq.WatchReplicas(context.Background(), "figlet", "", time.Second*5)
+	if err != nil {
+		t.Fatalf("Expected err to be nil got: %s ", err.Error())
+	}
+	if svcQryResp.AvailableReplicas != 1 {
+		t.Fatalf("Expected 1 available replica, got: %d", svcQryResp.AvailableReplicas)
+	}
+}
+
+func TestWatchReplicasNotSupported(t *testing.T) {
+	requests := 0
+
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests++
+			res.WriteHeader(http.StatusOK)
+			res.Write([]byte(`{"name":"figlet","replicas":1,"availableReplicas":0}`))
+		}))
+	defer testServer.Close()
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector).(scaling.ReadinessWatcher)
+
+	for i := 0; i < 2; i++ {
+		if _, err := esq.WatchReplicas(context.Background(), "figlet", "", time.Second); err != scaling.ErrWatchNotSupported {
+			t.Fatalf("Expected %s, got: %v", scaling.ErrWatchNotSupported, err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected the provider to be probed once, got: %d requests", requests)
+	}
+}
+
+func TestGetReplicasCachesNotFound(t *testing.T) {
+	requests := 0
+
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests++
+			res.WriteHeader(http.StatusNotFound)
+		}))
+	defer testServer.Close()
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector)
+
+	for i := 0; i < 3; i++ {
+		if _, err := esq.GetReplicas(context.Background(), "xyz", "openfaas-fn"); !errors.Is(err, scaling.ErrFunctionNotFound) {
+			t.Fatalf("Expected %s, got: %v", scaling.ErrFunctionNotFound, err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected the provider to be called once, got: %d requests", requests)
+	}
+
+	// A different namespace is not cached
+	esq.GetReplicas(context.Background(), "xyz", "dev")
+	if requests != 2 {
+		t.Fatalf("Expected the provider to be called for another namespace, got: %d requests", requests)
+	}
+}
+
+func TestGetReplicasNotFoundCacheDisabled(t *testing.T) {
+	requests := 0
+
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests++
+			res.WriteHeader(http.StatusNotFound)
+		}))
+	defer testServer.Close()
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector).(ExternalServiceQuery)
+	esq.NotFound.Expiry = 0
+
+	esq.GetReplicas(context.Background(), "xyz", "openfaas-fn")
+	esq.GetReplicas(context.Background(), "xyz", "openfaas-fn")
+
+	if requests != 2 {
+		t.Fatalf("Expected the provider to be called every time, got: %d requests", requests)
+	}
+}
+
+func TestGetReplicasCancelled(t *testing.T) {
+	released := make(chan struct{})
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			<-released
+		}))
+	defer testServer.Close()
+	defer close(released)
+
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	start := time.Now()
+	_, err := esq.GetReplicas(ctx, "figlet", "")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want: %s, got: %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("want the request to stop at the deadline, took: %s", time.Since(start))
+	}
+}
+
+func TestListFunctions(t *testing.T) {
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/system/functions" || req.URL.Query().Get("namespace") != "dev" {
+				res.WriteHeader(http.StatusNotFound)
+				return
+			}
+			res.Write([]byte(`[{"name":"figlet","namespace":"dev","labels":{"team":"ml"}}]`))
+		}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL + "/")
+	lister := NewExternalServiceQuery(*url, nil).(scaling.FunctionLister)
+
+	functions, err := lister.ListFunctions(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) != 1 || functions[0].Name != "figlet" || (*functions[0].Labels)["team"] != "ml" {
+		t.Errorf("unexpected functions: %+v", functions)
+	}
+
+	if _, err := lister.ListFunctions(context.Background(), "prod"); err == nil {
+		t.Errorf("want an error for a non-200 response")
+	}
+}
+
+func TestListNamespaces(t *testing.T) {
+	supported := true
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/system/namespaces" || !supported {
+				res.WriteHeader(http.StatusNotFound)
+				return
+			}
+			res.Write([]byte(`["openfaas-fn","team-a"]`))
+		}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL + "/")
+	lister := NewExternalServiceQuery(*url, nil).(scaling.NamespaceLister)
+
+	namespaces, err := lister.ListNamespaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 2 || namespaces[1] != "team-a" {
+		t.Errorf("unexpected namespaces: %v", namespaces)
+	}
+
+	supported = false
+	if namespaces, err := lister.ListNamespaces(context.Background()); err != nil || len(namespaces) != 0 {
+		t.Errorf("want no namespaces from a provider without them, got: %v, %v", namespaces, err)
+	}
+}
+
+func TestGetReplicasPropagatesTraceParent(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	defer tracing.SetTracer(tracing.DefaultTracer())
+	tracing.SetTracer(tracing.NewTracer(exporter, 1))
+
+	var traceParent string
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			traceParent = req.Header.Get(tracing.TraceParentHeader)
+			res.WriteHeader(http.StatusOK)
+			res.Write([]byte(`{"json":"body"}`))
+		}))
+	defer testServer.Close()
+
+	var injector middleware.AuthInjector
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, injector)
+
+	ctx, parent := tracing.Start(context.Background(), "gateway.scale", tracing.SpanKindInternal)
+	if _, err := esq.GetReplicas(ctx, "figlet", ""); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	span, ok := exporter.Span("provider.GetReplicas")
+	if !ok {
+		t.Fatalf("want a provider.GetReplicas span, got: %v", exporter.Spans())
+	}
+	if span.Parent.SpanID != parent.Context().SpanID {
+		t.Errorf("want the child of gateway.scale, got parent: %s", span.Parent.SpanID)
+	}
+	if traceParent != span.Context.TraceParent() {
+		t.Errorf("want traceparent sent to the provider: %s, got: %s", span.Context.TraceParent(), traceParent)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ActivatorCapacityAnnotation overrides the number of requests which
+	// can be parked for a function while it scales from zero
+	ActivatorCapacityAnnotation = "com.openfaas.activator.capacity"
+
+	// ActivatorTimeoutAnnotation overrides how long a request can be
+	// parked for a function while it scales from zero, i.e. "30s"
+	ActivatorTimeoutAnnotation = "com.openfaas.activator.timeout"
+)
+
+var (
+	// ErrActivatorFull is returned when the queue for a function is at capacity
+	ErrActivatorFull = errors.New("too many requests waiting for function to scale from zero")
+
+	// ErrActivatorTimeout is returned when a request's wait deadline passes
+	// before the function has an available replica
+	ErrActivatorTimeout = errors.New("timed out waiting for function to scale from zero")
+)
+
+// Activator parks requests in a bounded queue per function while it
+// scales from zero. A single goroutine per function waits on the
+// FunctionScaler and then releases the parked requests in order.
+// Requests to a function which turns out to have an available replica
+// are let through without counting against the queue's capacity.
+type Activator struct {
+	Scaler *FunctionScaler
+
+	// DefaultCapacity is the number of requests which can be parked
+	// per function, unless set by the ActivatorCapacityAnnotation
+	DefaultCapacity int
+
+	// DefaultTimeout is how long a request can be parked, unless set
+	// by the ActivatorTimeoutAnnotation
+	DefaultTimeout time.Duration
+
+	queues map[string]*activatorQueue
+	lock   sync.Mutex
+}
+
+type activatorQueue struct {
+	capacity int
+	timeout  time.Duration
+	waiters  []*activatorWaiter
+
+	// cancel stops the scale up once no requests are left waiting on it
+	cancel context.CancelFunc
+
+	// probed is closed once the provider has been queried, and warm is
+	// then true if the function already had an available replica
+	probed chan struct{}
+	warm   bool
+}
+
+// isWarm is true once the provider has been queried and the function
+// had an available replica, must be called with the lock held
+func (q *activatorQueue) isWarm() bool {
+	select {
+	case <-q.probed:
+		return q.warm
+	default:
+		return false
+	}
+}
+
+type activatorWaiter struct {
+	ready chan FunctionScaleResult
+}
+
+// NewActivator creates an Activator for scaler with the queue capacity
+// and wait deadline from config
+func NewActivator(scaler *FunctionScaler, config ScalingConfig) *Activator {
+	return &Activator{
+		Scaler:          scaler,
+		DefaultCapacity: int(config.ActivatorCapacity),
+		DefaultTimeout:  config.ActivatorTimeout,
+		queues:          make(map[string]*activatorQueue),
+	}
+}
+
+// Activate returns once the function has an available replica, the
+// scale up fails, or the request could not be parked or waited for
+// longer than the wait deadline. When ctx is done first, its error is
+// returned, and the scale up is cancelled if no other request is waiting.
+func (a *Activator) Activate(ctx context.Context, functionName, namespace string) (FunctionScaleResult, error) {
+	start := time.Now()
+
+	if cachedResponse, hit := a.Scaler.Cache.Get(functionName, namespace); hit &&
+		cachedResponse.AvailableReplicas > 0 {
+		return FunctionScaleResult{
+			Available: true,
+			Found:     true,
+			Duration:  time.Since(start),
+		}, nil
+	}
+
+	key := functionName + "." + namespace
+	waiter := &activatorWaiter{ready: make(chan FunctionScaleResult, 1)}
+
+	a.lock.Lock()
+	queue, active := a.queues[key]
+	if !active {
+		queue = a.newQueue(functionName, namespace)
+		a.queues[key] = queue
+
+		// The scale up is shared by every parked request, so it outlives
+		// the request which started it
+		var scaleCtx context.Context
+		scaleCtx, queue.cancel = context.WithCancel(withoutCancel{ctx})
+
+		go a.scale(scaleCtx, functionName, namespace, queue)
+	}
+
+	if queue.isWarm() {
+		a.lock.Unlock()
+		return FunctionScaleResult{Available: true, Found: true, Duration: time.Since(start)}, nil
+	}
+
+	if len(queue.waiters) >= queue.capacity {
+		a.lock.Unlock()
+		return a.overCapacity(ctx, queue, start)
+	}
+	queue.waiters = append(queue.waiters, waiter)
+	timeout := queue.timeout
+	a.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-waiter.ready:
+		res.Duration = time.Since(start)
+		if res.ColdStart && res.Available {
+			res.Ready = res.Duration
+		}
+		return res, nil
+	case <-timer.C:
+		a.remove(key, queue, waiter)
+		return FunctionScaleResult{Found: true, Duration: time.Since(start), ColdStart: true}, ErrActivatorTimeout
+	case <-ctx.Done():
+		a.remove(key, queue, waiter)
+		return FunctionScaleResult{Found: true, Duration: time.Since(start), ColdStart: true}, ctx.Err()
+	}
+}
+
+// overCapacity lets a request through when the provider says the function
+// has an available replica, so that only requests which would wait on a
+// cold start are rejected once the queue is full
+func (a *Activator) overCapacity(ctx context.Context, queue *activatorQueue, start time.Time) (FunctionScaleResult, error) {
+	timer := time.NewTimer(queue.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-queue.probed:
+	case <-timer.C:
+		return FunctionScaleResult{Found: true, Duration: time.Since(start)}, ErrActivatorFull
+	case <-ctx.Done():
+		return FunctionScaleResult{Found: true, Duration: time.Since(start)}, ctx.Err()
+	}
+
+	a.lock.Lock()
+	warm := queue.isWarm()
+	a.lock.Unlock()
+
+	if warm {
+		return FunctionScaleResult{Available: true, Found: true, Duration: time.Since(start)}, nil
+	}
+	return FunctionScaleResult{Found: true, Duration: time.Since(start)}, ErrActivatorFull
+}
+
+// newQueue reads the capacity and timeout for the function from the
+// last known annotations in the cache, must be called with the lock held
+func (a *Activator) newQueue(functionName, namespace string) *activatorQueue {
+	queue := &activatorQueue{
+		capacity: a.DefaultCapacity,
+		timeout:  a.DefaultTimeout,
+		probed:   make(chan struct{}),
+	}
+
+	if cachedResponse, _ := a.Scaler.Cache.Get(functionName, namespace); cachedResponse.Annotations != nil {
+		annotations := *cachedResponse.Annotations
+
+		if val, ok := annotations[ActivatorCapacityAnnotation]; ok {
+			if capacity, err := strconv.Atoi(val); err == nil && capacity >= 0 {
+				queue.capacity = capacity
+			} else {
+				log.Printf("Provided annotation %s=%s should be of type uint", ActivatorCapacityAnnotation, val)
+			}
+		}
+		queue.timeout = parseDurationAnnotation(annotations, ActivatorTimeoutAnnotation, queue.timeout)
+	}
+
+	// The request which starts the scale up is always parked, since
+	// the function may turn out to have an available replica.
+	if queue.capacity < 1 {
+		queue.capacity = 1
+	}
+
+	return queue
+}
+
+// scale queries the provider to find out if the function is already warm,
+// then waits on the FunctionScaler, and releases every parked request in
+// the order it arrived
+func (a *Activator) scale(ctx context.Context, functionName, namespace string, queue *activatorQueue) {
+	queryResponse, err := a.Scaler.Query(ctx, functionName, namespace)
+
+	a.lock.Lock()
+	queue.warm = err == nil && queryResponse.AvailableReplicas > 0
+	close(queue.probed)
+	a.lock.Unlock()
+
+	// Scale answers from the cache for a warm function
+	res := a.Scaler.Scale(ctx, functionName, namespace)
+	queue.cancel()
+
+	key := functionName + "." + namespace
+
+	a.lock.Lock()
+	if a.queues[key] == queue {
+		delete(a.queues, key)
+	}
+	waiters := queue.waiters
+	queue.waiters = nil
+	a.lock.Unlock()
+
+	for _, waiter := range waiters {
+		waiter.ready <- res
+	}
+}
+
+// remove stops waiter from being released, the last waiter to leave
+// cancels the scale up, and later requests start a new one
+func (a *Activator) remove(key string, queue *activatorQueue, waiter *activatorWaiter) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for i, w := range queue.waiters {
+		if w == waiter {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue.waiters) == 0 {
+		if a.queues[key] == queue {
+			delete(a.queues, key)
+		}
+		queue.cancel()
+	}
+}
+
+// Waiting returns the number of requests parked for a function
+func (a *Activator) Waiting(functionName, namespace string) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if queue, ok := a.queues[functionName+"."+namespace]; ok {
+		return len(queue.waiters)
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coldServiceQuery starts at zero replicas, a replica becomes available
+// readyAfter a scale up is requested
+type coldServiceQuery struct {
+	readyAfter  time.Duration
+	annotations map[string]string
+
+	lock         sync.Mutex
+	scaledAt     time.Time
+	replicas     uint64
+	getReplicas  int64
+	neverStarted bool
+}
+
+func (c *coldServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (ServiceQueryResponse, error) {
+	atomic.AddInt64(&c.getReplicas, 1)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	available := uint64(0)
+	if c.replicas > 0 && !c.neverStarted && time.Since(c.scaledAt) >= c.readyAfter {
+		available = c.replicas
+	}
+
+	annotations := c.annotations
+	return ServiceQueryResponse{
+		Replicas:          c.replicas,
+		AvailableReplicas: available,
+		MaxReplicas:       DefaultMaxReplicas,
+		ScalingFactor:     DefaultScalingFactor,
+		Annotations:       &annotations,
+	}, nil
+}
+
+func (c *coldServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.replicas = count
+	c.scaledAt = time.Now()
+	return nil
+}
+
+func newTestActivator(query ServiceQuery, capacity uint, timeout time.Duration) *Activator {
+	config := ScalingConfig{
+		MaxPollCount:         1000,
+		SetScaleRetries:      10,
+		FunctionPollInterval: time.Millisecond * 5,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         query,
+		ActivatorCapacity:    capacity,
+		ActivatorTimeout:     timeout,
+	}
+
+	scaler := NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+	return NewActivator(&scaler, config)
+}
+
+func Test_Activator_ReleasesAllParkedRequests(t *testing.T) {
+	query := &coldServiceQuery{readyAfter: time.Millisecond * 50}
+	activator := newTestActivator(query, 100, time.Second*5)
+
+	requests := 50
+	wg := sync.WaitGroup{}
+	var available int64
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := activator.Activate(context.Background(), "echo", "openfaas-fn")
+			if err == nil && res.Available {
+				atomic.AddInt64(&available, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if available != int64(requests) {
+		t.Fatalf("want %d requests released, got: %d", requests, available)
+	}
+
+	// Each request polling separately would need at least 10 queries
+	// per request to wait out the cold start.
+	if got := atomic.LoadInt64(&query.getReplicas); got > int64(requests) {
+		t.Errorf("want fewer queries than requests, got: %d", got)
+	}
+}
+
+func Test_Activator_RejectsRequestsOverCapacity(t *testing.T) {
+	query := &coldServiceQuery{readyAfter: time.Millisecond * 100}
+	activator := newTestActivator(query, 1, time.Second*5)
+
+	done := make(chan error)
+	go func() {
+		_, err := activator.Activate(context.Background(), "echo", "openfaas-fn")
+		done <- err
+	}()
+
+	for activator.Waiting("echo", "openfaas-fn") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := activator.Activate(context.Background(), "echo", "openfaas-fn"); err != ErrActivatorFull {
+		t.Errorf("want: %s, got: %v", ErrActivatorFull, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("want the parked request to be released, got: %s", err)
+	}
+}
+
+func Test_Activator_TimesOutParkedRequests(t *testing.T) {
+	query := &coldServiceQuery{neverStarted: true}
+	activator := newTestActivator(query, 10, time.Millisecond*20)
+
+	if _, err := activator.Activate(context.Background(), "echo", "openfaas-fn"); err != ErrActivatorTimeout {
+		t.Errorf("want: %s, got: %v", ErrActivatorTimeout, err)
+	}
+
+	if got := activator.Waiting("echo", "openfaas-fn"); got != 0 {
+		t.Errorf("want the timed out request to be removed, got: %d waiting", got)
+	}
+}
+
+func Test_Activator_WarmFunctionIsNotParked(t *testing.T) {
+	query := &coldServiceQuery{}
+	query.SetReplicas(context.Background(), "echo", "openfaas-fn", 1)
+	activator := newTestActivator(query, 0, time.Millisecond)
+
+	res, _ := activator.Activate(context.Background(), "echo", "openfaas-fn")
+	if !res.Available {
+		t.Fatalf("want the function to be available")
+	}
+
+	res, err := activator.Activate(context.Background(), "echo", "openfaas-fn")
+	if err != nil || !res.Available {
+		t.Fatalf("want a cached available replica to skip the queue, got: %v", err)
+	}
+}
+
+// slowServiceQuery delays each query, so that requests arrive while the
+// activator is still asking the provider about the function
+type slowServiceQuery struct {
+	*coldServiceQuery
+	delay time.Duration
+}
+
+func (s slowServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (ServiceQueryResponse, error) {
+	time.Sleep(s.delay)
+	return s.coldServiceQuery.GetReplicas(ctx, service, namespace)
+}
+
+func Test_Activator_WarmFunctionWithExpiredCacheIsNotRejected(t *testing.T) {
+	query := &coldServiceQuery{}
+	query.SetReplicas(context.Background(), "echo", "openfaas-fn", 1)
+	activator := newTestActivator(slowServiceQuery{coldServiceQuery: query, delay: time.Millisecond * 20}, 1, time.Second*5)
+
+	requests := 50
+	wg := sync.WaitGroup{}
+	var rejected int64
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := activator.Activate(context.Background(), "echo", "openfaas-fn")
+			if err != nil || !res.Available {
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rejected != 0 {
+		t.Errorf("want no requests rejected for a warm function, got: %d", rejected)
+	}
+}
+
+func Test_Activator_CancelledRequestStopsScaleUp(t *testing.T) {
+	query := &coldServiceQuery{neverStarted: true}
+	activator := newTestActivator(query, 10, time.Second*5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*20, cancel)
+
+	if _, err := activator.Activate(ctx, "echo", "openfaas-fn"); err != context.Canceled {
+		t.Errorf("want: %s, got: %v", context.Canceled, err)
+	}
+	if got := activator.Waiting("echo", "openfaas-fn"); got != 0 {
+		t.Errorf("want the cancelled request to be removed, got: %d waiting", got)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	queries := atomic.LoadInt64(&query.getReplicas)
+	time.Sleep(time.Millisecond * 50)
+	if got := atomic.LoadInt64(&query.getReplicas); got != queries {
+		t.Errorf("want the scale up to stop, got: %d more queries", got-queries)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TargetConcurrencyAnnotation sets the number of in-flight requests each
+// replica of a function should handle, a value of "0" disables the
+// ConcurrencyAutoscaler for the function
+const TargetConcurrencyAnnotation = "com.openfaas.scale.target"
+
+// ConcurrencyAutoscalerConfig tunes the ConcurrencyAutoscaler, the
+// defaults follow Knative's KPA
+type ConcurrencyAutoscalerConfig struct {
+	// DefaultTarget applies to functions without the
+	// TargetConcurrencyAnnotation, zero disables autoscaling for them
+	DefaultTarget float64
+
+	// StableWindow is the period over which concurrency is averaged
+	StableWindow time.Duration
+
+	// PanicWindow is the shorter period used to react to bursts
+	PanicWindow time.Duration
+
+	// PanicThreshold is the ratio of desired to current replicas over the
+	// PanicWindow which starts panic mode, i.e. 2 for 200%
+	PanicThreshold float64
+
+	// MaxReplicas caps every function, whatever its max scale label, and
+	// is ignored when 0
+	MaxReplicas uint64
+}
+
+// DefaultConcurrencyAutoscalerConfig uses a 60s stable window, a 6s
+// panic window and a 200% panic threshold
+func DefaultConcurrencyAutoscalerConfig() ConcurrencyAutoscalerConfig {
+	return ConcurrencyAutoscalerConfig{
+		StableWindow:   time.Second * 60,
+		PanicWindow:    time.Second * 6,
+		PanicThreshold: 2,
+	}
+}
+
+// ConcurrencyAutoscaler samples the in-flight requests of each function at
+// the forwarding proxy and sets replicas so that each handles the target
+// concurrency, or as decided by the ScalingPolicy selected for the function.
+// While a burst exceeds the panic threshold over the panic window, replicas
+// are scaled on the panic window and never scaled down until the burst has
+// passed for a full stable window.
+//
+// Functions at zero replicas are left to the FunctionScaler, and functions
+// are never scaled below one replica.
+type ConcurrencyAutoscaler struct {
+	Config        ConcurrencyAutoscalerConfig
+	Tracker       *InvocationTracker
+	ServiceQuery  ServiceQuery
+	FunctionQuery FunctionQuery
+	Policies      *ScalingPolicyRegistry
+
+	functions map[string]*concurrencyWindow
+	lock      sync.Mutex
+}
+
+type concurrencySample struct {
+	at       time.Time
+	inFlight float64
+}
+
+type concurrencyWindow struct {
+	samples []concurrencySample
+
+	// panicUntil is when panic mode ends, unless extended by another burst
+	panicUntil time.Time
+}
+
+// NewConcurrencyAutoscaler creates a ConcurrencyAutoscaler for the
+// functions seen by tracker
+func NewConcurrencyAutoscaler(config ConcurrencyAutoscalerConfig, tracker *InvocationTracker, serviceQuery ServiceQuery, functionQuery FunctionQuery, policies *ScalingPolicyRegistry) *ConcurrencyAutoscaler {
+	return &ConcurrencyAutoscaler{
+		Config:        config,
+		Tracker:       tracker,
+		ServiceQuery:  serviceQuery,
+		FunctionQuery: functionQuery,
+		Policies:      policies,
+		functions:     make(map[string]*concurrencyWindow),
+	}
+}
+
+// Start samples concurrency and reconciles replicas on every interval
+func (a *ConcurrencyAutoscaler) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			now := time.Now()
+			a.Sample(now)
+			a.Reconcile(now)
+		}
+	}()
+}
+
+// Sample records the in-flight requests of every function at the time now
+func (a *ConcurrencyAutoscaler) Sample(now time.Time) {
+	activities := a.Tracker.List()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, activity := range activities {
+		key := activity.Name + "." + activity.Namespace
+
+		window, ok := a.functions[key]
+		if !ok {
+			window = &concurrencyWindow{}
+			a.functions[key] = window
+		}
+
+		window.samples = append(window.samples, concurrencySample{at: now, inFlight: float64(activity.InFlight)})
+
+		// Drop samples which have left the stable window
+		i := 0
+		for i < len(window.samples) && now.Sub(window.samples[i].at) > a.Config.StableWindow {
+			i++
+		}
+		window.samples = window.samples[i:]
+	}
+}
+
+// Reconcile sets the replicas of every sampled function to its desired
+// replicas at the time now
+func (a *ConcurrencyAutoscaler) Reconcile(now time.Time) {
+	for _, activity := range a.Tracker.List() {
+		annotations, err := a.FunctionQuery.GetAnnotations(activity.Name, activity.Namespace)
+		if err != nil {
+			log.Printf("[Autoscale] function=%s.%s unable to get annotations: %s", activity.Name, activity.Namespace, err)
+			continue
+		}
+
+		target := a.target(annotations)
+		if target <= 0 {
+			continue
+		}
+
+		queryResponse, err := a.ServiceQuery.GetReplicas(context.Background(), activity.Name, activity.Namespace)
+		if err != nil {
+			log.Printf("[Autoscale] function=%s.%s unable to get replicas: %s", activity.Name, activity.Namespace, err)
+			continue
+		}
+
+		if queryResponse.Replicas == 0 {
+			continue
+		}
+
+		desired, ok := a.DesiredReplicas(activity.Name, activity.Namespace, target, queryResponse, now)
+		if min := ScheduledMinReplicas(annotations, now); ok && desired < min {
+			desired = min
+		}
+		if !ok || desired == queryResponse.Replicas {
+			continue
+		}
+
+		log.Printf("[Autoscale] function=%s.%s %d => %d requested", activity.Name, activity.Namespace, queryResponse.Replicas, desired)
+		if err := a.ServiceQuery.SetReplicas(context.Background(), activity.Name, activity.Namespace, desired); err != nil {
+			log.Printf("[Autoscale] function=%s.%s unable to scale: %s", activity.Name, activity.Namespace, err)
+		}
+	}
+}
+
+// DesiredReplicas is the number of replicas from the function's ScalingPolicy,
+// target-tracking by default, within the bounds from ResolveBounds.
+// ok is false when no samples have been recorded for the function.
+func (a *ConcurrencyAutoscaler) DesiredReplicas(functionName, namespace string, target float64, queryResponse ServiceQueryResponse, now time.Time) (desired uint64, ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	window, found := a.functions[functionName+"."+namespace]
+	if !found || len(window.samples) == 0 {
+		return 0, false
+	}
+
+	current := queryResponse.Replicas
+	stableInFlight := window.average(now, a.Config.StableWindow)
+	panicInFlight := window.average(now, a.Config.PanicWindow)
+	panicReplicas := uint64(math.Ceil(panicInFlight / target))
+
+	if current > 0 && float64(panicReplicas)/float64(current) >= a.Config.PanicThreshold {
+		if !now.Before(window.panicUntil) {
+			log.Printf("[Autoscale] function=%s.%s entering panic mode, %d => %d", functionName, namespace, current, panicReplicas)
+		}
+		window.panicUntil = now.Add(a.Config.StableWindow)
+	}
+
+	panicking := now.Before(window.panicUntil)
+
+	observation := NewScalingObservation(queryResponse, false)
+	observation.TargetConcurrency = target
+	observation.InFlight = stableInFlight
+	if panicking {
+		observation.InFlight = panicInFlight
+	}
+	observation.Firing = observation.InFlight > target*float64(current)
+
+	var annotations map[string]string
+	if queryResponse.Annotations != nil {
+		annotations = *queryResponse.Annotations
+	}
+
+	desired = a.Policies.Policy(annotations, ScalingPolicyTargetTracking).TargetReplicas(observation)
+	if panicking && desired < current {
+		desired = current
+	}
+
+	bounds := ResolveBounds(queryResponse, a.Config.MaxReplicas)
+	if desired < bounds.Min {
+		desired = bounds.Min
+	}
+	if desired > bounds.Max {
+		desired = bounds.Max
+	}
+	return desired, true
+}
+
+// average of the samples taken within period of now
+func (w *concurrencyWindow) average(now time.Time, period time.Duration) float64 {
+	total := 0.0
+	count := 0
+	for _, sample := range w.samples {
+		if now.Sub(sample.at) <= period {
+			total += sample.inFlight
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+func (a *ConcurrencyAutoscaler) target(annotations map[string]string) float64 {
+	val, ok := annotations[TargetConcurrencyAnnotation]
+	if !ok || len(val) == 0 {
+		return a.Config.DefaultTarget
+	}
+
+	target, err := strconv.ParseFloat(val, 64)
+	if err != nil || target < 0 {
+		log.Printf("Provided annotation %s=%s should be a positive number", TargetConcurrencyAnnotation, val)
+		return a.Config.DefaultTarget
+	}
+	return target
+}
@@ -0,0 +1,212 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestAutoscaler(query *fakeServiceQuery, target float64) (*ConcurrencyAutoscaler, *InvocationTracker) {
+	config := DefaultConcurrencyAutoscalerConfig()
+	config.DefaultTarget = target
+
+	tracker := NewInvocationTracker()
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+
+	return NewConcurrencyAutoscaler(config, tracker, query, functionQuery, NewScalingPolicyRegistry()), tracker
+}
+
+func startInvocations(tracker *InvocationTracker, count int, at time.Time) {
+	for i := 0; i < count; i++ {
+		tracker.Started("echo", "openfaas-fn", at)
+	}
+}
+
+func completeInvocations(tracker *InvocationTracker, count int, at time.Time) {
+	for i := 0; i < count; i++ {
+		tracker.Completed("echo", "openfaas-fn", at)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_ScalesToTargetOverStableWindow(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	autoscaler, tracker := newTestAutoscaler(query, 10)
+
+	start := time.Now()
+	startInvocations(tracker, 25, start)
+
+	for i := 0; i < 30; i++ {
+		now := start.Add(time.Duration(i) * time.Second * 2)
+		autoscaler.Sample(now)
+	}
+
+	// 25 in-flight requests at a target of 10 need 3 replicas, which is
+	// below the panic threshold for 2 replicas
+	desired, ok := autoscaler.DesiredReplicas("echo", "openfaas-fn", 10, ServiceQueryResponse{Replicas: 2, MaxReplicas: 5}, start.Add(time.Minute))
+	if !ok || desired != 3 {
+		t.Fatalf("want 3 replicas, got: %d", desired)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_PanicsOnBurst(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	autoscaler, tracker := newTestAutoscaler(query, 10)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	for i := 0; i < 28; i++ {
+		autoscaler.Sample(start.Add(time.Duration(i) * time.Second * 2))
+	}
+
+	// A burst of 40 requests over the last 6 seconds
+	burst := start.Add(time.Second * 56)
+	startInvocations(tracker, 39, burst)
+	for i := 0; i < 3; i++ {
+		autoscaler.Sample(burst.Add(time.Duration(i) * time.Second * 2))
+	}
+
+	now := burst.Add(time.Second * 4)
+	autoscaler.Reconcile(now)
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != 4 {
+		t.Fatalf("want a scale up to 4 replicas on the panic window, got: %v", calls)
+	}
+
+	// Once the burst ends, panic mode holds replicas for the stable window
+	completeInvocations(tracker, 39, now)
+	autoscaler.Sample(now.Add(time.Second * 2))
+	autoscaler.Reconcile(now.Add(time.Second * 2))
+
+	if calls := query.calls(); len(calls) != 1 {
+		t.Fatalf("want no scale down during panic mode, got: %v", calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_RespectsMaxReplicas(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	autoscaler, tracker := newTestAutoscaler(query, 1)
+
+	start := time.Now()
+	startInvocations(tracker, 100, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != DefaultMaxReplicas {
+		t.Fatalf("want a scale up to %d replicas, got: %v", DefaultMaxReplicas, calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_CapsAtConfiguredMaxReplicas(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	autoscaler, tracker := newTestAutoscaler(query, 1)
+	autoscaler.Config.MaxReplicas = 5
+
+	start := time.Now()
+	startInvocations(tracker, 100, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != 5 {
+		t.Fatalf("want a scale up to %d replicas, got: %v", 5, calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_ScalesDownToOneReplica(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 4}
+	autoscaler, tracker := newTestAutoscaler(query, 10)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != 1 {
+		t.Fatalf("want a scale down to 1 replica, got: %v", calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_SkipsFunctionsWithoutTarget(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	autoscaler, tracker := newTestAutoscaler(query, 0)
+
+	start := time.Now()
+	startInvocations(tracker, 100, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	if calls := query.calls(); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_TargetFromAnnotation(t *testing.T) {
+	query := &fakeServiceQuery{
+		replicas:    1,
+		annotations: map[string]string{TargetConcurrencyAnnotation: "50"},
+	}
+	autoscaler, tracker := newTestAutoscaler(query, 0)
+
+	start := time.Now()
+	startInvocations(tracker, 100, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != 2 {
+		t.Fatalf("want a scale up to 2 replicas from the annotation, got: %v", calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_LeavesFunctionsAtZero(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 0}
+	autoscaler, tracker := newTestAutoscaler(query, 1)
+
+	start := time.Now()
+	startInvocations(tracker, 3, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	if calls := query.calls(); len(calls) != 0 {
+		t.Fatalf("want scale from zero to be left to the scaler, got: %v", calls)
+	}
+}
+
+func Test_ConcurrencyAutoscaler_ProviderUnreachable(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	query.failSetReplicas(errors.New("connection refused"))
+	autoscaler, tracker := newTestAutoscaler(query, 10)
+
+	start := time.Now()
+	startInvocations(tracker, 30, start)
+	autoscaler.Sample(start)
+	autoscaler.Reconcile(start)
+
+	if len(query.calls()) != 1 || query.currentReplicas() != 1 {
+		t.Fatalf("want a failed scale up, got calls: %v, replicas: %d", query.calls(), query.currentReplicas())
+	}
+
+	// The samples are kept, so the retry is decided on the same window
+	autoscaler.lock.Lock()
+	samples := len(autoscaler.functions["echo.openfaas-fn"].samples)
+	autoscaler.lock.Unlock()
+	if samples != 1 {
+		t.Fatalf("want the sample kept after a failed scale up, got: %d sample(s)", samples)
+	}
+
+	// The scale up is tried again on the next interval
+	query.failSetReplicas(nil)
+	autoscaler.Sample(start.Add(time.Second * 2))
+	autoscaler.Reconcile(start.Add(time.Second * 2))
+
+	if query.currentReplicas() != 3 {
+		t.Fatalf("want 3 replicas, got: %d", query.currentReplicas())
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import "math"
+
+// Forecaster predicts a time-series of invocation counts sampled
+// at a fixed interval
+type Forecaster interface {
+	// Observe adds the count for the latest interval
+	Observe(count float64)
+
+	// Forecast predicts the count for the interval steps ahead
+	// of the latest observation
+	Forecast(steps int) float64
+}
+
+// EWMAForecaster is an exponentially weighted moving average, the
+// forecast is the same for every step ahead
+type EWMAForecaster struct {
+	// Alpha is the weight given to the latest observation
+	Alpha float64
+
+	average  float64
+	observed bool
+}
+
+// NewEWMAForecaster creates an EWMAForecaster
+func NewEWMAForecaster(alpha float64) *EWMAForecaster {
+	return &EWMAForecaster{Alpha: alpha}
+}
+
+// Observe adds the count for the latest interval
+func (f *EWMAForecaster) Observe(count float64) {
+	if !f.observed {
+		f.average = count
+		f.observed = true
+		return
+	}
+	f.average = f.Alpha*count + (1-f.Alpha)*f.average
+}
+
+// Forecast predicts the count for the interval steps ahead
+func (f *EWMAForecaster) Forecast(steps int) float64 {
+	return f.average
+}
+
+// HoltWintersForecaster is triple exponential smoothing with additive
+// seasonality, such as a daily pattern of batch jobs
+type HoltWintersForecaster struct {
+	// Alpha smooths the level
+	Alpha float64
+	// Beta smooths the trend
+	Beta float64
+	// Gamma smooths the seasonal component
+	Gamma float64
+
+	// SeasonLength is the number of intervals in a season, i.e. 1440
+	// for one minute intervals and a daily season
+	SeasonLength int
+
+	level    float64
+	trend    float64
+	seasonal []float64
+	// t is the number of observations so far
+	t int
+}
+
+// NewHoltWintersForecaster creates a HoltWintersForecaster
+func NewHoltWintersForecaster(alpha, beta, gamma float64, seasonLength int) *HoltWintersForecaster {
+	if seasonLength < 1 {
+		seasonLength = 1
+	}
+
+	return &HoltWintersForecaster{
+		Alpha:        alpha,
+		Beta:         beta,
+		Gamma:        gamma,
+		SeasonLength: seasonLength,
+		seasonal:     make([]float64, seasonLength),
+	}
+}
+
+// Observe adds the count for the latest interval
+func (f *HoltWintersForecaster) Observe(count float64) {
+	index := f.t % f.SeasonLength
+	defer func() { f.t++ }()
+
+	if f.t == 0 {
+		f.level = count
+		return
+	}
+
+	// The seasonal component of each interval is learnt over the first
+	// season, before then the level alone is used.
+	if f.t < f.SeasonLength {
+		lastLevel := f.level
+		f.level = f.Alpha*count + (1-f.Alpha)*(f.level+f.trend)
+		f.trend = f.Beta*(f.level-lastLevel) + (1-f.Beta)*f.trend
+		f.seasonal[index] = count - f.level
+		return
+	}
+
+	lastLevel := f.level
+	f.level = f.Alpha*(count-f.seasonal[index]) + (1-f.Alpha)*(f.level+f.trend)
+	f.trend = f.Beta*(f.level-lastLevel) + (1-f.Beta)*f.trend
+	f.seasonal[index] = f.Gamma*(count-f.level) + (1-f.Gamma)*f.seasonal[index]
+}
+
+// Forecast predicts the count for the interval steps ahead, it
+// is never less than zero
+func (f *HoltWintersForecaster) Forecast(steps int) float64 {
+	if f.t == 0 {
+		return 0
+	}
+
+	forecast := f.level + float64(steps)*f.trend
+	if f.t >= f.SeasonLength {
+		// The latest observation was at index t-1
+		index := (f.t - 1 + steps) % f.SeasonLength
+		forecast += f.seasonal[index]
+	}
+
+	return math.Max(forecast, 0)
+}
@@ -4,8 +4,11 @@
 package scaling
 
 import (
+	"container/list"
 	"sync"
 	"time"
+
+	"github.com/openfaas/faas/gateway/types"
 )
 
 // FunctionCacher queries functions and caches the results
@@ -14,11 +17,32 @@ type FunctionCacher interface {
 	Get(functionName, namespace string) (ServiceQueryResponse, bool)
 }
 
+// CacheObserver is told about each lookup in a FunctionCache, and each
+// entry removed because the cache was full or the entry had expired
+type CacheObserver interface {
+	Hit()
+	Miss()
+	Evicted()
+}
+
 // FunctionCache provides a cache of Function replica counts
 type FunctionCache struct {
 	Cache  map[string]*FunctionMeta
 	Expiry time.Duration
 	Sync   sync.RWMutex
+
+	// Clock stamps and expires entries, the system clock when nil
+	Clock types.Clock
+
+	// MaxEntries bounds the cache, the least recently used entry is
+	// evicted to make room for a new one. Zero is unbounded.
+	MaxEntries int
+
+	// Observer is told about hits, misses and evictions, when set
+	Observer CacheObserver
+
+	// recent orders the keys of Cache from most to least recently used
+	recent *list.List
 }
 
 // NewFunctionCache creates a function cache to query function metadata
@@ -29,17 +53,41 @@ func NewFunctionCache(cacheExpiry time.Duration) FunctionCacher {
 	}
 }
 
+// NewBoundedFunctionCache creates a function cache which holds at most
+// maxEntries, and reports hits, misses and evictions to observer
+func NewBoundedFunctionCache(cacheExpiry time.Duration, maxEntries int, observer CacheObserver) *FunctionCache {
+	return &FunctionCache{
+		Cache:      make(map[string]*FunctionMeta),
+		Expiry:     cacheExpiry,
+		MaxEntries: maxEntries,
+		Observer:   observer,
+	}
+}
+
 // Set replica count for functionName
 func (fc *FunctionCache) Set(functionName, namespace string, queryRes ServiceQueryResponse) {
 	fc.Sync.Lock()
 	defer fc.Sync.Unlock()
 
-	if _, exists := fc.Cache[functionName+"."+namespace]; !exists {
-		fc.Cache[functionName+"."+namespace] = &FunctionMeta{}
+	key := functionName + "." + namespace
+	if fc.Cache == nil {
+		fc.Cache = make(map[string]*FunctionMeta)
+	}
+
+	meta, exists := fc.Cache[key]
+	if !exists {
+		meta = &FunctionMeta{}
+		fc.Cache[key] = meta
 	}
 
-	fc.Cache[functionName+"."+namespace].LastRefresh = time.Now()
-	fc.Cache[functionName+"."+namespace].ServiceQueryResponse = queryRes
+	meta.LastRefresh = fc.now()
+	meta.ServiceQueryResponse = queryRes
+	fc.touch(key, meta)
+
+	for fc.MaxEntries > 0 && len(fc.Cache) > fc.MaxEntries {
+		oldest := fc.recent.Back()
+		fc.remove(oldest.Value.(string))
+	}
 }
 
 // Get replica count for functionName
@@ -49,13 +97,96 @@ func (fc *FunctionCache) Get(functionName, namespace string) (ServiceQueryRespon
 	}
 
 	hit := false
-	fc.Sync.RLock()
-	defer fc.Sync.RUnlock()
+	fc.Sync.Lock()
+	defer fc.Sync.Unlock()
 
-	if val, exists := fc.Cache[functionName+"."+namespace]; exists {
+	key := functionName + "." + namespace
+	if val, exists := fc.Cache[key]; exists {
 		queryRes = val.ServiceQueryResponse
-		hit = !val.Expired(fc.Expiry)
+		hit = !val.ExpiredAt(fc.now(), fc.Expiry)
+		if hit {
+			fc.touch(key, val)
+		}
+	}
+
+	if fc.Observer != nil {
+		if hit {
+			fc.Observer.Hit()
+		} else {
+			fc.Observer.Miss()
+		}
 	}
 
 	return queryRes, hit
 }
+
+// Len returns the number of entries, including expired entries which
+// have not yet been swept
+func (fc *FunctionCache) Len() int {
+	fc.Sync.RLock()
+	defer fc.Sync.RUnlock()
+
+	return len(fc.Cache)
+}
+
+// Sweep removes the entries which had expired at the time now
+func (fc *FunctionCache) Sweep(now time.Time) {
+	fc.Sync.Lock()
+	defer fc.Sync.Unlock()
+
+	for key, meta := range fc.Cache {
+		if meta.ExpiredAt(now, fc.Expiry) {
+			fc.remove(key)
+		}
+	}
+}
+
+// StartSweeper sweeps expired entries on every interval
+func (fc *FunctionCache) StartSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			fc.Sweep(fc.now())
+		}
+	}()
+}
+
+// touch marks key as the most recently used, it must be called with
+// the lock held
+func (fc *FunctionCache) touch(key string, meta *FunctionMeta) {
+	if fc.recent == nil {
+		fc.recent = list.New()
+	}
+
+	if meta.element == nil {
+		meta.element = fc.recent.PushFront(key)
+		return
+	}
+	fc.recent.MoveToFront(meta.element)
+}
+
+// remove evicts key, it must be called with the lock held
+func (fc *FunctionCache) remove(key string) {
+	meta, ok := fc.Cache[key]
+	if !ok {
+		return
+	}
+
+	if meta.element != nil {
+		fc.recent.Remove(meta.element)
+		meta.element = nil
+	}
+	delete(fc.Cache, key)
+
+	if fc.Observer != nil {
+		fc.Observer.Evicted()
+	}
+}
+
+func (fc *FunctionCache) now() time.Time {
+	if fc.Clock != nil {
+		return fc.Clock.Now()
+	}
+	return time.Now()
+}
@@ -137,3 +137,79 @@ func Test_CacheFunctionNotExist(t *testing.T) {
 		t.Errorf("hit, want: %v, got %v", wantHit, hit)
 	}
 }
+
+type countingCacheObserver struct {
+	hits, misses, evictions int
+}
+
+func (o *countingCacheObserver) Hit()     { o.hits++ }
+func (o *countingCacheObserver) Miss()    { o.misses++ }
+func (o *countingCacheObserver) Evicted() { o.evictions++ }
+
+func Test_Cache_EvictsLeastRecentlyUsed(t *testing.T) {
+	observer := &countingCacheObserver{}
+	cache := NewBoundedFunctionCache(time.Minute, 2, observer)
+
+	cache.Set("a", "openfaas-fn", ServiceQueryResponse{Replicas: 1})
+	cache.Set("b", "openfaas-fn", ServiceQueryResponse{Replicas: 2})
+
+	// Reading a makes b the least recently used
+	cache.Get("a", "openfaas-fn")
+	cache.Set("c", "openfaas-fn", ServiceQueryResponse{Replicas: 3})
+
+	if cache.Len() != 2 {
+		t.Fatalf("want 2 entries, got: %d", cache.Len())
+	}
+	if _, hit := cache.Get("b", "openfaas-fn"); hit {
+		t.Errorf("want b evicted")
+	}
+	if _, hit := cache.Get("a", "openfaas-fn"); !hit {
+		t.Errorf("want a kept")
+	}
+	if _, hit := cache.Get("c", "openfaas-fn"); !hit {
+		t.Errorf("want c kept")
+	}
+
+	if observer.hits != 3 || observer.misses != 1 || observer.evictions != 1 {
+		t.Errorf("want 3 hits, 1 miss and 1 eviction, got: %+v", *observer)
+	}
+}
+
+func Test_Cache_SetExistingEntryDoesNotEvict(t *testing.T) {
+	cache := NewBoundedFunctionCache(time.Minute, 1, nil)
+
+	cache.Set("a", "", ServiceQueryResponse{Replicas: 1})
+	cache.Set("a", "", ServiceQueryResponse{Replicas: 2})
+
+	res, hit := cache.Get("a", "")
+	if !hit || res.Replicas != 2 {
+		t.Errorf("want a hit with 2 replicas, got: %v %+v", hit, res)
+	}
+}
+
+func Test_Cache_SweepRemovesExpiredEntries(t *testing.T) {
+	observer := &countingCacheObserver{}
+	cache := NewBoundedFunctionCache(time.Second, 0, observer)
+
+	cache.Set("a", "", ServiceQueryResponse{})
+	cache.Set("b", "", ServiceQueryResponse{})
+	cache.Cache["a."].LastRefresh = time.Now().Add(-time.Minute)
+
+	cache.Sweep(time.Now())
+
+	if cache.Len() != 1 {
+		t.Fatalf("want 1 entry, got: %d", cache.Len())
+	}
+	if _, exists := cache.Cache["b."]; !exists {
+		t.Errorf("want b kept")
+	}
+	if observer.evictions != 1 {
+		t.Errorf("want 1 eviction, got: %d", observer.evictions)
+	}
+
+	// The swept entry can be set again
+	cache.Set("a", "", ServiceQueryResponse{})
+	if cache.Len() != 2 {
+		t.Errorf("want 2 entries, got: %d", cache.Len())
+	}
+}
@@ -4,6 +4,7 @@
 package scaling
 
 import (
+	"container/list"
 	"time"
 )
 
@@ -12,10 +13,19 @@ import (
 type FunctionMeta struct {
 	LastRefresh          time.Time
 	ServiceQueryResponse ServiceQueryResponse
+
+	// element is the entry's position in the FunctionCache's recently
+	// used list
+	element *list.Element
 }
 
 // Expired find out whether the cache item has expired with
 // the given expiry duration from when it was stored.
 func (fm *FunctionMeta) Expired(expiry time.Duration) bool {
-	return time.Now().After(fm.LastRefresh.Add(expiry))
+	return fm.ExpiredAt(time.Now(), expiry)
+}
+
+// ExpiredAt finds out whether the cache item had expired at the time now
+func (fm *FunctionMeta) ExpiredAt(now time.Time, expiry time.Duration) bool {
+	return now.After(fm.LastRefresh.Add(expiry))
 }
@@ -4,6 +4,7 @@
 package scaling
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -46,7 +47,7 @@ func (c *CachedFunctionQuery) Get(fn string, ns string) (ServiceQueryResponse, e
 		queryResponse, err, _ := c.singleFlight.Do(key, func() (interface{}, error) {
 			log.Printf("Cache miss - run GetReplicas")
 			// If there is a cache miss, then fetch the value from the provider API
-			return c.serviceQuery.GetReplicas(fn, ns)
+			return c.serviceQuery.GetReplicas(context.Background(), fn, ns)
 		})
 
 		if err != nil {
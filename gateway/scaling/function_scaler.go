@@ -1,10 +1,12 @@
 package scaling
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/openfaas/faas/gateway/pkg/tracing"
 	"github.com/openfaas/faas/gateway/types"
 	"golang.org/x/sync/singleflight"
 )
@@ -32,12 +34,39 @@ type FunctionScaleResult struct {
 	Error     error
 	Found     bool
 	Duration  time.Duration
+
+	// ColdStart is true when there was no available replica, and the
+	// request had to wait for one
+	ColdStart bool
+
+	// ScaleRequested is the time taken until the desired replicas were
+	// set, zero when another request had already set them
+	ScaleRequested time.Duration
+
+	// Ready is the time taken until a replica was available
+	Ready time.Duration
 }
 
 // Scale scales a function from zero replicas to 1 or the value set in
-// the minimum replicas metadata
-func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResult {
-	start := time.Now()
+// the minimum replicas metadata. Once ctx is done, Scale stops waiting
+// and returns its error in the result.
+func (f *FunctionScaler) Scale(ctx context.Context, functionName, namespace string) FunctionScaleResult {
+	ctx, span := tracing.Start(ctx, "gateway.scale", tracing.SpanKindInternal)
+	defer span.End()
+
+	span.SetAttribute("faas.name", functionName)
+	span.SetAttribute("faas.namespace", namespace)
+
+	res := f.scale(ctx, functionName, namespace)
+
+	span.SetAttribute("faas.coldstart", res.ColdStart)
+	span.SetAttribute("faas.available", res.Available)
+	span.RecordError(res.Error)
+	return res
+}
+
+func (f *FunctionScaler) scale(ctx context.Context, functionName, namespace string) FunctionScaleResult {
+	start := f.now()
 
 	// First check the cache, if there are available replicas, then the
 	// request can be served.
@@ -47,15 +76,15 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			Error:     nil,
 			Available: true,
 			Found:     true,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
 	// The wasn't a hit, or there were no available replicas found
 	// so query the live endpoint
 	getKey := fmt.Sprintf("GetReplicas-%s.%s", functionName, namespace)
-	res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-		return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
+	res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+		return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
 	})
 
 	if err != nil {
@@ -63,7 +92,7 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			Error:     err,
 			Available: false,
 			Found:     false,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 	if res == nil {
@@ -71,23 +100,28 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			Error:     fmt.Errorf("empty response from server"),
 			Available: false,
 			Found:     false,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
+	// Store the result of GetReplicas in the cache, so that the next
+	// requests to a warm function are served from it
+	queryResponse := res.(ServiceQueryResponse)
+	f.Cache.Set(functionName, namespace, queryResponse)
+
 	// Check if there are available replicas in the live data
-	if res.(ServiceQueryResponse).AvailableReplicas > 0 {
+	if queryResponse.AvailableReplicas > 0 {
 		return FunctionScaleResult{
 			Error:     nil,
 			Available: true,
 			Found:     true,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
-	// Store the result of GetReplicas in the cache
-	queryResponse := res.(ServiceQueryResponse)
-	f.Cache.Set(functionName, namespace, queryResponse)
+	config := f.Config.ForFunction(queryResponse.Annotations)
+
+	var scaleRequested time.Duration
 
 	// If the desired replica count is 0, then a scale up event
 	// is required.
@@ -99,10 +133,10 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 
 		// In a retry-loop, first query desired replicas, then
 		// set them if the value is still at 0.
-		scaleResult := types.Retry(func(attempt int) error {
+		scaleResult := types.RetryWithBackoff(ctx, f.clock(), func(attempt int) error {
 
-			res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-				return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
+			res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+				return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
 			})
 
 			if err != nil {
@@ -122,12 +156,12 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			// Request a scale up to the minimum amount of replicas
 			setKey := fmt.Sprintf("SetReplicas-%s.%s", functionName, namespace)
 
-			if _, err, _ := f.SingleFlight.Do(setKey, func() (interface{}, error) {
+			if _, err := f.do(ctx, setKey, func(ctx context.Context) (interface{}, error) {
 
 				log.Printf("[Scale %d/%d] function=%s 0 => %d requested",
 					attempt, int(f.Config.SetScaleRetries), functionName, minReplicas)
 
-				if err := f.Config.ServiceQuery.SetReplicas(functionName, namespace, minReplicas); err != nil {
+				if err := f.Config.ServiceQuery.SetReplicas(ctx, functionName, namespace, minReplicas); err != nil {
 					return nil, fmt.Errorf("unable to scale function [%s], err: %s", functionName, err)
 				}
 				return nil, nil
@@ -137,67 +171,182 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 
 			return nil
 
-		}, "Scale", int(f.Config.SetScaleRetries), f.Config.FunctionPollInterval)
+		}, "Scale", int(config.SetScaleRetries), config.backoff())
 
 		if scaleResult != nil {
 			return FunctionScaleResult{
 				Error:     scaleResult,
 				Available: false,
 				Found:     true,
-				Duration:  time.Since(start),
+				Duration:  f.since(start),
+				ColdStart: true,
 			}
 		}
 
+		scaleRequested = f.since(start)
 	}
 
-	// Holding pattern for at least one function replica to be available
-	for i := 0; i < int(f.Config.MaxPollCount); i++ {
+	// Wake as soon as a replica is ready when the provider supports
+	// watching, otherwise fall through to polling
+	if watcher, ok := f.Config.ServiceQuery.(ReadinessWatcher); ok {
+		if result, watched := f.watch(ctx, config, watcher, functionName, namespace, start); watched {
+			return coldStartResult(result, scaleRequested)
+		}
+	}
 
-		res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-			return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
-		})
-		queryResponse := res.(ServiceQueryResponse)
+	// Holding pattern for at least one function replica to be available
+	backoff := config.backoff()
+	var interval time.Duration
 
-		if err == nil {
-			f.Cache.Set(functionName, namespace, queryResponse)
+	for i := 0; i < int(config.MaxPollCount); i++ {
+		if err := ctx.Err(); err != nil {
+			return coldStartResult(cancelledResult(err, f.since(start)), scaleRequested)
 		}
 
-		totalTime := time.Since(start)
+		res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+			return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
+		})
+
+		totalTime := f.since(start)
 
 		if err != nil {
-			return FunctionScaleResult{
+			return coldStartResult(FunctionScaleResult{
 				Error:     err,
 				Available: false,
 				Found:     true,
 				Duration:  totalTime,
-			}
+			}, scaleRequested)
 		}
 
+		queryResponse := res.(ServiceQueryResponse)
+		f.Cache.Set(functionName, namespace, queryResponse)
+
 		if queryResponse.AvailableReplicas > 0 {
 
 			log.Printf("[Ready] function=%s waited for - %.4fs", functionName, totalTime.Seconds())
 
-			return FunctionScaleResult{
+			return coldStartResult(FunctionScaleResult{
 				Error:     nil,
 				Available: true,
 				Found:     true,
 				Duration:  totalTime,
-			}
+			}, scaleRequested)
 		}
 
-		time.Sleep(f.Config.FunctionPollInterval)
+		interval = backoff.Next(i, interval)
+		if err := f.sleep(ctx, interval); err != nil {
+			return coldStartResult(cancelledResult(err, f.since(start)), scaleRequested)
+		}
 	}
 
-	return FunctionScaleResult{
+	return coldStartResult(FunctionScaleResult{
 		Error:     nil,
 		Available: true,
 		Found:     true,
-		Duration:  time.Since(start),
+		Duration:  f.since(start),
+	}, scaleRequested)
+}
+
+// coldStartResult marks a result as a cold start with its phase timings
+func coldStartResult(result FunctionScaleResult, scaleRequested time.Duration) FunctionScaleResult {
+	result.ColdStart = true
+	result.ScaleRequested = scaleRequested
+	if result.Available {
+		result.Ready = result.Duration
 	}
+	return result
 }
 
-func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionScaleResult {
-	start := time.Now()
+// watch blocks on the provider until the function has an available replica
+// or the time it would take to poll MaxPollCount times is used up.
+// watched is false when the provider does not support watching.
+func (f *FunctionScaler) watch(ctx context.Context, config ScalingConfig, watcher ReadinessWatcher, functionName, namespace string, start time.Time) (result FunctionScaleResult, watched bool) {
+	watchKey := fmt.Sprintf("WatchReplicas-%s.%s", functionName, namespace)
+	deadline := start.Add(config.pollTimeout())
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return cancelledResult(err, f.since(start)), true
+		}
+
+		remaining := deadline.Sub(f.now())
+		if remaining <= 0 {
+			// Match the polling holding pattern, which lets the request
+			// through once its budget is used up
+			return FunctionScaleResult{
+				Error:     nil,
+				Available: true,
+				Found:     true,
+				Duration:  f.since(start),
+			}, true
+		}
+
+		watchStart := f.now()
+		res, err := f.do(ctx, watchKey, func(ctx context.Context) (interface{}, error) {
+			return watcher.WatchReplicas(ctx, functionName, namespace, remaining)
+		})
+
+		if err == ErrWatchNotSupported {
+			return FunctionScaleResult{}, false
+		}
+
+		totalTime := f.since(start)
+
+		if err != nil {
+			return FunctionScaleResult{
+				Error:     err,
+				Available: false,
+				Found:     true,
+				Duration:  totalTime,
+			}, true
+		}
+
+		queryResponse := res.(ServiceQueryResponse)
+		f.Cache.Set(functionName, namespace, queryResponse)
+
+		if queryResponse.AvailableReplicas > 0 {
+			log.Printf("[Ready] function=%s watched for - %.4fs", functionName, totalTime.Seconds())
+
+			return FunctionScaleResult{
+				Error:     nil,
+				Available: true,
+				Found:     true,
+				Duration:  totalTime,
+			}, true
+		}
+
+		// Don't spin on a provider which returns before a replica is ready
+		if f.since(watchStart) < config.FunctionPollInterval {
+			if err := f.sleep(ctx, config.FunctionPollInterval); err != nil {
+				return cancelledResult(err, f.since(start)), true
+			}
+		}
+	}
+}
+
+// Query returns the replicas of a function from the provider, sharing the
+// query with concurrent callers, and caches the response
+func (f *FunctionScaler) Query(ctx context.Context, functionName, namespace string) (ServiceQueryResponse, error) {
+	getKey := fmt.Sprintf("GetReplicas-%s.%s", functionName, namespace)
+	res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+		return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
+	})
+	if err != nil {
+		return ServiceQueryResponse{}, err
+	}
+	if res == nil {
+		return ServiceQueryResponse{}, fmt.Errorf("empty response from server")
+	}
+
+	queryResponse := res.(ServiceQueryResponse)
+	f.Cache.Set(functionName, namespace, queryResponse)
+	return queryResponse, nil
+}
+
+// ScaleToZero sets the replicas of a function to zero and waits until none
+// are available, or ctx is done
+func (f *FunctionScaler) ScaleToZero(ctx context.Context, functionName, namespace string) FunctionScaleResult {
+	start := f.now()
 
 	// First check the cache, if there are available replicas, then the
 	// request can be served.
@@ -207,7 +356,7 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			Error:     nil,
 			Available: true,
 			Found:     true,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
@@ -215,8 +364,8 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 	// so query the live endpoint
 	log.Println("replicas == 0")
 	getKey := fmt.Sprintf("GetReplicas-%s.%s", functionName, namespace)
-	res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-		return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
+	res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+		return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
 	})
 
 	if err != nil {
@@ -224,7 +373,7 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			Error:     err,
 			Available: false,
 			Found:     false,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 	if res == nil {
@@ -232,7 +381,7 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			Error:     fmt.Errorf("empty response from server"),
 			Available: false,
 			Found:     false,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
@@ -242,7 +391,7 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			Error:     nil,
 			Available: true,
 			Found:     true,
-			Duration:  time.Since(start),
+			Duration:  f.since(start),
 		}
 	}
 
@@ -250,6 +399,8 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 	queryResponse := res.(ServiceQueryResponse)
 	f.Cache.Set(functionName, namespace, queryResponse)
 
+	config := f.Config.ForFunction(queryResponse.Annotations)
+
 	// If the desired replica count is 0, then a scale up event
 	// is required.
 	if queryResponse.Replicas > 0 {
@@ -257,10 +408,10 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 
 		// In a retry-loop, first query desired replicas, then
 		// set them if the value is still at 0.
-		scaleResult := types.Retry(func(attempt int) error {
+		scaleResult := types.RetryWithBackoff(ctx, f.clock(), func(attempt int) error {
 
-			res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-				return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
+			res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+				return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
 			})
 
 			if err != nil {
@@ -280,12 +431,12 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			// Request a scale up to the minimum amount of replicas
 			setKey := fmt.Sprintf("SetReplicas-%s.%s", functionName, namespace)
 
-			if _, err, _ := f.SingleFlight.Do(setKey, func() (interface{}, error) {
+			if _, err := f.do(ctx, setKey, func(ctx context.Context) (interface{}, error) {
 
 				log.Printf("[Scale %d/%d] function=%s N => %d requested",
 					attempt, int(f.Config.SetScaleRetries), functionName, minReplicas)
 
-				if err := f.Config.ServiceQuery.SetReplicas(functionName, namespace, minReplicas); err != nil {
+				if err := f.Config.ServiceQuery.SetReplicas(ctx, functionName, namespace, minReplicas); err != nil {
 					return nil, fmt.Errorf("unable to scale to zero function [%s], err: %s", functionName, err)
 				}
 				return nil, nil
@@ -295,32 +446,33 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 
 			return nil
 
-		}, "Scale", int(f.Config.SetScaleRetries), f.Config.FunctionPollInterval)
+		}, "Scale", int(config.SetScaleRetries), config.backoff())
 
 		if scaleResult != nil {
 			return FunctionScaleResult{
 				Error:     scaleResult,
 				Available: false,
 				Found:     true,
-				Duration:  time.Since(start),
+				Duration:  f.since(start),
 			}
 		}
 
 	}
 
 	// Holding pattern for at least one function replica to be available
-	for i := 0; i < int(f.Config.MaxPollCount); i++ {
+	backoff := config.backoff()
+	var interval time.Duration
 
-		res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
-			return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
-		})
-		queryResponse := res.(ServiceQueryResponse)
-
-		if err == nil {
-			f.Cache.Set(functionName, namespace, queryResponse)
+	for i := 0; i < int(config.MaxPollCount); i++ {
+		if err := ctx.Err(); err != nil {
+			return cancelledResult(err, f.since(start))
 		}
 
-		totalTime := time.Since(start)
+		res, err := f.do(ctx, getKey, func(ctx context.Context) (interface{}, error) {
+			return f.Config.ServiceQuery.GetReplicas(ctx, functionName, namespace)
+		})
+
+		totalTime := f.since(start)
 
 		if err != nil {
 			return FunctionScaleResult{
@@ -331,6 +483,9 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			}
 		}
 
+		queryResponse := res.(ServiceQueryResponse)
+		f.Cache.Set(functionName, namespace, queryResponse)
+
 		if queryResponse.AvailableReplicas == 0 {
 
 			log.Printf("[Ready] function=%s waited for - %.4fs", functionName, totalTime.Seconds())
@@ -343,13 +498,90 @@ func (f *FunctionScaler) ScaleToZero(functionName, namespace string) FunctionSca
 			}
 		}
 
-		time.Sleep(f.Config.FunctionPollInterval)
+		interval = backoff.Next(i, interval)
+		if err := f.sleep(ctx, interval); err != nil {
+			return cancelledResult(err, f.since(start))
+		}
 	}
 
 	return FunctionScaleResult{
 		Error:     nil,
 		Available: true,
 		Found:     true,
-		Duration:  time.Since(start),
+		Duration:  f.since(start),
 	}
 }
+
+// cancelledResult is returned when the context of a request is done before
+// its function was scaled
+func cancelledResult(err error, duration time.Duration) FunctionScaleResult {
+	return FunctionScaleResult{
+		Error:     err,
+		Available: false,
+		Found:     true,
+		Duration:  duration,
+	}
+}
+
+// do shares a call to fn between concurrent callers with the same key. A
+// caller stops waiting once its ctx is done, but the shared call carries on
+// for the other callers, without ctx's cancellation.
+func (f *FunctionScaler) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if ctx.Done() == nil {
+		res, err, _ := f.SingleFlight.Do(key, func() (interface{}, error) {
+			return fn(ctx)
+		})
+		return res, err
+	}
+
+	shared := withoutCancel{ctx}
+	ch := f.SingleFlight.DoChan(key, func() (interface{}, error) {
+		return fn(shared)
+	})
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// withoutCancel keeps the values of a context, such as for tracing, but
+// is never cancelled and has no deadline
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (withoutCancel) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancel) Err() error {
+	return nil
+}
+
+// clock is the ScalingConfig's Clock, or the system clock when unset
+func (f *FunctionScaler) clock() types.Clock {
+	if f.Config.Clock != nil {
+		return f.Config.Clock
+	}
+	return types.SystemClock{}
+}
+
+func (f *FunctionScaler) now() time.Time {
+	return f.clock().Now()
+}
+
+func (f *FunctionScaler) since(t time.Time) time.Duration {
+	return f.now().Sub(t)
+}
+
+// sleep waits d on the clock, or returns ctx's error once it is done
+func (f *FunctionScaler) sleep(ctx context.Context, d time.Duration) error {
+	return types.SleepContext(ctx, f.clock(), d)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// watchingServiceQuery wakes watchers as soon as a replica is ready
+type watchingServiceQuery struct {
+	*coldServiceQuery
+	supported bool
+	watches   int64
+}
+
+func (w *watchingServiceQuery) WatchReplicas(ctx context.Context, service, namespace string, timeout time.Duration) (ServiceQueryResponse, error) {
+	if !w.supported {
+		return ServiceQueryResponse{}, ErrWatchNotSupported
+	}
+	atomic.AddInt64(&w.watches, 1)
+
+	w.lock.Lock()
+	readyAt := w.scaledAt.Add(w.readyAfter)
+	w.lock.Unlock()
+
+	wait := time.Until(readyAt)
+	if wait > timeout {
+		wait = timeout
+	}
+	time.Sleep(wait)
+
+	return w.GetReplicas(ctx, service, namespace)
+}
+
+func newTestScaler(query ServiceQuery) FunctionScaler {
+	config := ScalingConfig{
+		MaxPollCount:         1000,
+		SetScaleRetries:      10,
+		FunctionPollInterval: time.Millisecond * 5,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         query,
+	}
+
+	return NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+}
+
+func Test_FunctionScaler_Scale_WatchesWhenSupported(t *testing.T) {
+	query := &watchingServiceQuery{
+		coldServiceQuery: &coldServiceQuery{readyAfter: time.Millisecond * 50},
+		supported:        true,
+	}
+	scaler := newTestScaler(query)
+
+	res := scaler.Scale(context.Background(), "echo", "openfaas-fn")
+	if res.Error != nil || !res.Available {
+		t.Fatalf("want the function to be available, got: %+v", res)
+	}
+
+	if got := atomic.LoadInt64(&query.watches); got != 1 {
+		t.Errorf("want a single watch, got: %d", got)
+	}
+
+	// Initial query plus one from the scale up retry loop, polling
+	// would need ten or more to wait out the cold start.
+	if got := atomic.LoadInt64(&query.getReplicas); got > 3 {
+		t.Errorf("want no polling while watching, got: %d queries", got)
+	}
+}
+
+func Test_FunctionScaler_Scale_PollsWhenWatchNotSupported(t *testing.T) {
+	query := &watchingServiceQuery{
+		coldServiceQuery: &coldServiceQuery{readyAfter: time.Millisecond * 50},
+	}
+	scaler := newTestScaler(query)
+
+	res := scaler.Scale(context.Background(), "echo", "openfaas-fn")
+	if res.Error != nil || !res.Available {
+		t.Fatalf("want the function to be available, got: %+v", res)
+	}
+
+	if got := atomic.LoadInt64(&query.getReplicas); got < 5 {
+		t.Errorf("want the scaler to fall back to polling, got: %d queries", got)
+	}
+}
+
+// steppingClock advances when slept on, rather than waiting
+type steppingClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *steppingClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// clockServiceQuery makes a replica available readyAfter a scale up, on clock
+type clockServiceQuery struct {
+	clock       *steppingClock
+	readyAfter  time.Duration
+	readyAt     time.Time
+	replicas    uint64
+	annotations map[string]string
+	queries     int
+}
+
+func (c *clockServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (ServiceQueryResponse, error) {
+	c.queries++
+
+	available := uint64(0)
+	if c.replicas > 0 && !c.clock.Now().Before(c.readyAt) {
+		available = c.replicas
+	}
+
+	annotations := c.annotations
+	return ServiceQueryResponse{Replicas: c.replicas, AvailableReplicas: available, Annotations: &annotations}, nil
+}
+
+func (c *clockServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	c.replicas = count
+	c.readyAt = c.clock.Now().Add(c.readyAfter)
+	return nil
+}
+
+func Test_FunctionScaler_Scale_WaitsOnConfiguredClock(t *testing.T) {
+	clock := &steppingClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	query := &clockServiceQuery{clock: clock, readyAfter: time.Minute}
+
+	scaler := newTestScaler(query)
+	scaler.Config.Clock = clock
+	scaler.Config.FunctionPollInterval = time.Second
+	scaler.Cache = &FunctionCache{Cache: make(map[string]*FunctionMeta), Expiry: time.Second, Clock: clock}
+
+	started := time.Now()
+	res := scaler.Scale(context.Background(), "echo", "openfaas-fn")
+
+	if res.Error != nil || !res.Available {
+		t.Fatalf("want the function to be available, got: %+v", res)
+	}
+	if res.Duration != time.Minute {
+		t.Errorf("want a cold start of: %s on the clock, got: %s", time.Minute, res.Duration)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("want no real time spent waiting, took: %s", elapsed)
+	}
+}
+
+func Test_FunctionScaler_Scale_BacksOffFromAnnotations(t *testing.T) {
+	clock := &steppingClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	query := &clockServiceQuery{
+		clock:      clock,
+		readyAfter: time.Minute,
+		annotations: map[string]string{
+			BackoffAnnotation:         "exponential",
+			PollIntervalAnnotation:    "1s",
+			MaxPollIntervalAnnotation: "8s",
+		},
+	}
+
+	scaler := newTestScaler(query)
+	scaler.Config.Clock = clock
+	scaler.Config.FunctionPollInterval = time.Second
+	scaler.Cache = &FunctionCache{Cache: make(map[string]*FunctionMeta), Expiry: time.Second, Clock: clock}
+
+	res := scaler.Scale(context.Background(), "echo", "openfaas-fn")
+
+	if res.Error != nil || !res.Available {
+		t.Fatalf("want the function to be available, got: %+v", res)
+	}
+	if res.Duration < time.Minute {
+		t.Errorf("want a cold start of at least: %s, got: %s", time.Minute, res.Duration)
+	}
+
+	// Polling every second would take 60 queries
+	if query.queries > 30 {
+		t.Errorf("want the scaler to back off, got: %d queries", query.queries)
+	}
+}
+
+func Test_FunctionScaler_Scale_MaxPollCountAnnotation(t *testing.T) {
+	clock := &steppingClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	query := &clockServiceQuery{
+		clock:       clock,
+		readyAfter:  time.Minute * 10,
+		annotations: map[string]string{MaxPollCountAnnotation: "900"},
+	}
+
+	scaler := newTestScaler(query)
+	scaler.Config.Clock = clock
+	scaler.Config.MaxPollCount = 100
+	scaler.Config.FunctionPollInterval = time.Second
+	scaler.Cache = &FunctionCache{Cache: make(map[string]*FunctionMeta), Expiry: time.Second, Clock: clock}
+
+	res := scaler.Scale(context.Background(), "echo", "openfaas-fn")
+
+	if res.Duration != time.Minute*10 {
+		t.Errorf("want the scaler to wait: %s for a replica, got: %s", time.Minute*10, res.Duration)
+	}
+}
+
+func Test_ScalingConfig_PollTimeout(t *testing.T) {
+	config := ScalingConfig{MaxPollCount: 10, FunctionPollInterval: time.Second, MaxPollInterval: time.Second * 4}
+
+	if got := config.pollTimeout(); got != time.Second*10 {
+		t.Errorf("constant, want: %s, got: %s", time.Second*10, got)
+	}
+
+	// 1s, 2s, then 4s for the remaining 8 polls
+	config.Backoff = "exponential"
+	if got := config.pollTimeout(); got != time.Second*35 {
+		t.Errorf("exponential, want: %s, got: %s", time.Second*35, got)
+	}
+}
+
+func Test_FunctionScaler_Scale_StopsPollingWhenCancelled(t *testing.T) {
+	query := &coldServiceQuery{neverStarted: true}
+	scaler := newTestScaler(query)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	res := scaler.Scale(ctx, "echo", "openfaas-fn")
+	if res.Error != context.DeadlineExceeded || res.Available {
+		t.Fatalf("want: %s, got: %+v", context.DeadlineExceeded, res)
+	}
+	if !res.ColdStart {
+		t.Errorf("want a cold start")
+	}
+
+	queries := atomic.LoadInt64(&query.getReplicas)
+	time.Sleep(time.Millisecond * 50)
+	if got := atomic.LoadInt64(&query.getReplicas); got != queries {
+		t.Errorf("want polling to stop, got: %d more queries", got-queries)
+	}
+}
+
+func Test_FunctionScaler_Scale_CancelledDuringPollInterval(t *testing.T) {
+	query := &coldServiceQuery{neverStarted: true}
+	scaler := newTestScaler(query)
+	scaler.Config.FunctionPollInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	start := time.Now()
+	res := scaler.Scale(ctx, "echo", "openfaas-fn")
+
+	if res.Error != context.DeadlineExceeded || res.Available {
+		t.Fatalf("want: %s, got: %+v", context.DeadlineExceeded, res)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want the poll interval cut short, took: %s", took)
+	}
+}
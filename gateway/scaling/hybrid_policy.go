@@ -0,0 +1,427 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// KeepAlivePolicyAnnotation selects the keep-alive policy for a function,
+	// either KeepAlivePolicyFixed or KeepAlivePolicyHybrid
+	KeepAlivePolicyAnnotation = "com.openfaas.scale.keep-alive-policy"
+
+	// KeepAlivePolicyFixed scales to zero after a fixed idle duration, see IdleReaper
+	KeepAlivePolicyFixed = "fixed"
+
+	// KeepAlivePolicyHybrid derives pre-warm and keep-alive windows from a
+	// histogram of idle times, see HybridHistogramPolicy
+	KeepAlivePolicyHybrid = "hybrid"
+)
+
+// HybridPolicyConfig tunes the HybridHistogramPolicy, the defaults
+// follow "Serverless in the Wild" (Shahrad et al, ATC '20)
+type HybridPolicyConfig struct {
+	// BinWidth is the width of each histogram bin
+	BinWidth time.Duration
+
+	// Range is the longest idle time tracked in the histogram, longer
+	// idle times are counted as out-of-bounds
+	Range time.Duration
+
+	// HeadPercentile of idle times used for the pre-warm window
+	HeadPercentile float64
+
+	// TailPercentile of idle times used for the keep-alive window
+	TailPercentile float64
+
+	// Margin widens the windows to absorb small variations, i.e. 0.1 for 10%
+	Margin float64
+
+	// MinSamples is the number of idle times needed before the histogram
+	// is considered representative
+	MinSamples uint64
+
+	// MinCV is the lowest coefficient of variation of the bin counts for the
+	// histogram to be considered representative, a flat histogram has no pattern
+	MinCV float64
+
+	// MaxOutOfBounds is the highest fraction of out-of-bounds idle times before
+	// the histogram is considered unrepresentative
+	MaxOutOfBounds float64
+
+	// DefaultKeepAlive is used with no pre-warm window while the histogram is
+	// unrepresentative
+	DefaultKeepAlive time.Duration
+}
+
+// DefaultHybridPolicyConfig uses one-minute bins over a four hour range,
+// the 5th and 99th percentiles and a 10% margin
+func DefaultHybridPolicyConfig() HybridPolicyConfig {
+	return HybridPolicyConfig{
+		BinWidth:         time.Minute,
+		Range:            time.Hour * 4,
+		HeadPercentile:   5,
+		TailPercentile:   99,
+		Margin:           0.1,
+		MinSamples:       10,
+		MinCV:            2,
+		MaxOutOfBounds:   0.5,
+		DefaultKeepAlive: time.Hour * 4,
+	}
+}
+
+// KeepAliveWindows are derived per function by the HybridHistogramPolicy.
+// After an invocation completes the function is unloaded for PreWarm,
+// then loaded and kept warm for KeepAlive.
+type KeepAliveWindows struct {
+	PreWarm   time.Duration
+	KeepAlive time.Duration
+}
+
+// HybridHistogramPolicy keeps a histogram of the idle times between
+// invocations of each function. Functions are scaled to zero after
+// an invocation until just before the next expected arrival, and
+// kept warm for the tail of the histogram.
+type HybridHistogramPolicy struct {
+	Config        HybridPolicyConfig
+	Scaler        *FunctionScaler
+	ServiceQuery  ServiceQuery
+	FunctionQuery FunctionQuery
+
+	// DefaultPolicy applies to functions without the KeepAlivePolicyAnnotation
+	DefaultPolicy string
+
+	functions map[string]*hybridFunction
+	lock      sync.Mutex
+
+	// applying tracks the scale requests started by Reconcile
+	applying sync.WaitGroup
+}
+
+type hybridFunction struct {
+	name      string
+	namespace string
+
+	bins        []uint64
+	samples     uint64
+	outOfBounds uint64
+
+	inFlight      int64
+	lastCompleted time.Time
+
+	// applied is the state last requested of the provider for the
+	// idle period which began at appliedFor
+	applied    string
+	appliedFor time.Time
+	pending    bool
+}
+
+const (
+	hybridUnloaded = "unloaded"
+	hybridWarm     = "warm"
+)
+
+// NewHybridHistogramPolicy creates a HybridHistogramPolicy
+func NewHybridHistogramPolicy(config HybridPolicyConfig, scaler *FunctionScaler, functionQuery FunctionQuery, defaultPolicy string) *HybridHistogramPolicy {
+	return &HybridHistogramPolicy{
+		Config:        config,
+		Scaler:        scaler,
+		ServiceQuery:  scaler.Config.ServiceQuery,
+		FunctionQuery: functionQuery,
+		DefaultPolicy: defaultPolicy,
+		functions:     make(map[string]*hybridFunction),
+	}
+}
+
+// Started records the idle time since the last invocation completed
+func (p *HybridHistogramPolicy) Started(functionName, namespace string, at time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn := p.get(functionName, namespace)
+	if fn.inFlight == 0 && !fn.lastCompleted.IsZero() {
+		fn.record(at.Sub(fn.lastCompleted), p.Config)
+	}
+	fn.inFlight++
+}
+
+// Completed starts a new idle period for the function
+func (p *HybridHistogramPolicy) Completed(functionName, namespace string, at time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn := p.get(functionName, namespace)
+	if fn.inFlight > 0 {
+		fn.inFlight--
+	}
+	if at.After(fn.lastCompleted) {
+		fn.lastCompleted = at
+	}
+}
+
+// Windows returns the pre-warm and keep-alive windows for a function
+func (p *HybridHistogramPolicy) Windows(functionName, namespace string) KeepAliveWindows {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.get(functionName, namespace).windows(p.Config)
+}
+
+// Start reconciles functions on every interval
+func (p *HybridHistogramPolicy) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			p.Reconcile(time.Now())
+		}
+	}()
+}
+
+// Reconcile unloads or pre-warms each function according to its
+// windows and the time since its last invocation completed
+func (p *HybridHistogramPolicy) Reconcile(now time.Time) {
+	p.lock.Lock()
+	functions := make([]*hybridFunction, 0, len(p.functions))
+	for _, fn := range p.functions {
+		functions = append(functions, fn)
+	}
+	p.lock.Unlock()
+
+	for _, fn := range functions {
+		p.reconcileFunction(fn, now)
+	}
+}
+
+func (p *HybridHistogramPolicy) reconcileFunction(fn *hybridFunction, now time.Time) {
+	p.lock.Lock()
+	if fn.inFlight > 0 || fn.pending || fn.lastCompleted.IsZero() {
+		p.lock.Unlock()
+		return
+	}
+
+	windows := fn.windows(p.Config)
+	idle := now.Sub(fn.lastCompleted)
+
+	want := hybridWarm
+	if idle < windows.PreWarm || idle >= windows.PreWarm+windows.KeepAlive {
+		want = hybridUnloaded
+	}
+
+	// Nothing to do if the state has already been applied for this idle
+	// period, or the function has not been unloaded yet to need pre-warming.
+	if fn.appliedFor.Equal(fn.lastCompleted) && fn.applied == want ||
+		want == hybridWarm && !(fn.appliedFor.Equal(fn.lastCompleted) && fn.applied == hybridUnloaded) {
+		p.lock.Unlock()
+		return
+	}
+	lastCompleted := fn.lastCompleted
+	p.lock.Unlock()
+
+	annotations, err := p.FunctionQuery.GetAnnotations(fn.name, fn.namespace)
+	if err != nil {
+		log.Printf("[Hybrid] function=%s.%s unable to get annotations: %s", fn.name, fn.namespace, err)
+		return
+	}
+	if policy := KeepAlivePolicy(annotations, p.DefaultPolicy); policy != KeepAlivePolicyHybrid {
+		return
+	}
+	if want == hybridUnloaded && ScheduledMinReplicas(annotations, now) > 0 {
+		return
+	}
+
+	p.lock.Lock()
+	fn.pending = true
+	p.lock.Unlock()
+
+	p.applying.Add(1)
+	go func() {
+		defer p.applying.Done()
+
+		applied := p.apply(fn, want, windows)
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		fn.pending = false
+		if applied {
+			fn.applied = want
+			fn.appliedFor = lastCompleted
+		}
+	}()
+}
+
+// Wait blocks until the scale requests started by Reconcile have completed
+func (p *HybridHistogramPolicy) Wait() {
+	p.applying.Wait()
+}
+
+func (p *HybridHistogramPolicy) apply(fn *hybridFunction, want string, windows KeepAliveWindows) bool {
+	if want == hybridUnloaded {
+		log.Printf("[Hybrid] function=%s.%s unloading, pre-warm: %s, keep-alive: %s",
+			fn.name, fn.namespace, windows.PreWarm, windows.KeepAlive)
+
+		res := p.Scaler.ScaleToZero(context.Background(), fn.name, fn.namespace)
+		if res.Error != nil {
+			log.Printf("[Hybrid] function=%s.%s unable to scale to zero: %s", fn.name, fn.namespace, res.Error)
+			return false
+		}
+		return true
+	}
+
+	queryResponse, err := p.ServiceQuery.GetReplicas(context.Background(), fn.name, fn.namespace)
+	if err != nil {
+		log.Printf("[Hybrid] function=%s.%s unable to get replicas: %s", fn.name, fn.namespace, err)
+		return false
+	}
+	if queryResponse.Replicas > 0 {
+		return true
+	}
+
+	minReplicas := uint64(1)
+	if queryResponse.MinReplicas > 0 {
+		minReplicas = queryResponse.MinReplicas
+	}
+
+	log.Printf("[Hybrid] function=%s.%s pre-warming 0 => %d, keep-alive: %s",
+		fn.name, fn.namespace, minReplicas, windows.KeepAlive)
+
+	if err := p.ServiceQuery.SetReplicas(context.Background(), fn.name, fn.namespace, minReplicas); err != nil {
+		log.Printf("[Hybrid] function=%s.%s unable to pre-warm: %s", fn.name, fn.namespace, err)
+		return false
+	}
+	return true
+}
+
+// get must be called with the lock held
+func (p *HybridHistogramPolicy) get(functionName, namespace string) *hybridFunction {
+	key := functionName + "." + namespace
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &hybridFunction{
+			name:      functionName,
+			namespace: namespace,
+			bins:      make([]uint64, binCount(p.Config)),
+		}
+		p.functions[key] = fn
+	}
+	return fn
+}
+
+func binCount(config HybridPolicyConfig) int {
+	if config.BinWidth <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(config.Range) / float64(config.BinWidth)))
+}
+
+func (fn *hybridFunction) record(idle time.Duration, config HybridPolicyConfig) {
+	fn.samples++
+
+	if idle < 0 {
+		idle = 0
+	}
+	bin := int(idle / config.BinWidth)
+	if idle > config.Range || bin >= len(fn.bins) {
+		fn.outOfBounds++
+		return
+	}
+	fn.bins[bin]++
+}
+
+func (fn *hybridFunction) windows(config HybridPolicyConfig) KeepAliveWindows {
+	fallback := KeepAliveWindows{KeepAlive: config.DefaultKeepAlive}
+
+	inBounds := fn.samples - fn.outOfBounds
+	if fn.samples < config.MinSamples || inBounds == 0 {
+		return fallback
+	}
+	if float64(fn.outOfBounds)/float64(fn.samples) > config.MaxOutOfBounds {
+		return fallback
+	}
+	if binCV(fn.bins) < config.MinCV {
+		return fallback
+	}
+
+	head := percentileBin(fn.bins, inBounds, config.HeadPercentile)
+	tail := percentileBin(fn.bins, inBounds, config.TailPercentile)
+
+	preWarm := time.Duration(float64(time.Duration(head)*config.BinWidth) * (1 - config.Margin))
+	keepAlive := time.Duration(float64(time.Duration(tail+1)*config.BinWidth)*(1+config.Margin)) - preWarm
+
+	return KeepAliveWindows{
+		PreWarm:   preWarm,
+		KeepAlive: keepAlive,
+	}
+}
+
+// percentileBin finds the first bin at which the cumulative count
+// reaches the percentile of total
+func percentileBin(bins []uint64, total uint64, percentile float64) int {
+	threshold := float64(total) * percentile / 100
+	var cumulative uint64
+	for i, count := range bins {
+		cumulative += count
+		if float64(cumulative) >= threshold && cumulative > 0 {
+			return i
+		}
+	}
+	return len(bins) - 1
+}
+
+// binCV is the coefficient of variation of the bin counts
+func binCV(bins []uint64) float64 {
+	if len(bins) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, count := range bins {
+		sum += float64(count)
+	}
+	mean := sum / float64(len(bins))
+	if mean == 0 {
+		return 0
+	}
+
+	var variance float64
+	for _, count := range bins {
+		variance += math.Pow(float64(count)-mean, 2)
+	}
+	variance /= float64(len(bins))
+
+	return math.Sqrt(variance) / mean
+}
+
+// ValidateKeepAlivePolicy returns an error unless policy is
+// KeepAlivePolicyFixed, KeepAlivePolicyHybrid or empty for the default
+func ValidateKeepAlivePolicy(policy string) error {
+	switch policy {
+	case "", KeepAlivePolicyFixed, KeepAlivePolicyHybrid:
+		return nil
+	}
+	return fmt.Errorf("keep-alive policy must be %s or %s, got: %s", KeepAlivePolicyFixed, KeepAlivePolicyHybrid, policy)
+}
+
+// KeepAlivePolicy returns the keep-alive policy for a function
+// from its annotations, or fallback when it is missing or invalid
+func KeepAlivePolicy(annotations map[string]string, fallback string) string {
+	if policy, ok := annotations[KeepAlivePolicyAnnotation]; ok && len(policy) > 0 {
+		err := ValidateKeepAlivePolicy(policy)
+		if err == nil {
+			return policy
+		}
+		log.Printf("Provided annotation %s=%s is invalid: %s", KeepAlivePolicyAnnotation, policy, err)
+	}
+	if len(fallback) == 0 {
+		return KeepAlivePolicyFixed
+	}
+	return fallback
+}
@@ -0,0 +1,181 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestHybridPolicy(query *fakeServiceQuery) *HybridHistogramPolicy {
+	config := ScalingConfig{
+		MaxPollCount:         10,
+		SetScaleRetries:      10,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+	}
+
+	// Pre-warming sets replicas directly, so the scaler's cache must not
+	// outlive it for the next unload to see the function warm
+	scaler := NewFunctionScaler(config, NewFunctionCache(0))
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(config.CacheExpiry), query)
+
+	return NewHybridHistogramPolicy(DefaultHybridPolicyConfig(), &scaler, functionQuery, KeepAlivePolicyHybrid)
+}
+
+// invokeEvery simulates invocations which complete instantly, with
+// the given idle time between them, and returns the last completion
+func invokeEvery(p *HybridHistogramPolicy, idle time.Duration, count int) time.Time {
+	at := time.Now()
+	for i := 0; i < count; i++ {
+		p.Started("echo", "openfaas-fn", at)
+		p.Completed("echo", "openfaas-fn", at)
+		at = at.Add(idle)
+	}
+	return at.Add(-idle)
+}
+
+func Test_HybridPolicy_FallbackWindowsWithoutSamples(t *testing.T) {
+	p := newTestHybridPolicy(&fakeServiceQuery{replicas: 1})
+	invokeEvery(p, time.Minute*10, 3)
+
+	got := p.Windows("echo", "openfaas-fn")
+	want := KeepAliveWindows{KeepAlive: p.Config.DefaultKeepAlive}
+	if got != want {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_HybridPolicy_WindowsFromRegularArrivals(t *testing.T) {
+	p := newTestHybridPolicy(&fakeServiceQuery{replicas: 1})
+	invokeEvery(p, time.Minute*10+time.Second*30, 50)
+
+	got := p.Windows("echo", "openfaas-fn")
+
+	wantPreWarm := time.Duration(float64(time.Minute*10) * 0.9)
+	if got.PreWarm != wantPreWarm {
+		t.Errorf("PreWarm want: %s, got: %s", wantPreWarm, got.PreWarm)
+	}
+
+	wantKeepAlive := time.Duration(float64(time.Minute*11)*1.1) - wantPreWarm
+	if got.KeepAlive != wantKeepAlive {
+		t.Errorf("KeepAlive want: %s, got: %s", wantKeepAlive, got.KeepAlive)
+	}
+}
+
+func Test_HybridPolicy_OutOfBoundsFallsBack(t *testing.T) {
+	p := newTestHybridPolicy(&fakeServiceQuery{replicas: 1})
+	invokeEvery(p, time.Hour*5, 20)
+
+	got := p.Windows("echo", "openfaas-fn")
+	want := KeepAliveWindows{KeepAlive: p.Config.DefaultKeepAlive}
+	if got != want {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+}
+
+func Test_HybridPolicy_UnloadsThenPreWarms(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	p := newTestHybridPolicy(query)
+	last := invokeEvery(p, time.Minute*10+time.Second*30, 50)
+
+	p.Reconcile(last.Add(time.Minute))
+	calls := waitForScaling(t, p.Wait, query)
+	if len(calls) != 1 || calls[0] != 0 {
+		t.Fatalf("want the function to be unloaded after execution, got: %v", calls)
+	}
+
+	p.Reconcile(last.Add(time.Minute * 10))
+	calls = waitForScaling(t, p.Wait, query)
+	if len(calls) != 2 || calls[1] != 1 {
+		t.Fatalf("want the function to be pre-warmed, got: %v", calls)
+	}
+
+	p.Reconcile(last.Add(time.Minute * 30))
+	calls = waitForScaling(t, p.Wait, query)
+	if len(calls) != 3 || calls[2] != 0 {
+		t.Fatalf("want the function to be unloaded after keep-alive, got: %v", calls)
+	}
+}
+
+func Test_HybridPolicy_IgnoresFixedPolicyFunctions(t *testing.T) {
+	query := &fakeServiceQuery{
+		replicas:    1,
+		annotations: map[string]string{KeepAlivePolicyAnnotation: KeepAlivePolicyFixed},
+	}
+	p := newTestHybridPolicy(query)
+	last := invokeEvery(p, time.Minute*10+time.Second*30, 50)
+
+	p.Reconcile(last.Add(time.Minute))
+	if calls := waitForScaling(t, p.Wait, query); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_HybridPolicy_ProviderUnreachable(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	query.failSetReplicas(errors.New("connection refused"))
+	p := newTestHybridPolicy(query)
+	last := invokeEvery(p, time.Minute*10+time.Second*30, 50)
+
+	p.Reconcile(last.Add(time.Minute))
+	waitForScaling(t, p.Wait, query)
+
+	if len(query.calls()) == 0 || query.currentReplicas() != 1 {
+		t.Fatalf("want a failed unload, got calls: %v, replicas: %d", query.calls(), query.currentReplicas())
+	}
+
+	// A failed unload is not recorded as applied, so it is tried again
+	p.lock.Lock()
+	fn := p.functions["echo.openfaas-fn"]
+	applied, pending := fn.applied, fn.pending
+	p.lock.Unlock()
+	if applied == hybridUnloaded || pending {
+		t.Fatalf("want the unload neither applied nor pending, got applied: %q, pending: %t", applied, pending)
+	}
+
+	// The unload is tried again once the provider is back
+	query.failSetReplicas(nil)
+	p.Reconcile(last.Add(time.Minute * 2))
+	waitForScaling(t, p.Wait, query)
+
+	if query.currentReplicas() != 0 {
+		t.Fatalf("want the function unloaded, got replicas: %d", query.currentReplicas())
+	}
+}
+
+func Test_ValidateKeepAlivePolicy(t *testing.T) {
+	for _, policy := range []string{"", KeepAlivePolicyFixed, KeepAlivePolicyHybrid} {
+		if err := ValidateKeepAlivePolicy(policy); err != nil {
+			t.Errorf("%q, want no error, got: %s", policy, err)
+		}
+	}
+
+	if err := ValidateKeepAlivePolicy("forever"); err == nil {
+		t.Errorf("want an error for an unknown policy")
+	}
+}
+
+func Test_KeepAlivePolicy_InvalidAnnotationFallsBack(t *testing.T) {
+	cases := []struct {
+		annotation string
+		fallback   string
+		want       string
+	}{
+		{"", "", KeepAlivePolicyFixed},
+		{"", KeepAlivePolicyHybrid, KeepAlivePolicyHybrid},
+		{KeepAlivePolicyHybrid, "", KeepAlivePolicyHybrid},
+		{"forever", KeepAlivePolicyHybrid, KeepAlivePolicyHybrid},
+		{"Hybrid", "", KeepAlivePolicyFixed},
+	}
+
+	for _, c := range cases {
+		annotations := map[string]string{KeepAlivePolicyAnnotation: c.annotation}
+		if got := KeepAlivePolicy(annotations, c.fallback); got != c.want {
+			t.Errorf("annotation %q with fallback %q, want: %s, got: %s", c.annotation, c.fallback, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ZeroDurationAnnotation sets how long a function may go without an
+// invocation before it is scaled to zero, i.e. "15m". A value of "0"
+// disables scale to zero for the function.
+const ZeroDurationAnnotation = "com.openfaas.scale.zero-duration"
+
+// IdleReaper scales functions to zero replicas once they have been
+// idle for longer than their zero-duration
+type IdleReaper struct {
+	Tracker       *InvocationTracker
+	Scaler        *FunctionScaler
+	FunctionQuery FunctionQuery
+
+	// DefaultIdleDuration applies to functions without the
+	// ZeroDurationAnnotation, zero disables the reaper for them
+	DefaultIdleDuration time.Duration
+
+	// DefaultPolicy applies to functions without the KeepAlivePolicyAnnotation,
+	// only functions with the KeepAlivePolicyFixed policy are reaped
+	DefaultPolicy string
+
+	// reaped holds the last invocation time of each function at
+	// the point it was scaled to zero
+	reaped map[string]time.Time
+	// pending holds functions with a scale to zero in progress
+	pending map[string]bool
+	lock    sync.Mutex
+
+	// scaling tracks scale to zero requests started by Reconcile
+	scaling sync.WaitGroup
+}
+
+// NewIdleReaper creates an IdleReaper for the functions seen by tracker
+func NewIdleReaper(tracker *InvocationTracker, scaler *FunctionScaler, functionQuery FunctionQuery, defaultIdleDuration time.Duration, defaultPolicy string) *IdleReaper {
+	return &IdleReaper{
+		Tracker:             tracker,
+		Scaler:              scaler,
+		FunctionQuery:       functionQuery,
+		DefaultIdleDuration: defaultIdleDuration,
+		DefaultPolicy:       defaultPolicy,
+		reaped:              make(map[string]time.Time),
+		pending:             make(map[string]bool),
+	}
+}
+
+// Start reconciles idle functions on every interval
+func (r *IdleReaper) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			r.Reconcile(time.Now())
+		}
+	}()
+}
+
+// Reconcile scales any function to zero which has been idle for
+// longer than its zero-duration at the time now
+func (r *IdleReaper) Reconcile(now time.Time) {
+	for _, activity := range r.Tracker.List() {
+		if activity.InFlight > 0 {
+			continue
+		}
+
+		key := activity.Name + "." + activity.Namespace
+
+		r.lock.Lock()
+		reapedAt, reaped := r.reaped[key]
+		pending := r.pending[key]
+		r.lock.Unlock()
+
+		if pending || (reaped && !activity.LastInvocation.After(reapedAt)) {
+			continue
+		}
+
+		annotations, err := r.FunctionQuery.GetAnnotations(activity.Name, activity.Namespace)
+		if err != nil {
+			log.Printf("[Idle] function=%s.%s unable to get annotations: %s", activity.Name, activity.Namespace, err)
+			continue
+		}
+
+		if KeepAlivePolicy(annotations, r.DefaultPolicy) != KeepAlivePolicyFixed {
+			continue
+		}
+
+		// A function is kept at its scheduled minimum replicas
+		if ScheduledMinReplicas(annotations, now) > 0 {
+			continue
+		}
+
+		idleDuration := parseDurationAnnotation(annotations, ZeroDurationAnnotation, r.DefaultIdleDuration)
+		if idleDuration <= 0 || now.Sub(activity.LastInvocation) < idleDuration {
+			continue
+		}
+
+		r.lock.Lock()
+		r.pending[key] = true
+		r.lock.Unlock()
+
+		r.scaling.Add(1)
+		go func(activity FunctionActivity) {
+			defer r.scaling.Done()
+			r.scaleToZero(activity, now.Sub(activity.LastInvocation))
+		}(activity)
+	}
+}
+
+// Wait blocks until the scale to zero requests started by Reconcile
+// have completed
+func (r *IdleReaper) Wait() {
+	r.scaling.Wait()
+}
+
+func (r *IdleReaper) scaleToZero(activity FunctionActivity, idle time.Duration) {
+	key := activity.Name + "." + activity.Namespace
+
+	log.Printf("[Idle] function=%s.%s idle for %.4fs, scaling to zero", activity.Name, activity.Namespace, idle.Seconds())
+	res := r.Scaler.ScaleToZero(context.Background(), activity.Name, activity.Namespace)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.pending, key)
+	if res.Error != nil {
+		log.Printf("[Idle] function=%s.%s unable to scale to zero: %s", activity.Name, activity.Namespace, res.Error)
+		return
+	}
+	r.reaped[key] = activity.LastInvocation
+}
+
+// parseDurationAnnotation reads a duration such as "30s" or a whole
+// number of seconds from annotations, or returns fallback
+func parseDurationAnnotation(annotations map[string]string, key string, fallback time.Duration) time.Duration {
+	val, ok := annotations[key]
+	if !ok || len(val) == 0 {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("Provided annotation %s=%s should be a duration", key, val)
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,244 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeServiceQuery struct {
+	lock        sync.Mutex
+	replicas    uint64
+	annotations map[string]string
+	setCalls    []uint64
+
+	// setErr fails every SetReplicas, as when the provider is unreachable
+	setErr error
+}
+
+func (f *fakeServiceQuery) GetReplicas(ctx context.Context, service, namespace string) (ServiceQueryResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	annotations := f.annotations
+	return ServiceQueryResponse{
+		Replicas:          f.replicas,
+		AvailableReplicas: f.replicas,
+		MaxReplicas:       DefaultMaxReplicas,
+		ScalingFactor:     DefaultScalingFactor,
+		Annotations:       &annotations,
+	}, nil
+}
+
+func (f *fakeServiceQuery) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setCalls = append(f.setCalls, count)
+	if f.setErr != nil {
+		return f.setErr
+	}
+	f.replicas = count
+	return nil
+}
+
+func (f *fakeServiceQuery) failSetReplicas(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setErr = err
+}
+
+func (f *fakeServiceQuery) currentReplicas() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.replicas
+}
+
+func (f *fakeServiceQuery) calls() []uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]uint64{}, f.setCalls...)
+}
+
+func newTestReaper(query *fakeServiceQuery, defaultIdle time.Duration) (*IdleReaper, *InvocationTracker) {
+	config := ScalingConfig{
+		MaxPollCount:         10,
+		SetScaleRetries:      10,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+	}
+
+	scaler := NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(config.CacheExpiry), query)
+	tracker := NewInvocationTracker()
+
+	return NewIdleReaper(tracker, &scaler, functionQuery, defaultIdle, KeepAlivePolicyFixed), tracker
+}
+
+// waitForScaling waits on wait for the scale requests started by Reconcile,
+// then returns the replicas requested of query. The test fails if they
+// have not completed within a second.
+func waitForScaling(t *testing.T, wait func(), query *fakeServiceQuery) []uint64 {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for scale requests")
+	}
+	return query.calls()
+}
+
+func Test_IdleReaper_ScalesIdleFunctionToZero(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	reaper, tracker := newTestReaper(query, time.Minute)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(2 * time.Minute))
+
+	calls := waitForScaling(t, reaper.Wait, query)
+	if len(calls) != 1 || calls[0] != 0 {
+		t.Fatalf("want a single scale to zero, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_KeepsRecentlyInvokedFunction(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	reaper, tracker := newTestReaper(query, time.Minute)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(30 * time.Second))
+
+	if calls := waitForScaling(t, reaper.Wait, query); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_KeepsFunctionWithInFlightRequest(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	reaper, tracker := newTestReaper(query, time.Minute)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(2 * time.Minute))
+
+	if calls := waitForScaling(t, reaper.Wait, query); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_AnnotationOverridesDefault(t *testing.T) {
+	query := &fakeServiceQuery{
+		replicas:    1,
+		annotations: map[string]string{ZeroDurationAnnotation: "10s"},
+	}
+	reaper, tracker := newTestReaper(query, 0)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(11 * time.Second))
+
+	calls := waitForScaling(t, reaper.Wait, query)
+	if len(calls) != 1 || calls[0] != 0 {
+		t.Fatalf("want a single scale to zero, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_DisabledByDefault(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	reaper, tracker := newTestReaper(query, 0)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(24 * time.Hour))
+
+	if calls := waitForScaling(t, reaper.Wait, query); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_KeepsFunctionAtScheduledMinimum(t *testing.T) {
+	query := &fakeServiceQuery{
+		replicas:    1,
+		annotations: map[string]string{ScheduleAnnotation: "min=1 on weekdays 08:00-18:00, otherwise 0"},
+	}
+	reaper, tracker := newTestReaper(query, time.Minute)
+
+	// Monday at 09:00 UTC
+	start := time.Date(2023, time.October, 2, 9, 0, 0, 0, time.UTC)
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(2 * time.Minute))
+	if calls := waitForScaling(t, reaper.Wait, query); len(calls) != 0 {
+		t.Fatalf("want no scaling within the schedule, got: %v", calls)
+	}
+
+	reaper.Reconcile(start.Add(10 * time.Hour))
+	calls := waitForScaling(t, reaper.Wait, query)
+	if len(calls) != 1 || calls[0] != 0 {
+		t.Fatalf("want a single scale to zero outside the schedule, got: %v", calls)
+	}
+}
+
+func Test_IdleReaper_ProviderUnreachable(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 1}
+	query.failSetReplicas(errors.New("connection refused"))
+	reaper, tracker := newTestReaper(query, time.Minute)
+
+	start := time.Now()
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Completed("echo", "openfaas-fn", start)
+
+	reaper.Reconcile(start.Add(2 * time.Minute))
+	waitForScaling(t, reaper.Wait, query)
+
+	if len(query.calls()) == 0 || query.currentReplicas() != 1 {
+		t.Fatalf("want a failed scale to zero, got calls: %v, replicas: %d", query.calls(), query.currentReplicas())
+	}
+
+	// A failed scale to zero is not recorded, so the function stays a
+	// candidate without another invocation
+	reaper.lock.Lock()
+	_, reaped := reaper.reaped["echo.openfaas-fn"]
+	pending := reaper.pending["echo.openfaas-fn"]
+	reaper.lock.Unlock()
+	if reaped || pending {
+		t.Fatalf("want the function neither reaped nor pending, got reaped: %t, pending: %t", reaped, pending)
+	}
+
+	// The function is reaped once the provider is back
+	query.failSetReplicas(nil)
+	reaper.Reconcile(start.Add(3 * time.Minute))
+	waitForScaling(t, reaper.Wait, query)
+
+	if query.currentReplicas() != 0 {
+		t.Fatalf("want the scale to zero retried, got replicas: %d", query.currentReplicas())
+	}
+}
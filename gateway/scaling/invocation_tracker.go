@@ -0,0 +1,157 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"sync"
+	"time"
+)
+
+// InvocationObserver is told when an invocation of a function starts
+// and when it completes
+type InvocationObserver interface {
+	Started(functionName, namespace string, at time.Time)
+	Completed(functionName, namespace string, at time.Time)
+}
+
+// FunctionActivity is a point-in-time view of the invocations of a
+// function seen by the gateway
+type FunctionActivity struct {
+	Name      string
+	Namespace string
+
+	// LastInvocation is the time the most recent invocation started
+	// or completed, or the function was touched
+	LastInvocation time.Time
+
+	// InFlight is the number of invocations which have started, but
+	// not yet completed
+	InFlight int64
+
+	// BusyTime is the time invocations were in flight, summed across
+	// concurrent invocations, up to the last start or completion
+	BusyTime time.Duration
+
+	// changed is the time of the last start or completion
+	changed time.Time
+}
+
+// advance adds the time since the last change, for each invocation in
+// flight, to BusyTime
+func (a *FunctionActivity) advance(at time.Time) {
+	if !at.After(a.changed) {
+		return
+	}
+	if !a.changed.IsZero() {
+		a.BusyTime += time.Duration(a.InFlight) * at.Sub(a.changed)
+	}
+	a.changed = at
+}
+
+// InvocationTracker records the last invocation and in-flight requests
+// for each function invoked through the gateway
+type InvocationTracker struct {
+	functions map[string]*FunctionActivity
+	lock      sync.RWMutex
+}
+
+// NewInvocationTracker creates an empty InvocationTracker
+func NewInvocationTracker() *InvocationTracker {
+	return &InvocationTracker{
+		functions: make(map[string]*FunctionActivity),
+	}
+}
+
+// Started records the start of an invocation
+func (t *InvocationTracker) Started(functionName, namespace string, at time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	activity := t.get(functionName, namespace)
+	activity.advance(at)
+	activity.InFlight++
+	if at.After(activity.LastInvocation) {
+		activity.LastInvocation = at
+	}
+}
+
+// Completed records the completion of an invocation
+func (t *InvocationTracker) Completed(functionName, namespace string, at time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	activity := t.get(functionName, namespace)
+	activity.advance(at)
+	if activity.InFlight > 0 {
+		activity.InFlight--
+	}
+	if at.After(activity.LastInvocation) {
+		activity.LastInvocation = at
+	}
+}
+
+// Touch records a function as active at, without an invocation, so that
+// the time it has been idle is counted from then
+func (t *InvocationTracker) Touch(functionName, namespace string, at time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	activity := t.get(functionName, namespace)
+	if at.After(activity.LastInvocation) {
+		activity.LastInvocation = at
+	}
+}
+
+// Get returns the activity for a function, and whether it has been
+// invoked since the gateway started
+func (t *InvocationTracker) Get(functionName, namespace string) (FunctionActivity, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if activity, ok := t.functions[functionName+"."+namespace]; ok {
+		return *activity, true
+	}
+	return FunctionActivity{Name: functionName, Namespace: namespace}, false
+}
+
+// List returns the activity of every function which has been invoked
+func (t *InvocationTracker) List() []FunctionActivity {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	list := make([]FunctionActivity, 0, len(t.functions))
+	for _, activity := range t.functions {
+		list = append(list, *activity)
+	}
+	return list
+}
+
+// InFlight returns the number of invocations of a function which have
+// started, but not yet completed
+func (t *InvocationTracker) InFlight(functionName, namespace string) int64 {
+	activity, _ := t.Get(functionName, namespace)
+	return activity.InFlight
+}
+
+// BusyTime returns the time invocations of a function were in flight up
+// to at, summed across concurrent invocations
+func (t *InvocationTracker) BusyTime(functionName, namespace string, at time.Time) time.Duration {
+	activity, _ := t.Get(functionName, namespace)
+	activity.advance(at)
+	return activity.BusyTime
+}
+
+// get must be called with the lock held
+func (t *InvocationTracker) get(functionName, namespace string) *FunctionActivity {
+	key := functionName + "." + namespace
+	activity, ok := t.functions[key]
+	if !ok {
+		activity = &FunctionActivity{
+			Name:      functionName,
+			Namespace: namespace,
+		}
+		t.functions[key] = activity
+	}
+	return activity
+}
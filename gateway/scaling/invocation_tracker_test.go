@@ -0,0 +1,32 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_InvocationTracker_BusyTimeSumsConcurrentInvocations(t *testing.T) {
+	tracker := NewInvocationTracker()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tracker.Started("echo", "openfaas-fn", start)
+	tracker.Started("echo", "openfaas-fn", start.Add(time.Second))
+	tracker.Completed("echo", "openfaas-fn", start.Add(time.Second*3))
+
+	// 1s with one in flight, 2s with two, then 2s with one still in flight
+	if got := tracker.BusyTime("echo", "openfaas-fn", start.Add(time.Second*5)); got != time.Second*7 {
+		t.Errorf("want: %s, got: %s", time.Second*7, got)
+	}
+
+	tracker.Completed("echo", "openfaas-fn", start.Add(time.Second*5))
+	if got := tracker.BusyTime("echo", "openfaas-fn", start.Add(time.Minute)); got != time.Second*7 {
+		t.Errorf("want no busy time once idle, got: %s", got)
+	}
+
+	if got := tracker.BusyTime("figlet", "openfaas-fn", start); got != 0 {
+		t.Errorf("want no busy time for a function not invoked, got: %s", got)
+	}
+}
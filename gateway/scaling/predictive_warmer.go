@@ -0,0 +1,245 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+const (
+	// ForecastAnnotation selects the forecast model used to pre-warm a
+	// function, either ForecastEWMA, ForecastHoltWinters or ForecastNone
+	ForecastAnnotation = "com.openfaas.scale.forecast"
+
+	// ForecastEWMA forecasts with an exponentially weighted moving average
+	ForecastEWMA = "ewma"
+
+	// ForecastHoltWinters forecasts with Holt-Winters and a daily season
+	ForecastHoltWinters = "holt-winters"
+
+	// ForecastNone disables pre-warming from a forecast
+	ForecastNone = "none"
+)
+
+// InvocationCountSource reads the number of invocations of each function
+// over the latest window. Functions are keyed by "name.namespace", or by
+// name alone when the function is in the default namespace.
+type InvocationCountSource interface {
+	InvocationCounts(window time.Duration) (map[string]float64, error)
+}
+
+// InvocationHistorySource reads the number of invocations of each function
+// in every window over period up to end, oldest first, with the same keys
+// as InvocationCountSource
+type InvocationHistorySource interface {
+	InvocationHistory(window, period time.Duration, end time.Time) (map[string][]float64, error)
+}
+
+// PredictiveWarmer samples the invocation counts of each function on a
+// fixed interval, fits a forecaster per function and scales a function
+// up from zero ahead of its predicted arrivals
+type PredictiveWarmer struct {
+	Source        InvocationCountSource
+	ServiceQuery  ServiceQuery
+	FunctionQuery FunctionQuery
+
+	// DefaultModel applies to functions without the ForecastAnnotation
+	DefaultModel string
+
+	// DefaultNamespace is used for function names without a namespace
+	DefaultNamespace string
+
+	// Interval between samples of the invocation counts
+	Interval time.Duration
+
+	// LeadTime is how far ahead of predicted arrivals to pre-warm
+	LeadTime time.Duration
+
+	// Threshold is the number of invocations expected within LeadTime
+	// for a function to be pre-warmed
+	Threshold float64
+
+	// History is read from the Source on Start, when it is also an
+	// InvocationHistorySource, to fit each forecaster without waiting
+	// for a season of samples
+	History time.Duration
+
+	forecasters map[string]*functionForecast
+	lock        sync.Mutex
+}
+
+type functionForecast struct {
+	model      string
+	forecaster Forecaster
+}
+
+// NewPredictiveWarmer creates a PredictiveWarmer which samples counts
+// from source on every interval
+func NewPredictiveWarmer(source InvocationCountSource, serviceQuery ServiceQuery, functionQuery FunctionQuery, defaultModel, defaultNamespace string, interval, leadTime time.Duration) *PredictiveWarmer {
+	return &PredictiveWarmer{
+		Source:           source,
+		ServiceQuery:     serviceQuery,
+		FunctionQuery:    functionQuery,
+		DefaultModel:     defaultModel,
+		DefaultNamespace: defaultNamespace,
+		Interval:         interval,
+		LeadTime:         leadTime,
+		Threshold:        0.5,
+		History:          time.Hour * 24 * 2,
+		forecasters:      make(map[string]*functionForecast),
+	}
+}
+
+// NewForecaster creates a forecaster for model, where the series is
+// sampled every interval, or returns nil for an unknown model
+func NewForecaster(model string, interval time.Duration) Forecaster {
+	switch model {
+	case ForecastEWMA:
+		return NewEWMAForecaster(0.3)
+	case ForecastHoltWinters:
+		seasonLength := int((time.Hour * 24) / interval)
+		return NewHoltWintersForecaster(0.1, 0.01, 0.3, seasonLength)
+	}
+	return nil
+}
+
+// Start fits the forecasters to the History, then samples the invocation
+// counts on every Interval
+func (p *PredictiveWarmer) Start() {
+	ticker := time.NewTicker(p.Interval)
+
+	go func() {
+		p.Backfill(time.Now())
+
+		for range ticker.C {
+			p.Reconcile()
+		}
+	}()
+}
+
+// Backfill observes the invocation counts of each function over the History
+// up to now, when the Source can read it
+func (p *PredictiveWarmer) Backfill(now time.Time) {
+	source, ok := p.Source.(InvocationHistorySource)
+	if !ok || p.History <= 0 {
+		return
+	}
+
+	history, err := source.InvocationHistory(p.Interval, p.History, now)
+	if err != nil {
+		log.Printf("[Forecast] unable to read invocation history: %s", err)
+		return
+	}
+
+	for key, counts := range history {
+		functionName, namespace := middleware.GetNamespace(p.DefaultNamespace, key)
+		p.observe(key, functionName, namespace, counts...)
+	}
+	log.Printf("[Forecast] fitted %d function(s) to %s of invocations", len(history), p.History)
+}
+
+// Reconcile observes the latest invocation counts and pre-warms any
+// function at zero replicas with arrivals predicted within LeadTime
+func (p *PredictiveWarmer) Reconcile() {
+	counts, err := p.Source.InvocationCounts(p.Interval)
+	if err != nil {
+		log.Printf("[Forecast] unable to read invocation counts: %s", err)
+		return
+	}
+
+	p.lock.Lock()
+	// Functions which were not invoked in the latest interval still
+	// need a zero count to be observed.
+	for key := range p.forecasters {
+		if _, ok := counts[key]; !ok {
+			counts[key] = 0
+		}
+	}
+	p.lock.Unlock()
+
+	for key, count := range counts {
+		functionName, namespace := middleware.GetNamespace(p.DefaultNamespace, key)
+
+		expected, ok := p.observe(key, functionName, namespace, count)
+		if !ok || expected < p.Threshold {
+			continue
+		}
+
+		p.preWarm(functionName, namespace, expected)
+	}
+}
+
+// observe adds counts to the forecaster for the function in order and
+// returns the number of invocations expected within the lead time
+func (p *PredictiveWarmer) observe(key, functionName, namespace string, counts ...float64) (float64, bool) {
+	annotations, err := p.FunctionQuery.GetAnnotations(functionName, namespace)
+	if err != nil {
+		log.Printf("[Forecast] function=%s.%s unable to get annotations: %s", functionName, namespace, err)
+		return 0, false
+	}
+
+	model := p.DefaultModel
+	if value, ok := annotations[ForecastAnnotation]; ok && len(value) > 0 {
+		model = value
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	forecast, ok := p.forecasters[key]
+	if !ok || forecast.model != model {
+		forecaster := NewForecaster(model, p.Interval)
+		if forecaster == nil {
+			delete(p.forecasters, key)
+			return 0, false
+		}
+
+		forecast = &functionForecast{model: model, forecaster: forecaster}
+		p.forecasters[key] = forecast
+	}
+
+	for _, count := range counts {
+		forecast.forecaster.Observe(count)
+	}
+
+	steps := int(p.LeadTime / p.Interval)
+	if steps < 1 {
+		steps = 1
+	}
+
+	expected := 0.0
+	for step := 1; step <= steps; step++ {
+		expected += forecast.forecaster.Forecast(step)
+	}
+	return expected, true
+}
+
+func (p *PredictiveWarmer) preWarm(functionName, namespace string, expected float64) {
+	queryResponse, err := p.ServiceQuery.GetReplicas(context.Background(), functionName, namespace)
+	if err != nil {
+		log.Printf("[Forecast] function=%s.%s unable to get replicas: %s", functionName, namespace, err)
+		return
+	}
+
+	if queryResponse.Replicas > 0 {
+		return
+	}
+
+	minReplicas := uint64(1)
+	if queryResponse.MinReplicas > 0 {
+		minReplicas = queryResponse.MinReplicas
+	}
+
+	log.Printf("[Forecast] function=%s.%s %.2f invocations expected within %s, 0 => %d",
+		functionName, namespace, expected, p.LeadTime, minReplicas)
+
+	if err := p.ServiceQuery.SetReplicas(context.Background(), functionName, namespace, minReplicas); err != nil {
+		log.Printf("[Forecast] function=%s.%s unable to pre-warm: %s", functionName, namespace, err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type fakeInvocationCounts struct {
+	counts []map[string]float64
+}
+
+func (f *fakeInvocationCounts) InvocationCounts(window time.Duration) (map[string]float64, error) {
+	if len(f.counts) == 0 {
+		return map[string]float64{}, nil
+	}
+
+	next := f.counts[0]
+	f.counts = f.counts[1:]
+	return next, nil
+}
+
+func Test_EWMAForecaster_ConvergesOnConstantRate(t *testing.T) {
+	f := NewEWMAForecaster(0.3)
+	for i := 0; i < 50; i++ {
+		f.Observe(4)
+	}
+
+	if got := f.Forecast(1); math.Abs(got-4) > 0.001 {
+		t.Fatalf("want: %f, got: %f", 4.0, got)
+	}
+}
+
+func Test_HoltWintersForecaster_PredictsSeasonalSpike(t *testing.T) {
+	seasonLength := 24
+	f := NewHoltWintersForecaster(0.1, 0.01, 0.3, seasonLength)
+
+	// A batch job runs at index 8 of every season
+	for day := 0; day < 5; day++ {
+		for i := 0; i < seasonLength; i++ {
+			count := 0.0
+			if i == 8 {
+				count = 100
+			}
+			f.Observe(count)
+		}
+	}
+
+	// Advance to just before the batch job
+	for i := 0; i < 8; i++ {
+		f.Observe(0)
+	}
+
+	if got := f.Forecast(1); got < 50 {
+		t.Errorf("want the spike to be forecast, got: %f", got)
+	}
+	if got := f.Forecast(5); got > 10 {
+		t.Errorf("want no spike after the batch job, got: %f", got)
+	}
+}
+
+// fakeInvocationHistory returns history for InvocationHistory, and counts
+// for InvocationCounts
+type fakeInvocationHistory struct {
+	fakeInvocationCounts
+	history map[string][]float64
+	period  time.Duration
+}
+
+func (f *fakeInvocationHistory) InvocationHistory(window, period time.Duration, end time.Time) (map[string][]float64, error) {
+	f.period = period
+	return f.history, nil
+}
+
+func Test_PredictiveWarmer_BackfillFitsDailySeason(t *testing.T) {
+	// Two days of hourly counts with a batch job in the second hour
+	counts := make([]float64, 48)
+	counts[1] = 100
+	counts[25] = 100
+
+	for _, backfill := range []bool{false, true} {
+		query := &fakeServiceQuery{replicas: 0}
+		functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+		source := &fakeInvocationHistory{
+			fakeInvocationCounts: fakeInvocationCounts{
+				counts: []map[string]float64{{"echo": 0}},
+			},
+			history: map[string][]float64{"echo": counts},
+		}
+
+		warmer := NewPredictiveWarmer(source, query, functionQuery, ForecastHoltWinters, "openfaas-fn", time.Hour, time.Hour)
+		if backfill {
+			warmer.Backfill(time.Now())
+			if source.period != time.Hour*48 {
+				t.Fatalf("want two days of history read, got: %s", source.period)
+			}
+		}
+		warmer.Reconcile()
+
+		calls := query.calls()
+		if backfill && (len(calls) != 1 || calls[0] != 1) {
+			t.Fatalf("want a pre-warm ahead of the batch job, got: %v", calls)
+		}
+		if !backfill && len(calls) != 0 {
+			t.Fatalf("want no pre-warm without history, got: %v", calls)
+		}
+	}
+}
+
+func Test_PredictiveWarmer_ScalesUpFromZero(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 0}
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+	source := &fakeInvocationCounts{
+		counts: []map[string]float64{
+			{"echo": 3},
+		},
+	}
+
+	warmer := NewPredictiveWarmer(source, query, functionQuery, ForecastEWMA, "openfaas-fn", time.Minute, time.Minute*5)
+	warmer.Reconcile()
+
+	calls := query.calls()
+	if len(calls) != 1 || calls[0] != 1 {
+		t.Fatalf("want a scale up to 1 replica, got: %v", calls)
+	}
+}
+
+func Test_PredictiveWarmer_NoArrivalsExpected(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 0}
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+	source := &fakeInvocationCounts{
+		counts: []map[string]float64{
+			{"echo.openfaas-fn": 0},
+		},
+	}
+
+	warmer := NewPredictiveWarmer(source, query, functionQuery, ForecastEWMA, "openfaas-fn", time.Minute, time.Minute*5)
+	warmer.Reconcile()
+
+	if calls := query.calls(); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_PredictiveWarmer_AnnotationDisablesForecast(t *testing.T) {
+	query := &fakeServiceQuery{
+		replicas:    0,
+		annotations: map[string]string{ForecastAnnotation: ForecastNone},
+	}
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+	source := &fakeInvocationCounts{
+		counts: []map[string]float64{
+			{"echo.openfaas-fn": 10},
+		},
+	}
+
+	warmer := NewPredictiveWarmer(source, query, functionQuery, ForecastEWMA, "openfaas-fn", time.Minute, time.Minute*5)
+	warmer.Reconcile()
+
+	if calls := query.calls(); len(calls) != 0 {
+		t.Fatalf("want no scaling, got: %v", calls)
+	}
+}
+
+func Test_PredictiveWarmer_ProviderUnreachable(t *testing.T) {
+	query := &fakeServiceQuery{replicas: 0}
+	query.failSetReplicas(errors.New("connection refused"))
+	functionQuery := NewCachedFunctionQuery(NewFunctionCache(time.Millisecond), query)
+	source := &fakeInvocationCounts{
+		counts: []map[string]float64{
+			{"echo": 3},
+			{"echo": 3},
+		},
+	}
+
+	warmer := NewPredictiveWarmer(source, query, functionQuery, ForecastEWMA, "openfaas-fn", time.Minute, time.Minute*5)
+	warmer.Reconcile()
+
+	if len(query.calls()) != 1 || query.currentReplicas() != 0 {
+		t.Fatalf("want a failed pre-warm, got calls: %v, replicas: %d", query.calls(), query.currentReplicas())
+	}
+
+	// The count is observed whether or not the pre-warm succeeds
+	warmer.lock.Lock()
+	forecast, ok := warmer.forecasters["echo"]
+	warmer.lock.Unlock()
+	if !ok || forecast.forecaster.Forecast(1) != 3 {
+		t.Fatalf("want the count observed after a failed pre-warm, got: %+v", forecast)
+	}
+
+	// The pre-warm is tried again on the next interval
+	query.failSetReplicas(nil)
+	warmer.Reconcile()
+
+	if query.currentReplicas() != 1 {
+		t.Fatalf("want the function pre-warmed, got replicas: %d", query.currentReplicas())
+	}
+}
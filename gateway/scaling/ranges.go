@@ -3,17 +3,24 @@ package scaling
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
-	"github.com/openfaas/faas-provider/types"
+	"github.com/gorilla/mux"
+	providerTypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
 )
 
 const (
 	// DefaultMinReplicas is the minimal amount of replicas for a service.
 	DefaultMinReplicas = 0
 
-	// DefaultMaxReplicas is the amount of replicas a service will auto-scale up to.
+	// DefaultMaxReplicas is the amount of replicas a service will auto-scale up to
+	// when it has no MaxScaleLabel.
 	DefaultMaxReplicas = 5
 
 	// DefaultScalingFactor is the defining proportion for the scaling increments.
@@ -31,42 +38,142 @@ const (
 	ScalingFactorLabel = "com.openfaas.scale.factor"
 )
 
-func MakeHorizontalScalingHandler(next http.HandlerFunc) http.HandlerFunc {
+// ReplicaBounds are the fewest and most replicas a function may be scaled
+// to, other than to zero
+type ReplicaBounds struct {
+	Min uint64
+	Max uint64
+}
+
+// ResolveBounds reads the bounds of a function from its min and max scale
+// labels. maxReplicas caps every function, whatever its label, and is
+// ignored when 0.
+func ResolveBounds(queryResponse ServiceQueryResponse, maxReplicas uint64) ReplicaBounds {
+	bounds := ReplicaBounds{Min: queryResponse.MinReplicas, Max: queryResponse.MaxReplicas}
+	if bounds.Max == 0 {
+		bounds.Max = DefaultMaxReplicas
+	}
+	if maxReplicas > 0 && bounds.Max > maxReplicas {
+		bounds.Max = maxReplicas
+	}
+
+	if bounds.Min < 1 {
+		bounds.Min = 1
+	}
+	if bounds.Min > bounds.Max {
+		bounds.Min = bounds.Max
+	}
+	return bounds
+}
+
+// ScaleToZeroPermitted is false for a function with scale to zero disabled
+// by its ZeroDurationAnnotation, or with a scheduled minimum at the time now
+func ScaleToZeroPermitted(annotations map[string]string, now time.Time) bool {
+	if _, ok := annotations[ZeroDurationAnnotation]; ok && parseDurationAnnotation(annotations, ZeroDurationAnnotation, time.Second) == 0 {
+		return false
+	}
+	return ScheduledMinReplicas(annotations, now) == 0
+}
+
+// ValidateReplicas returns an error when replicas is outside of the bounds
+// from ResolveBounds, or is zero for a function which does not permit scale
+// to zero at the time now
+func ValidateReplicas(queryResponse ServiceQueryResponse, replicas, maxReplicas uint64, now time.Time) error {
+	bounds := ResolveBounds(queryResponse, maxReplicas)
+
+	if replicas == 0 {
+		var annotations map[string]string
+		if queryResponse.Annotations != nil {
+			annotations = *queryResponse.Annotations
+		}
+		if !ScaleToZeroPermitted(annotations, now) {
+			return fmt.Errorf("cannot be scaled to zero, replicas must be between %d and %d", bounds.Min, bounds.Max)
+		}
+		return nil
+	}
+
+	if replicas < bounds.Min || replicas > bounds.Max {
+		return fmt.Errorf("replicas must be between %d and %d, or 0, got: %d", bounds.Min, bounds.Max, replicas)
+	}
+	return nil
+}
+
+// MakeHorizontalScalingHandler rejects requests to scale a function outside
+// of the bounds from its labels, capped at maxReplicas when set, with a 422.
+// Requests for zero replicas are passed on when the function permits scale
+// to zero. The function is the one named in the URL, a request body naming
+// another function or namespace is rejected with a 400.
+func MakeHorizontalScalingHandler(next http.HandlerFunc, functionQuery FunctionQuery, defaultNamespace string, maxReplicas uint64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+			writeScaleRequestError(w, r, http.StatusMethodNotAllowed, types.ErrorCodeMethodNotAllowed, "Only POST is allowed")
 			return
 		}
 
 		if r.Body == nil {
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			writeScaleRequestError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "Error reading request body")
 			return
 		}
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			writeScaleRequestError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "Error reading request body")
 			return
 		}
 
-		scaleRequest := types.ScaleServiceRequest{}
+		scaleRequest := providerTypes.ScaleServiceRequest{}
 		if err := json.Unmarshal(body, &scaleRequest); err != nil {
-			http.Error(w, "Error unmarshalling request body", http.StatusBadRequest)
+			writeScaleRequestError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest, "Error unmarshalling request body")
+			return
+		}
+
+		// The provider scales the function named in the URL, so the body
+		// may only repeat it
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, mux.Vars(r)["name"])
+		if queryNamespace := r.URL.Query().Get("namespace"); len(queryNamespace) > 0 {
+			namespace = queryNamespace
+		}
+
+		if len(scaleRequest.ServiceName) > 0 &&
+			scaleRequest.ServiceName != functionName && scaleRequest.ServiceName != functionName+"."+namespace {
+			writeScaleRequestError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest,
+				fmt.Sprintf("serviceName %q does not match the function in the URL: %s", scaleRequest.ServiceName, functionName))
+			return
+		}
+		if len(scaleRequest.Namespace) > 0 && scaleRequest.Namespace != namespace {
+			writeScaleRequestError(w, r, http.StatusBadRequest, types.ErrorCodeBadRequest,
+				fmt.Sprintf("namespace %q does not match the namespace of the function in the URL: %s", scaleRequest.Namespace, namespace))
 			return
 		}
 
-		if scaleRequest.Replicas < 1 {
-			scaleRequest.Replicas = 1
+		queryResponse, err := functionQuery.Get(functionName, namespace)
+		if err != nil {
+			res := types.ErrorResponse{Code: types.ErrorCodeScaleFailed, Message: err.Error(), Function: functionName, Namespace: namespace}
+			statusCode := http.StatusBadGateway
+			if errors.Is(err, ErrFunctionNotFound) {
+				res.Code, statusCode = types.ErrorCodeFunctionNotFound, http.StatusNotFound
+			}
+			types.WriteError(w, r, statusCode, res)
+			return
 		}
 
-		if scaleRequest.Replicas > DefaultMaxReplicas {
-			scaleRequest.Replicas = DefaultMaxReplicas
+		if err := ValidateReplicas(queryResponse, scaleRequest.Replicas, maxReplicas, time.Now()); err != nil {
+			types.WriteError(w, r, http.StatusUnprocessableEntity, types.ErrorResponse{
+				Code:      types.ErrorCodeReplicasOutOfBounds,
+				Message:   fmt.Sprintf("Function %s.%s %s", functionName, namespace, err),
+				Function:  functionName,
+				Namespace: namespace,
+			})
+			return
 		}
 
-		upstreamReq, _ := json.Marshal(scaleRequest)
 		// Restore the io.ReadCloser to its original state
-		r.Body = io.NopCloser(bytes.NewBuffer(upstreamReq))
+		r.Body = io.NopCloser(bytes.NewBuffer(body))
 
 		next.ServeHTTP(w, r)
 	}
 }
+
+func writeScaleRequestError(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	types.WriteError(w, r, statusCode, types.ErrorResponse{Code: code, Message: message})
+}
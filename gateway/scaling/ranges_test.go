@@ -0,0 +1,171 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	providerTypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// boundsFunctionQuery returns the same bounds and annotations for
+// every function
+type boundsFunctionQuery struct {
+	minReplicas uint64
+	maxReplicas uint64
+	annotations map[string]string
+}
+
+func (b boundsFunctionQuery) Get(name, namespace string) (ServiceQueryResponse, error) {
+	if name == "missing" {
+		return ServiceQueryResponse{}, ErrFunctionNotFound
+	}
+
+	annotations := b.annotations
+	return ServiceQueryResponse{MinReplicas: b.minReplicas, MaxReplicas: b.maxReplicas, Annotations: &annotations}, nil
+}
+
+func (b boundsFunctionQuery) GetAnnotations(name, namespace string) (map[string]string, error) {
+	return b.annotations, nil
+}
+
+// scaleRequest is a request to scale name, routed as by the gateway
+func scaleRequest(name, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/system/scale-function/"+name, strings.NewReader(body))
+	return mux.SetURLVars(r, map[string]string{"name": name})
+}
+
+func Test_MakeHorizontalScalingHandler_Bounds(t *testing.T) {
+	query := boundsFunctionQuery{minReplicas: 2, maxReplicas: 20}
+
+	cases := []struct {
+		name        string
+		maxReplicas uint64
+		replicas    uint64
+		want        int
+	}{
+		{"within the max label", 0, 12, http.StatusOK},
+		{"at the min label", 0, 2, http.StatusOK},
+		{"zero is permitted", 0, 0, http.StatusOK},
+		{"below the min label", 0, 1, http.StatusUnprocessableEntity},
+		{"above the max label", 0, 21, http.StatusUnprocessableEntity},
+		{"above the global cap", 10, 12, http.StatusUnprocessableEntity},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var forwarded *providerTypes.ScaleServiceRequest
+			next := func(w http.ResponseWriter, r *http.Request) {
+				forwarded = &providerTypes.ScaleServiceRequest{}
+				json.NewDecoder(r.Body).Decode(forwarded)
+			}
+			handler := MakeHorizontalScalingHandler(next, query, "openfaas-fn", c.maxReplicas)
+
+			body, _ := json.Marshal(providerTypes.ScaleServiceRequest{ServiceName: "echo", Replicas: c.replicas})
+			rr := httptest.NewRecorder()
+			handler(rr, scaleRequest("echo", string(body)))
+
+			if rr.Code != c.want {
+				t.Fatalf("status code want: %d, got: %d", c.want, rr.Code)
+			}
+
+			if c.want == http.StatusOK {
+				if forwarded == nil || forwarded.Replicas != c.replicas {
+					t.Fatalf("want %d replicas forwarded unchanged, got: %+v", c.replicas, forwarded)
+				}
+				return
+			}
+
+			res := types.ErrorResponse{}
+			json.Unmarshal(rr.Body.Bytes(), &res)
+			if res.Code != types.ErrorCodeReplicasOutOfBounds || forwarded != nil {
+				t.Fatalf("want the request rejected with %s, got: %+v", types.ErrorCodeReplicasOutOfBounds, res)
+			}
+		})
+	}
+}
+
+func Test_MakeHorizontalScalingHandler_ZeroNotPermitted(t *testing.T) {
+	query := boundsFunctionQuery{maxReplicas: 5, annotations: map[string]string{ZeroDurationAnnotation: "0"}}
+	handler := MakeHorizontalScalingHandler(func(w http.ResponseWriter, r *http.Request) {}, query, "openfaas-fn", 0)
+
+	rr := httptest.NewRecorder()
+	handler(rr, scaleRequest("echo", `{"serviceName": "echo", "replicas": 0}`))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status code want: %d, got: %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func Test_MakeHorizontalScalingHandler_NotFound(t *testing.T) {
+	handler := MakeHorizontalScalingHandler(func(w http.ResponseWriter, r *http.Request) {}, boundsFunctionQuery{}, "openfaas-fn", 0)
+
+	rr := httptest.NewRecorder()
+	handler(rr, scaleRequest("missing", `{"serviceName": "missing", "replicas": 1}`))
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status code want: %d, got: %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func Test_MakeHorizontalScalingHandler_BodyMustMatchURL(t *testing.T) {
+	cases := []struct {
+		name string
+		url  string
+		body string
+		want int
+	}{
+		{"same name", "big", `{"serviceName": "big", "replicas": 1}`, http.StatusOK},
+		{"name with namespace", "big", `{"serviceName": "big.openfaas-fn", "replicas": 1}`, http.StatusOK},
+		{"no name", "big", `{"replicas": 1}`, http.StatusOK},
+		{"same namespace", "big", `{"serviceName": "big", "namespace": "openfaas-fn", "replicas": 1}`, http.StatusOK},
+		{"other name", "big", `{"serviceName": "small", "replicas": 1}`, http.StatusBadRequest},
+		{"other namespace", "big", `{"serviceName": "big", "namespace": "dev", "replicas": 1}`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			forwarded := false
+			next := func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+			}
+			handler := MakeHorizontalScalingHandler(next, boundsFunctionQuery{maxReplicas: 5}, "openfaas-fn", 0)
+
+			rr := httptest.NewRecorder()
+			handler(rr, scaleRequest(c.url, c.body))
+
+			if rr.Code != c.want {
+				t.Fatalf("status code want: %d, got: %d", c.want, rr.Code)
+			}
+			if forwarded != (c.want == http.StatusOK) {
+				t.Fatalf("want forwarded: %t, got: %t", c.want == http.StatusOK, forwarded)
+			}
+		})
+	}
+}
+
+func Test_ResolveBounds(t *testing.T) {
+	cases := []struct {
+		queryResponse ServiceQueryResponse
+		maxReplicas   uint64
+		want          ReplicaBounds
+	}{
+		{ServiceQueryResponse{MinReplicas: 0, MaxReplicas: 0}, 0, ReplicaBounds{Min: 1, Max: DefaultMaxReplicas}},
+		{ServiceQueryResponse{MinReplicas: 3, MaxReplicas: 50}, 0, ReplicaBounds{Min: 3, Max: 50}},
+		{ServiceQueryResponse{MinReplicas: 3, MaxReplicas: 50}, 20, ReplicaBounds{Min: 3, Max: 20}},
+		{ServiceQueryResponse{MinReplicas: 30, MaxReplicas: 50}, 20, ReplicaBounds{Min: 20, Max: 20}},
+	}
+
+	for _, c := range cases {
+		if got := ResolveBounds(c.queryResponse, c.maxReplicas); got != c.want {
+			t.Errorf("%+v capped at %d, want: %+v, got: %+v", c.queryResponse, c.maxReplicas, c.want, got)
+		}
+	}
+}
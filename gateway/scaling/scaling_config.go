@@ -1,7 +1,30 @@
 package scaling
 
 import (
+	"log"
+	"strconv"
 	"time"
+
+	"github.com/openfaas/faas/gateway/types"
+)
+
+const (
+	// MaxPollCountAnnotation overrides the number of times a function's
+	// readiness is queried while it scales from zero
+	MaxPollCountAnnotation = "com.openfaas.scale.max-poll-count"
+
+	// PollIntervalAnnotation overrides the first interval between queries
+	// of a function's readiness, i.e. "500ms"
+	PollIntervalAnnotation = "com.openfaas.scale.poll-interval"
+
+	// MaxPollIntervalAnnotation overrides the longest interval between
+	// queries of a function's readiness, i.e. "5s"
+	MaxPollIntervalAnnotation = "com.openfaas.scale.max-poll-interval"
+
+	// BackoffAnnotation overrides the strategy used to back off between
+	// queries of a function's readiness and retries of a scale request,
+	// one of "constant", "exponential" or "decorrelated-jitter"
+	BackoffAnnotation = "com.openfaas.scale.backoff"
 )
 
 // ScalingConfig for scaling behaviours
@@ -13,6 +36,16 @@ type ScalingConfig struct {
 	// readiness status
 	FunctionPollInterval time.Duration
 
+	// MaxPollInterval is the longest interval between polling a function's
+	// readiness status when Backoff grows the interval
+	MaxPollInterval time.Duration
+
+	// Backoff is the strategy for the interval between polling a function's
+	// readiness and retrying a scale request, starting at FunctionPollInterval.
+	// One of types.BackoffConstant, types.BackoffExponential or
+	// types.BackoffDecorrelatedJitter, constant when empty.
+	Backoff string
+
 	// CacheExpiry life-time for a cache entry before considering invalid
 	CacheExpiry time.Duration
 
@@ -22,4 +55,84 @@ type ScalingConfig struct {
 	// SetScaleRetries is the number of times to try scaling a function before
 	// giving up due to errors
 	SetScaleRetries uint
+
+	// ActivatorCapacity is the number of requests which can be parked for
+	// a function while it scales from zero
+	ActivatorCapacity uint
+
+	// ActivatorTimeout is how long a request can be parked for a function
+	// while it scales from zero
+	ActivatorTimeout time.Duration
+
+	// Clock is used by the FunctionScaler to measure and wait, the system
+	// clock when nil
+	Clock types.Clock
+}
+
+// ForFunction returns the config with the polling and backoff overrides
+// set in a function's annotations
+func (c ScalingConfig) ForFunction(annotations *map[string]string) ScalingConfig {
+	if annotations == nil {
+		return c
+	}
+
+	if val, ok := (*annotations)[MaxPollCountAnnotation]; ok {
+		if count, err := strconv.Atoi(val); err == nil && count > 0 {
+			c.MaxPollCount = uint(count)
+		} else {
+			log.Printf("Provided annotation %s=%s should be of type uint", MaxPollCountAnnotation, val)
+		}
+	}
+
+	c.FunctionPollInterval = parseDurationAnnotation(*annotations, PollIntervalAnnotation, c.FunctionPollInterval)
+	c.MaxPollInterval = parseDurationAnnotation(*annotations, MaxPollIntervalAnnotation, c.MaxPollInterval)
+
+	if val, ok := (*annotations)[BackoffAnnotation]; ok {
+		if _, err := types.NewBackoff(val, c.FunctionPollInterval, c.MaxPollInterval); err == nil {
+			c.Backoff = val
+		} else {
+			log.Printf("Provided annotation %s=%s is invalid: %s", BackoffAnnotation, val, err)
+		}
+	}
+
+	return c
+}
+
+// backoff creates the Backoff for polling and retries, falling back to
+// polling at a constant FunctionPollInterval
+func (c ScalingConfig) backoff() types.Backoff {
+	backoff, err := types.NewBackoff(c.Backoff, c.FunctionPollInterval, c.maxPollInterval())
+	if err != nil {
+		log.Printf("Unable to use backoff %s: %s", c.Backoff, err)
+		return types.ConstantBackoff{Interval: c.FunctionPollInterval}
+	}
+	return backoff
+}
+
+// maxPollInterval is MaxPollInterval, but never less than FunctionPollInterval
+func (c ScalingConfig) maxPollInterval() time.Duration {
+	if c.MaxPollInterval < c.FunctionPollInterval {
+		return c.FunctionPollInterval
+	}
+	return c.MaxPollInterval
+}
+
+// pollTimeout is how long it takes to poll a function MaxPollCount times,
+// ignoring any jitter in the backoff
+func (c ScalingConfig) pollTimeout() time.Duration {
+	if c.Backoff == "" || c.Backoff == types.BackoffConstant {
+		return time.Duration(c.MaxPollCount) * c.FunctionPollInterval
+	}
+
+	backoff := types.ExponentialBackoff{Base: c.FunctionPollInterval, Max: c.maxPollInterval()}
+
+	var timeout time.Duration
+	for i := 0; i < int(c.MaxPollCount); i++ {
+		interval := backoff.Next(i, 0)
+		if interval == c.maxPollInterval() {
+			return timeout + time.Duration(int(c.MaxPollCount)-i)*interval
+		}
+		timeout += interval
+	}
+	return timeout
 }
@@ -0,0 +1,220 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"math"
+	"sync"
+)
+
+const (
+	// ScalingPolicyAnnotation selects the ScalingPolicy for a function by
+	// the name it was registered with
+	ScalingPolicyAnnotation = "com.openfaas.scale.policy"
+
+	// ScalingPolicyStep adds a step of the scaling factor of max replicas
+	// while firing, and returns to min replicas when resolved
+	ScalingPolicyStep = "step"
+
+	// ScalingPolicyProportional adds or removes the scaling factor of the
+	// current replicas while firing or resolved
+	ScalingPolicyProportional = "proportional"
+
+	// ScalingPolicyTargetTracking sets replicas so that each handles the
+	// target concurrency
+	ScalingPolicyTargetTracking = "target-tracking"
+
+	// ScalingPolicyFixed never changes the current replicas
+	ScalingPolicyFixed = "fixed"
+)
+
+// ScalingObservation is what is known about a function at the point
+// a scaling decision is made
+type ScalingObservation struct {
+	Replicas      uint64
+	MinReplicas   uint64
+	MaxReplicas   uint64
+	ScalingFactor uint64
+
+	// Firing is true while the function needs more replicas, i.e. an
+	// alert is firing or in-flight requests exceed the target
+	Firing bool
+
+	// InFlight is the average number of in-flight requests, when known
+	InFlight float64
+
+	// TargetConcurrency is the number of in-flight requests each replica
+	// should handle, zero when not set
+	TargetConcurrency float64
+}
+
+// NewScalingObservation reads the replica counts and bounds from a
+// ServiceQueryResponse
+func NewScalingObservation(queryResponse ServiceQueryResponse, firing bool) ScalingObservation {
+	return ScalingObservation{
+		Replicas:      queryResponse.Replicas,
+		MinReplicas:   queryResponse.MinReplicas,
+		MaxReplicas:   queryResponse.MaxReplicas,
+		ScalingFactor: queryResponse.ScalingFactor,
+		Firing:        firing,
+	}
+}
+
+// ScalingPolicy decides the target replica count for a function
+type ScalingPolicy interface {
+	TargetReplicas(observation ScalingObservation) uint64
+}
+
+// ScalingPolicyFunc adapts a function to a ScalingPolicy
+type ScalingPolicyFunc func(observation ScalingObservation) uint64
+
+// TargetReplicas calls f(observation)
+func (f ScalingPolicyFunc) TargetReplicas(observation ScalingObservation) uint64 {
+	return f(observation)
+}
+
+// StepPolicy scales up by a step of ScalingFactor percent of max replicas,
+// capped at max replicas, and back to min replicas once resolved
+type StepPolicy struct{}
+
+// TargetReplicas for the StepPolicy
+func (StepPolicy) TargetReplicas(observation ScalingObservation) uint64 {
+	var newReplicas uint64
+
+	maxReplicas := observation.MaxReplicas
+	if maxReplicas == 0 {
+		maxReplicas = DefaultMaxReplicas
+	}
+	step := uint64(math.Ceil(float64(maxReplicas) / 100 * float64(observation.ScalingFactor)))
+
+	if observation.Firing && step > 0 {
+		if observation.Replicas+step > maxReplicas {
+			newReplicas = maxReplicas
+		} else {
+			newReplicas = observation.Replicas + step
+		}
+	} else { // Resolved event.
+		newReplicas = observation.MinReplicas
+	}
+
+	return newReplicas
+}
+
+// ProportionalPolicy grows or shrinks the current replicas by ScalingFactor
+// percent, by at least one replica
+type ProportionalPolicy struct{}
+
+// TargetReplicas for the ProportionalPolicy
+func (ProportionalPolicy) TargetReplicas(observation ScalingObservation) uint64 {
+	step := uint64(math.Ceil(float64(observation.Replicas) / 100 * float64(observation.ScalingFactor)))
+	if step == 0 && observation.ScalingFactor > 0 {
+		step = 1
+	}
+
+	replicas := observation.Replicas
+	if observation.Firing {
+		replicas += step
+	} else if replicas > step {
+		replicas -= step
+	} else {
+		replicas = 0
+	}
+
+	return observation.bound(replicas)
+}
+
+// TargetTrackingPolicy sets replicas so that each handles TargetConcurrency
+// in-flight requests, the current replicas are kept while no target is set
+type TargetTrackingPolicy struct{}
+
+// TargetReplicas for the TargetTrackingPolicy
+func (TargetTrackingPolicy) TargetReplicas(observation ScalingObservation) uint64 {
+	if observation.TargetConcurrency <= 0 {
+		return observation.Replicas
+	}
+
+	replicas := uint64(math.Ceil(observation.InFlight / observation.TargetConcurrency))
+	return observation.bound(replicas)
+}
+
+// FixedPolicy leaves the current replicas as they are
+type FixedPolicy struct{}
+
+// TargetReplicas for the FixedPolicy
+func (FixedPolicy) TargetReplicas(observation ScalingObservation) uint64 {
+	return observation.Replicas
+}
+
+// bound keeps replicas within the min and max replicas of the function
+func (o ScalingObservation) bound(replicas uint64) uint64 {
+	maxReplicas := o.MaxReplicas
+	if maxReplicas == 0 {
+		maxReplicas = DefaultMaxReplicas
+	}
+
+	if replicas < o.MinReplicas {
+		replicas = o.MinReplicas
+	}
+	if replicas > maxReplicas {
+		replicas = maxReplicas
+	}
+	return replicas
+}
+
+// ScalingPolicyRegistry holds the ScalingPolicy for each name which can
+// be selected by the ScalingPolicyAnnotation
+type ScalingPolicyRegistry struct {
+	policies map[string]ScalingPolicy
+	lock     sync.RWMutex
+}
+
+// NewScalingPolicyRegistry creates a registry with the step, proportional,
+// target-tracking and fixed policies
+func NewScalingPolicyRegistry() *ScalingPolicyRegistry {
+	registry := &ScalingPolicyRegistry{
+		policies: make(map[string]ScalingPolicy),
+	}
+
+	registry.Register(ScalingPolicyStep, StepPolicy{})
+	registry.Register(ScalingPolicyProportional, ProportionalPolicy{})
+	registry.Register(ScalingPolicyTargetTracking, TargetTrackingPolicy{})
+	registry.Register(ScalingPolicyFixed, FixedPolicy{})
+
+	return registry
+}
+
+// Register adds or replaces the policy for name
+func (r *ScalingPolicyRegistry) Register(name string, policy ScalingPolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.policies[name] = policy
+}
+
+// Get returns the policy registered for name
+func (r *ScalingPolicyRegistry) Get(name string) (ScalingPolicy, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	policy, ok := r.policies[name]
+	return policy, ok
+}
+
+// Policy returns the policy selected by the ScalingPolicyAnnotation, or
+// the policy registered for fallback when the annotation is not set or
+// names an unknown policy
+func (r *ScalingPolicyRegistry) Policy(annotations map[string]string, fallback string) ScalingPolicy {
+	if name, ok := annotations[ScalingPolicyAnnotation]; ok && len(name) > 0 {
+		if policy, found := r.Get(name); found {
+			return policy
+		}
+		log.Printf("Provided annotation %s=%s is not a registered scaling policy, using: %s", ScalingPolicyAnnotation, name, fallback)
+	}
+
+	if policy, found := r.Get(fallback); found {
+		return policy
+	}
+	return FixedPolicy{}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import "testing"
+
+func Test_ScalingPolicyRegistry_SelectsPolicyByAnnotation(t *testing.T) {
+	registry := NewScalingPolicyRegistry()
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        ScalingPolicy
+	}{
+		{"no annotation uses fallback", nil, StepPolicy{}},
+		{"proportional", map[string]string{ScalingPolicyAnnotation: ScalingPolicyProportional}, ProportionalPolicy{}},
+		{"target-tracking", map[string]string{ScalingPolicyAnnotation: ScalingPolicyTargetTracking}, TargetTrackingPolicy{}},
+		{"fixed", map[string]string{ScalingPolicyAnnotation: ScalingPolicyFixed}, FixedPolicy{}},
+		{"unknown uses fallback", map[string]string{ScalingPolicyAnnotation: "unknown"}, StepPolicy{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := registry.Policy(c.annotations, ScalingPolicyStep); got != c.want {
+				t.Fatalf("want: %T, got: %T", c.want, got)
+			}
+		})
+	}
+}
+
+func Test_ScalingPolicyRegistry_RegistersCustomPolicy(t *testing.T) {
+	registry := NewScalingPolicyRegistry()
+	registry.Register("double", ScalingPolicyFunc(func(observation ScalingObservation) uint64 {
+		return observation.Replicas * 2
+	}))
+
+	policy := registry.Policy(map[string]string{ScalingPolicyAnnotation: "double"}, ScalingPolicyStep)
+	if got := policy.TargetReplicas(ScalingObservation{Replicas: 3}); got != 6 {
+		t.Fatalf("want: %d, got: %d", 6, got)
+	}
+}
+
+func Test_ProportionalPolicy(t *testing.T) {
+	observation := ScalingObservation{Replicas: 10, MinReplicas: 1, MaxReplicas: 20, ScalingFactor: 20}
+
+	observation.Firing = true
+	if got := (ProportionalPolicy{}).TargetReplicas(observation); got != 12 {
+		t.Errorf("firing want: %d, got: %d", 12, got)
+	}
+
+	observation.Firing = false
+	if got := (ProportionalPolicy{}).TargetReplicas(observation); got != 8 {
+		t.Errorf("resolved want: %d, got: %d", 8, got)
+	}
+
+	observation.Replicas = 1
+	if got := (ProportionalPolicy{}).TargetReplicas(observation); got != 1 {
+		t.Errorf("resolved want min replicas: %d, got: %d", 1, got)
+	}
+}
+
+func Test_TargetTrackingPolicy(t *testing.T) {
+	observation := ScalingObservation{Replicas: 2, MinReplicas: 1, MaxReplicas: 10, InFlight: 45, TargetConcurrency: 10}
+
+	if got := (TargetTrackingPolicy{}).TargetReplicas(observation); got != 5 {
+		t.Errorf("want: %d, got: %d", 5, got)
+	}
+
+	observation.TargetConcurrency = 0
+	if got := (TargetTrackingPolicy{}).TargetReplicas(observation); got != 2 {
+		t.Errorf("want replicas kept without a target: %d, got: %d", 2, got)
+	}
+}
+
+func Test_FixedPolicy_KeepsReplicas(t *testing.T) {
+	observation := ScalingObservation{Replicas: 3, MinReplicas: 1, MaxReplicas: 10, Firing: true}
+
+	if got := (FixedPolicy{}).TargetReplicas(observation); got != 3 {
+		t.Errorf("want: %d, got: %d", 3, got)
+	}
+}
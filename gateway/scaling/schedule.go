@@ -0,0 +1,416 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Time zones are loaded from the binary, the gateway's image has no tzdata
+	_ "time/tzdata"
+)
+
+const (
+	// ScheduleAnnotation holds the minimum replicas of a function by the
+	// time of day, as rules separated by "," or ";", i.e.
+	// "min=3 on weekdays 08:00-18:00, otherwise 0"
+	ScheduleAnnotation = "com.openfaas.scale.schedule"
+
+	// ScheduleTimezoneAnnotation is the IANA time zone the times in the
+	// ScheduleAnnotation are in, i.e. "Europe/London", UTC by default
+	ScheduleTimezoneAnnotation = "com.openfaas.scale.schedule-timezone"
+)
+
+// Schedule is the minimum replicas of a function by the time of day
+type Schedule struct {
+	Rules []ScheduleRule
+
+	// Otherwise is the minimum replicas when no rule matches
+	Otherwise uint64
+}
+
+// ScheduleRule sets MinReplicas on Days between Start and End, each an
+// offset from midnight. A rule with an End before its Start runs past
+// midnight into the next day. Start and End are both zero for all day.
+type ScheduleRule struct {
+	MinReplicas uint64
+	Days        [7]bool
+	Start       time.Duration
+	End         time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSchedule parses rules of the form "min=N [on DAYS] [HH:MM-HH:MM]"
+// and an optional "otherwise N", separated by "," or ";". DAYS is one or
+// more of "daily", "weekdays", "weekends", a day such as "sat" or a range
+// of days such as "mon-thu".
+func ParseSchedule(value string) (Schedule, error) {
+	schedule := Schedule{}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+	if len(parts) == 0 {
+		return schedule, fmt.Errorf("no rules in schedule %q", value)
+	}
+
+	otherwise := false
+	for _, part := range parts {
+		fields := strings.Fields(strings.ToLower(part))
+		if len(fields) == 0 {
+			return schedule, fmt.Errorf("empty rule in schedule %q", value)
+		}
+
+		if fields[0] == "otherwise" {
+			if otherwise || len(fields) != 2 {
+				return schedule, fmt.Errorf("otherwise must be given once with a number of replicas, got: %q", part)
+			}
+			replicas, err := parseScheduleReplicas(strings.TrimPrefix(fields[1], "min="))
+			if err != nil {
+				return schedule, err
+			}
+			schedule.Otherwise = replicas
+			otherwise = true
+			continue
+		}
+
+		rule, err := parseScheduleRule(fields)
+		if err != nil {
+			return schedule, fmt.Errorf("invalid rule %q: %s", strings.TrimSpace(part), err)
+		}
+		schedule.Rules = append(schedule.Rules, rule)
+	}
+
+	return schedule, nil
+}
+
+func parseScheduleRule(fields []string) (ScheduleRule, error) {
+	rule := ScheduleRule{}
+
+	if !strings.HasPrefix(fields[0], "min=") {
+		return rule, fmt.Errorf("a rule must start with min=N")
+	}
+	replicas, err := parseScheduleReplicas(strings.TrimPrefix(fields[0], "min="))
+	if err != nil {
+		return rule, err
+	}
+	rule.MinReplicas = replicas
+
+	days := false
+	for _, field := range fields[1:] {
+		switch {
+		case field == "on":
+			continue
+		case strings.Contains(field, ":"):
+			if rule.Start != 0 || rule.End != 0 {
+				return rule, fmt.Errorf("more than one time range")
+			}
+			if rule.Start, rule.End, err = parseScheduleTimes(field); err != nil {
+				return rule, err
+			}
+		default:
+			if err := parseScheduleDays(field, &rule.Days); err != nil {
+				return rule, err
+			}
+			days = true
+		}
+	}
+
+	if !days {
+		for i := range rule.Days {
+			rule.Days[i] = true
+		}
+	}
+
+	return rule, nil
+}
+
+func parseScheduleReplicas(value string) (uint64, error) {
+	replicas, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("replicas must be a whole number, got: %q", value)
+	}
+	return replicas, nil
+}
+
+// parseScheduleDays sets each day given by value in days
+func parseScheduleDays(value string, days *[7]bool) error {
+	switch value {
+	case "daily", "everyday":
+		value = "sun-sat"
+	case "weekdays":
+		value = "mon-fri"
+	case "weekends":
+		value = "sat-sun"
+	}
+
+	from, to := value, value
+	if parts := strings.SplitN(value, "-", 2); len(parts) == 2 {
+		from, to = parts[0], parts[1]
+	}
+
+	start, ok := weekdays[from]
+	if !ok {
+		return fmt.Errorf("unknown day %q", from)
+	}
+	end, ok := weekdays[to]
+	if !ok {
+		return fmt.Errorf("unknown day %q", to)
+	}
+
+	for day := start; ; day = (day + 1) % 7 {
+		days[day] = true
+		if day == end {
+			break
+		}
+	}
+	return nil
+}
+
+// parseScheduleTimes parses "HH:MM-HH:MM" as offsets from midnight, the
+// end may be "24:00"
+func parseScheduleTimes(value string) (start, end time.Duration, err error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("times must be a range of HH:MM-HH:MM, got: %q", value)
+	}
+
+	if start, err = parseScheduleTime(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseScheduleTime(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	if start == end || start == time.Hour*24 {
+		return 0, 0, fmt.Errorf("times must be a range of HH:MM-HH:MM, got: %q", value)
+	}
+	if end == time.Hour*24 {
+		end = 0
+	}
+	return start, end, nil
+}
+
+func parseScheduleTime(value string) (time.Duration, error) {
+	if value == "24:00" {
+		return time.Hour * 24, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time must be HH:MM, got: %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// MinReplicas is the highest minimum of the rules which match t, or
+// Otherwise when none match
+func (s Schedule) MinReplicas(t time.Time) uint64 {
+	min, matched := uint64(0), false
+	for _, rule := range s.Rules {
+		if rule.matches(t) && (!matched || rule.MinReplicas > min) {
+			min, matched = rule.MinReplicas, true
+		}
+	}
+
+	if !matched {
+		return s.Otherwise
+	}
+	return min
+}
+
+func (r ScheduleRule) matches(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+
+	switch {
+	case r.Start == r.End:
+		return r.Days[day]
+	case r.Start < r.End:
+		return r.Days[day] && offset >= r.Start && offset < r.End
+	case r.End == 0:
+		return r.Days[day] && offset >= r.Start
+	default:
+		// The range runs past midnight, the early hours belong to the day before
+		return (r.Days[day] && offset >= r.Start) || (r.Days[(day+6)%7] && offset < r.End)
+	}
+}
+
+// ScheduledMinReplicas is the minimum replicas of a function from its
+// ScheduleAnnotation at the time now, 0 when it has no schedule
+func ScheduledMinReplicas(annotations map[string]string, now time.Time) uint64 {
+	value, ok := annotations[ScheduleAnnotation]
+	if !ok || len(value) == 0 {
+		return 0
+	}
+
+	schedule, err := ParseSchedule(value)
+	if err != nil {
+		log.Printf("Provided annotation %s=%s is invalid: %s", ScheduleAnnotation, value, err)
+		return 0
+	}
+
+	location := time.UTC
+	if name, ok := annotations[ScheduleTimezoneAnnotation]; ok && len(name) > 0 {
+		if location, err = time.LoadLocation(name); err != nil {
+			log.Printf("Provided annotation %s=%s should be a time zone: %s", ScheduleTimezoneAnnotation, name, err)
+			location = time.UTC
+		}
+	}
+
+	return schedule.MinReplicas(now.In(location))
+}
+
+// ScheduleReconciler keeps functions with a ScheduleAnnotation at or above
+// their scheduled minimum replicas. The schedule is only a floor, once a
+// rule no longer applies the function is never scaled down by the
+// reconciler, since it may be serving requests. It is left to the idle
+// reaper, which counts the function as idle from when its floor dropped.
+type ScheduleReconciler struct {
+	ServiceQuery ServiceQuery
+	Lister       FunctionLister
+
+	// Namespaces to list functions in, "" is the provider's default
+	Namespaces []string
+
+	// NamespaceLister, when set, lists the namespaces in place of
+	// Namespaces, which are used when it fails or returns none
+	NamespaceLister NamespaceLister
+
+	// Tracker, when set, is touched when the floor of a function it scaled
+	// up drops, so that the idle reaper can scale the function down even
+	// if it was never invoked
+	Tracker *InvocationTracker
+
+	// raised holds the replicas set by the reconciler for each function
+	raised map[string]uint64
+	lock   sync.Mutex
+}
+
+// NewScheduleReconciler creates a ScheduleReconciler for the functions
+// listed by lister in namespaces, which touches functions in tracker
+// once their floor drops
+func NewScheduleReconciler(serviceQuery ServiceQuery, lister FunctionLister, namespaces []string, tracker *InvocationTracker) *ScheduleReconciler {
+	return &ScheduleReconciler{
+		ServiceQuery: serviceQuery,
+		Lister:       lister,
+		Namespaces:   namespaces,
+		Tracker:      tracker,
+		raised:       make(map[string]uint64),
+	}
+}
+
+// Start reconciles scheduled functions on every interval
+func (s *ScheduleReconciler) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			s.Reconcile(time.Now())
+		}
+	}()
+}
+
+// Reconcile sets the replicas of every scheduled function for the time now
+func (s *ScheduleReconciler) Reconcile(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, namespace := range s.namespaces() {
+		functions, err := s.Lister.ListFunctions(context.Background(), namespace)
+		if err != nil {
+			log.Printf("[Schedule] unable to list functions in %q: %s", namespace, err)
+			continue
+		}
+
+		for _, function := range functions {
+			if len(function.Namespace) == 0 {
+				function.Namespace = namespace
+			}
+
+			var annotations map[string]string
+			if function.Annotations != nil {
+				annotations = *function.Annotations
+			}
+
+			key := function.Name + "." + function.Namespace
+			if _, ok := annotations[ScheduleAnnotation]; !ok {
+				delete(s.raised, key)
+				continue
+			}
+
+			s.reconcileFunction(function.Name, function.Namespace, ScheduledMinReplicas(annotations, now), now)
+		}
+	}
+}
+
+// namespaces returns the namespaces to list functions in
+func (s *ScheduleReconciler) namespaces() []string {
+	if s.NamespaceLister == nil {
+		return s.Namespaces
+	}
+
+	namespaces, err := s.NamespaceLister.ListNamespaces(context.Background())
+	if err != nil {
+		log.Printf("[Schedule] unable to list namespaces: %s", err)
+		return s.Namespaces
+	}
+	if len(namespaces) == 0 {
+		return s.Namespaces
+	}
+	return namespaces
+}
+
+// reconcileFunction must be called with the lock held
+func (s *ScheduleReconciler) reconcileFunction(functionName, namespace string, min uint64, now time.Time) {
+	key := functionName + "." + namespace
+
+	queryResponse, err := s.ServiceQuery.GetReplicas(context.Background(), functionName, namespace)
+	if err != nil {
+		log.Printf("[Schedule] function=%s.%s unable to get replicas: %s", functionName, namespace, err)
+		return
+	}
+
+	if queryResponse.MaxReplicas > 0 && min > queryResponse.MaxReplicas {
+		min = queryResponse.MaxReplicas
+	}
+
+	raised, ok := s.raised[key]
+	if ok && queryResponse.Replicas != raised {
+		// The replicas were changed since, so leave them be
+		delete(s.raised, key)
+		ok = false
+	}
+
+	if ok && min < raised {
+		log.Printf("[Schedule] function=%s.%s minimum %d => %d, left to scale down once idle", functionName, namespace, raised, min)
+		delete(s.raised, key)
+		if s.Tracker != nil {
+			s.Tracker.Touch(functionName, namespace, now)
+		}
+		return
+	}
+
+	if queryResponse.Replicas >= min {
+		return
+	}
+
+	log.Printf("[Schedule] function=%s.%s %d => %d requested", functionName, namespace, queryResponse.Replicas, min)
+	if err := s.ServiceQuery.SetReplicas(context.Background(), functionName, namespace, min); err != nil {
+		log.Printf("[Schedule] function=%s.%s unable to scale: %s", functionName, namespace, err)
+		return
+	}
+	s.raised[key] = min
+}
@@ -0,0 +1,224 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	providerTypes "github.com/openfaas/faas-provider/types"
+)
+
+// listingFakeServiceQuery lists a single function with annotations, and
+// records the namespaces listed
+type listingFakeServiceQuery struct {
+	fakeServiceQuery
+
+	listed []string
+}
+
+func (f *listingFakeServiceQuery) ListFunctions(ctx context.Context, namespace string) ([]providerTypes.FunctionStatus, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.listed = append(f.listed, namespace)
+
+	annotations := f.annotations
+	return []providerTypes.FunctionStatus{
+		{Name: "echo", Namespace: namespace, Replicas: f.replicas, Annotations: &annotations},
+	}, nil
+}
+
+type fakeNamespaceLister struct {
+	namespaces []string
+	err        error
+}
+
+func (f fakeNamespaceLister) ListNamespaces(ctx context.Context) ([]string, error) {
+	return f.namespaces, f.err
+}
+
+func Test_ParseSchedule_MinReplicas(t *testing.T) {
+	schedule, err := ParseSchedule("min=3 on weekdays 08:00-18:00, min=1 on sat 22:00-02:00; otherwise 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		at   time.Time
+		want uint64
+	}{
+		{time.Date(2023, time.October, 2, 8, 0, 0, 0, time.UTC), 3},   // Monday
+		{time.Date(2023, time.October, 2, 17, 59, 0, 0, time.UTC), 3}, // Monday
+		{time.Date(2023, time.October, 2, 18, 0, 0, 0, time.UTC), 0},  // Monday
+		{time.Date(2023, time.October, 6, 12, 0, 0, 0, time.UTC), 3},  // Friday
+		{time.Date(2023, time.October, 7, 12, 0, 0, 0, time.UTC), 0},  // Saturday
+		{time.Date(2023, time.October, 7, 23, 0, 0, 0, time.UTC), 1},  // Saturday
+		{time.Date(2023, time.October, 8, 1, 0, 0, 0, time.UTC), 1},   // Sunday
+		{time.Date(2023, time.October, 8, 3, 0, 0, 0, time.UTC), 0},   // Sunday
+	}
+
+	for _, c := range cases {
+		if got := schedule.MinReplicas(c.at); got != c.want {
+			t.Errorf("%s, want: %d, got: %d", c.at.Format(time.RFC1123), c.want, got)
+		}
+	}
+}
+
+func Test_ParseSchedule_HighestMatchingRuleWins(t *testing.T) {
+	schedule, err := ParseSchedule("min=1 daily; min=4 on mon-wed 12:00-13:00; otherwise 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := schedule.MinReplicas(time.Date(2023, time.October, 3, 12, 30, 0, 0, time.UTC)); got != 4 {
+		t.Errorf("want: 4, got: %d", got)
+	}
+	if got := schedule.MinReplicas(time.Date(2023, time.October, 5, 12, 30, 0, 0, time.UTC)); got != 1 {
+		t.Errorf("want: 1, got: %d", got)
+	}
+}
+
+func Test_ParseSchedule_Invalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"min=x on weekdays",
+		"3 on weekdays",
+		"min=1 on someday",
+		"min=1 08:00",
+		"min=1 08:00-08:00",
+		"min=1 25:00-26:00",
+		"min=1, otherwise",
+		"otherwise 1, otherwise 2",
+	} {
+		if _, err := ParseSchedule(value); err == nil {
+			t.Errorf("%q, want an error", value)
+		}
+	}
+}
+
+func Test_ScheduledMinReplicas_Timezone(t *testing.T) {
+	annotations := map[string]string{
+		ScheduleAnnotation:         "min=2 on weekdays 08:00-18:00",
+		ScheduleTimezoneAnnotation: "America/New_York",
+	}
+
+	// 13:00 UTC is 09:00 in New York during daylight saving time
+	if got := ScheduledMinReplicas(annotations, time.Date(2023, time.October, 2, 13, 0, 0, 0, time.UTC)); got != 2 {
+		t.Errorf("want: 2, got: %d", got)
+	}
+	if got := ScheduledMinReplicas(annotations, time.Date(2023, time.October, 2, 9, 0, 0, 0, time.UTC)); got != 0 {
+		t.Errorf("want: 0, got: %d", got)
+	}
+}
+
+func Test_ScheduleReconciler_RaisesAndLeavesScaleDownToIdleReaper(t *testing.T) {
+	query := &listingFakeServiceQuery{fakeServiceQuery: fakeServiceQuery{
+		annotations: map[string]string{
+			ScheduleAnnotation:     "min=3 on weekdays 08:00-18:00, otherwise 0",
+			ZeroDurationAnnotation: "15m",
+		},
+	}}
+	reaper, tracker := newTestReaper(&query.fakeServiceQuery, time.Minute)
+	reconciler := NewScheduleReconciler(query, query, []string{"openfaas-fn"}, tracker)
+
+	monday := time.Date(2023, time.October, 2, 0, 0, 0, 0, time.UTC)
+
+	reconciler.Reconcile(monday.Add(7 * time.Hour))
+	reconciler.Reconcile(monday.Add(9 * time.Hour))
+	reconciler.Reconcile(monday.Add(10 * time.Hour))
+	reconciler.Reconcile(monday.Add(19 * time.Hour))
+
+	// The function may be serving requests when the floor drops
+	if calls := query.calls(); len(calls) != 1 || calls[0] != 3 {
+		t.Fatalf("want a single scale to 3, got: %v", calls)
+	}
+
+	reaper.Reconcile(monday.Add(19*time.Hour + 10*time.Minute))
+	if calls := waitForScaling(t, reaper.Wait, &query.fakeServiceQuery); len(calls) != 1 {
+		t.Fatalf("want the function kept for its zero-duration, got: %v", calls)
+	}
+
+	reaper.Reconcile(monday.Add(19*time.Hour + 20*time.Minute))
+	if calls := waitForScaling(t, reaper.Wait, &query.fakeServiceQuery); len(calls) != 2 || calls[1] != 0 {
+		t.Fatalf("want the idle reaper to scale to zero, got: %v", calls)
+	}
+}
+
+func Test_ScheduleReconciler_LeavesChangedReplicas(t *testing.T) {
+	query := &listingFakeServiceQuery{fakeServiceQuery: fakeServiceQuery{
+		annotations: map[string]string{ScheduleAnnotation: "min=3 on weekdays 08:00-18:00, otherwise 0"},
+	}}
+	reconciler := NewScheduleReconciler(query, query, []string{"openfaas-fn"}, nil)
+
+	monday := time.Date(2023, time.October, 2, 0, 0, 0, 0, time.UTC)
+	reconciler.Reconcile(monday.Add(9 * time.Hour))
+
+	// Scaled up since, i.e. by the autoscaler
+	query.SetReplicas(context.Background(), "echo", "openfaas-fn", 5)
+	reconciler.Reconcile(monday.Add(19 * time.Hour))
+
+	calls := query.calls()
+	if len(calls) != 2 || calls[1] != 5 {
+		t.Fatalf("want replicas changed since left alone, got: %v", calls)
+	}
+}
+
+func Test_ScheduleReconciler_ProviderUnreachable(t *testing.T) {
+	query := &listingFakeServiceQuery{fakeServiceQuery: fakeServiceQuery{
+		annotations: map[string]string{ScheduleAnnotation: "min=3 on weekdays 08:00-18:00, otherwise 0"},
+	}}
+	query.failSetReplicas(errors.New("connection refused"))
+	reconciler := NewScheduleReconciler(query, query, []string{"openfaas-fn"}, nil)
+
+	monday := time.Date(2023, time.October, 2, 0, 0, 0, 0, time.UTC)
+	reconciler.Reconcile(monday.Add(9 * time.Hour))
+
+	if len(query.calls()) != 1 || query.currentReplicas() != 0 {
+		t.Fatalf("want a failed scale up, got calls: %v, replicas: %d", query.calls(), query.currentReplicas())
+	}
+
+	// A failed scale up is not recorded as raised, so it is not taken as a
+	// floor which later drops
+	if raised, ok := reconciler.raised["echo.openfaas-fn"]; ok {
+		t.Fatalf("want no raised replicas recorded, got: %d", raised)
+	}
+
+	// The scale up is tried again on the next interval
+	query.failSetReplicas(nil)
+	reconciler.Reconcile(monday.Add(10 * time.Hour))
+
+	if query.currentReplicas() != 3 || reconciler.raised["echo.openfaas-fn"] != 3 {
+		t.Fatalf("want 3 replicas recorded as raised, got: %d", query.currentReplicas())
+	}
+}
+
+func Test_ScheduleReconciler_ListsNamespacesFromProvider(t *testing.T) {
+	cases := []struct {
+		name   string
+		lister fakeNamespaceLister
+		want   string
+	}{
+		{"from the provider", fakeNamespaceLister{namespaces: []string{"openfaas-fn", "team-a"}}, "[openfaas-fn team-a]"},
+		{"provider without namespaces", fakeNamespaceLister{}, "[openfaas-fn]"},
+		{"provider unreachable", fakeNamespaceLister{err: errors.New("connection refused")}, "[openfaas-fn]"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query := &listingFakeServiceQuery{}
+			reconciler := NewScheduleReconciler(query, query, []string{"openfaas-fn"}, nil)
+			reconciler.NamespaceLister = c.lister
+
+			reconciler.Reconcile(time.Now())
+
+			if got := fmt.Sprint(query.listed); got != c.want {
+				t.Errorf("want functions listed in: %s, got: %s", c.want, got)
+			}
+		})
+	}
+}
@@ -3,10 +3,46 @@
 
 package scaling
 
-// ServiceQuery provides interface for replica querying/setting
+import (
+	"context"
+	"errors"
+	"time"
+
+	providerTypes "github.com/openfaas/faas-provider/types"
+)
+
+// ServiceQuery provides interface for replica querying/setting, calls
+// give up when ctx is cancelled
 type ServiceQuery interface {
-	GetReplicas(service, namespace string) (response ServiceQueryResponse, err error)
-	SetReplicas(service, namespace string, count uint64) error
+	GetReplicas(ctx context.Context, service, namespace string) (response ServiceQueryResponse, err error)
+	SetReplicas(ctx context.Context, service, namespace string, count uint64) error
+}
+
+// ErrFunctionNotFound is returned by a ServiceQuery when the provider
+// has no function by the name requested
+var ErrFunctionNotFound = errors.New("function not found")
+
+// ErrWatchNotSupported is returned by a ReadinessWatcher when the provider
+// cannot watch a function's replicas, callers should poll GetReplicas instead
+var ErrWatchNotSupported = errors.New("provider does not support watching replicas")
+
+// ReadinessWatcher is optionally implemented by a ServiceQuery to block
+// until a function has an available replica, or timeout passes, rather
+// than polling GetReplicas
+type ReadinessWatcher interface {
+	WatchReplicas(ctx context.Context, service, namespace string, timeout time.Duration) (response ServiceQueryResponse, err error)
+}
+
+// FunctionLister is optionally implemented by a ServiceQuery to list the
+// functions deployed in a namespace, along with their labels
+type FunctionLister interface {
+	ListFunctions(ctx context.Context, namespace string) ([]providerTypes.FunctionStatus, error)
+}
+
+// NamespaceLister is optionally implemented by a ServiceQuery to list the
+// namespaces functions can be deployed to
+type NamespaceLister interface {
+	ListNamespaces(ctx context.Context) ([]string, error)
 }
 
 // ServiceQueryResponse response from querying a function status
@@ -0,0 +1,158 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package simulator
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// VirtualClock is a types.Clock which only moves when advanced. Goroutines
+// started with Go which Sleep on the clock are woken in time order as the
+// clock is advanced past their wake-up time, so code written against
+// types.Clock runs as it would in real time, without waiting.
+//
+// Sleep must only be called from goroutines started with Go.
+type VirtualClock struct {
+	lock     sync.Mutex
+	idle     *sync.Cond
+	now      time.Time
+	sleepers sleeperQueue
+	seq      uint64
+
+	// running counts goroutines started with Go which are not sleeping
+	running int
+}
+
+// NewVirtualClock creates a VirtualClock stopped at start
+func NewVirtualClock(start time.Time) *VirtualClock {
+	c := &VirtualClock{now: start}
+	c.idle = sync.NewCond(&c.lock)
+	return c
+}
+
+// Now returns the virtual time
+func (c *VirtualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// Sleep blocks until the clock is advanced by at least d
+func (c *VirtualClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	c.seq++
+	s := &sleeper{at: c.now.Add(d), seq: c.seq, wake: make(chan struct{})}
+	heap.Push(&c.sleepers, s)
+	c.running--
+	c.idle.Broadcast()
+	c.lock.Unlock()
+
+	<-s.wake
+}
+
+// Go runs f in a goroutine which may Sleep on the clock
+func (c *VirtualClock) Go(f func()) {
+	c.lock.Lock()
+	c.running++
+	c.lock.Unlock()
+
+	go func() {
+		defer func() {
+			c.lock.Lock()
+			c.running--
+			c.idle.Broadcast()
+			c.lock.Unlock()
+		}()
+
+		f()
+	}()
+}
+
+// Settle blocks until every goroutine started with Go is sleeping or
+// has returned
+func (c *VirtualClock) Settle() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for c.running > 0 {
+		c.idle.Wait()
+	}
+}
+
+// NextWakeup returns the earliest time a sleeping goroutine is due to wake
+func (c *VirtualClock) NextWakeup() (time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.sleepers) == 0 {
+		return time.Time{}, false
+	}
+	return c.sleepers[0].at, true
+}
+
+// AdvanceTo moves the clock forward to t, waking each sleeping goroutine
+// due by then in turn and letting it run until it sleeps again or returns.
+// The clock never moves backwards.
+func (c *VirtualClock) AdvanceTo(t time.Time) {
+	c.Settle()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.sleepers) > 0 && !c.sleepers[0].at.After(t) {
+		s := heap.Pop(&c.sleepers).(*sleeper)
+		if s.at.After(c.now) {
+			c.now = s.at
+		}
+
+		c.running++
+		close(s.wake)
+
+		for c.running > 0 {
+			c.idle.Wait()
+		}
+	}
+
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+type sleeper struct {
+	at   time.Time
+	seq  uint64
+	wake chan struct{}
+}
+
+// sleeperQueue is a heap of sleepers by wake-up time, then by the order
+// in which they went to sleep
+type sleeperQueue []*sleeper
+
+func (q sleeperQueue) Len() int { return len(q) }
+
+func (q sleeperQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q sleeperQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *sleeperQueue) Push(x interface{}) { *q = append(*q, x.(*sleeper)) }
+
+func (q *sleeperQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	s := old[n-1]
+	*q = old[:n-1]
+	return s
+}
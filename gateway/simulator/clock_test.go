@@ -0,0 +1,53 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package simulator
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_VirtualClock_WakesSleepersInOrder(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	var lock sync.Mutex
+	woken := []string{}
+
+	sleep := func(name string, d time.Duration) {
+		clock.Go(func() {
+			clock.Sleep(d)
+
+			lock.Lock()
+			woken = append(woken, name)
+			lock.Unlock()
+		})
+	}
+
+	sleep("c", time.Second*3)
+	sleep("a", time.Second)
+	sleep("b", time.Second*2)
+	clock.Settle()
+
+	if next, ok := clock.NextWakeup(); !ok || !next.Equal(start.Add(time.Second)) {
+		t.Fatalf("want the next wake-up at 1s, got: %s", next)
+	}
+
+	clock.AdvanceTo(start.Add(time.Second * 2))
+	if got := clock.Now(); !got.Equal(start.Add(time.Second * 2)) {
+		t.Errorf("want the clock at 2s, got: %s", got.Sub(start))
+	}
+
+	lock.Lock()
+	if len(woken) != 2 || woken[0] != "a" || woken[1] != "b" {
+		t.Errorf("want a and b woken in order, got: %v", woken)
+	}
+	lock.Unlock()
+
+	clock.AdvanceTo(start.Add(time.Hour))
+	if len(woken) != 3 {
+		t.Errorf("want all sleepers woken, got: %v", woken)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// Provider models a faas-provider as a scaling.ServiceQuery. Replicas
+// added by a scale up become available after the function's cold start,
+// replicas removed by a scale down are released immediately.
+type Provider struct {
+	clock     types.Clock
+	functions map[string]*modelFunction
+	lock      sync.Mutex
+}
+
+type modelFunction struct {
+	Function
+
+	replicas  uint64
+	available uint64
+	readyAt   time.Time
+}
+
+// NewProvider creates a Provider with no functions
+func NewProvider(clock types.Clock) *Provider {
+	return &Provider{
+		clock:     clock,
+		functions: make(map[string]*modelFunction),
+	}
+}
+
+// Deploy adds a function with its initial replicas available
+func (p *Provider) Deploy(fn Function) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.functions[fn.Name+"."+fn.Namespace] = &modelFunction{
+		Function:  fn,
+		replicas:  fn.Replicas,
+		available: fn.Replicas,
+	}
+}
+
+// GetReplicas returns the replicas of a function at the clock's time
+func (p *Provider) GetReplicas(ctx context.Context, service, namespace string) (scaling.ServiceQueryResponse, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn, ok := p.functions[service+"."+namespace]
+	if !ok {
+		return scaling.ServiceQueryResponse{}, fmt.Errorf("function %s.%s not found", service, namespace)
+	}
+	fn.refresh(p.clock.Now())
+
+	annotations := fn.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	return scaling.ServiceQueryResponse{
+		Replicas:          fn.replicas,
+		AvailableReplicas: fn.available,
+		MinReplicas:       scaling.DefaultMinReplicas,
+		MaxReplicas:       scaling.DefaultMaxReplicas,
+		ScalingFactor:     scaling.DefaultScalingFactor,
+		Annotations:       &annotations,
+	}, nil
+}
+
+// SetReplicas sets the desired replicas of a function at the clock's time
+func (p *Provider) SetReplicas(ctx context.Context, service, namespace string, count uint64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn, ok := p.functions[service+"."+namespace]
+	if !ok {
+		return fmt.Errorf("function %s.%s not found", service, namespace)
+	}
+
+	now := p.clock.Now()
+	fn.refresh(now)
+
+	if count > fn.replicas {
+		fn.readyAt = now.Add(fn.ColdStart)
+	} else {
+		fn.available = count
+		fn.readyAt = time.Time{}
+	}
+	fn.replicas = count
+	fn.refresh(now)
+
+	return nil
+}
+
+// Replicas returns the desired replicas of a function, which hold memory
+// whether they are available or still starting
+func (p *Provider) Replicas(service, namespace string) uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if fn, ok := p.functions[service+"."+namespace]; ok {
+		return fn.replicas
+	}
+	return 0
+}
+
+// refresh makes pending replicas available once their cold start has passed
+func (fn *modelFunction) refresh(now time.Time) {
+	if !fn.readyAt.IsZero() && !now.Before(fn.readyAt) {
+		fn.available = fn.replicas
+		fn.readyAt = time.Time{}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package simulator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FunctionReport is the outcome of a simulation for a function, or for
+// every function in Report.Total
+type FunctionReport struct {
+	Name       string
+	Requests   int
+	ColdStarts int
+	Errors     int
+
+	// MemoryMBSeconds is the memory held by replicas over the simulation,
+	// IdleMemoryMBSeconds the part of it held with no invocation in flight
+	MemoryMBSeconds     float64
+	IdleMemoryMBSeconds float64
+
+	// Latency percentiles include waiting for a cold start and the
+	// function's execution time
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+
+	latencies []time.Duration
+}
+
+// ColdStartRatio is the fraction of requests which waited for a cold start
+func (r FunctionReport) ColdStartRatio() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.ColdStarts) / float64(r.Requests)
+}
+
+func (r *FunctionReport) record(latency time.Duration, coldStart, failed bool) {
+	r.Requests++
+	if coldStart {
+		r.ColdStarts++
+	}
+	if failed {
+		r.Errors++
+	}
+	r.latencies = append(r.latencies, latency)
+}
+
+// summarise sorts the latencies and sets the percentiles
+func (r *FunctionReport) summarise() {
+	sort.Slice(r.latencies, func(i, j int) bool {
+		return r.latencies[i] < r.latencies[j]
+	})
+
+	r.LatencyP50 = percentile(r.latencies, 50)
+	r.LatencyP90 = percentile(r.latencies, 90)
+	r.LatencyP99 = percentile(r.latencies, 99)
+}
+
+// percentile of sorted by the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Report of a simulation
+type Report struct {
+	// Functions sorted by name
+	Functions []FunctionReport
+	Total     FunctionReport
+}
+
+func newReport(results map[string]*FunctionReport) Report {
+	report := Report{
+		Total: FunctionReport{Name: "total"},
+	}
+
+	for _, name := range sortedNames(results) {
+		result := results[name]
+		result.summarise()
+		report.Functions = append(report.Functions, *result)
+
+		report.Total.Requests += result.Requests
+		report.Total.ColdStarts += result.ColdStarts
+		report.Total.Errors += result.Errors
+		report.Total.MemoryMBSeconds += result.MemoryMBSeconds
+		report.Total.IdleMemoryMBSeconds += result.IdleMemoryMBSeconds
+		report.Total.latencies = append(report.Total.latencies, result.latencies...)
+	}
+	report.Total.summarise()
+
+	return report
+}
+
+// WriteCSV writes a row for each function and the total
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"function", "requests", "cold_starts", "cold_start_ratio", "errors",
+		"latency_p50_seconds", "latency_p90_seconds", "latency_p99_seconds",
+		"memory_mb_seconds", "idle_memory_mb_seconds"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, result := range append(r.Functions, r.Total) {
+		if err := writer.Write(result.row()); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (r FunctionReport) row() []string {
+	return []string{
+		r.Name,
+		strconv.Itoa(r.Requests),
+		strconv.Itoa(r.ColdStarts),
+		fmt.Sprintf("%.4f", r.ColdStartRatio()),
+		strconv.Itoa(r.Errors),
+		fmt.Sprintf("%.3f", r.LatencyP50.Seconds()),
+		fmt.Sprintf("%.3f", r.LatencyP90.Seconds()),
+		fmt.Sprintf("%.3f", r.LatencyP99.Seconds()),
+		fmt.Sprintf("%.1f", r.MemoryMBSeconds),
+		fmt.Sprintf("%.1f", r.IdleMemoryMBSeconds),
+	}
+}
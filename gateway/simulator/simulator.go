@@ -0,0 +1,406 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package simulator replays invocations through the gateway's scaling
+// code on a VirtualClock, against a modeled Provider, to compare
+// keep-alive and scaling policies in seconds rather than hours.
+//
+// Each invocation is scaled from zero by a scaling.FunctionScaler, idle
+// functions are unloaded by the scaling.IdleReaper or the
+// scaling.HybridHistogramPolicy, and busy functions are scaled by the
+// scaling.ConcurrencyAutoscaler, as they would be by the gateway. Every
+// replica serves any number of concurrent invocations.
+package simulator
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// Invocation of a function to simulate
+type Invocation struct {
+	Function string
+
+	// At is the offset from the start of the simulation
+	At time.Duration
+
+	// Duration is the execution time of the function, once a replica is available
+	Duration time.Duration
+}
+
+// Function is deployed to the modeled Provider, functions which are
+// invoked without being configured are deployed with the Config's defaults
+type Function struct {
+	Name        string
+	Namespace   string
+	Annotations map[string]string
+
+	// Replicas is the initial replica count, which is available immediately
+	Replicas uint64
+
+	// ColdStart is how long new replicas take to become available
+	ColdStart time.Duration
+
+	// MemoryMB held by each replica
+	MemoryMB float64
+}
+
+// Config for a Simulation
+type Config struct {
+	// Namespace of every function, "openfaas-fn" when empty
+	Namespace string
+
+	// ColdStart and MemoryMB apply to functions which don't set them
+	ColdStart time.Duration
+	MemoryMB  float64
+
+	// KeepAlivePolicy applies to functions without the
+	// scaling.KeepAlivePolicyAnnotation, see scaling.KeepAlivePolicy
+	KeepAlivePolicy string
+
+	// IdleDuration is how long functions with the fixed keep-alive policy
+	// are kept warm without an invocation, zero keeps them warm
+	IdleDuration time.Duration
+
+	// Hybrid configures the hybrid keep-alive policy
+	Hybrid scaling.HybridPolicyConfig
+
+	// TargetConcurrency enables the concurrency autoscaler for functions
+	// without the scaling.TargetConcurrencyAnnotation, zero disables it
+	TargetConcurrency float64
+
+	// ReconcileInterval is how often the keep-alive policies run
+	ReconcileInterval time.Duration
+
+	// AutoscaleInterval is how often the concurrency autoscaler runs
+	AutoscaleInterval time.Duration
+
+	// FunctionPollInterval, MaxPollCount and CacheExpiry are passed to the
+	// FunctionScaler in its scaling.ScalingConfig
+	FunctionPollInterval time.Duration
+	MaxPollCount         uint
+	CacheExpiry          time.Duration
+
+	Functions []Function
+}
+
+// DefaultConfig uses the gateway's defaults, a two second cold start,
+// 128MB per replica and a 15 minute fixed keep-alive
+func DefaultConfig() Config {
+	return Config{
+		Namespace:            "openfaas-fn",
+		ColdStart:            time.Second * 2,
+		MemoryMB:             128,
+		KeepAlivePolicy:      scaling.KeepAlivePolicyFixed,
+		IdleDuration:         time.Minute * 15,
+		Hybrid:               scaling.DefaultHybridPolicyConfig(),
+		ReconcileInterval:    time.Second * 10,
+		AutoscaleInterval:    time.Second * 2,
+		FunctionPollInterval: time.Millisecond * 100,
+		MaxPollCount:         1000,
+		CacheExpiry:          time.Millisecond * 250,
+	}
+}
+
+// epoch is the start of the VirtualClock, so that reports are reproducible
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	eventArrival = iota
+	eventCompletion
+	eventReconcile
+	eventAutoscale
+)
+
+type event struct {
+	at         time.Time
+	seq        uint64
+	kind       int
+	invocation Invocation
+}
+
+// Run simulates invocations for duration, or until the last invocation
+// completes if that is later, and reports the result for each function
+func Run(config Config, invocations []Invocation, duration time.Duration) Report {
+	s := newSimulation(config)
+	return s.run(invocations, duration)
+}
+
+type simulation struct {
+	config Config
+
+	clock        *VirtualClock
+	provider     *Provider
+	scaler       scaling.FunctionScaler
+	tracker      *scaling.InvocationTracker
+	reaper       *scaling.IdleReaper
+	hybrid       *scaling.HybridHistogramPolicy
+	autoscaler   *scaling.ConcurrencyAutoscaler
+	functions    map[string]Function
+	accruedUntil time.Time
+
+	// lock guards the events and results, which are added to by
+	// invocations running on the clock
+	lock    sync.Mutex
+	events  eventQueue
+	seq     uint64
+	results map[string]*FunctionReport
+}
+
+func newSimulation(config Config) *simulation {
+	if len(config.Namespace) == 0 {
+		config.Namespace = "openfaas-fn"
+	}
+
+	clock := NewVirtualClock(epoch)
+	provider := NewProvider(clock)
+
+	scalingConfig := scaling.ScalingConfig{
+		MaxPollCount:         config.MaxPollCount,
+		SetScaleRetries:      1,
+		FunctionPollInterval: config.FunctionPollInterval,
+		CacheExpiry:          config.CacheExpiry,
+		ServiceQuery:         provider,
+		Clock:                clock,
+	}
+
+	scalingCache := &scaling.FunctionCache{Cache: make(map[string]*scaling.FunctionMeta), Expiry: config.CacheExpiry, Clock: clock}
+	annotationCache := &scaling.FunctionCache{Cache: make(map[string]*scaling.FunctionMeta), Expiry: config.CacheExpiry, Clock: clock}
+	functionQuery := scaling.NewCachedFunctionQuery(annotationCache, provider)
+
+	s := &simulation{
+		config:       config,
+		clock:        clock,
+		provider:     provider,
+		scaler:       scaling.NewFunctionScaler(scalingConfig, scalingCache),
+		tracker:      scaling.NewInvocationTracker(),
+		functions:    make(map[string]Function),
+		accruedUntil: epoch,
+		results:      make(map[string]*FunctionReport),
+	}
+
+	s.reaper = scaling.NewIdleReaper(s.tracker, &s.scaler, functionQuery, config.IdleDuration, config.KeepAlivePolicy)
+	s.hybrid = scaling.NewHybridHistogramPolicy(config.Hybrid, &s.scaler, functionQuery, config.KeepAlivePolicy)
+
+	autoscalerConfig := scaling.DefaultConcurrencyAutoscalerConfig()
+	autoscalerConfig.DefaultTarget = config.TargetConcurrency
+	s.autoscaler = scaling.NewConcurrencyAutoscaler(autoscalerConfig, s.tracker, provider, functionQuery, scaling.NewScalingPolicyRegistry())
+
+	for _, fn := range config.Functions {
+		s.deploy(fn)
+	}
+
+	return s
+}
+
+func (s *simulation) deploy(fn Function) {
+	if len(fn.Namespace) == 0 {
+		fn.Namespace = s.config.Namespace
+	}
+	if fn.ColdStart == 0 {
+		fn.ColdStart = s.config.ColdStart
+	}
+	if fn.MemoryMB == 0 {
+		fn.MemoryMB = s.config.MemoryMB
+	}
+
+	s.functions[fn.Name] = fn
+	s.provider.Deploy(fn)
+	s.results[fn.Name] = &FunctionReport{Name: fn.Name}
+}
+
+func (s *simulation) run(invocations []Invocation, duration time.Duration) Report {
+	end := epoch.Add(duration)
+
+	for _, invocation := range invocations {
+		if _, ok := s.functions[invocation.Function]; !ok {
+			s.deploy(Function{Name: invocation.Function})
+		}
+		s.schedule(event{at: epoch.Add(invocation.At), kind: eventArrival, invocation: invocation})
+	}
+
+	if s.config.ReconcileInterval > 0 {
+		s.schedule(event{at: epoch.Add(s.config.ReconcileInterval), kind: eventReconcile})
+	}
+	if s.config.AutoscaleInterval > 0 {
+		s.schedule(event{at: epoch.Add(s.config.AutoscaleInterval), kind: eventAutoscale})
+	}
+
+	for {
+		next, ok := s.next()
+		wakeup, sleeping := s.clock.NextWakeup()
+
+		if sleeping && (!ok || !wakeup.After(next.at)) {
+			s.accrue(wakeup)
+			s.clock.AdvanceTo(wakeup)
+			continue
+		}
+		if !ok {
+			break
+		}
+
+		s.pop()
+		s.accrue(next.at)
+		s.clock.AdvanceTo(next.at)
+		s.handle(next, end)
+		s.clock.Settle()
+	}
+
+	s.accrue(end)
+
+	return newReport(s.results)
+}
+
+func (s *simulation) handle(e event, end time.Time) {
+	now := s.clock.Now()
+
+	switch e.kind {
+	case eventArrival:
+		fn := s.functions[e.invocation.Function]
+
+		s.tracker.Started(fn.Name, fn.Namespace, now)
+		s.hybrid.Started(fn.Name, fn.Namespace, now)
+
+		s.clock.Go(func() {
+			s.invoke(fn, e.invocation, now)
+		})
+
+	case eventCompletion:
+		fn := s.functions[e.invocation.Function]
+
+		s.tracker.Completed(fn.Name, fn.Namespace, now)
+		s.hybrid.Completed(fn.Name, fn.Namespace, now)
+
+	case eventReconcile:
+		s.reaper.Reconcile(now)
+		s.reaper.Wait()
+		s.hybrid.Reconcile(now)
+		s.hybrid.Wait()
+
+		if next := now.Add(s.config.ReconcileInterval); !next.After(end) {
+			s.schedule(event{at: next, kind: eventReconcile})
+		}
+
+	case eventAutoscale:
+		s.autoscaler.Sample(now)
+		s.autoscaler.Reconcile(now)
+
+		if next := now.Add(s.config.AutoscaleInterval); !next.After(end) {
+			s.schedule(event{at: next, kind: eventAutoscale})
+		}
+	}
+}
+
+// invoke scales the function from zero if needed, then schedules the
+// completion of the invocation
+func (s *simulation) invoke(fn Function, invocation Invocation, arrived time.Time) {
+	res := s.scaler.Scale(context.Background(), fn.Name, fn.Namespace)
+	now := s.clock.Now()
+
+	failed := res.Error != nil || !res.Available
+	if !failed {
+		// The scaler lets requests through once it has polled MaxPollCount
+		// times, which fail at the provider if there is still no replica
+		queryResponse, err := s.provider.GetReplicas(context.Background(), fn.Name, fn.Namespace)
+		failed = err != nil || queryResponse.AvailableReplicas == 0
+	}
+
+	latency := now.Sub(arrived)
+	if !failed {
+		latency += invocation.Duration
+	}
+
+	s.lock.Lock()
+	s.results[fn.Name].record(latency, res.ColdStart, failed)
+	s.lock.Unlock()
+
+	s.schedule(event{at: arrived.Add(latency), kind: eventCompletion, invocation: invocation})
+}
+
+// accrue adds the memory held by each function's replicas up to the time to
+func (s *simulation) accrue(to time.Time) {
+	elapsed := to.Sub(s.accruedUntil).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.accruedUntil = to
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, fn := range s.functions {
+		memory := float64(s.provider.Replicas(fn.Name, fn.Namespace)) * fn.MemoryMB * elapsed
+
+		result := s.results[name]
+		result.MemoryMBSeconds += memory
+
+		if activity, _ := s.tracker.Get(fn.Name, fn.Namespace); activity.InFlight == 0 {
+			result.IdleMemoryMBSeconds += memory
+		}
+	}
+}
+
+func (s *simulation) schedule(e event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.seq++
+	e.seq = s.seq
+	heap.Push(&s.events, e)
+}
+
+func (s *simulation) next() (event, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.events) == 0 {
+		return event{}, false
+	}
+	return s.events[0], true
+}
+
+func (s *simulation) pop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	heap.Pop(&s.events)
+}
+
+// eventQueue is a heap of events by time, then by the order they were scheduled
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
+
+// sortedNames returns the keys of results in order
+func sortedNames(results map[string]*FunctionReport) []string {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
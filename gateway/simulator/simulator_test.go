@@ -0,0 +1,135 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package simulator
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The scaling code logs every decision
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func Test_Run_FixedKeepAliveColdStartsAfterIdle(t *testing.T) {
+	config := DefaultConfig()
+	config.ColdStart = time.Second * 2
+	config.IdleDuration = time.Minute * 15
+
+	invocations := []Invocation{
+		{Function: "echo", At: 0, Duration: time.Millisecond * 100},
+		{Function: "echo", At: time.Minute, Duration: time.Millisecond * 100},
+		{Function: "echo", At: time.Minute * 30, Duration: time.Millisecond * 100},
+	}
+
+	report := Run(config, invocations, time.Hour)
+
+	if len(report.Functions) != 1 {
+		t.Fatalf("want 1 function, got: %d", len(report.Functions))
+	}
+	echo := report.Functions[0]
+
+	if echo.Requests != 3 || echo.ColdStarts != 2 || echo.Errors != 0 {
+		t.Fatalf("want 3 requests with 2 cold starts, got: %+v", echo)
+	}
+	if want := time.Second*2 + time.Millisecond*100; echo.LatencyP99 != want {
+		t.Errorf("want p99 latency: %s, got: %s", want, echo.LatencyP99)
+	}
+	if want := time.Millisecond * 100; echo.LatencyP50 != want && echo.LatencyP50 != time.Second*2+want {
+		t.Errorf("unexpected p50 latency: %s", echo.LatencyP50)
+	}
+
+	// Warm from 0s until reaped around 16m, then from 30m until reaped
+	// again around 45m, with 128MB per replica
+	if echo.MemoryMBSeconds < 128*(16*60+15*60) || echo.MemoryMBSeconds > 128*(17*60+16*60) {
+		t.Errorf("unexpected memory: %.1f MB-seconds", echo.MemoryMBSeconds)
+	}
+	if echo.IdleMemoryMBSeconds >= echo.MemoryMBSeconds || echo.IdleMemoryMBSeconds < echo.MemoryMBSeconds-128*5 {
+		t.Errorf("want idle memory just below the total: %.1f, got: %.1f", echo.MemoryMBSeconds, echo.IdleMemoryMBSeconds)
+	}
+}
+
+func Test_Run_KeepWarmColdStartsOnce(t *testing.T) {
+	config := DefaultConfig()
+	config.IdleDuration = 0
+
+	invocations := []Invocation{
+		{Function: "echo", At: 0},
+		{Function: "echo", At: time.Minute * 30},
+		{Function: "echo", At: time.Hour * 2},
+	}
+
+	report := Run(config, invocations, time.Hour*3)
+
+	if got := report.Total.ColdStarts; got != 1 {
+		t.Errorf("want 1 cold start, got: %d", got)
+	}
+}
+
+func Test_Run_ConcurrentArrivalsShareAColdStart(t *testing.T) {
+	config := DefaultConfig()
+	config.ColdStart = time.Second * 5
+
+	invocations := []Invocation{
+		{Function: "echo", At: 0},
+		{Function: "echo", At: time.Second},
+		{Function: "echo", At: time.Second * 10},
+	}
+
+	report := Run(config, invocations, time.Minute)
+	echo := report.Functions[0]
+
+	if echo.ColdStarts != 2 {
+		t.Errorf("want both requests during the cold start to wait, got: %d cold starts", echo.ColdStarts)
+	}
+
+	// The second request waits for the rest of the first's cold start
+	if echo.LatencyP50 != time.Second*4 || echo.LatencyP99 != time.Second*5 {
+		t.Errorf("want latencies of 4s and 5s, got p50: %s, p99: %s", echo.LatencyP50, echo.LatencyP99)
+	}
+}
+
+func Test_Run_SimulatesADayQuickly(t *testing.T) {
+	config := DefaultConfig()
+
+	invocations := []Invocation{}
+	for i := 0; i < 24*60; i += 7 {
+		invocations = append(invocations,
+			Invocation{Function: "a", At: time.Duration(i) * time.Minute, Duration: time.Millisecond * 300},
+			Invocation{Function: "b", At: time.Duration(i*3) * time.Minute / 2, Duration: time.Second})
+	}
+
+	started := time.Now()
+	report := Run(config, invocations, time.Hour*24)
+
+	if elapsed := time.Since(started); elapsed > time.Second*20 {
+		t.Errorf("want a day simulated in seconds, took: %s", elapsed)
+	}
+	if report.Total.Requests != len(invocations) {
+		t.Errorf("want %d requests, got: %d", len(invocations), report.Total.Requests)
+	}
+}
+
+func Test_Report_WriteCSV(t *testing.T) {
+	report := Run(DefaultConfig(), []Invocation{{Function: "echo", At: 0}}, time.Minute)
+
+	out := &strings.Builder{}
+	if err := report.WriteCSV(out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want a header, a function and a total, got: %q", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "echo,1,1,1.0000,0,") || !strings.HasPrefix(lines[2], "total,1,1,") {
+		t.Errorf("unexpected rows: %q", lines[1:])
+	}
+}
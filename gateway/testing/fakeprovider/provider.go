@@ -0,0 +1,471 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package fakeprovider is an in-process faas-provider for hermetic tests
+// of the gateway. It serves the provider HTTP API used by the
+// ExternalServiceQuery, the Exporter and the forwarding proxy, with
+// configurable cold starts, failures and responses per function.
+//
+// Serve it with httptest.NewServer and point the gateway's provider
+// URL at the test server:
+//
+//	provider := fakeprovider.New(fakeprovider.Config{ColdStart: time.Second})
+//	provider.Deploy(fakeprovider.Function{Name: "echo"})
+//	server := httptest.NewServer(provider)
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// DefaultNamespace is used for functions and requests without a namespace
+const DefaultNamespace = "openfaas-fn"
+
+// watchHeader is set on watch responses, see plugin.WatchHeader
+const watchHeader = "X-Openfaas-Watch"
+
+// Config for the Provider
+type Config struct {
+	// DefaultNamespace for requests without a namespace, DefaultNamespace
+	// when empty
+	DefaultNamespace string
+
+	// Namespaces returned by /system/namespaces, when empty the endpoint
+	// returns 404 like a provider without namespace support
+	Namespaces []string
+
+	// ColdStart is how long new replicas take to become available, unless
+	// set on the Function
+	ColdStart time.Duration
+
+	// APIFailureRate is the fraction of /system/ requests which fail with
+	// a 500, between 0 and 1
+	APIFailureRate float64
+
+	// Watch enables long-polling of /system/function/{name}?watch=available
+	// until the function has an available replica
+	Watch bool
+
+	// Seed for failures, zero uses a fixed seed so that tests are repeatable
+	Seed int64
+}
+
+// Function is deployed to the Provider
+type Function struct {
+	Name        string
+	Namespace   string
+	Image       string
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Replicas is the initial replica count, which is available immediately
+	Replicas uint64
+
+	// ColdStart overrides Config.ColdStart when set
+	ColdStart time.Duration
+
+	// FailureRate is the fraction of invocations which fail with a 500
+	FailureRate float64
+
+	// Handler responds to invocations with an available replica, the
+	// default responds 200 with the request body
+	Handler http.HandlerFunc
+}
+
+type function struct {
+	Function
+
+	available uint64
+	readyAt   time.Time
+
+	invocations   int
+	scaleRequests []uint64
+}
+
+// Provider serves the faas-provider HTTP API from memory
+type Provider struct {
+	config    Config
+	functions map[string]*function
+	random    *rand.Rand
+	lock      sync.Mutex
+}
+
+// New creates a Provider with no functions
+func New(config Config) *Provider {
+	if len(config.DefaultNamespace) == 0 {
+		config.DefaultNamespace = DefaultNamespace
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = 1
+	}
+
+	return &Provider{
+		config:    config,
+		functions: make(map[string]*function),
+		random:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Deploy adds or replaces a function
+func (p *Provider) Deploy(fn Function) {
+	if len(fn.Namespace) == 0 {
+		fn.Namespace = p.config.DefaultNamespace
+	}
+	if len(fn.Image) == 0 {
+		fn.Image = "ghcr.io/openfaas/" + fn.Name + ":latest"
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.functions[key(fn.Name, fn.Namespace)] = &function{
+		Function:  fn,
+		available: fn.Replicas,
+	}
+}
+
+// Remove deletes a function
+func (p *Provider) Remove(name, namespace string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.functions, key(name, p.namespace(namespace)))
+}
+
+// Status returns the status of a function as served by the provider
+func (p *Provider) Status(name, namespace string) (types.FunctionStatus, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn, ok := p.functions[key(name, p.namespace(namespace))]
+	if !ok {
+		return types.FunctionStatus{}, false
+	}
+	return fn.status(time.Now()), true
+}
+
+// ScaleRequests returns the replica counts requested for a function, in order
+func (p *Provider) ScaleRequests(name, namespace string) []uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if fn, ok := p.functions[key(name, p.namespace(namespace))]; ok {
+		return append([]uint64{}, fn.scaleRequests...)
+	}
+	return nil
+}
+
+// Invocations returns the number of invocations served by a function
+func (p *Provider) Invocations(name, namespace string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if fn, ok := p.functions[key(name, p.namespace(namespace))]; ok {
+		return fn.invocations
+	}
+	return 0
+}
+
+// ServeHTTP routes requests to the provider API
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if strings.HasPrefix(path, "/system/") && p.fail(p.config.APIFailureRate) {
+		http.Error(w, "fakeprovider: injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case path == "/system/functions":
+		p.handleFunctions(w, r)
+	case strings.HasPrefix(path, "/system/function/"):
+		p.handleFunctionStatus(w, r, strings.TrimPrefix(path, "/system/function/"))
+	case strings.HasPrefix(path, "/system/scale-function/"):
+		p.handleScale(w, r, strings.TrimPrefix(path, "/system/scale-function/"))
+	case path == "/system/namespaces":
+		p.handleNamespaces(w, r)
+	case strings.HasPrefix(path, "/function/"):
+		p.handleInvoke(w, r, strings.TrimPrefix(path, "/function/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		namespace := p.namespace(r.URL.Query().Get("namespace"))
+
+		p.lock.Lock()
+		now := time.Now()
+		statuses := []types.FunctionStatus{}
+		for _, fn := range p.functions {
+			if fn.Namespace == namespace {
+				statuses = append(statuses, fn.status(now))
+			}
+		}
+		p.lock.Unlock()
+
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Name < statuses[j].Name
+		})
+		writeJSON(w, http.StatusOK, statuses)
+
+	case http.MethodPost, http.MethodPut:
+		deployment := types.FunctionDeployment{}
+		if err := json.NewDecoder(r.Body).Decode(&deployment); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fn := Function{
+			Name:      deployment.Service,
+			Namespace: deployment.Namespace,
+			Image:     deployment.Image,
+			Replicas:  1,
+		}
+		if deployment.Labels != nil {
+			fn.Labels = *deployment.Labels
+		}
+		if deployment.Annotations != nil {
+			fn.Annotations = *deployment.Annotations
+		}
+		p.Deploy(fn)
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodDelete:
+		req := types.DeleteFunctionRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := p.Status(req.FunctionName, req.Namespace); !ok {
+			http.Error(w, "function not found", http.StatusNotFound)
+			return
+		}
+		p.Remove(req.FunctionName, req.Namespace)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Provider) handleFunctionStatus(w http.ResponseWriter, r *http.Request, name string) {
+	namespace := r.URL.Query().Get("namespace")
+
+	status, ok := p.Status(name, namespace)
+	if !ok {
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+
+	if p.config.Watch && len(r.URL.Query().Get("watch")) > 0 {
+		timeout, _ := strconv.Atoi(r.URL.Query().Get("timeout"))
+		deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+		for status.AvailableReplicas == 0 && time.Now().Before(deadline) {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond * 5):
+			}
+
+			if status, ok = p.Status(name, namespace); !ok {
+				http.Error(w, "function not found", http.StatusNotFound)
+				return
+			}
+		}
+		w.Header().Set(watchHeader, "true")
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (p *Provider) handleScale(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := types.ScaleServiceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	namespace := req.Namespace
+	if len(namespace) == 0 {
+		namespace = r.URL.Query().Get("namespace")
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn, ok := p.functions[key(name, p.namespace(namespace))]
+	if !ok {
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	fn.scaleRequests = append(fn.scaleRequests, req.Replicas)
+	fn.refresh(now)
+
+	if req.Replicas > fn.Replicas {
+		coldStart := p.config.ColdStart
+		if fn.ColdStart > 0 {
+			coldStart = fn.ColdStart
+		}
+		fn.readyAt = now.Add(coldStart)
+	} else {
+		fn.available = req.Replicas
+		fn.readyAt = time.Time{}
+	}
+	fn.Replicas = req.Replicas
+	fn.refresh(now)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *Provider) handleNamespaces(w http.ResponseWriter, r *http.Request) {
+	if len(p.config.Namespaces) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.config.Namespaces)
+}
+
+func (p *Provider) handleInvoke(w http.ResponseWriter, r *http.Request, path string) {
+	name := path
+	if i := strings.Index(path, "/"); i >= 0 {
+		name = path[:i]
+	}
+
+	namespace := ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name, namespace = name[:i], name[i+1:]
+	}
+
+	p.lock.Lock()
+	fn, ok := p.functions[key(name, p.namespace(namespace))]
+	var available uint64
+	var failureRate float64
+	var handler http.HandlerFunc
+	if ok {
+		fn.refresh(time.Now())
+		available = fn.available
+		failureRate = fn.FailureRate
+		handler = fn.Handler
+	}
+	p.lock.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("function %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	if available == 0 {
+		http.Error(w, fmt.Sprintf("no available replicas for function %s", name), http.StatusServiceUnavailable)
+		return
+	}
+
+	if p.fail(failureRate) {
+		http.Error(w, "fakeprovider: injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	p.lock.Lock()
+	fn.invocations++
+	p.lock.Unlock()
+
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// fail decides whether to inject a failure at rate
+func (p *Provider) fail(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.random.Float64() < rate
+}
+
+func (p *Provider) namespace(namespace string) string {
+	if len(namespace) == 0 {
+		return p.config.DefaultNamespace
+	}
+	return namespace
+}
+
+// refresh makes pending replicas available once their cold start has passed
+func (f *function) refresh(now time.Time) {
+	if !f.readyAt.IsZero() && !now.Before(f.readyAt) {
+		f.available = f.Replicas
+		f.readyAt = time.Time{}
+	}
+}
+
+func (f *function) status(now time.Time) types.FunctionStatus {
+	f.refresh(now)
+
+	status := types.FunctionStatus{
+		Name:              f.Name,
+		Namespace:         f.Namespace,
+		Image:             f.Image,
+		Replicas:          f.Replicas,
+		AvailableReplicas: f.available,
+		InvocationCount:   float64(f.invocations),
+	}
+
+	if f.Labels != nil {
+		labels := make(map[string]string, len(f.Labels))
+		for k, v := range f.Labels {
+			labels[k] = v
+		}
+		status.Labels = &labels
+	}
+	if f.Annotations != nil {
+		annotations := make(map[string]string, len(f.Annotations))
+		for k, v := range f.Annotations {
+			annotations[k] = v
+		}
+		status.Annotations = &annotations
+	}
+
+	return status
+}
+
+func key(name, namespace string) string {
+	return name + "." + namespace
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
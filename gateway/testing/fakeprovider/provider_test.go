@@ -0,0 +1,292 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package fakeprovider_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/handlers"
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/plugin"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/testing/fakeprovider"
+	"github.com/openfaas/faas/gateway/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestScalingConfig(t *testing.T, server *httptest.Server) scaling.ScalingConfig {
+	providerURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return scaling.ScalingConfig{
+		MaxPollCount:         1000,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         plugin.NewExternalServiceQuery(*providerURL, nil),
+		SetScaleRetries:      3,
+		ActivatorCapacity:    10,
+		ActivatorTimeout:     time.Second * 5,
+	}
+}
+
+func Test_FunctionScaler_ScalesFromZero(t *testing.T) {
+	for _, watch := range []bool{false, true} {
+		provider := fakeprovider.New(fakeprovider.Config{
+			ColdStart: time.Millisecond * 50,
+			Watch:     watch,
+		})
+		provider.Deploy(fakeprovider.Function{Name: "echo"})
+
+		server := httptest.NewServer(provider)
+
+		config := newTestScalingConfig(t, server)
+		scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+		res := scaler.Scale(context.Background(), "echo", fakeprovider.DefaultNamespace)
+		server.Close()
+
+		if res.Error != nil || !res.Found || !res.Available {
+			t.Fatalf("watch=%t, want the function available, got: %+v", watch, res)
+		}
+		if !res.ColdStart {
+			t.Errorf("watch=%t, want a cold start", watch)
+		}
+		if res.Duration < time.Millisecond*50 {
+			t.Errorf("watch=%t, want the scaler to wait for the cold start, took: %s", watch, res.Duration)
+		}
+
+		status, _ := provider.Status("echo", "")
+		if status.AvailableReplicas != 1 {
+			t.Errorf("watch=%t, want 1 available replica, got: %d", watch, status.AvailableReplicas)
+		}
+	}
+}
+
+func Test_ScalingHandler_ForwardsAfterColdStart(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{ColdStart: time.Millisecond * 20})
+	provider.Deploy(fakeprovider.Function{
+		Name: "hello",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello world"))
+		},
+	})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	config := newTestScalingConfig(t, server)
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	providerURL, _ := url.Parse(server.URL + "/")
+	proxy := types.NewHTTPClientReverseProxy(providerURL, time.Second*5, 10, 10)
+	next := handlers.MakeForwardingProxyHandler(proxy,
+		[]handlers.HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: server.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil)
+
+	handler := handlers.MakeScalingHandler(next, scaler, config, fakeprovider.DefaultNamespace, nil)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/hello", strings.NewReader("")))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d, body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if got := rr.Body.String(); got != "hello world" {
+		t.Errorf("want body: %q, got: %q", "hello world", got)
+	}
+	if got := rr.Header().Get(handlers.ColdStartHeader); got != "true" {
+		t.Errorf("want %s: true, got: %q", handlers.ColdStartHeader, got)
+	}
+	if got := provider.Invocations("hello", ""); got != 1 {
+		t.Errorf("want 1 invocation, got: %d", got)
+	}
+}
+
+func Test_ScaleToZeroHandler_ScalesDown(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{})
+	provider.Deploy(fakeprovider.Function{Name: "idle", Replicas: 2})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	config := newTestScalingConfig(t, server)
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := handlers.MakeScaleToZeroHandler(scaler, config, fakeprovider.DefaultNamespace)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/zero/idle", nil))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("want status: %d, got: %d, body: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	status, _ := provider.Status("idle", "")
+	if status.Replicas != 0 || status.AvailableReplicas != 0 {
+		t.Errorf("want 0 replicas, got: %d/%d", status.AvailableReplicas, status.Replicas)
+	}
+	if got := provider.ScaleRequests("idle", ""); len(got) != 1 || got[0] != 0 {
+		t.Errorf("want a single request to scale to 0, got: %v", got)
+	}
+}
+
+func Test_Provider_UnknownFunction(t *testing.T) {
+	server := httptest.NewServer(fakeprovider.New(fakeprovider.Config{}))
+	defer server.Close()
+
+	config := newTestScalingConfig(t, server)
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	res := scaler.Scale(context.Background(), "missing", fakeprovider.DefaultNamespace)
+	if res.Found || res.Error == nil {
+		t.Errorf("want the function not to be found, got: %+v", res)
+	}
+
+	res2, err := http.Post(server.URL+"/function/missing", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusNotFound {
+		t.Errorf("want status: %d, got: %d", http.StatusNotFound, res2.StatusCode)
+	}
+}
+
+func Test_Provider_InvokeWithoutReplicas(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{})
+	provider.Deploy(fakeprovider.Function{Name: "cold"})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/function/cold.openfaas-fn", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d, got: %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+}
+
+func Test_Provider_FailureRate(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{})
+	provider.Deploy(fakeprovider.Function{Name: "flaky", Replicas: 1, FailureRate: 0.5})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	failures := 0
+	for i := 0; i < 200; i++ {
+		res, err := http.Post(server.URL+"/function/flaky", "text/plain", strings.NewReader("hi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode == http.StatusInternalServerError {
+			failures++
+		} else if string(body) != "hi" {
+			t.Fatalf("want the request body echoed, got: %q", string(body))
+		}
+	}
+
+	if failures < 60 || failures > 140 {
+		t.Errorf("want around 100 failures, got: %d", failures)
+	}
+}
+
+func Test_Provider_GetReplicasByNamespace(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{})
+	provider.Deploy(fakeprovider.Function{Name: "b", Namespace: "dev", Annotations: map[string]string{"key": "value"}})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	providerURL, _ := url.Parse(server.URL + "/")
+	query := plugin.NewExternalServiceQuery(*providerURL, nil)
+
+	res, err := query.GetReplicas(context.Background(), "b", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Replicas != 0 || res.Annotations == nil || (*res.Annotations)["key"] != "value" {
+		t.Errorf("unexpected response: %+v", res)
+	}
+
+	if _, err := query.GetReplicas(context.Background(), "b", ""); err == nil {
+		t.Errorf("want an error for a function in another namespace")
+	}
+}
+
+type errorPrometheusQuery struct{}
+
+func (errorPrometheusQuery) Fetch(query string) (*metrics.VectorQueryResponse, error) {
+	return nil, fmt.Errorf("no prometheus in tests")
+}
+
+func Test_Exporter_WatchesServicesInEachNamespace(t *testing.T) {
+	provider := fakeprovider.New(fakeprovider.Config{Namespaces: []string{"openfaas-fn", "dev"}})
+	provider.Deploy(fakeprovider.Function{Name: "a", Replicas: 1})
+	provider.Deploy(fakeprovider.Function{Name: "b", Namespace: "dev", Replicas: 3})
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	metricsOptions := metrics.BuildMetricsOptions()
+	exporter := metrics.NewExporter(metricsOptions, nil, fakeprovider.DefaultNamespace, errorPrometheusQuery{}, metrics.DefaultQueryTemplates())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	providerURL, _ := url.Parse(server.URL + "/")
+	exporter.StartServiceWatcher(*providerURL, metricsOptions, "func", time.Millisecond*10)
+
+	want := map[string]float64{"a.openfaas-fn": 1, "b.dev": 3}
+	deadline := time.Now().Add(time.Second * 2)
+
+	for {
+		got := map[string]float64{}
+
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			if family.GetName() != "gateway_service_count" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "function_name" {
+						got[label.GetValue()] = metric.GetGauge().GetValue()
+					}
+				}
+			}
+		}
+
+		if got["a.openfaas-fn"] == want["a.openfaas-fn"] && got["b.dev"] == want["b.dev"] {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want replicas: %v, got: %v", want, got)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
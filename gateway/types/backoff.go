@@ -0,0 +1,110 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// BackoffConstant waits the same interval between each attempt
+	BackoffConstant = "constant"
+
+	// BackoffExponential doubles the interval after each attempt, up to
+	// a maximum, with up to half of each interval taken off at random
+	BackoffExponential = "exponential"
+
+	// BackoffDecorrelatedJitter picks each interval at random between the
+	// base interval and three times the previous one, up to a maximum
+	BackoffDecorrelatedJitter = "decorrelated-jitter"
+)
+
+// Backoff decides how long to wait before the next attempt of a retry or
+// poll. attempt starts at 0, previous is the last interval returned, or 0
+// on the first attempt.
+type Backoff interface {
+	Next(attempt int, previous time.Duration) time.Duration
+}
+
+// ConstantBackoff waits Interval between each attempt
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+// Next returns Interval
+func (b ConstantBackoff) Next(attempt int, previous time.Duration) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff waits Base, then doubles the interval after each
+// attempt up to Max. Jitter is the fraction of each interval, from 0 to 1,
+// which may be taken off at random so that callers which started together
+// spread out.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// Next returns Base * 2^attempt, capped at Max, less the jitter
+func (b ExponentialBackoff) Next(attempt int, previous time.Duration) time.Duration {
+	interval := float64(b.Base) * math.Pow(2, float64(attempt))
+	if b.Max > 0 && interval > float64(b.Max) {
+		interval = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		interval -= interval * b.Jitter * rand.Float64()
+	}
+
+	if interval >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(interval)
+}
+
+// DecorrelatedJitterBackoff picks each interval at random between Base
+// and three times the previous interval, capped at Max. Intervals grow
+// much like ExponentialBackoff, but callers don't stay in step.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Next returns a random interval between Base and 3 * previous, capped at Max
+func (b DecorrelatedJitterBackoff) Next(attempt int, previous time.Duration) time.Duration {
+	if previous < b.Base {
+		previous = b.Base
+	}
+
+	upper := previous * 3
+	interval := b.Base
+	if upper > b.Base {
+		interval += time.Duration(rand.Int63n(int64(upper - b.Base)))
+	}
+
+	if b.Max > 0 && interval > b.Max {
+		interval = b.Max
+	}
+	return interval
+}
+
+// NewBackoff creates the Backoff for strategy, which starts at base and
+// backs off to at most max
+func NewBackoff(strategy string, base, max time.Duration) (Backoff, error) {
+	switch strategy {
+	case BackoffConstant, "":
+		return ConstantBackoff{Interval: base}, nil
+	case BackoffExponential:
+		return ExponentialBackoff{Base: base, Max: max, Jitter: 0.5}, nil
+	case BackoffDecorrelatedJitter:
+		return DecorrelatedJitterBackoff{Base: base, Max: max}, nil
+	}
+
+	return nil, fmt.Errorf("backoff must be %s, %s or %s, got: %s",
+		BackoffConstant, BackoffExponential, BackoffDecorrelatedJitter, strategy)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ExponentialBackoff_DoublesUpToMax(t *testing.T) {
+	backoff := ExponentialBackoff{Base: time.Millisecond * 100, Max: time.Second}
+
+	want := []time.Duration{
+		time.Millisecond * 100,
+		time.Millisecond * 200,
+		time.Millisecond * 400,
+		time.Millisecond * 800,
+		time.Second,
+		time.Second,
+	}
+
+	var previous time.Duration
+	for attempt, w := range want {
+		previous = backoff.Next(attempt, previous)
+		if previous != w {
+			t.Errorf("attempt %d, want: %s, got: %s", attempt, w, previous)
+		}
+	}
+}
+
+func Test_ExponentialBackoff_JitterStaysWithinInterval(t *testing.T) {
+	backoff := ExponentialBackoff{Base: time.Second, Max: time.Second * 8, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		got := backoff.Next(2, 0)
+		if got < time.Second*2 || got > time.Second*4 {
+			t.Fatalf("want between 2s and 4s, got: %s", got)
+		}
+	}
+}
+
+func Test_DecorrelatedJitterBackoff_StaysWithinBounds(t *testing.T) {
+	backoff := DecorrelatedJitterBackoff{Base: time.Millisecond * 100, Max: time.Second * 2}
+
+	var previous time.Duration
+	for attempt := 0; attempt < 100; attempt++ {
+		next := backoff.Next(attempt, previous)
+
+		upper := previous * 3
+		if previous < backoff.Base {
+			upper = backoff.Base * 3
+		}
+		if upper > backoff.Max {
+			upper = backoff.Max
+		}
+		if next < backoff.Base || next > upper {
+			t.Fatalf("attempt %d, want between %s and %s, got: %s", attempt, backoff.Base, upper, next)
+		}
+		previous = next
+	}
+}
+
+func Test_NewBackoff(t *testing.T) {
+	for _, strategy := range []string{"", BackoffConstant, BackoffExponential, BackoffDecorrelatedJitter} {
+		if _, err := NewBackoff(strategy, time.Millisecond*100, time.Second); err != nil {
+			t.Errorf("strategy %q: %s", strategy, err)
+		}
+	}
+
+	if _, err := NewBackoff("linear", time.Millisecond*100, time.Second); err == nil {
+		t.Errorf("want an error for an unknown strategy")
+	}
+
+	backoff, _ := NewBackoff(BackoffConstant, time.Millisecond*100, time.Second)
+	if got := backoff.Next(5, time.Second); got != time.Millisecond*100 {
+		t.Errorf("want: %s, got: %s", time.Millisecond*100, got)
+	}
+}
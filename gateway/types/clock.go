@@ -0,0 +1,61 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and sleeps, so that code which waits on time
+// can be run on a virtual clock in tests and simulations
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the Clock of the time package
+type SystemClock struct{}
+
+// Now returns the current local time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep pauses the current goroutine for at least d
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// SleepContext pauses the current goroutine for at least d, or until ctx
+// is done, when it returns ctx's error
+func (SystemClock) SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ContextClock is a Clock which can stop sleeping once a context is done
+type ContextClock interface {
+	Clock
+	SleepContext(ctx context.Context, d time.Duration) error
+}
+
+// SleepContext sleeps on clock for d, returning ctx's error early when ctx
+// is done. A clock which is not a ContextClock, such as a virtual clock,
+// sleeps for d before ctx is checked.
+func SleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if contextClock, ok := clock.(ContextClock); ok {
+		return contextClock.SleepContext(ctx, d)
+	}
+
+	clock.Sleep(d)
+	return ctx.Err()
+}
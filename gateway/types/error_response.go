@@ -0,0 +1,70 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Codes set in an ErrorResponse, so that clients can tell errors with the
+// same status code apart
+const (
+	ErrorCodeBadRequest          = "bad_request"
+	ErrorCodeMethodNotAllowed    = "method_not_allowed"
+	ErrorCodeFunctionNotFound    = "function_not_found"
+	ErrorCodeScaleFailed         = "scale_failed"
+	ErrorCodeReplicasOutOfBounds = "replicas_out_of_bounds"
+	ErrorCodeScaleTimeout        = "scale_timeout"
+	ErrorCodeActivatorFull       = "activator_full"
+	ErrorCodeRequestCancelled    = "request_cancelled"
+	ErrorCodeQueueUnavailable    = "queue_unavailable"
+	ErrorCodeUpstreamUnavailable = "upstream_unavailable"
+	ErrorCodeUpstreamTimeout     = "upstream_timeout"
+	ErrorCodeInternal            = "internal_error"
+)
+
+// ErrorResponse is the body of an error returned by the gateway itself,
+// rather than by a function
+type ErrorResponse struct {
+	// Code identifies the kind of error, i.e. ErrorCodeScaleTimeout
+	Code string `json:"code"`
+
+	// Message describes the error for a person
+	Message string `json:"message"`
+
+	// Function and Namespace are set when the error relates to a function
+	Function  string `json:"function,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// CallID is the X-Call-Id of the request
+	CallID string `json:"callId,omitempty"`
+}
+
+// WriteError writes res as JSON with statusCode, taking the CallID from
+// the request's X-Call-Id header
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, res ErrorResponse) {
+	if len(res.CallID) == 0 && r != nil {
+		res.CallID = r.Header.Get("X-Call-Id")
+	}
+
+	body, _ := json.Marshal(res)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// SetRetryAfter suggests to the client how long to wait before retrying,
+// rounded up to whole seconds
+func SetRetryAfter(w http.ResponseWriter, after time.Duration) {
+	seconds := int((after + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
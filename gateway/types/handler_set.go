@@ -28,12 +28,21 @@ type HandlerSet struct {
 	// FunctionStatus returns the status of an already deployed function
 	FunctionStatus http.HandlerFunc
 
+	// FunctionMetrics returns time series of a function's metrics from Prometheus
+	FunctionMetrics http.HandlerFunc
+
+	// Usage reports the resources used by functions over time
+	Usage http.HandlerFunc
+
 	// QueuedProxy queue work and return synchronous response
 	QueuedProxy http.HandlerFunc
 
 	// ScaleFunction enables a function to be scaled
 	ScaleFunction http.HandlerFunc
 
+	// ScaleFunctions scales many functions at once, by name or label selector
+	ScaleFunctions http.HandlerFunc
+
 	// InfoHandler provides version and build info
 	InfoHandler http.HandlerFunc
 
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -51,6 +52,17 @@ func parseIntOrDurationValue(val string, fallback time.Duration) time.Duration {
 	return duration
 }
 
+// parseListValue splits a list separated by commas, dropping empty items
+func parseListValue(val string) []string {
+	items := []string{}
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Read fetches gateway server configuration from environmental variables
 func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 	cfg := GatewayConfig{
@@ -165,6 +177,175 @@ func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 
 	cfg.Namespace = hasEnv.Getenv("function_namespace")
 
+	cfg.ScaleToZeroDuration = parseIntOrDurationValue(hasEnv.Getenv("scale_to_zero_duration"), 0)
+
+	cfg.KeepAlivePolicy = hasEnv.Getenv("keep_alive_policy")
+	if cfg.KeepAlivePolicy != "" && cfg.KeepAlivePolicy != "fixed" && cfg.KeepAlivePolicy != "hybrid" {
+		return nil, fmt.Errorf("keep_alive_policy must be fixed or hybrid, got: %s", cfg.KeepAlivePolicy)
+	}
+
+	cfg.ScheduleInterval = parseIntOrDurationValue(hasEnv.Getenv("schedule_interval"), time.Minute)
+
+	cfg.UsageSampleInterval = parseIntOrDurationValue(hasEnv.Getenv("usage_sample_interval"), time.Second*15)
+
+	cfg.ForecastModel = hasEnv.Getenv("forecast_model")
+	if cfg.ForecastModel != "" && cfg.ForecastModel != "ewma" && cfg.ForecastModel != "holt-winters" {
+		return nil, fmt.Errorf("forecast_model must be ewma or holt-winters, got: %s", cfg.ForecastModel)
+	}
+
+	cfg.ForecastSource = "prometheus"
+	if forecastSource := hasEnv.Getenv("forecast_source"); len(forecastSource) > 0 {
+		if forecastSource != "prometheus" && forecastSource != "gateway" {
+			return nil, fmt.Errorf("forecast_source must be prometheus or gateway, got: %s", forecastSource)
+		}
+		cfg.ForecastSource = forecastSource
+	}
+
+	cfg.ActivatorCapacity = 1000
+	if activatorCapacity := hasEnv.Getenv("activator_capacity"); len(activatorCapacity) > 0 {
+		val, err := strconv.Atoi(activatorCapacity)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for activator_capacity: %s", activatorCapacity)
+		}
+		cfg.ActivatorCapacity = val
+	}
+	cfg.ActivatorTimeout = parseIntOrDurationValue(hasEnv.Getenv("activator_timeout"), time.Second*100)
+
+	cfg.ForecastInterval = parseIntOrDurationValue(hasEnv.Getenv("forecast_interval"), time.Minute)
+	if cfg.ForecastInterval <= 0 {
+		return nil, fmt.Errorf("invalid value for forecast_interval: %s", hasEnv.Getenv("forecast_interval"))
+	}
+	// The daily season of holt-winters is a whole number of intervals
+	if (time.Hour*24)%cfg.ForecastInterval != 0 {
+		return nil, fmt.Errorf("forecast_interval must divide 24h evenly, got: %s", cfg.ForecastInterval)
+	}
+	cfg.ForecastLeadTime = parseIntOrDurationValue(hasEnv.Getenv("forecast_lead_time"), time.Minute*5)
+
+	if targetConcurrency := hasEnv.Getenv("autoscaler_target_concurrency"); len(targetConcurrency) > 0 {
+		val, err := strconv.ParseFloat(targetConcurrency, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for autoscaler_target_concurrency: %s", targetConcurrency)
+		}
+		cfg.AutoscalerTargetConcurrency = val
+	}
+	cfg.AutoscalerStableWindow = parseIntOrDurationValue(hasEnv.Getenv("autoscaler_stable_window"), time.Second*60)
+	cfg.AutoscalerPanicWindow = parseIntOrDurationValue(hasEnv.Getenv("autoscaler_panic_window"), time.Second*6)
+
+	cfg.FunctionCacheMaxEntries = 10000
+	if maxEntries := hasEnv.Getenv("function_cache_max_entries"); len(maxEntries) > 0 {
+		val, err := strconv.Atoi(maxEntries)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for function_cache_max_entries: %s", maxEntries)
+		}
+		cfg.FunctionCacheMaxEntries = val
+	}
+	cfg.NotFoundCacheExpiry = parseIntOrDurationValue(hasEnv.Getenv("not_found_cache_expiry"), time.Second*5)
+
+	cfg.MaxPollCount = 1000
+	if maxPollCount := hasEnv.Getenv("max_poll_count"); len(maxPollCount) > 0 {
+		val, err := strconv.Atoi(maxPollCount)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid value for max_poll_count: %s", maxPollCount)
+		}
+		cfg.MaxPollCount = val
+	}
+
+	cfg.SetScaleRetries = 20
+	if setScaleRetries := hasEnv.Getenv("set_scale_retries"); len(setScaleRetries) > 0 {
+		val, err := strconv.Atoi(setScaleRetries)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid value for set_scale_retries: %s", setScaleRetries)
+		}
+		cfg.SetScaleRetries = val
+	}
+
+	cfg.FunctionPollInterval = parseIntOrDurationValue(hasEnv.Getenv("function_poll_interval"), time.Millisecond*100)
+	cfg.FunctionPollMaxInterval = parseIntOrDurationValue(hasEnv.Getenv("function_poll_max_interval"), time.Second*5)
+
+	cfg.FunctionPollBackoff = BackoffConstant
+	if backoff := hasEnv.Getenv("function_poll_backoff"); len(backoff) > 0 {
+		if _, err := NewBackoff(backoff, cfg.FunctionPollInterval, cfg.FunctionPollMaxInterval); err != nil {
+			return nil, fmt.Errorf("invalid value for function_poll_backoff: %s, %s", backoff, err)
+		}
+		cfg.FunctionPollBackoff = backoff
+	}
+
+	cfg.FunctionCacheExpiry = parseIntOrDurationValue(hasEnv.Getenv("function_cache_expiry"), time.Millisecond*250)
+
+	cfg.BulkScaleParallelism = 10
+	if parallelism := hasEnv.Getenv("bulk_scale_parallelism"); len(parallelism) > 0 {
+		val, err := strconv.Atoi(parallelism)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid value for bulk_scale_parallelism: %s", parallelism)
+		}
+		cfg.BulkScaleParallelism = val
+	}
+
+	cfg.MetricsQueriesFile = hasEnv.Getenv("metrics_queries_file")
+
+	cfg.RequestDurationBuckets = hasEnv.Getenv("request_duration_buckets")
+
+	if factor := hasEnv.Getenv("native_histogram_bucket_factor"); len(factor) > 0 {
+		val, err := strconv.ParseFloat(factor, 64)
+		if err != nil || (val != 0 && val <= 1) {
+			return nil, fmt.Errorf("invalid value for native_histogram_bucket_factor: %s", factor)
+		}
+		cfg.NativeHistogramBucketFactor = val
+	}
+
+	if maxReplicas := hasEnv.Getenv("max_replicas"); len(maxReplicas) > 0 {
+		val, err := strconv.Atoi(maxReplicas)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_replicas: %s", maxReplicas)
+		}
+		cfg.MaxReplicas = val
+	}
+
+	cfg.OTLPEndpoint = hasEnv.Getenv("otlp_endpoint")
+
+	cfg.TraceSampleRatio = 1
+	if ratio := hasEnv.Getenv("trace_sample_ratio"); len(ratio) > 0 {
+		val, err := strconv.ParseFloat(ratio, 64)
+		if err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for trace_sample_ratio: %s", ratio)
+		}
+		cfg.TraceSampleRatio = val
+	}
+
+	cfg.AccessLog = hasEnv.Getenv("access_log")
+	cfg.AccessLogFields = parseListValue(hasEnv.Getenv("access_log_fields"))
+	cfg.AccessLogRedact = parseListValue(hasEnv.Getenv("access_log_redact"))
+
+	cfg.AccessLogMaxSize = 100 * 1024 * 1024
+	if maxSize := hasEnv.Getenv("access_log_max_size_mb"); len(maxSize) > 0 {
+		val, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for access_log_max_size_mb: %s", maxSize)
+		}
+		cfg.AccessLogMaxSize = val * 1024 * 1024
+	}
+
+	cfg.AccessLogMaxAge = parseIntOrDurationValue(hasEnv.Getenv("access_log_max_age"), time.Hour*24)
+
+	cfg.AccessLogMaxBackups = 7
+	if maxBackups := hasEnv.Getenv("access_log_max_backups"); len(maxBackups) > 0 {
+		val, err := strconv.Atoi(maxBackups)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for access_log_max_backups: %s", maxBackups)
+		}
+		cfg.AccessLogMaxBackups = val
+	}
+
+	cfg.UsageWindow = parseIntOrDurationValue(hasEnv.Getenv("usage_window"), time.Hour)
+	if cfg.UsageWindow <= 0 {
+		return nil, fmt.Errorf("invalid value for usage_window: %s", hasEnv.Getenv("usage_window"))
+	}
+
+	cfg.UsageRetention = parseIntOrDurationValue(hasEnv.Getenv("usage_retention"), time.Hour*24*7)
+	if cfg.UsageRetention < cfg.UsageWindow {
+		return nil, fmt.Errorf("usage_retention must be at least usage_window, got: %s", cfg.UsageRetention)
+	}
+
 	return &cfg, nil
 }
 
@@ -227,6 +408,135 @@ type GatewayConfig struct {
 
 	// Namespace for endpoints
 	Namespace string
+
+	// ScaleToZeroDuration is how long a function can be idle before it is scaled to zero,
+	// it can be overridden per function. Disabled when zero.
+	ScaleToZeroDuration time.Duration
+
+	// KeepAlivePolicy is the default keep-alive policy for functions, "fixed" uses
+	// ScaleToZeroDuration and "hybrid" adapts to each function's idle times.
+	// It is "fixed" when empty.
+	KeepAlivePolicy string
+
+	// ScheduleInterval is how often functions are scaled to the minimum replicas
+	// of their schedule annotation, disabled when 0
+	ScheduleInterval time.Duration
+
+	// UsageSampleInterval is how often the CPU and memory of functions are
+	// queried from Prometheus for the gateway's metrics, disabled when 0
+	UsageSampleInterval time.Duration
+
+	// UsageWindow is the period each set of usage totals covers, and
+	// UsageRetention how long they are kept for /system/usage
+	UsageWindow    time.Duration
+	UsageRetention time.Duration
+
+	// ActivatorCapacity is the number of requests parked per function while it scales from zero
+	ActivatorCapacity int
+
+	// ActivatorTimeout is how long a request is parked while a function scales from zero
+	ActivatorTimeout time.Duration
+
+	// ForecastModel pre-warms functions ahead of their forecasted invocations
+	// using "ewma" or "holt-winters", disabled when empty
+	ForecastModel string
+
+	// ForecastSource reads invocation counts from "prometheus" or the "gateway"'s own counters
+	ForecastSource string
+
+	// ForecastInterval between samples of invocation counts
+	ForecastInterval time.Duration
+
+	// ForecastLeadTime is how far ahead of forecasted invocations to pre-warm a function
+	ForecastLeadTime time.Duration
+
+	// AutoscalerTargetConcurrency is the default number of in-flight requests per replica
+	// for the concurrency autoscaler, disabled for functions without an annotation when 0
+	AutoscalerTargetConcurrency float64
+
+	// AutoscalerStableWindow is the period over which in-flight requests are averaged
+	AutoscalerStableWindow time.Duration
+
+	// AutoscalerPanicWindow is the shorter period used to react to bursts of requests
+	AutoscalerPanicWindow time.Duration
+
+	// FunctionCacheMaxEntries bounds each cache of function replicas and annotations,
+	// unbounded when 0
+	FunctionCacheMaxEntries int
+
+	// NotFoundCacheExpiry is how long a 404 from the provider is cached for a function,
+	// disabled when 0
+	NotFoundCacheExpiry time.Duration
+
+	// MaxPollCount is the number of times a function's readiness is queried
+	// while it scales from zero
+	MaxPollCount int
+
+	// SetScaleRetries is the number of attempts to scale a function from zero
+	SetScaleRetries int
+
+	// FunctionPollInterval is the first interval between queries of a function's readiness
+	FunctionPollInterval time.Duration
+
+	// FunctionPollMaxInterval caps the interval between queries of a function's
+	// readiness as FunctionPollBackoff grows it
+	FunctionPollMaxInterval time.Duration
+
+	// FunctionPollBackoff is the strategy for the interval between queries of a
+	// function's readiness: "constant", "exponential" or "decorrelated-jitter"
+	FunctionPollBackoff string
+
+	// FunctionCacheExpiry is how long replica values are fresh for before
+	// the provider is queried again
+	FunctionCacheExpiry time.Duration
+
+	// BulkScaleParallelism is the number of functions scaled at once by
+	// a request to /system/scale-functions
+	BulkScaleParallelism int
+
+	// MaxReplicas caps the replicas any function can be scaled to by an alert or
+	// a request to /system/scale-function, whatever its max scale label. No cap when 0
+	MaxReplicas int
+
+	// MetricsQueriesFile is the path to a JSON file of PromQL query templates,
+	// the built-in queries are used when empty
+	MetricsQueriesFile string
+
+	// RequestDurationBuckets are the upper bounds in seconds of the request
+	// histogram separated by commas, the built-in buckets are used when empty
+	RequestDurationBuckets string
+
+	// NativeHistogramBucketFactor records the request histogram as a native
+	// histogram as well, with this growth factor between buckets. Disabled when 0
+	NativeHistogramBucketFactor float64
+
+	// OTLPEndpoint is the OpenTelemetry collector spans are sent to over
+	// OTLP/HTTP, i.e. "http://otel-collector:4318". Spans are not exported when empty
+	OTLPEndpoint string
+
+	// TraceSampleRatio is the fraction of new traces which are exported,
+	// from 0 to 1
+	TraceSampleRatio float64
+
+	// AccessLog is where a line of JSON is written for each invocation:
+	// "stdout" or the path of a file. When empty, invocations are logged
+	// as plain text
+	AccessLog string
+
+	// AccessLogFields are the fields written to the access log, all when empty
+	AccessLogFields []string
+
+	// AccessLogRedact are the fields whose values are replaced in the access log
+	AccessLogRedact []string
+
+	// AccessLogMaxSize in bytes and AccessLogMaxAge rotate the access log file
+	// when either is reached, neither applies when 0
+	AccessLogMaxSize int64
+	AccessLogMaxAge  time.Duration
+
+	// AccessLogMaxBackups is the number of rotated access log files kept,
+	// all are kept when 0
+	AccessLogMaxBackups int
 }
 
 // UseNATS Use NATSor not
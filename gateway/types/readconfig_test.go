@@ -5,6 +5,7 @@ package types
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -436,3 +437,351 @@ func TestRead_LogsProviderURL(t *testing.T) {
 		}
 	})
 }
+
+func TestRead_ScaleToZeroDuration(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	t.Run("default value is disabled", func(t *testing.T) {
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.ScaleToZeroDuration != 0 {
+			t.Fatalf("config.ScaleToZeroDuration, want: %s, got: %s\n", time.Duration(0), config.ScaleToZeroDuration)
+		}
+	})
+
+	t.Run("override by scale_to_zero_duration", func(t *testing.T) {
+		expected := time.Minute * 15
+		defaults.Setenv("scale_to_zero_duration", "15m")
+
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.ScaleToZeroDuration != expected {
+			t.Fatalf("config.ScaleToZeroDuration, want: %s, got: %s\n", expected, config.ScaleToZeroDuration)
+		}
+	})
+}
+
+func TestRead_AutoscalerTargetConcurrency(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	t.Run("default value is disabled", func(t *testing.T) {
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.AutoscalerTargetConcurrency != 0 {
+			t.Fatalf("config.AutoscalerTargetConcurrency, want: %f, got: %f\n", 0.0, config.AutoscalerTargetConcurrency)
+		}
+	})
+
+	t.Run("override by autoscaler_target_concurrency", func(t *testing.T) {
+		defaults.Setenv("autoscaler_target_concurrency", "2.5")
+
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.AutoscalerTargetConcurrency != 2.5 {
+			t.Fatalf("config.AutoscalerTargetConcurrency, want: %f, got: %f\n", 2.5, config.AutoscalerTargetConcurrency)
+		}
+	})
+
+	t.Run("invalid value is an error", func(t *testing.T) {
+		defaults.Setenv("autoscaler_target_concurrency", "-1")
+
+		readConfig := ReadConfig{}
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Fatalf("want an error for a negative target")
+		}
+	})
+}
+
+func TestRead_FunctionCacheMaxEntries(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	t.Run("default value", func(t *testing.T) {
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.FunctionCacheMaxEntries != 10000 {
+			t.Fatalf("config.FunctionCacheMaxEntries, want: %d, got: %d\n", 10000, config.FunctionCacheMaxEntries)
+		}
+		if config.NotFoundCacheExpiry != time.Second*5 {
+			t.Fatalf("config.NotFoundCacheExpiry, want: %s, got: %s\n", time.Second*5, config.NotFoundCacheExpiry)
+		}
+	})
+
+	t.Run("override by function_cache_max_entries", func(t *testing.T) {
+		defaults.Setenv("function_cache_max_entries", "100")
+
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.FunctionCacheMaxEntries != 100 {
+			t.Fatalf("config.FunctionCacheMaxEntries, want: %d, got: %d\n", 100, config.FunctionCacheMaxEntries)
+		}
+	})
+
+	t.Run("invalid value is an error", func(t *testing.T) {
+		defaults.Setenv("function_cache_max_entries", "lots")
+
+		readConfig := ReadConfig{}
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Fatalf("want an error for a non-numeric value")
+		}
+	})
+}
+
+func TestRead_FunctionPolling(t *testing.T) {
+	defaults := NewEnvBucket()
+
+	t.Run("default values", func(t *testing.T) {
+		readConfig := ReadConfig{}
+		config, _ := readConfig.Read(defaults)
+		if config.MaxPollCount != 1000 {
+			t.Fatalf("config.MaxPollCount, want: %d, got: %d\n", 1000, config.MaxPollCount)
+		}
+		if config.SetScaleRetries != 20 {
+			t.Fatalf("config.SetScaleRetries, want: %d, got: %d\n", 20, config.SetScaleRetries)
+		}
+		if config.FunctionPollInterval != time.Millisecond*100 {
+			t.Fatalf("config.FunctionPollInterval, want: %s, got: %s\n", time.Millisecond*100, config.FunctionPollInterval)
+		}
+		if config.FunctionPollBackoff != BackoffConstant {
+			t.Fatalf("config.FunctionPollBackoff, want: %s, got: %s\n", BackoffConstant, config.FunctionPollBackoff)
+		}
+		if config.FunctionCacheExpiry != time.Millisecond*250 {
+			t.Fatalf("config.FunctionCacheExpiry, want: %s, got: %s\n", time.Millisecond*250, config.FunctionCacheExpiry)
+		}
+	})
+
+	t.Run("override by env", func(t *testing.T) {
+		defaults.Setenv("max_poll_count", "300")
+		defaults.Setenv("function_poll_interval", "500ms")
+		defaults.Setenv("function_poll_max_interval", "10s")
+		defaults.Setenv("function_poll_backoff", "decorrelated-jitter")
+
+		readConfig := ReadConfig{}
+		config, err := readConfig.Read(defaults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.MaxPollCount != 300 {
+			t.Fatalf("config.MaxPollCount, want: %d, got: %d\n", 300, config.MaxPollCount)
+		}
+		if config.FunctionPollInterval != time.Millisecond*500 {
+			t.Fatalf("config.FunctionPollInterval, want: %s, got: %s\n", time.Millisecond*500, config.FunctionPollInterval)
+		}
+		if config.FunctionPollMaxInterval != time.Second*10 {
+			t.Fatalf("config.FunctionPollMaxInterval, want: %s, got: %s\n", time.Second*10, config.FunctionPollMaxInterval)
+		}
+		if config.FunctionPollBackoff != BackoffDecorrelatedJitter {
+			t.Fatalf("config.FunctionPollBackoff, want: %s, got: %s\n", BackoffDecorrelatedJitter, config.FunctionPollBackoff)
+		}
+	})
+
+	t.Run("unknown backoff is an error", func(t *testing.T) {
+		defaults.Setenv("function_poll_backoff", "linear")
+
+		readConfig := ReadConfig{}
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Fatalf("want an error for an unknown backoff")
+		}
+	})
+}
+
+func TestRead_ScheduleInterval(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScheduleInterval != time.Minute {
+		t.Fatalf("config.ScheduleInterval, want: %s, got: %s\n", time.Minute, config.ScheduleInterval)
+	}
+
+	defaults.Setenv("schedule_interval", "0")
+	config, _ = readConfig.Read(defaults)
+	if config.ScheduleInterval != 0 {
+		t.Fatalf("config.ScheduleInterval, want: %s, got: %s\n", time.Duration(0), config.ScheduleInterval)
+	}
+}
+
+func TestRead_UsageSampleInterval(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.UsageSampleInterval != time.Second*15 {
+		t.Fatalf("config.UsageSampleInterval, want: %s, got: %s\n", time.Second*15, config.UsageSampleInterval)
+	}
+
+	defaults.Setenv("usage_sample_interval", "1m")
+	config, _ = readConfig.Read(defaults)
+	if config.UsageSampleInterval != time.Minute {
+		t.Fatalf("config.UsageSampleInterval, want: %s, got: %s\n", time.Minute, config.UsageSampleInterval)
+	}
+}
+
+func TestRead_UsageWindow(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.UsageWindow != time.Hour || config.UsageRetention != time.Hour*24*7 {
+		t.Fatalf("config.UsageWindow, config.UsageRetention, want: %s %s, got: %s %s\n", time.Hour, time.Hour*24*7, config.UsageWindow, config.UsageRetention)
+	}
+
+	defaults.Setenv("usage_window", "5m")
+	defaults.Setenv("usage_retention", "1m")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a retention shorter than the window")
+	}
+
+	defaults.Setenv("usage_window", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a window of 0")
+	}
+}
+
+func TestRead_NativeHistogramBucketFactor(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.NativeHistogramBucketFactor != 0 {
+		t.Fatalf("config.NativeHistogramBucketFactor, want: %f, got: %f\n", 0.0, config.NativeHistogramBucketFactor)
+	}
+
+	defaults.Setenv("native_histogram_bucket_factor", "1.1")
+	config, _ = readConfig.Read(defaults)
+	if config.NativeHistogramBucketFactor != 1.1 {
+		t.Fatalf("config.NativeHistogramBucketFactor, want: %f, got: %f\n", 1.1, config.NativeHistogramBucketFactor)
+	}
+
+	defaults.Setenv("native_histogram_bucket_factor", "0.5")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a factor which is not greater than 1")
+	}
+}
+
+func TestRead_TraceSampleRatio(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TraceSampleRatio != 1 {
+		t.Fatalf("config.TraceSampleRatio, want: %f, got: %f\n", 1.0, config.TraceSampleRatio)
+	}
+
+	defaults.Setenv("trace_sample_ratio", "0.25")
+	config, _ = readConfig.Read(defaults)
+	if config.TraceSampleRatio != 0.25 {
+		t.Fatalf("config.TraceSampleRatio, want: %f, got: %f\n", 0.25, config.TraceSampleRatio)
+	}
+
+	defaults.Setenv("trace_sample_ratio", "2")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a ratio above 1")
+	}
+}
+
+func TestRead_AccessLog(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.AccessLog) > 0 || len(config.AccessLogFields) > 0 {
+		t.Fatalf("want the access log disabled with all fields, got: %q %v\n", config.AccessLog, config.AccessLogFields)
+	}
+	if config.AccessLogMaxSize != 100*1024*1024 || config.AccessLogMaxAge != time.Hour*24 || config.AccessLogMaxBackups != 7 {
+		t.Fatalf("want the default rotation, got: %d %s %d\n", config.AccessLogMaxSize, config.AccessLogMaxAge, config.AccessLogMaxBackups)
+	}
+
+	defaults.Setenv("access_log", "/var/log/gateway/access.log")
+	defaults.Setenv("access_log_fields", "time, function,status,")
+	defaults.Setenv("access_log_redact", "client_ip")
+	defaults.Setenv("access_log_max_size_mb", "10")
+	defaults.Setenv("access_log_max_age", "1h")
+	defaults.Setenv("access_log_max_backups", "0")
+
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AccessLog != "/var/log/gateway/access.log" {
+		t.Fatalf("config.AccessLog, want: %s, got: %s\n", "/var/log/gateway/access.log", config.AccessLog)
+	}
+	if got := strings.Join(config.AccessLogFields, ","); got != "time,function,status" {
+		t.Fatalf("config.AccessLogFields, want: %s, got: %s\n", "time,function,status", got)
+	}
+	if got := strings.Join(config.AccessLogRedact, ","); got != "client_ip" {
+		t.Fatalf("config.AccessLogRedact, want: %s, got: %s\n", "client_ip", got)
+	}
+	if config.AccessLogMaxSize != 10*1024*1024 || config.AccessLogMaxAge != time.Hour || config.AccessLogMaxBackups != 0 {
+		t.Fatalf("want the rotation set, got: %d %s %d\n", config.AccessLogMaxSize, config.AccessLogMaxAge, config.AccessLogMaxBackups)
+	}
+
+	defaults.Setenv("access_log_max_size_mb", "large")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for an invalid access_log_max_size_mb")
+	}
+}
+
+func TestRead_KeepAlivePolicy(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	for _, value := range []string{"", "fixed", "hybrid"} {
+		defaults.Setenv("keep_alive_policy", value)
+		config, err := readConfig.Read(defaults)
+		if err != nil {
+			t.Fatalf("want no error for a keep_alive_policy of %q, got: %s", value, err)
+		}
+		if config.KeepAlivePolicy != value {
+			t.Fatalf("config.KeepAlivePolicy, want: %s, got: %s\n", value, config.KeepAlivePolicy)
+		}
+	}
+
+	defaults.Setenv("keep_alive_policy", "forever")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for an invalid keep_alive_policy")
+	}
+}
+
+func TestRead_ForecastInterval(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ForecastInterval != time.Minute {
+		t.Fatalf("config.ForecastInterval, want: %s, got: %s\n", time.Minute, config.ForecastInterval)
+	}
+
+	defaults.Setenv("forecast_interval", "30s")
+	config, _ = readConfig.Read(defaults)
+	if config.ForecastInterval != time.Second*30 {
+		t.Fatalf("config.ForecastInterval, want: %s, got: %s\n", time.Second*30, config.ForecastInterval)
+	}
+
+	for _, value := range []string{"0", "0s", "-1m", "7m", "25h"} {
+		defaults.Setenv("forecast_interval", value)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Fatalf("want an error for a forecast_interval of %s", value)
+		}
+	}
+}
+
+func TestRead_MaxReplicas(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.MaxReplicas != 0 {
+		t.Fatalf("config.MaxReplicas, want: %d, got: %d\n", 0, config.MaxReplicas)
+	}
+
+	defaults.Setenv("max_replicas", "50")
+	config, _ = readConfig.Read(defaults)
+	if config.MaxReplicas != 50 {
+		t.Fatalf("config.MaxReplicas, want: %d, got: %d\n", 50, config.MaxReplicas)
+	}
+
+	defaults.Setenv("max_replicas", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Fatalf("want an error for a negative max_replicas")
+	}
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"log"
 	"time"
 )
@@ -8,9 +9,27 @@ import (
 type routine func(attempt int) error
 
 func Retry(r routine, label string, attempts int, interval time.Duration) error {
+	return RetryWithClock(context.Background(), SystemClock{}, r, label, attempts, interval)
+}
+
+// RetryWithClock is Retry, sleeping between attempts on clock. No further
+// attempts are made once ctx is done, even part way through an interval,
+// and its error is returned.
+func RetryWithClock(ctx context.Context, clock Clock, r routine, label string, attempts int, interval time.Duration) error {
+	return RetryWithBackoff(ctx, clock, r, label, attempts, ConstantBackoff{Interval: interval})
+}
+
+// RetryWithBackoff is RetryWithClock, waiting the interval given by
+// backoff between attempts
+func RetryWithBackoff(ctx context.Context, clock Clock, r routine, label string, attempts int, backoff Backoff) error {
 	var err error
+	var interval time.Duration
 
 	for i := 0; i < attempts; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
 		res := r(i)
 		if res != nil {
 			err = res
@@ -19,7 +38,11 @@ func Retry(r routine, label string, attempts int, interval time.Duration) error
 			err = nil
 			break
 		}
-		time.Sleep(interval)
+
+		interval = backoff.Next(i, interval)
+		if ctxErr := SleepContext(ctx, clock, interval); ctxErr != nil {
+			return ctxErr
+		}
 	}
 	return err
 }
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -41,3 +42,88 @@ func Test_retry_until_max_attempts(t *testing.T) {
 		t.Errorf("want: %d, got: %d", want, called)
 	}
 }
+
+type sleepCountingClock struct {
+	SystemClock
+	slept time.Duration
+}
+
+func (c *sleepCountingClock) Sleep(d time.Duration) {
+	c.slept += d
+}
+
+func (c *sleepCountingClock) SleepContext(ctx context.Context, d time.Duration) error {
+	c.Sleep(d)
+	return ctx.Err()
+}
+
+func Test_RetryWithClock_SleepsOnClock(t *testing.T) {
+	clock := &sleepCountingClock{}
+	routine := func(i int) error {
+		return fmt.Errorf("unable to pass condition for routine")
+	}
+
+	RetryWithClock(context.Background(), clock, routine, "test", 3, time.Hour)
+
+	want := time.Hour * 3
+	if clock.slept != want {
+		t.Errorf("want: %s, got: %s", want, clock.slept)
+	}
+}
+
+func Test_RetryWithClock_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	called := 0
+	routine := func(i int) error {
+		called++
+		if called == 2 {
+			cancel()
+		}
+		return fmt.Errorf("unable to pass condition for routine")
+	}
+
+	err := RetryWithClock(ctx, &sleepCountingClock{}, routine, "test", 10, time.Hour)
+
+	if called != 2 {
+		t.Errorf("want: %d, got: %d", 2, called)
+	}
+	if err != context.Canceled {
+		t.Errorf("want: %s, got: %v", context.Canceled, err)
+	}
+}
+
+func Test_RetryWithBackoff_SleepsEachInterval(t *testing.T) {
+	clock := &sleepCountingClock{}
+	routine := func(i int) error {
+		return fmt.Errorf("unable to pass condition for routine")
+	}
+
+	backoff := ExponentialBackoff{Base: time.Second, Max: time.Second * 3}
+	RetryWithBackoff(context.Background(), clock, routine, "test", 4, backoff)
+
+	// 1s, 2s, then capped at 3s twice
+	want := time.Second * 9
+	if clock.slept != want {
+		t.Errorf("want: %s, got: %s", want, clock.slept)
+	}
+}
+
+func Test_RetryWithClock_CancelledDuringInterval(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	routine := func(i int) error {
+		return fmt.Errorf("unable to pass condition for routine")
+	}
+
+	start := time.Now()
+	err := RetryWithClock(ctx, SystemClock{}, routine, "test", 10, time.Hour)
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("want: %s, got: %v", context.DeadlineExceeded, err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want the interval cut short, took: %s", took)
+	}
+}